@@ -0,0 +1,231 @@
+package dbus
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// _ParseAddress splits a server address, like "unix:path=/run/bus" or
+// "tcp:host=localhost,port=4000", into its transport and its keys and
+// values, undoing the escaping of the values.
+func _ParseAddress(address string) (string, map[string]string, error) {
+	i := strings.Index(address, ":")
+	if i <= 0 {
+		return "", nil, errors.New("Invalid bus address")
+	}
+	transport := address[:i]
+	values := make(map[string]string)
+	if address[i+1:] == "" {
+		return transport, values, nil
+	}
+	for _, pair := range strings.Split(address[i+1:], ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return "", nil, errors.New("Invalid bus address")
+		}
+		value, err := _UnescapeAddressValue(kv[1])
+		if err != nil {
+			return "", nil, err
+		}
+		values[kv[0]] = value
+	}
+	return transport, values, nil
+}
+
+// _UnescapeAddressValue undoes the %xx escaping of address values.
+func _UnescapeAddressValue(value string) (string, error) {
+	if strings.IndexByte(value, '%') < 0 {
+		return value, nil
+	}
+	b := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			b = append(b, value[i])
+			continue
+		}
+		if i+2 >= len(value) {
+			return "", errors.New("Invalid bus address escape")
+		}
+		c, err := strconv.ParseUint(value[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", errors.New("Invalid bus address escape")
+		}
+		b = append(b, byte(c))
+		i += 2
+	}
+	return string(b), nil
+}
+
+// Dialer opens the stream of a connection, like net.Dial, which is the one
+// Connect uses. Dialers may reach the server through other means, like an
+// SSH tunnel, as long as they return a stream to it.
+type Dialer func(network, address string) (net.Conn, error)
+
+// _Dial connects to the first server of the semicolon separated address
+// list which accepts the connection, and returns the connection along with
+// the keys and values of its address. It fails with the error of the last
+// address when none does.
+func _Dial(dial Dialer, addresses string) (net.Conn, map[string]string, error) {
+	err := errors.New("Unknown bus address")
+	for _, address := range strings.Split(addresses, ";") {
+		if address == "" {
+			continue
+		}
+		var conn net.Conn
+		var values map[string]string
+		if conn, values, err = _DialAddress(dial, address); err == nil {
+			return conn, values, nil
+		}
+	}
+	return nil, nil, err
+}
+
+// _DialAddress connects to a single server address.
+func _DialAddress(dial Dialer, address string) (net.Conn, map[string]string, error) {
+	transport, values, err := _ParseAddress(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var network string
+	switch transport {
+	case "unix":
+		network = "unix"
+		if path, ok := values["path"]; ok {
+			address = path
+		} else if abstract, ok := values["abstract"]; ok {
+			address = "@" + abstract
+		} else {
+			return nil, nil, errors.New("Unknown address key")
+		}
+
+	case "tcp":
+		switch values["family"] {
+		case "":
+			network = "tcp"
+		case "ipv4":
+			network = "tcp4"
+		case "ipv6":
+			network = "tcp6"
+		default:
+			return nil, nil, errors.New("Unknown address family")
+		}
+		host, port := values["host"], values["port"]
+		if host == "" {
+			host = "localhost"
+		}
+		if port == "" {
+			return nil, nil, errors.New("Missing address port")
+		}
+		address = net.JoinHostPort(host, port)
+
+	case "autolaunch":
+		launched, err := _Autolaunch()
+		if err != nil {
+			return nil, nil, err
+		}
+		return _Dial(dial, launched)
+
+	default:
+		return nil, nil, errors.New("Unknown transport")
+	}
+
+	conn, err := dial(network, address)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, values, nil
+}
+
+// _SessionBusAddress finds the session bus of programs which did not
+// inherit DBUS_SESSION_BUS_ADDRESS, like those started by cron: the one
+// dbus-launch recorded for the X11 display, or else "autolaunch:".
+func _SessionBusAddress() string {
+	if path, ok := _SessionBusFile(); ok {
+		if f, err := os.Open(path); err == nil {
+			defer f.Close()
+			if address := _ReadSessionBusFile(f); address != "" {
+				return address
+			}
+		}
+	}
+	return "autolaunch:"
+}
+
+// _SessionBusFile returns the path of the file in which dbus-launch records
+// the session bus of the X11 display.
+func _SessionBusFile() (string, bool) {
+	display := _DisplayNumber(os.Getenv("DISPLAY"))
+	if display == "" {
+		return "", false
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", false
+	}
+	machineID, err := _MachineId()
+	if err != nil || machineID == "" {
+		return "", false
+	}
+	return filepath.Join(home, ".dbus", "session-bus", machineID+"-"+display), true
+}
+
+// _DisplayNumber returns the number of the X11 display, "0" for
+// "localhost:0.1".
+func _DisplayNumber(display string) string {
+	i := strings.LastIndex(display, ":")
+	if i < 0 {
+		return ""
+	}
+	number := display[i+1:]
+	if j := strings.Index(number, "."); j >= 0 {
+		number = number[:j]
+	}
+	if _, err := strconv.ParseUint(number, 10, 32); err != nil {
+		return ""
+	}
+	return number
+}
+
+// _ReadSessionBusFile returns the DBUS_SESSION_BUS_ADDRESS set in the shell
+// syntax written by dbus-launch.
+func _ReadSessionBusFile(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "DBUS_SESSION_BUS_ADDRESS=") {
+			continue
+		}
+		value := strings.TrimSuffix(line[len("DBUS_SESSION_BUS_ADDRESS="):], ";")
+		if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		return value
+	}
+	return ""
+}
+
+// _Autolaunch asks dbus-launch for the session bus of the X11 display,
+// which it starts unless one is running already.
+func _Autolaunch() (string, error) {
+	machineID, err := _MachineId()
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command("dbus-launch", "--autolaunch="+machineID, "--sh-syntax", "--close-stderr").Output()
+	if err != nil {
+		return "", err
+	}
+	address := _ReadSessionBusFile(strings.NewReader(string(out)))
+	if address == "" {
+		return "", errors.New("Unknown bus address")
+	}
+	return address, nil
+}
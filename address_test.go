@@ -0,0 +1,121 @@
+package dbus
+
+import (
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	transport, values, e := _ParseAddress("unix:path=/tmp/dbus%2dtest,guid=0123")
+	if e != nil || transport != "unix" || values["path"] != "/tmp/dbus-test" || values["guid"] != "0123" {
+		t.Error("#1 Failed:", transport, values, e)
+	}
+	transport, values, e = _ParseAddress("tcp:host=example.com,port=4000,family=ipv4")
+	if e != nil || transport != "tcp" || values["host"] != "example.com" || values["port"] != "4000" || values["family"] != "ipv4" {
+		t.Error("#2 Failed:", transport, values, e)
+	}
+	for i, address := range []string{"", "unix", ":path=/tmp", "unix:path", "unix:=x", "unix:path=%2", "unix:path=%zz"} {
+		if _, _, e := _ParseAddress(address); e == nil {
+			t.Error("#3 Failed:", i, address)
+		}
+	}
+}
+
+func TestDial(t *testing.T) {
+	l, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer l.Close()
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+
+	conn, values, e := _Dial(net.Dial, "tcp:host=127.0.0.1,port="+port+",family=ipv4")
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	conn.Close()
+	if values["port"] != port {
+		t.Error("#2 Failed:", values)
+	}
+
+	path := filepath.Join(t.TempDir(), "bus")
+	ul, e := net.Listen("unix", path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer ul.Close()
+	if conn, _, e = _Dial(net.Dial, "unix:path="+path); e != nil {
+		t.Fatal("#3 Failed:", e)
+	}
+	conn.Close()
+
+	list := "unix:path=" + path + "-missing;tcp:host=127.0.0.1;;tcp:host=127.0.0.1,port=" + port
+	if conn, values, e = _Dial(net.Dial, list); e != nil || values["port"] != port {
+		t.Fatal("#4 Failed:", values, e)
+	}
+	conn.Close()
+
+	for i, address := range []string{"tcp:host=127.0.0.1", "tcp:port=1,family=ipx", "unix:tmpdir=/tmp", "launchd:env=X", "", ";", "unix:path=" + path + "-missing;launchd:env=X"} {
+		if _, _, e := _Dial(net.Dial, address); e == nil {
+			t.Error("#5 Failed:", i, address)
+		}
+	}
+}
+
+func TestSessionBusFile(t *testing.T) {
+	for display, expected := range map[string]string{":0": "0", "localhost:10.1": "10", "unix:3": "3", "": "", ":x": ""} {
+		if number := _DisplayNumber(display); number != expected {
+			t.Error("#1 Failed:", display, number)
+		}
+	}
+
+	file := `# This file allows processes on the machine with id 0123 using
+# display :0 to find the D-Bus session bus with the below address.
+DBUS_SESSION_BUS_ADDRESS=unix:abstract=/tmp/dbus-test,guid=0123
+DBUS_SESSION_BUS_PID=42
+`
+	if address := _ReadSessionBusFile(strings.NewReader(file)); address != "unix:abstract=/tmp/dbus-test,guid=0123" {
+		t.Error("#2 Failed:", address)
+	}
+	sh := "DBUS_SESSION_BUS_ADDRESS='unix:path=/tmp/bus';\nexport DBUS_SESSION_BUS_ADDRESS;\n"
+	if address := _ReadSessionBusFile(strings.NewReader(sh)); address != "unix:path=/tmp/bus" {
+		t.Error("#3 Failed:", address)
+	}
+	if address := _ReadSessionBusFile(strings.NewReader("DBUS_SESSION_BUS_PID=42\n")); address != "" {
+		t.Error("#4 Failed:", address)
+	}
+}
+
+func TestConnectTo(t *testing.T) {
+	con, _ := newTestBus(t, nil)
+	other := ConnectTo(con.conn)
+	if e := other.Initialize(); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if other.UniqueName() == "" {
+		t.Error("#2 Failed")
+	}
+}
+
+func TestConnectWithDialer(t *testing.T) {
+	con, _ := newTestBus(t, nil)
+	var network, address string
+	dial := func(n, a string) (net.Conn, error) {
+		network, address = n, a
+		return con.conn, nil
+	}
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "tcp:host=remote,port=4000")
+	other, e := ConnectWithDialer(SessionBus, dial)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if network != "tcp" || address != "remote:4000" {
+		t.Error("#2 Failed:", network, address)
+	}
+	if e := other.Initialize(); e != nil {
+		t.Error("#3 Failed:", e)
+	}
+}
@@ -2,23 +2,43 @@ package dbus
 
 import (
 	"container/list"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
 	ErrAuthUnknownCommand = errors.New("UnknowAuthCommand")
 	ErrAuthFailed         = errors.New("AuthenticationFailed")
+	ErrAuthTimeout        = errors.New("AuthenticationTimeout")
 )
 
+// Authenticator is a SASL mechanism to authenticate with. Mechanism returns
+// its name, Authenticate the hex encoded initial response sent along with
+// it. Connections try the mechanisms in their Authenticators in order.
 type Authenticator interface {
 	Mechanism() string
 	Authenticate() string
 }
 
+// DataAuthenticator is an Authenticator of a mechanism in which the server
+// sends challenges, which HandleData answers. Challenges and responses are
+// hex encoded, like the initial response. An error cancels the mechanism,
+// so that the next one is tried.
+type DataAuthenticator interface {
+	Authenticator
+	HandleData(challenge string) (string, error)
+}
+
+// AuthExternal authenticates with the uid of the process, which the server
+// checks against the credentials of the socket.
 type AuthExternal struct {
 }
 
@@ -27,6 +47,14 @@ func (p *AuthExternal) Authenticate() string {
 	return fmt.Sprintf("%x", fmt.Sprintf("%d", os.Getuid()))
 }
 
+// AuthAnonymous authenticates without credentials, for servers which allow
+// anonymous clients, typically on TCP where EXTERNAL can not work.
+type AuthAnonymous struct {
+}
+
+func (p *AuthAnonymous) Mechanism() string    { return "ANONYMOUS" }
+func (p *AuthAnonymous) Authenticate() string { return "" }
+
 type authStatus int
 
 const (
@@ -39,6 +67,7 @@ const (
 	AUTH_ERROR
 	AUTHENTICATED
 	AUTH_NEXT
+	WAITING_FOR_AGREE
 )
 
 type authState struct {
@@ -46,39 +75,67 @@ type authState struct {
 	auth     Authenticator
 	authList list.List
 	conn     net.Conn
+	// negotiateUnixFDs asks the server to pass file descriptors once it
+	// accepted the client, unixFDs tells whether it agreed.
+	negotiateUnixFDs bool
+	unixFDs          bool
 }
 
 func (p *authState) AddAuthenticator(auth Authenticator) {
 	p.authList.PushBack(auth)
 }
 
-func (p *authState) _NextAuthenticator() {
+func (p *authState) _NextAuthenticator() error {
 	if p.authList.Len() == 0 {
 		p.auth = nil
-		return
+		return nil
 	}
 
 	p.auth, _ = p.authList.Front().Value.(Authenticator)
 	p.authList.Remove(p.authList.Front())
 	msg := strings.Join([]string{"AUTH", p.auth.Mechanism(), p.auth.Authenticate()}, " ")
-	p._Send(msg)
+	return p._Send(strings.TrimSpace(msg))
 }
 
-func (p *authState) _NextMessage() []string {
+func (p *authState) _NextMessage() ([]string, error) {
 	b := make([]byte, 4096)
-	p.conn.Read(b)
-	retstr := string(b)
-	return strings.SplitN(strings.Trim(retstr, " "), " ", -1)
+	n, err := p.conn.Read(b)
+	if err != nil {
+		return nil, _AuthError(err)
+	}
+	fields := strings.Fields(string(b[:n]))
+	if len(fields) == 0 {
+		return nil, ErrAuthUnknownCommand
+	}
+	return fields, nil
+}
+
+// _AuthError turns timeouts of the socket into ErrAuthTimeout.
+func _AuthError(err error) error {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return ErrAuthTimeout
+	}
+	return err
 }
 
-func (p *authState) _Send(msg string) {
-	p.conn.Write([]byte(msg + "\r\n"))
+func (p *authState) _Send(msg string) error {
+	return _AuthError(_WriteFull(p.conn, net.Buffers{[]byte(msg + "\r\n")}))
 }
 
-func (p *authState) Authenticate(conn net.Conn) error {
+// Authenticate runs the handshake on conn. If timeout is not zero, it fails
+// with ErrAuthTimeout when the server has not accepted the client by then.
+func (p *authState) Authenticate(conn net.Conn, timeout time.Duration) error {
 	p.conn = conn
-	p.conn.Write([]byte("\x00"))
-	p._NextAuthenticator()
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	if err := _WriteFull(p.conn, net.Buffers{[]byte("\x00")}); err != nil {
+		return _AuthError(err)
+	}
+	if err := p._NextAuthenticator(); err != nil {
+		return err
+	}
 	p.status = STARTING
 	for p.status != AUTHENTICATED {
 		if nil == p.auth {
@@ -92,11 +149,14 @@ func (p *authState) Authenticate(conn net.Conn) error {
 }
 
 func (p *authState) _NextState() (err error) {
-	nextMsg := p._NextMessage()
+	nextMsg, err := p._NextMessage()
+	if err != nil {
+		return err
+	}
 
 	if STARTING == p.status {
 		switch nextMsg[0] {
-		case "CONTINUE":
+		case "CONTINUE", "DATA", "REJECTED":
 			p.status = WAITING_FOR_DATA
 		case "OK":
 			p.status = WAITING_FOR_OK
@@ -104,6 +164,8 @@ func (p *authState) _NextState() (err error) {
 	}
 
 	switch p.status {
+	case WAITING_FOR_AGREE:
+		err = p._WaitingForAgree(nextMsg)
 	case WAITING_FOR_DATA:
 		err = p._WaitingForData(nextMsg)
 	case WAITING_FOR_OK:
@@ -118,46 +180,204 @@ func (p *authState) _NextState() (err error) {
 func (p *authState) _WaitingForData(msg []string) error {
 	switch msg[0] {
 	case "DATA":
-		return ErrAuthUnknownCommand
+		auth, ok := p.auth.(DataAuthenticator)
+		if !ok {
+			return ErrAuthUnknownCommand
+		}
+		challenge := ""
+		if len(msg) > 1 {
+			challenge = msg[1]
+		}
+		response, err := auth.HandleData(challenge)
+		if err != nil {
+			p.status = WAITING_FOR_REJECT
+			return p._Send("CANCEL")
+		}
+		return p._Send(strings.TrimSpace("DATA " + response))
 	case "REJECTED":
-		p._NextAuthenticator()
 		p.status = WAITING_FOR_DATA
+		return p._NextAuthenticator()
 	case "OK":
-		p._Send("BEGIN")
-		p.status = AUTHENTICATED
+		return p._Accepted()
 	default:
-		p._Send("ERROR")
 		p.status = WAITING_FOR_DATA
+		return p._Send("ERROR")
 	}
-	return nil
 }
 
 func (p *authState) _WaitingForOK(msg []string) error {
 	switch msg[0] {
 	case "OK":
-		p._Send("BEGIN")
-		p.status = AUTHENTICATED
-	case "REJECT":
-		p._NextAuthenticator()
+		return p._Accepted()
+	case "REJECTED":
 		p.status = WAITING_FOR_DATA
+		return p._NextAuthenticator()
 	case "DATA", "ERROR":
-		p._Send("CANCEL")
 		p.status = WAITING_FOR_REJECT
+		return p._Send("CANCEL")
 	default:
-		p._Send("ERROR")
 		p.status = WAITING_FOR_OK
+		return p._Send("ERROR")
 	}
-
-	return nil
 }
 
 func (p *authState) _WaitingForReject(msg []string) error {
 	switch msg[0] {
-	case "REJECT":
-		p._NextAuthenticator()
-		p.status = WAITING_FOR_OK
+	case "REJECTED":
+		p.status = WAITING_FOR_DATA
+		return p._NextAuthenticator()
 	default:
 		return ErrAuthUnknownCommand
 	}
-	return nil
+}
+
+// _Accepted negotiates the passing of file descriptors if asked to, or
+// begins the message stream, once the server accepted the client.
+func (p *authState) _Accepted() error {
+	if p.negotiateUnixFDs {
+		p.status = WAITING_FOR_AGREE
+		return p._Send("NEGOTIATE_UNIX_FD")
+	}
+	p.status = AUTHENTICATED
+	return p._Send("BEGIN")
+}
+
+func (p *authState) _WaitingForAgree(msg []string) error {
+	switch msg[0] {
+	case "AGREE_UNIX_FD":
+		p.unixFDs = true
+	case "ERROR":
+	default:
+		return ErrAuthUnknownCommand
+	}
+	p.status = AUTHENTICATED
+	return p._Send("BEGIN")
+}
+
+// MAX_AUTH_LINE is the longest line of the handshake a server accepts.
+const MAX_AUTH_LINE = 16384
+
+// _AuthenticateClient runs the server side of the handshake on conn, for
+// peer to peer connections. It accepts EXTERNAL for clients running as the
+// same user and ANONYMOUS if anonymous is set, and reports whether the
+// client negotiated passing file descriptors.
+func _AuthenticateClient(conn net.Conn, anonymous bool, timeout time.Duration) (bool, error) {
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	guid := make([]byte, 16)
+	if _, err := rand.Read(guid); err != nil {
+		return false, err
+	}
+	mechanisms := "REJECTED EXTERNAL"
+	if anonymous {
+		mechanisms += " ANONYMOUS"
+	}
+	send := func(msg string) error {
+		return _AuthError(_WriteFull(conn, net.Buffers{[]byte(msg + "\r\n")}))
+	}
+	accept := func(ok bool) (bool, error) {
+		if !ok {
+			return false, send(mechanisms)
+		}
+		return true, send(fmt.Sprintf("OK %x", guid))
+	}
+
+	nul := make([]byte, 1)
+	if _, err := io.ReadFull(conn, nul); err != nil {
+		return false, _AuthError(err)
+	}
+	if nul[0] != 0 {
+		return false, ErrAuthFailed
+	}
+	var accepted, waitingForData, unixFDs bool
+	for {
+		line, err := _ReadAuthLine(conn, MAX_AUTH_LINE)
+		if err != nil {
+			return false, err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			fields = []string{""}
+		}
+
+		switch {
+		case fields[0] == "AUTH" && !accepted:
+			waitingForData = false
+			switch {
+			case len(fields) == 2 && fields[1] == "EXTERNAL":
+				waitingForData = true
+				err = send("DATA")
+			case len(fields) == 3 && fields[1] == "EXTERNAL":
+				accepted, err = accept(_CheckExternal(conn, fields[2]))
+			case len(fields) >= 2 && fields[1] == "ANONYMOUS":
+				accepted, err = accept(anonymous)
+			default:
+				err = send(mechanisms)
+			}
+		case fields[0] == "DATA" && waitingForData && len(fields) <= 2:
+			waitingForData = false
+			response := ""
+			if len(fields) == 2 {
+				response = fields[1]
+			}
+			accepted, err = accept(_CheckExternal(conn, response))
+		case fields[0] == "CANCEL" || fields[0] == "ERROR":
+			if accepted {
+				err = send("ERROR")
+				break
+			}
+			waitingForData = false
+			err = send(mechanisms)
+		case fields[0] == "NEGOTIATE_UNIX_FD" && accepted:
+			if _, ok := conn.(*net.UnixConn); ok {
+				unixFDs = true
+				err = send("AGREE_UNIX_FD")
+			} else {
+				err = send("ERROR")
+			}
+		case fields[0] == "BEGIN":
+			if !accepted {
+				return false, ErrAuthFailed
+			}
+			return unixFDs, nil
+		default:
+			err = send("ERROR")
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// _ReadAuthLine reads a line of the handshake without its line break. It
+// reads byte by byte, so that the messages following BEGIN stay unread.
+func _ReadAuthLine(conn net.Conn, max int) (string, error) {
+	line := make([]byte, 0, 64)
+	b := make([]byte, 1)
+	for len(line) < max {
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return "", _AuthError(err)
+		}
+		if b[0] == '\n' {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+		line = append(line, b[0])
+	}
+	return "", ErrAuthFailed
+}
+
+// _CheckExternal reports whether the client at the other end of conn runs
+// as the same user, and as the user it claims if response names one.
+func _CheckExternal(conn net.Conn, response string) bool {
+	uid, ok := _PeerUID(conn)
+	if !ok || uid != os.Getuid() {
+		return false
+	}
+	if response == "" {
+		return true
+	}
+	claimed, err := hex.DecodeString(response)
+	return err == nil && string(claimed) == strconv.Itoa(uid)
 }
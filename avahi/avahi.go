@@ -0,0 +1,171 @@
+// Package avahi discovers DNS-SD services on the local network through the
+// Avahi daemon on the system bus.
+//
+// Browsers are created with ServiceBrowserPrepare and started once their
+// signals are subscribed, so no service is missed; this needs Avahi 0.7 or
+// later.
+package avahi
+
+import (
+	"errors"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION               = "org.freedesktop.Avahi"
+	PATH                      = "/"
+	SERVER_INTERFACE          = "org.freedesktop.Avahi.Server"
+	SERVICE_BROWSER_INTERFACE = "org.freedesktop.Avahi.ServiceBrowser"
+)
+
+// Wildcards and protocols of the interface and protocol arguments.
+const (
+	IF_UNSPEC    int32 = -1
+	PROTO_UNSPEC int32 = -1
+	PROTO_INET   int32 = 0
+	PROTO_INET6  int32 = 1
+)
+
+var (
+	ErrNoService = errors.New("NoAvahi")
+	ErrNoObject  = errors.New("NoSuchObject")
+)
+
+// Service is a service reported by a browser.
+type Service struct {
+	Interface int32
+	Protocol  int32
+	Name      string
+	Type      string
+	Domain    string
+	Flags     uint32
+}
+
+// ResolvedService is a service with its address and TXT records.
+type ResolvedService struct {
+	Interface       int32
+	Protocol        int32
+	Name            string
+	Type            string
+	Domain          string
+	Host            string
+	AddressProtocol int32
+	Address         string
+	Port            uint16
+	Txt             [][]byte
+	Flags           uint32
+}
+
+// Server is the Avahi daemon.
+type Server struct {
+	conn  *dbus.Connection
+	iface *dbus.Interface
+}
+
+// NewServer returns the daemon reached through conn, which must be an
+// initialized connection to the system bus.
+func NewServer(conn *dbus.Connection) (*Server, error) {
+	obj := conn.GetObject(DESTINATION, PATH)
+	iface := conn.Interface(obj, SERVER_INTERFACE)
+	if iface == nil {
+		return nil, ErrNoService
+	}
+	return &Server{conn, iface}, nil
+}
+
+// Browser reports the services of a type.
+type Browser struct {
+	conn     *dbus.Connection
+	path     string
+	iface    *dbus.Interface
+	handlers []*dbus.SignalHandler
+}
+
+// Browse looks for services of serviceType, like "_http._tcp", in domain,
+// empty for the default domain. added and removed are called from the
+// dispatcher as services appear and disappear, and must not call methods
+// of the server.
+func (p *Server) Browse(serviceType, domain string, added, removed func(*Service)) (*Browser, error) {
+	ret, err := p.conn.CallMethod(p.iface, "ServiceBrowserPrepare",
+		IF_UNSPEC, PROTO_UNSPEC, serviceType, domain, uint32(0))
+	if err != nil {
+		return nil, err
+	}
+	var path string
+	if err = dbus.Store(ret, &path); err != nil {
+		return nil, err
+	}
+
+	obj := p.conn.GetObject(DESTINATION, path)
+	iface := p.conn.Interface(obj, SERVICE_BROWSER_INTERFACE)
+	if iface == nil {
+		return nil, ErrNoObject
+	}
+	b := &Browser{conn: p.conn, path: path, iface: iface}
+	if err = b._AddSignalHandler("ItemNew", added); err == nil {
+		err = b._AddSignalHandler("ItemRemove", removed)
+	}
+	if err == nil {
+		_, err = p.conn.CallMethod(iface, "Start")
+	}
+	if err != nil {
+		b.Free()
+		return nil, err
+	}
+	return b, nil
+}
+
+func (p *Browser) _AddSignalHandler(member string, proc func(*Service)) error {
+	if proc == nil {
+		return nil
+	}
+	mr := &dbus.MatchRule{
+		Type:      "signal",
+		Sender:    DESTINATION,
+		Interface: SERVICE_BROWSER_INTERFACE,
+		Member:    member,
+		Path:      p.path,
+	}
+	handler, err := p.conn.AddSignalHandler(mr, func(msg *dbus.Message) {
+		if service, err := _NewService(msg.Params); err == nil {
+			proc(service)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	p.handlers = append(p.handlers, handler)
+	return nil
+}
+
+// _NewService decodes the (iisssu) body of ItemNew and ItemRemove.
+func _NewService(params []interface{}) (*Service, error) {
+	service := new(Service)
+	if err := dbus.Store([]interface{}{params}, service); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// Free stops the browser and removes its signal handlers.
+func (p *Browser) Free() error {
+	_, err := p.conn.CallMethod(p.iface, "Free")
+	if rerr := p.conn.RemoveSignalHandler(p.handlers...); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// Resolve looks up the address, port and TXT records of service.
+func (p *Server) Resolve(service *Service) (*ResolvedService, error) {
+	ret, err := p.conn.CallMethod(p.iface, "ResolveService",
+		service.Interface, service.Protocol, service.Name, service.Type, service.Domain,
+		PROTO_UNSPEC, uint32(0))
+	if err != nil {
+		return nil, err
+	}
+	resolved := new(ResolvedService)
+	err = dbus.Store([]interface{}{ret}, resolved)
+	return resolved, err
+}
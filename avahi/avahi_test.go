@@ -0,0 +1,19 @@
+package avahi
+
+import (
+	"testing"
+)
+
+func TestNewService(t *testing.T) {
+	params := []interface{}{int32(2), PROTO_INET, "printer", "_ipp._tcp", "local", uint32(4)}
+	service, e := _NewService(params)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if service.Interface != 2 || service.Name != "printer" || service.Type != "_ipp._tcp" || service.Flags != 4 {
+		t.Error("#2 Failed:", service)
+	}
+	if _, e := _NewService(params[:3]); e == nil {
+		t.Error("#3 Failed")
+	}
+}
@@ -0,0 +1,123 @@
+package dbus
+
+import (
+	"sync"
+	"testing"
+)
+
+func benchmarkMessage(sig string, params ...interface{}) *Message {
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example/Object"
+	msg.Iface = "org.example.Interface"
+	msg.Member = "Changed"
+	msg.Sig = sig
+	msg.Params = params
+	return msg
+}
+
+func benchmarkStructs(n int) []interface{} {
+	slice := make([]interface{}, n)
+	for i := range slice {
+		slice[i] = []interface{}{"element", uint32(i)}
+	}
+	return slice
+}
+
+func benchmarkBytes(n int) []interface{} {
+	slice := make([]interface{}, n)
+	for i := range slice {
+		slice[i] = byte(i)
+	}
+	return slice
+}
+
+var benchmarkMessages = []struct {
+	name string
+	msg  *Message
+}{
+	{"Empty", benchmarkMessage("")},
+	{"Strings", benchmarkMessage("ssu", "org.example.Name", ":1.42", uint32(1))},
+	{"StructArray", benchmarkMessage("a(su)", benchmarkStructs(100))},
+	{"ByteArray", benchmarkMessage("ay", benchmarkBytes(4096))},
+	{"ByteSlice", benchmarkMessage("ay", make([]byte, 1<<20))},
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	for _, bm := range benchmarkMessages {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				header, body, _ := bm.msg._MarshalParts()
+				_PutBuffer(header)
+				body.Release()
+			}
+		})
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	for _, bm := range benchmarkMessages {
+		buff, _ := bm.msg._Marshal()
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(buff)))
+			for i := 0; i < b.N; i++ {
+				if _, _, e := _Unmarshal(buff); e != nil {
+					b.Fatal(e)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSignalDispatch(b *testing.B) {
+	con := new(Connection)
+	con.names = make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		con.signalHandlers.Add(&SignalHandler{mr: MatchRule{Type: "signal", Member: "Other"}, proc: func(*Message) {}})
+	}
+	count := 0
+	con.signalHandlers.Add(&SignalHandler{mr: MatchRule{Type: "signal", Member: "Changed"}, proc: func(*Message) { count++ }})
+
+	msg := benchmarkMessage("s", "value")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		con._MessageDispatch(msg)
+	}
+	if count != b.N {
+		b.Fatal("missed signals:", count)
+	}
+}
+
+func BenchmarkSignalReceive(b *testing.B) {
+	con, bus := newTestConnection(b, nil)
+
+	var wg sync.WaitGroup
+	con.handlersMutex.Lock()
+	con.signalHandlers.Add(&SignalHandler{mr: MatchRule{Type: "signal"}, proc: func(*Message) { wg.Done() }})
+	con.handlersMutex.Unlock()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	wg.Add(b.N)
+	for i := 0; i < b.N; i++ {
+		bus.Emit("/org/example/Object", "org.example.Interface", "Changed", "s", "value")
+	}
+	wg.Wait()
+}
+
+func BenchmarkCall(b *testing.B) {
+	con, _ := newTestConnection(b, func(bus *testBus, msg *Message) {
+		bus.Reply(msg, "s", ":1.2")
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, e := con.CallMethod(con.proxy, "GetNameOwner", "org.example.Name"); e != nil {
+			b.Fatal(e)
+		}
+	}
+}
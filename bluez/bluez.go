@@ -0,0 +1,246 @@
+// Package bluez gives access to Bluetooth adapters and devices through the
+// BlueZ daemon on the system bus.
+//
+// Adapters and devices are found from the managed objects of the daemon,
+// and devices appearing during discovery are reported from its
+// InterfacesAdded signals. Pairing agents, which BlueZ calls back, need
+// exported objects and are not supported.
+package bluez
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION              = "org.bluez"
+	ADAPTER_INTERFACE        = "org.bluez.Adapter1"
+	DEVICE_INTERFACE         = "org.bluez.Device1"
+	OBJECT_MANAGER_INTERFACE = "org.freedesktop.DBus.ObjectManager"
+	PROPERTIES_INTERFACE     = "org.freedesktop.DBus.Properties"
+)
+
+var (
+	ErrNoService = errors.New("NoBluez")
+	ErrNoObject  = errors.New("NoSuchObject")
+)
+
+// ManagedObjects maps object paths to the properties of their interfaces
+// by interface name, as returned by GetManagedObjects.
+type ManagedObjects map[string]map[string]map[string]interface{}
+
+// Client is the BlueZ daemon.
+type Client struct {
+	conn *dbus.Connection
+	om   *dbus.Interface
+}
+
+// NewClient returns the daemon reached through conn, which must be an
+// initialized connection to the system bus.
+func NewClient(conn *dbus.Connection) (*Client, error) {
+	obj := conn.GetObject(DESTINATION, "/")
+	om := conn.Interface(obj, OBJECT_MANAGER_INTERFACE)
+	if om == nil {
+		return nil, ErrNoService
+	}
+	return &Client{conn, om}, nil
+}
+
+// ManagedObjects returns all objects of the daemon.
+func (p *Client) ManagedObjects() (ManagedObjects, error) {
+	ret, err := p.conn.CallMethod(p.om, "GetManagedObjects")
+	if err != nil {
+		return nil, err
+	}
+	var objects ManagedObjects
+	err = dbus.Store(ret, &objects)
+	return objects, err
+}
+
+// Adapters returns the Bluetooth adapters.
+func (p *Client) Adapters() ([]*Adapter, error) {
+	objects, err := p.ManagedObjects()
+	if err != nil {
+		return nil, err
+	}
+	adapters := make([]*Adapter, 0)
+	for path, ifaces := range objects {
+		if props, ok := ifaces[ADAPTER_INTERFACE]; ok {
+			adapters = append(adapters, &Adapter{object{conn: p.conn, path: path}, props})
+		}
+	}
+	return adapters, nil
+}
+
+// Devices returns the devices known to the daemon, paired or recently
+// discovered.
+func (p *Client) Devices() ([]*Device, error) {
+	objects, err := p.ManagedObjects()
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]*Device, 0)
+	for path, ifaces := range objects {
+		if props, ok := ifaces[DEVICE_INTERFACE]; ok {
+			devices = append(devices, &Device{object{conn: p.conn, path: path}, props})
+		}
+	}
+	return devices, nil
+}
+
+// OnDeviceFound calls proc with each device appearing, typically while an
+// adapter is discovering. proc is called from the dispatcher and must not
+// call methods of the device itself. The handler can be passed to
+// RemoveSignalHandler to stop watching.
+func (p *Client) OnDeviceFound(proc func(*Device)) (*dbus.SignalHandler, error) {
+	mr := &dbus.MatchRule{
+		Type:      "signal",
+		Sender:    DESTINATION,
+		Interface: OBJECT_MANAGER_INTERFACE,
+		Member:    "InterfacesAdded",
+		Path:      "/",
+	}
+	return p.conn.AddSignalHandler(mr, func(msg *dbus.Message) {
+		if device := _NewAddedDevice(p.conn, msg.Params); device != nil {
+			proc(device)
+		}
+	})
+}
+
+// _NewAddedDevice returns the device added by the (oa{sa{sv}}) body of an
+// InterfacesAdded signal, or nil if no device was added.
+func _NewAddedDevice(conn *dbus.Connection, params []interface{}) *Device {
+	var path string
+	var ifaces map[string]map[string]interface{}
+	if dbus.Store(params, &path, &ifaces) != nil {
+		return nil
+	}
+	props, ok := ifaces[DEVICE_INTERFACE]
+	if !ok {
+		return nil
+	}
+	return &Device{object{conn: conn, path: path}, props}
+}
+
+// object is an object of the daemon. Its interfaces are only introspected
+// once a method is called, so that objects can be created from signal
+// handlers.
+type object struct {
+	conn  *dbus.Connection
+	path  string
+	mutex sync.Mutex
+	obj   *dbus.Object
+}
+
+// Path returns the object path.
+func (p *object) Path() string { return p.path }
+
+func (p *object) _Call(iface, method string, args ...interface{}) ([]interface{}, error) {
+	p.mutex.Lock()
+	if p.obj == nil {
+		p.obj = p.conn.GetObject(DESTINATION, p.path)
+	}
+	obj := p.obj
+	p.mutex.Unlock()
+
+	i := p.conn.Interface(obj, iface)
+	if i == nil {
+		return nil, ErrNoObject
+	}
+	return p.conn.CallMethod(i, method, args...)
+}
+
+// WatchProperties calls proc with the interface, name and new value of
+// each property of the object that changes. The value is nil for
+// properties whose value was not sent.
+func (p *object) WatchProperties(proc func(iface, name string, value interface{})) (*dbus.SignalHandler, error) {
+	mr := &dbus.MatchRule{
+		Type:      "signal",
+		Sender:    DESTINATION,
+		Interface: PROPERTIES_INTERFACE,
+		Member:    "PropertiesChanged",
+		Path:      p.path,
+	}
+	return p.conn.AddSignalHandler(mr, func(msg *dbus.Message) {
+		var iface string
+		var changed map[string]interface{}
+		var invalidated []string
+		if dbus.Store(msg.Params, &iface, &changed, &invalidated) != nil {
+			return
+		}
+		for k, v := range changed {
+			proc(iface, k, v)
+		}
+		for _, k := range invalidated {
+			proc(iface, k, nil)
+		}
+	})
+}
+
+// Adapter is a Bluetooth adapter.
+type Adapter struct {
+	object
+	// Properties holds the adapter properties at the time the adapter was
+	// found.
+	Properties map[string]interface{}
+}
+
+// StartDiscovery starts looking for devices, which are reported to
+// OnDeviceFound.
+func (p *Adapter) StartDiscovery() error {
+	_, err := p._Call(ADAPTER_INTERFACE, "StartDiscovery")
+	return err
+}
+
+// StopDiscovery stops looking for devices.
+func (p *Adapter) StopDiscovery() error {
+	_, err := p._Call(ADAPTER_INTERFACE, "StopDiscovery")
+	return err
+}
+
+// RemoveDevice removes the device at path and its pairing information.
+func (p *Adapter) RemoveDevice(path string) error {
+	_, err := p._Call(ADAPTER_INTERFACE, "RemoveDevice", path)
+	return err
+}
+
+// Device is a remote Bluetooth device.
+type Device struct {
+	object
+	// Properties holds the device properties at the time the device was
+	// found.
+	Properties map[string]interface{}
+}
+
+// Address returns the Bluetooth address of the device.
+func (p *Device) Address() string {
+	address, _ := p.Properties["Address"].(string)
+	return address
+}
+
+// Name returns the name of the device, if it is known.
+func (p *Device) Name() string {
+	name, _ := p.Properties["Name"].(string)
+	return name
+}
+
+// Connect connects the profiles of the device which may auto connect.
+func (p *Device) Connect() error {
+	_, err := p._Call(DEVICE_INTERFACE, "Connect")
+	return err
+}
+
+// Disconnect disconnects all profiles of the device.
+func (p *Device) Disconnect() error {
+	_, err := p._Call(DEVICE_INTERFACE, "Disconnect")
+	return err
+}
+
+// Pair pairs with the device. Without a registered agent, this only works
+// for devices not requiring user confirmation.
+func (p *Device) Pair() error {
+	_, err := p._Call(DEVICE_INTERFACE, "Pair")
+	return err
+}
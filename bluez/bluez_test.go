@@ -0,0 +1,31 @@
+package bluez
+
+import (
+	"testing"
+)
+
+func TestNewAddedDevice(t *testing.T) {
+	params := []interface{}{
+		"/org/bluez/hci0/dev_00_11_22_33_44_55",
+		[]interface{}{
+			[]interface{}{DEVICE_INTERFACE, []interface{}{
+				[]interface{}{"Address", "00:11:22:33:44:55"},
+				[]interface{}{"Name", "Headset"},
+				[]interface{}{"RSSI", int16(-60)},
+			}},
+			[]interface{}{PROPERTIES_INTERFACE, []interface{}{}},
+		},
+	}
+	device := _NewAddedDevice(nil, params)
+	if device == nil {
+		t.Fatal("#1 Failed")
+	}
+	if device.Path() != "/org/bluez/hci0/dev_00_11_22_33_44_55" || device.Address() != "00:11:22:33:44:55" || device.Name() != "Headset" {
+		t.Error("#2 Failed:", device.Path(), device.Properties)
+	}
+
+	params[1] = []interface{}{[]interface{}{ADAPTER_INTERFACE, []interface{}{}}}
+	if _NewAddedDevice(nil, params) != nil {
+		t.Error("#3 Failed: adapter reported as device")
+	}
+}
@@ -0,0 +1,41 @@
+package dbus
+
+import (
+	"bytes"
+	"sync"
+)
+
+// bufferClasses are the capacities of pooled buffers. Buffers which grew
+// larger than the largest class are left to the garbage collector.
+var bufferClasses = [...]int{512, 4096, 32768, 262144}
+
+var bufferPools [len(bufferClasses)]sync.Pool
+
+// _GetBuffer returns an empty buffer with a capacity of at least size bytes,
+// taken from the pool of the smallest class that fits.
+func _GetBuffer(size int) *bytes.Buffer {
+	for i, c := range bufferClasses {
+		if size <= c {
+			if b, ok := bufferPools[i].Get().(*bytes.Buffer); ok {
+				return b
+			}
+			return bytes.NewBuffer(make([]byte, 0, c))
+		}
+	}
+	return bytes.NewBuffer(make([]byte, 0, size))
+}
+
+// _PutBuffer returns b to the pool of the largest class it can serve. b must
+// not be used afterwards.
+func _PutBuffer(b *bytes.Buffer) {
+	c := b.Cap()
+	for i := len(bufferClasses) - 1; i >= 0; i-- {
+		if c >= bufferClasses[i] {
+			if c <= 2*bufferClasses[len(bufferClasses)-1] {
+				b.Reset()
+				bufferPools[i].Put(b)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package dbus
+
+import (
+	"testing"
+)
+
+func TestBufferPool(t *testing.T) {
+	b := _GetBuffer(100)
+	if b.Len() != 0 || b.Cap() < 100 {
+		t.Error("#1 Failed:", b.Len(), b.Cap())
+	}
+	b.WriteString("data")
+	_PutBuffer(b)
+
+	b = _GetBuffer(5000)
+	if b.Len() != 0 || b.Cap() < 5000 {
+		t.Error("#2 Failed:", b.Len(), b.Cap())
+	}
+
+	b = _GetBuffer(1 << 20)
+	if b.Cap() < 1<<20 {
+		t.Error("#3 Failed:", b.Cap())
+	}
+	_PutBuffer(b) // too large to be retained
+}
+
+func TestMarshalBufferReuse(t *testing.T) {
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Member = "Foo"
+	msg.Sig = "s"
+	msg.Params = []interface{}{"bar"}
+
+	first, _ := msg._Marshal()
+	for i := 0; i < 3; i++ {
+		buff, _ := msg._MarshalBuffer()
+		if string(buff.Bytes()) != string(first) {
+			t.Error("#1 Failed", i)
+		}
+		_PutBuffer(buff)
+	}
+}
@@ -0,0 +1,443 @@
+//go:build conformance
+// +build conformance
+
+package dbus
+
+// The conformance tests run connections against real message bus
+// implementations and exchange messages with tools built on the reference
+// libraries, dbus-send (libdbus) and gdbus (GDBus), to catch wire format
+// incompatibilities the unit tests cannot. They are not run by default:
+//
+//	go test -tags conformance -run Conformance
+//
+// Buses and tools which are not installed are skipped.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type conformanceBus struct {
+	name  string
+	start func(t *testing.T) string
+}
+
+var conformanceBuses = []conformanceBus{
+	{"dbus-daemon", startDBusDaemon},
+	{"dbus-broker", startDBusBroker},
+}
+
+// startDBusDaemon starts a dbus-daemon and returns its address.
+func startDBusDaemon(t *testing.T) string {
+	address, _ := runDBusDaemon(t, filepath.Join(t.TempDir(), "bus"))
+	return address
+}
+
+// runDBusDaemon starts a dbus-daemon listening at path and returns its
+// address and a function killing it.
+func runDBusDaemon(t *testing.T, path string) (string, func()) {
+	if _, e := exec.LookPath("dbus-daemon"); e != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address=1",
+		"--address=unix:path="+path)
+	out, e := cmd.StdoutPipe()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e = cmd.Start(); e != nil {
+		t.Fatal(e)
+	}
+	kill := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	t.Cleanup(kill)
+
+	address, e := bufio.NewReader(out).ReadString('\n')
+	if e != nil {
+		t.Fatal(e)
+	}
+	return strings.TrimSpace(address), kill
+}
+
+// startDBusBroker starts a dbus-broker through its launcher, which only
+// accepts its listening socket by socket activation.
+func startDBusBroker(t *testing.T) string {
+	if _, e := exec.LookPath("dbus-broker-launch"); e != nil {
+		t.Skip("dbus-broker not installed")
+	}
+	path := filepath.Join(t.TempDir(), "bus")
+	l, e := net.Listen("unix", path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer l.Close()
+	f, e := l.(*net.UnixListener).File()
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer f.Close()
+
+	cmd := exec.Command("sh", "-c", `LISTEN_PID=$$ LISTEN_FDS=1 exec dbus-broker-launch --scope user`)
+	cmd.ExtraFiles = []*os.File{f}
+	if e = cmd.Start(); e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	return "unix:path=" + path
+}
+
+// connectConformance returns a connection initialized on the bus at
+// address, which is also set as the session bus of the tools run.
+func connectConformance(t *testing.T, address string) *Connection {
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", address)
+	var con *Connection
+	var e error
+	for i := 0; i < 50; i++ { // the bus may not accept connections yet
+		if con, e = Connect(SessionBus); e == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e = con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+	return con
+}
+
+// receiveSignal runs the command args, which emits the signal member of
+// the interface org.example.Test, and returns the decoded body.
+func receiveSignal(t *testing.T, con *Connection, member string, args ...string) []interface{} {
+	if _, e := exec.LookPath(args[0]); e != nil {
+		t.Skip(args[0], "not installed")
+	}
+	received := make(chan []interface{}, 1)
+	con.AddSignalHandler(&MatchRule{Type: "signal", Interface: "org.example.Test", Member: member},
+		func(msg *Message) { received <- msg.Params })
+
+	if out, e := exec.Command(args[0], args[1:]...).CombinedOutput(); e != nil {
+		t.Fatal(e, string(out))
+	}
+	select {
+	case params := <-received:
+		return params
+	case <-time.After(5 * time.Second):
+		t.Fatal("signal not received")
+	}
+	return nil
+}
+
+func TestConformance(t *testing.T) {
+	for _, bus := range conformanceBuses {
+		bus := bus
+		t.Run(bus.name, func(t *testing.T) {
+			address := bus.start(t)
+
+			t.Run("Hello", func(t *testing.T) {
+				con := connectConformance(t, address)
+				if !strings.HasPrefix(con.UniqueName(), ":") {
+					t.Error("#1 Failed:", con.UniqueName())
+				}
+				names, e := con.CallMethod(con.proxy, "ListNames")
+				if e != nil {
+					t.Fatal("#2 Failed:", e)
+				}
+				found := false
+				for _, name := range names[0].([]interface{}) {
+					found = found || name == con.UniqueName()
+				}
+				if !found {
+					t.Error("#3 Failed:", names)
+				}
+			})
+
+			t.Run("BasicTypes", func(t *testing.T) {
+				con := connectConformance(t, address)
+				params := receiveSignal(t, con, "Types", "dbus-send", "--session", "--type=signal",
+					"/org/example", "org.example.Test.Types",
+					"byte:1", "boolean:true", "int16:-2", "uint16:3", "int32:-4", "uint32:5",
+					"int64:-6", "uint64:7", "double:0.5", "string:s", "objpath:/o",
+					"array:string:a,b", "dict:string:int32:k,1", "variant:int32:9")
+				expected := []interface{}{byte(1), true, int16(-2), uint16(3), int32(-4), uint32(5),
+					int64(-6), uint64(7), 0.5, "s", ObjectPath("/o"),
+					[]interface{}{"a", "b"},
+					[]interface{}{[]interface{}{"k", int32(1)}},
+					Variant{"i", int32(9)}}
+				if !reflect.DeepEqual(params, expected) {
+					t.Error("#1 Failed:", params)
+				}
+			})
+
+			t.Run("Containers", func(t *testing.T) {
+				con := connectConformance(t, address)
+				params := receiveSignal(t, con, "Containers", "gdbus", "emit", "--session",
+					"--object-path", "/org/example", "--signal", "org.example.Test.Containers",
+					"('a', [<1>, <'b'>], {'k': <(true, @ay [1, 2])>}, @aay [[3]])")
+				expected := []interface{}{[]interface{}{
+					"a",
+					[]interface{}{Variant{"i", int32(1)}, Variant{"s", "b"}},
+					[]interface{}{[]interface{}{"k", Variant{"(bay)", []interface{}{true, []byte{1, 2}}}}},
+					[]interface{}{[]byte{3}},
+				}}
+				if !reflect.DeepEqual(params, expected) {
+					t.Error("#1 Failed:", params)
+				}
+			})
+
+			t.Run("BigEndian", func(t *testing.T) {
+				con := connectConformance(t, address)
+				sender, e := Connect(SessionBus)
+				if e != nil {
+					t.Fatal(e)
+				}
+				sender.ByteOrder = binary.BigEndian
+				if e = sender.Initialize(); e != nil {
+					t.Fatal("#1 Failed:", e)
+				}
+
+				received := make(chan *Message, 1)
+				con.AddSignalHandler(&MatchRule{Type: "signal", Interface: "org.example.Test", Member: "BigEndian"},
+					func(msg *Message) { received <- msg })
+				if e = sender._EmitSignal("/org/example", "org.example.Test", "BigEndian", "nua{sv}",
+					int16(-2), uint32(3), map[string]interface{}{"k": int64(-4)}); e != nil {
+					t.Fatal("#2 Failed:", e)
+				}
+				select {
+				case msg := <-received:
+					expected := []interface{}{int16(-2), uint32(3),
+						[]interface{}{[]interface{}{"k", Variant{"x", int64(-4)}}}}
+					if !reflect.DeepEqual(msg.Params, expected) || msg.Sender != sender.UniqueName() {
+						t.Error("#3 Failed:", msg.Params, msg.Sender)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("#4 Failed: signal not received")
+				}
+			})
+
+			t.Run("UnixFD", func(t *testing.T) {
+				con := connectConformance(t, address)
+				if !con.SupportsUnixFDs() {
+					t.Fatal("#1 Failed")
+				}
+				r, w, e := os.Pipe()
+				if e != nil {
+					t.Fatal(e)
+				}
+				defer r.Close()
+				defer w.Close()
+
+				received := make(chan *Message, 1)
+				con.AddSignalHandler(&MatchRule{Type: "signal", Interface: "org.example.Test", Member: "UnixFD"},
+					func(msg *Message) { received <- msg })
+				if e = con._EmitSignal("/org/example", "org.example.Test", "UnixFD", "h", UnixFD(w.Fd())); e != nil {
+					t.Fatal("#2 Failed:", e)
+				}
+				select {
+				case msg := <-received:
+					fd, ok := msg.Params[0].(UnixFD)
+					if !ok || fd == UnixFD(w.Fd()) {
+						t.Fatal("#3 Failed:", msg.Params)
+					}
+					f := os.NewFile(uintptr(fd), "received")
+					f.Write([]byte("fd"))
+					f.Close()
+				case <-time.After(5 * time.Second):
+					t.Fatal("#4 Failed: signal not received")
+				}
+				w.Close()
+				b := make([]byte, 2)
+				if _, e := r.Read(b); e != nil || string(b) != "fd" {
+					t.Error("#5 Failed:", string(b), e)
+				}
+			})
+		})
+	}
+}
+
+// TestConformanceTCP connects to a dbus-daemon listening on TCP, which
+// allows anonymous clients since EXTERNAL needs a unix socket.
+func TestConformanceTCP(t *testing.T) {
+	if _, e := exec.LookPath("dbus-daemon"); e != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+	config := filepath.Join(t.TempDir(), "tcp.conf")
+	e := os.WriteFile(config, []byte(`<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>tcp:host=127.0.0.1,port=0</listen>
+  <auth>ANONYMOUS</auth>
+  <allow_anonymous/>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`), 0600)
+	if e != nil {
+		t.Fatal(e)
+	}
+	cmd := exec.Command("dbus-daemon", "--config-file="+config, "--nofork", "--print-address=1")
+	out, e := cmd.StdoutPipe()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e = cmd.Start(); e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, e := bufio.NewReader(out).ReadString('\n')
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !strings.HasPrefix(address, "tcp:") {
+		t.Fatal("#1 Failed:", address)
+	}
+
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", strings.TrimSpace(address))
+	con, e := Connect(SessionBus)
+	if e != nil {
+		t.Fatal("#2 Failed:", e)
+	}
+	con.Authenticators = []Authenticator{new(AuthAnonymous)}
+	if e = con.Initialize(); e != nil {
+		t.Fatal("#3 Failed:", e)
+	}
+	defer con.Close()
+	if con.SupportsUnixFDs() {
+		t.Error("#4 Failed")
+	}
+	ret, e := con.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "GetId")
+	if e != nil || len(ret) != 1 {
+		t.Error("#5 Failed:", ret, e)
+	}
+}
+
+func TestConformanceReconnect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bus")
+	address, kill := runDBusDaemon(t, path)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", address)
+	con, e := Connect(SessionBus)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer con.Close()
+	con.Reconnect = true
+	con.ReconnectDelay = 20 * time.Millisecond
+	reconnected := make(chan error, 1)
+	con.Reconnected = func(err error) { reconnected <- err }
+	if e = con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := con.RequestName("org.example.Reconnect", 0); e != nil {
+		t.Fatal(e)
+	}
+	received := make(chan string, 1)
+	con.AddSignalHandler(&MatchRule{Type: "signal", Interface: "org.example.Test", Member: "Ping"},
+		func(msg *Message) { received <- msg.Path })
+
+	kill()
+	os.Remove(path)
+	runDBusDaemon(t, path)
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("#1 Failed: not reconnected")
+	}
+	ret, e := con.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "GetNameOwner", "org.example.Reconnect")
+	if e != nil || len(ret) != 1 || ret[0] != con.UniqueName() {
+		t.Error("#2 Failed:", ret, e)
+	}
+
+	other := connectConformance(t, address)
+	defer other.Close()
+	if e := other.Emit("/ping", "org.example.Test", "Ping", ""); e != nil {
+		t.Fatal(e)
+	}
+	select {
+	case path := <-received:
+		if path != "/ping" {
+			t.Error("#3 Failed:", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("#3 Failed: signal not received")
+	}
+}
+
+func TestConformanceMonitor(t *testing.T) {
+	address := startDBusDaemon(t)
+	monitorCon := connectConformance(t, address)
+	defer monitorCon.Close()
+	monitor, e := monitorCon.BecomeMonitor([]MatchRule{{Type: "method_call", Member: "GetId"}, {Type: "method_return"}})
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+
+	con := connectConformance(t, address)
+	defer con.Close()
+	ret, e := con.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "GetId")
+	if e != nil {
+		t.Fatal(e)
+	}
+	timeout := time.After(5 * time.Second)
+	var call *Message
+	for {
+		select {
+		case msg := <-monitor:
+			if msg.Type == METHOD_CALL && msg.Sender == con.UniqueName() {
+				call = msg
+			} else if call != nil && msg.Type == METHOD_RETURN && msg.replySerial == call.serial {
+				if len(msg.Params) != 1 || msg.Params[0] != ret[0] {
+					t.Error("#2 Failed:", msg.Params)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("#3 Failed: call not observed", call)
+		}
+	}
+}
+
+func TestConformanceEavesdrop(t *testing.T) {
+	address := startDBusDaemon(t)
+	sniffer := connectConformance(t, address)
+	defer sniffer.Close()
+	calls := make(chan *Message, 4)
+	rule := &MatchRule{Type: "method_call", Interface: "org.freedesktop.DBus", Member: "GetId", Eavesdrop: true}
+	if _, e := sniffer.AddSignalHandler(rule, func(msg *Message) { calls <- msg }); e != nil {
+		t.Fatal(e)
+	}
+
+	con := connectConformance(t, address)
+	defer con.Close()
+	if _, e := con.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "GetId"); e != nil {
+		t.Fatal(e)
+	}
+	select {
+	case msg := <-calls:
+		if msg.Sender != con.UniqueName() {
+			t.Error("#1 Failed:", msg.Sender)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("#1 Failed: call not observed")
+	}
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"go/format"
+	"go/token"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/norisatir/go-dbus"
+)
+
+type nodeXML struct {
+	Name       string         `xml:"name,attr,omitempty"`
+	Interfaces []interfaceXML `xml:"interface"`
+	Nodes      []nodeXML      `xml:"node"`
+}
+
+type interfaceXML struct {
+	Name       string          `xml:"name,attr,omitempty"`
+	Methods    []methodXML     `xml:"method"`
+	Signals    []signalXML     `xml:"signal"`
+	Properties []propertyXML   `xml:"property"`
+	Annotation []annotationXML `xml:"annotation"`
+}
+
+type methodXML struct {
+	Name       string          `xml:"name,attr,omitempty"`
+	Args       []argXML        `xml:"arg"`
+	Annotation []annotationXML `xml:"annotation"`
+}
+
+type signalXML struct {
+	Name       string          `xml:"name,attr,omitempty"`
+	Args       []argXML        `xml:"arg"`
+	Annotation []annotationXML `xml:"annotation"`
+}
+
+type propertyXML struct {
+	Name       string          `xml:"name,attr,omitempty"`
+	Type       string          `xml:"type,attr,omitempty"`
+	Access     string          `xml:"access,attr,omitempty"`
+	Annotation []annotationXML `xml:"annotation"`
+}
+
+type argXML struct {
+	Name      string `xml:"name,attr,omitempty"`
+	Type      string `xml:"type,attr,omitempty"`
+	Direction string `xml:"direction,attr,omitempty"`
+}
+
+type annotationXML struct {
+	Name  string `xml:"name,attr,omitempty"`
+	Value string `xml:"value,attr,omitempty"`
+}
+
+// standardInterfaces are implemented by the dbus package itself, so no
+// clients are generated for them.
+var standardInterfaces = map[string]bool{
+	"org.freedesktop.DBus.Peer":           true,
+	"org.freedesktop.DBus.Introspectable": true,
+	"org.freedesktop.DBus.Properties":     true,
+	"org.freedesktop.DBus.ObjectManager":  true,
+}
+
+// reservedNames may not name parameters of generated functions, as the
+// function bodies use them.
+var reservedNames = map[string]bool{
+	"p": true, "ret": true, "err": true, "dbus": true, "msg": true, "proc": true, "signal": true,
+	"conn": true, "path": true, "srv": true, "methods": true,
+}
+
+// generator writes the Go source of the clients and server skeletons of
+// the interfaces of an introspection document.
+type generator struct {
+	pkg        string
+	interfaces []interfaceXML
+	client     bool
+	server     bool
+	buff       bytes.Buffer
+	// typeNames are the Go names of the interfaces, by interface name.
+	typeNames map[string]string
+}
+
+// _ParseIntrospection returns the interfaces described by the introspection
+// document data, also those of its nested nodes, without the standard
+// ones and without duplicates.
+func _ParseIntrospection(data []byte) ([]interfaceXML, error) {
+	var root nodeXML
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	ifaces := make([]interfaceXML, 0)
+	var collect func(node *nodeXML)
+	collect = func(node *nodeXML) {
+		for _, iface := range node.Interfaces {
+			if !standardInterfaces[iface.Name] && !seen[iface.Name] {
+				seen[iface.Name] = true
+				ifaces = append(ifaces, iface)
+			}
+		}
+		for i := range node.Nodes {
+			collect(&node.Nodes[i])
+		}
+	}
+	collect(&root)
+	sort.Slice(ifaces, func(i, j int) bool { return ifaces[i].Name < ifaces[j].Name })
+	return ifaces, nil
+}
+
+func _NewGenerator(pkg string, ifaces []interfaceXML, client, server bool) (*generator, error) {
+	g := &generator{pkg: pkg, interfaces: ifaces, client: client, server: server, typeNames: make(map[string]string)}
+	used := make(map[string]string)
+	for _, iface := range ifaces {
+		if err := dbus.ValidateInterfaceName(iface.Name); err != nil {
+			return nil, err
+		}
+		// The last component of the name, or more of them where the last
+		// ones of two interfaces are the same.
+		parts := strings.Split(iface.Name, ".")
+		name := ""
+		for i := len(parts) - 1; i >= 0; i-- {
+			name = _ExportedName(parts[i]) + name
+			if other, ok := used[name]; !ok || other == iface.Name {
+				break
+			}
+		}
+		if other, ok := used[name]; ok && other != iface.Name {
+			return nil, fmt.Errorf("interfaces %s and %s have the same Go name", other, iface.Name)
+		}
+		used[name] = iface.Name
+		g.typeNames[iface.Name] = name
+	}
+	return g, nil
+}
+
+// Generate returns the formatted Go source of the clients and server
+// skeletons.
+func (p *generator) Generate() ([]byte, error) {
+	p._Printf("// Code generated by dbus-codegen. DO NOT EDIT.\n\n")
+	p._Printf("package %s\n\n", p.pkg)
+	p._Printf("import (\n\t\"github.com/norisatir/go-dbus\"\n)\n\n")
+	for _, iface := range p.interfaces {
+		constName := _ConstName(p.typeNames[iface.Name]) + "_INTERFACE"
+		p._Printf("const %s = %q\n\n", constName, iface.Name)
+		if p.client {
+			if err := p._GenerateClient(&iface, constName); err != nil {
+				return nil, err
+			}
+		}
+		if p.server {
+			if err := p._GenerateServer(&iface, constName); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return format.Source(p.buff.Bytes())
+}
+
+func (p *generator) _Printf(format string, args ...interface{}) {
+	fmt.Fprintf(&p.buff, format, args...)
+}
+
+// _GenerateClient writes the client type of iface, with a method for each
+// of its methods, and for its signals and properties.
+func (p *generator) _GenerateClient(iface *interfaceXML, constName string) error {
+	name := p.typeNames[iface.Name]
+	p._Printf("// %s is a client of the %s interface of an object.\n", name, iface.Name)
+	p._Printf("type %s struct {\n\tconn *dbus.Connection\n\tdest string\n\tpath string\n}\n\n", name)
+	p._Printf("// New%s returns a client of the object at path of the connection\n// dest.\n", name)
+	p._Printf("func New%s(conn *dbus.Connection, dest, path string) *%s {\n\treturn &%s{conn, dest, path}\n}\n\n", name, name, name)
+
+	// Go names of the methods of the client, which generated accessors
+	// of signals and properties must not take.
+	methods := make(map[string]bool)
+	for _, method := range iface.Methods {
+		goName := _ExportedName(method.Name)
+		if methods[goName] {
+			return fmt.Errorf("%s: methods with the same Go name %s", iface.Name, goName)
+		}
+		methods[goName] = true
+	}
+
+	for _, method := range iface.Methods {
+		if err := p._GenerateMethod(name, constName, &method); err != nil {
+			return fmt.Errorf("%s.%s: %v", iface.Name, method.Name, err)
+		}
+	}
+	for _, signal := range iface.Signals {
+		if err := p._GenerateSignal(name, constName, &signal, methods); err != nil {
+			return fmt.Errorf("%s.%s: %v", iface.Name, signal.Name, err)
+		}
+	}
+	for _, prop := range iface.Properties {
+		if err := p._GenerateProperty(name, constName, &prop, methods); err != nil {
+			return fmt.Errorf("%s.%s: %v", iface.Name, prop.Name, err)
+		}
+	}
+	return nil
+}
+
+// methodParams are the Go parameters and results of a method.
+type methodParams struct {
+	inNames, inTypes   []string
+	outNames, outTypes []string
+	inSig              string
+}
+
+func _MethodParams(method *methodXML) (*methodParams, error) {
+	if err := dbus.ValidateMemberName(method.Name); err != nil {
+		return nil, err
+	}
+	var in, out []argXML
+	for _, arg := range method.Args {
+		if arg.Direction == "out" {
+			out = append(out, arg)
+		} else {
+			in = append(in, arg)
+		}
+	}
+	m := new(methodParams)
+	names := make(map[string]bool)
+	var err error
+	if m.inNames, m.inTypes, m.inSig, err = _Params(in, "arg", names); err != nil {
+		return nil, err
+	}
+	if m.outNames, m.outTypes, _, err = _Params(out, "ret", names); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// _Signature returns the parameters and results of the Go function of the
+// method, which returns an error last.
+func (p *methodParams) _Signature() string {
+	params := make([]string, len(p.inNames))
+	for i := range p.inNames {
+		params[i] = p.inNames[i] + " " + p.inTypes[i]
+	}
+	results := make([]string, 0, len(p.outNames)+1)
+	for i := range p.outNames {
+		results = append(results, p.outNames[i]+" "+p.outTypes[i])
+	}
+	results = append(results, "err error")
+	return "(" + strings.Join(params, ", ") + ") (" + strings.Join(results, ", ") + ")"
+}
+
+func (p *generator) _GenerateMethod(typeName, constName string, method *methodXML) error {
+	m, err := _MethodParams(method)
+	if err != nil {
+		return err
+	}
+	inSig, outNames := m.inSig, m.outNames
+	args := ""
+	if len(m.inNames) > 0 {
+		args = ", " + strings.Join(m.inNames, ", ")
+	}
+
+	goName := _ExportedName(method.Name)
+	p._Printf("// %s calls the %s method.\n", goName, method.Name)
+	p._WriteDeprecated(method.Annotation)
+	p._Printf("func (p *%s) %s%s {\n", typeName, goName, m._Signature())
+	if _Annotation(method.Annotation, "org.freedesktop.DBus.Method.NoReply") == "true" {
+		p._Printf("\t_, err = p.conn.CallWithFlags(dbus.NO_REPLY_EXPECTED, p.dest, p.path, %s, %q, %q%s)\n", constName, method.Name, inSig, args)
+		p._Printf("\treturn\n}\n\n")
+		return nil
+	}
+	if len(outNames) == 0 {
+		p._Printf("\t_, err = p.conn.CallWithSignature(p.dest, p.path, %s, %q, %q%s)\n", constName, method.Name, inSig, args)
+		p._Printf("\treturn\n}\n\n")
+		return nil
+	}
+	p._Printf("\tvar ret []interface{}\n")
+	p._Printf("\tif ret, err = p.conn.CallWithSignature(p.dest, p.path, %s, %q, %q%s); err != nil {\n\t\treturn\n\t}\n", constName, method.Name, inSig, args)
+	ptrs := make([]string, len(outNames))
+	for i, name := range outNames {
+		ptrs[i] = "&" + name
+	}
+	p._Printf("\terr = dbus.Store(ret, %s)\n\treturn\n}\n\n", strings.Join(ptrs, ", "))
+	return nil
+}
+
+func (p *generator) _GenerateSignal(typeName, constName string, signal *signalXML, methods map[string]bool) error {
+	if err := dbus.ValidateMemberName(signal.Name); err != nil {
+		return err
+	}
+	watch := "Watch" + _ExportedName(signal.Name)
+	if methods[watch] {
+		return fmt.Errorf("%s clashes with a method", watch)
+	}
+	methods[watch] = true
+	signalType := typeName + _ExportedName(signal.Name) + "Signal"
+
+	fields := make([]string, len(signal.Args))
+	used := make(map[string]bool)
+	p._Printf("// %s is the %s signal.\n", signalType, signal.Name)
+	p._WriteDeprecated(signal.Annotation)
+	p._Printf("type %s struct {\n", signalType)
+	for i, arg := range signal.Args {
+		goType, err := _GoType(arg.Type)
+		if err != nil {
+			return err
+		}
+		field := _ExportedName(arg.Name)
+		if field == "" || used[field] {
+			field = fmt.Sprintf("Arg%d", i)
+		}
+		used[field] = true
+		fields[i] = "&signal." + field
+		p._Printf("\t%s %s\n", field, goType)
+	}
+	p._Printf("}\n\n")
+
+	p._Printf("// %s calls proc with the %s signals of the object, sent by the\n", watch, signal.Name)
+	p._Printf("// current owner of its destination.\n")
+	p._Printf("func (p *%s) %s(proc func(*%s)) (*dbus.SignalHandler, error) {\n", typeName, watch, signalType)
+	p._Printf("\tmr := &dbus.MatchRule{Type: \"signal\", Sender: p.dest, Path: p.path, Interface: %s, Member: %q}\n", constName, signal.Name)
+	p._Printf("\treturn p.conn.AddSignalHandler(mr, func(msg *dbus.Message) {\n")
+	p._Printf("\t\tsignal := new(%s)\n", signalType)
+	if len(fields) == 0 {
+		p._Printf("\t\tproc(signal)\n")
+	} else {
+		p._Printf("\t\tif dbus.Store(msg.Params, %s) == nil {\n\t\t\tproc(signal)\n\t\t}\n", strings.Join(fields, ", "))
+	}
+	p._Printf("\t})\n}\n\n")
+	return nil
+}
+
+func (p *generator) _GenerateProperty(typeName, constName string, prop *propertyXML, methods map[string]bool) error {
+	if err := dbus.ValidateMemberName(prop.Name); err != nil {
+		return err
+	}
+	goType, err := _GoType(prop.Type)
+	if err != nil {
+		return err
+	}
+	readable := prop.Access == "read" || prop.Access == "readwrite"
+	writable := prop.Access == "write" || prop.Access == "readwrite"
+	getter := "Get" + _ExportedName(prop.Name)
+	setter := "Set" + _ExportedName(prop.Name)
+	if (readable && methods[getter]) || (writable && methods[setter]) {
+		return fmt.Errorf("property accessors clash with a method")
+	}
+
+	if readable {
+		methods[getter] = true
+		p._Printf("// %s returns the value of the %s property.\n", getter, prop.Name)
+		p._WriteDeprecated(prop.Annotation)
+		p._Printf("func (p *%s) %s() (value %s, err error) {\n", typeName, getter, goType)
+		p._Printf("\tvar ret []interface{}\n")
+		p._Printf("\tif ret, err = p.conn.CallWithSignature(p.dest, p.path, dbus.PROPERTIES_INTERFACE, \"Get\", \"ss\", %s, %q); err != nil {\n\t\treturn\n\t}\n", constName, prop.Name)
+		p._Printf("\terr = dbus.Store(ret, &value)\n\treturn\n}\n\n")
+	}
+	if writable {
+		methods[setter] = true
+		p._Printf("// %s sets the %s property.\n", setter, prop.Name)
+		p._WriteDeprecated(prop.Annotation)
+		p._Printf("func (p *%s) %s(value %s) error {\n", typeName, setter, goType)
+		p._Printf("\t_, err := p.conn.CallWithSignature(p.dest, p.path, dbus.PROPERTIES_INTERFACE, \"Set\", \"ssv\", %s, %q, dbus.Variant{Sig: %q, Value: value})\n", constName, prop.Name, prop.Type)
+		p._Printf("\treturn err\n}\n\n")
+	}
+	return nil
+}
+
+// _GenerateServer writes the interface implemented by the objects serving
+// iface, the function exporting them with the introspection data of iface,
+// and a function emitting each of its signals. Properties are left out, as
+// exported objects do not implement org.freedesktop.DBus.Properties.
+func (p *generator) _GenerateServer(iface *interfaceXML, constName string) error {
+	name := p.typeNames[iface.Name]
+	serverName := name + "Server"
+	introName := strings.ToLower(name[:1]) + name[1:] + "Introspection"
+
+	p._Printf("// %s is implemented by the objects serving the %s\n", serverName, iface.Name)
+	p._Printf("// interface, which Export%s exports. Errors returned fail the calls; a\n", name)
+	p._Printf("// *dbus.Error is sent with its name.\n")
+	p._Printf("type %s interface {\n", serverName)
+	for _, method := range iface.Methods {
+		m, err := _MethodParams(&method)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", iface.Name, method.Name, err)
+		}
+		p._Printf("\t// %s is called for the %s method.\n", _ExportedName(method.Name), method.Name)
+		p._Printf("\t%s%s\n", _ExportedName(method.Name), m._Signature())
+	}
+	p._Printf("}\n\n")
+
+	p._Printf("// Export%s exports srv as the %s interface of the\n", name, iface.Name)
+	p._Printf("// object at path.\n")
+	p._Printf("func Export%s(conn *dbus.Connection, srv %s, path string) error {\n", name, serverName)
+	p._Printf("\tmethods := map[string]interface{}{\n")
+	for _, method := range iface.Methods {
+		p._Printf("\t\t%q: srv.%s,\n", method.Name, _ExportedName(method.Name))
+	}
+	p._Printf("\t}\n")
+	p._Printf("\treturn conn.ExportMethods(methods, %s, path, %s)\n}\n\n", introName, constName)
+
+	for _, signal := range iface.Signals {
+		if err := dbus.ValidateMemberName(signal.Name); err != nil {
+			return fmt.Errorf("%s.%s: %v", iface.Name, signal.Name, err)
+		}
+		names, types, sig, err := _Params(signal.Args, "arg", make(map[string]bool))
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", iface.Name, signal.Name, err)
+		}
+		params := ""
+		for i := range names {
+			params += ", " + names[i] + " " + types[i]
+		}
+		args := ""
+		if len(names) > 0 {
+			args = ", " + strings.Join(names, ", ")
+		}
+		emit := "Emit" + name + _ExportedName(signal.Name)
+		p._Printf("// %s emits the %s signal from the object at path.\n", emit, signal.Name)
+		p._WriteDeprecated(signal.Annotation)
+		p._Printf("func %s(conn *dbus.Connection, path string%s) error {\n", emit, params)
+		p._Printf("\treturn conn.Emit(path, %s, %q, %q%s)\n}\n\n", constName, signal.Name, sig, args)
+	}
+
+	intro, err := _ServerIntrospection(iface)
+	if err != nil {
+		return err
+	}
+	p._Printf("// %s describes %s in the introspection data of\n// the objects exported by Export%s.\n", introName, iface.Name, name)
+	if strings.Contains(intro, "`") {
+		p._Printf("const %s = %q\n\n", introName, intro)
+	} else {
+		p._Printf("const %s = `%s`\n\n", introName, intro)
+	}
+	return nil
+}
+
+// _ServerIntrospection returns the <interface> element of iface for
+// exported objects, which has no properties.
+func _ServerIntrospection(iface *interfaceXML) (string, error) {
+	served := *iface
+	served.Properties = nil
+	b, err := xml.MarshalIndent(struct {
+		XMLName struct{} `xml:"interface"`
+		*interfaceXML
+	}{interfaceXML: &served}, "  ", "  ")
+	if err != nil {
+		return "", err
+	}
+	return emptyElement.ReplaceAllString(strings.TrimSpace(string(b)), "<$1$2/>"), nil
+}
+
+// emptyElement matches the elements without content which encoding/xml
+// writes with end tags.
+var emptyElement = regexp.MustCompile(`<(\w+)([^<>]*)></\w+>`)
+
+// _WriteDeprecated marks a declaration as deprecated if its annotations
+// say so.
+func (p *generator) _WriteDeprecated(annotations []annotationXML) {
+	if _Annotation(annotations, "org.freedesktop.DBus.Deprecated") == "true" {
+		p._Printf("//\n// Deprecated: marked as deprecated in the introspection data.\n")
+	}
+}
+
+func _Annotation(annotations []annotationXML, name string) string {
+	for _, a := range annotations {
+		if a.Name == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// _Params returns the Go names and types of args, and their signature.
+// Unnamed arguments and those whose names are taken are named after prefix
+// and their position.
+func _Params(args []argXML, prefix string, used map[string]bool) ([]string, []string, string, error) {
+	names := make([]string, len(args))
+	types := make([]string, len(args))
+	sig := ""
+	for i, arg := range args {
+		goType, err := _GoType(arg.Type)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		name := _ParamName(arg.Name)
+		if name == "" || used[name] {
+			name = fmt.Sprintf("%s%d", prefix, i)
+		}
+		used[name] = true
+		names[i] = name
+		types[i] = goType
+		sig += arg.Type
+	}
+	return names, types, sig, nil
+}
+
+// _GoType returns the Go type of values of the signature sig, which must
+// be a single complete type. It is the type Store accepts for them and
+// which marshals with that signature.
+func _GoType(sig string) (string, error) {
+	types, err := dbus.ParseSignature(sig)
+	if err != nil {
+		return "", err
+	}
+	if len(types) != 1 {
+		return "", fmt.Errorf("signature %q is not a single type", sig)
+	}
+	return _CompleteGoType(string(types[0]))
+}
+
+func _CompleteGoType(t string) (string, error) {
+	switch t[0] {
+	case 'y':
+		return "byte", nil
+	case 'b':
+		return "bool", nil
+	case 'n':
+		return "int16", nil
+	case 'q':
+		return "uint16", nil
+	case 'i':
+		return "int32", nil
+	case 'u':
+		return "uint32", nil
+	case 'x':
+		return "int64", nil
+	case 't':
+		return "uint64", nil
+	case 'd':
+		return "float64", nil
+	case 's':
+		return "string", nil
+	case 'o':
+		return "dbus.ObjectPath", nil
+	case 'g':
+		return "dbus.Signature", nil
+	case 'h':
+		return "dbus.UnixFD", nil
+	case 'v':
+		return "dbus.Variant", nil
+	case 'a':
+		if t[1] == '{' {
+			key, err := _CompleteGoType(t[2:3])
+			if err != nil {
+				return "", err
+			}
+			value, err := _CompleteGoType(t[3 : len(t)-1])
+			if err != nil {
+				return "", err
+			}
+			return "map[" + key + "]" + value, nil
+		}
+		elem, err := _CompleteGoType(t[1:])
+		if err != nil {
+			return "", err
+		}
+		return "[]" + elem, nil
+	case '(':
+		fields, err := dbus.ParseSignature(t[1 : len(t)-1])
+		if err != nil {
+			return "", err
+		}
+		decls := make([]string, len(fields))
+		for i, field := range fields {
+			goType, err := _CompleteGoType(string(field))
+			if err != nil {
+				return "", err
+			}
+			decls[i] = fmt.Sprintf("Field%d %s", i, goType)
+		}
+		return "struct {\n" + strings.Join(decls, "\n") + "\n}", nil
+	}
+	return "", fmt.Errorf("unknown type %q", t)
+}
+
+// _ExportedName turns a D-Bus name, like "NameOwnerChanged", "get_id" or
+// "device-name", into an exported Go name.
+func _ExportedName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(part[:1]) + part[1:]
+	}
+	exported := strings.Join(parts, "")
+	if exported != "" && unicode.IsDigit(rune(exported[0])) {
+		exported = "X" + exported
+	}
+	return exported
+}
+
+// _ParamName turns an argument name into a Go parameter name, or returns
+// an empty string if it can not be one.
+func _ParamName(name string) string {
+	exported := _ExportedName(name)
+	if exported == "" {
+		return ""
+	}
+	param := strings.ToLower(exported[:1]) + exported[1:]
+	if token.IsKeyword(param) || reservedNames[param] || !token.IsIdentifier(param) {
+		return ""
+	}
+	return param
+}
+
+// _ConstName turns a Go name like "NetworkManager" into "NETWORK_MANAGER".
+func _ConstName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(rune(name[i-1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
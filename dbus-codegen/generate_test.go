@@ -0,0 +1,135 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	data, e := ioutil.ReadFile("testdata/calc.xml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	ifaces, e := _ParseIntrospection(data)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if len(ifaces) != 2 || ifaces[0].Name != "org.example.Calc" || ifaces[1].Name != "org.example.other.Calc" {
+		t.Fatal("#2 Failed:", ifaces)
+	}
+	g, e := _NewGenerator("calc", ifaces, true, false)
+	if e != nil {
+		t.Fatal("#3 Failed:", e)
+	}
+	if g.typeNames["org.example.Calc"] != "Calc" || g.typeNames["org.example.other.Calc"] != "OtherCalc" {
+		t.Error("#4 Failed:", g.typeNames)
+	}
+	src, e := g.Generate()
+	if e != nil {
+		t.Fatal("#5 Failed:", e)
+	}
+	if _, e := parser.ParseFile(token.NewFileSet(), "calc.go", src, 0); e != nil {
+		t.Fatal("#6 Failed:", e)
+	}
+
+	code := string(src)
+	for i, expected := range []string{
+		`const CALC_INTERFACE = "org.example.Calc"`,
+		"func NewCalc(conn *dbus.Connection, dest, path string) *Calc {",
+		"func (p *Calc) Add(a int32, b int32) (sum int32, err error) {",
+		`p.conn.CallWithSignature(p.dest, p.path, CALC_INTERFACE, "Add", "ii", a, b)`,
+		"err = dbus.Store(ret, &sum)",
+		"func (p *Calc) Move(point struct {",
+		"by map[string]int32) (ret0 struct {",
+		"log []string, err error) {",
+		`p.conn.CallWithFlags(dbus.NO_REPLY_EXPECTED, p.dest, p.path, CALC_INTERFACE, "Reset", "")`,
+		"// Deprecated: marked as deprecated in the introspection data.\nfunc (p *Calc) Clear() (err error) {",
+		"type CalcChangedSignal struct {\n\tValue int32\n\tType  string\n}",
+		"// WatchChanged calls proc with the Changed signals of the object, sent by the\n// current owner of its destination.\nfunc (p *Calc) WatchChanged(proc func(*CalcChangedSignal)) (*dbus.SignalHandler, error) {",
+		`mr := &dbus.MatchRule{Type: "signal", Sender: p.dest, Path: p.path, Interface: CALC_INTERFACE, Member: "Changed"}`,
+		"dbus.Store(msg.Params, &signal.Value, &signal.Type)",
+		"func (p *Calc) GetPrecision() (value uint32, err error) {",
+		`dbus.Variant{Sig: "u", Value: value}`,
+		"func (p *Calc) GetMemory() (value map[string]dbus.Variant, err error) {",
+		"func (p *OtherCalc) Add(arg0 int32, arg1 dbus.ObjectPath) (err error) {",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("#%d Failed: %s", i+7, expected)
+		}
+	}
+	if strings.Contains(code, "SetMemory") || strings.Contains(code, "Introspect") {
+		t.Error("#24 Failed")
+	}
+}
+
+func TestGenerateServer(t *testing.T) {
+	data, e := ioutil.ReadFile("testdata/calc.xml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	ifaces, e := _ParseIntrospection(data)
+	if e != nil {
+		t.Fatal(e)
+	}
+	g, e := _NewGenerator("calc", ifaces, false, true)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	src, e := g.Generate()
+	if e != nil {
+		t.Fatal("#2 Failed:", e)
+	}
+	if _, e := parser.ParseFile(token.NewFileSet(), "calc.go", src, 0); e != nil {
+		t.Fatal("#3 Failed:", e)
+	}
+
+	code := string(src)
+	for i, expected := range []string{
+		`const CALC_INTERFACE = "org.example.Calc"`,
+		"type CalcServer interface {",
+		"\tAdd(a int32, b int32) (sum int32, err error)",
+		"func ExportCalc(conn *dbus.Connection, srv CalcServer, path string) error {",
+		`"Reset": srv.Reset,`,
+		"return conn.ExportMethods(methods, calcIntrospection, path, CALC_INTERFACE)",
+		"func EmitCalcChanged(conn *dbus.Connection, path string, value int32, arg1 string) error {",
+		`return conn.Emit(path, CALC_INTERFACE, "Changed", "is", value, arg1)`,
+		`<arg name="a" type="i" direction="in"/>`,
+		"type OtherCalcServer interface {",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("#%d Failed: %s", i+4, expected)
+		}
+	}
+	if strings.Contains(code, "NewCalc") || strings.Contains(code, "Precision") {
+		t.Error("#14 Failed")
+	}
+}
+
+func TestNames(t *testing.T) {
+	for name, expected := range map[string]string{"NameOwnerChanged": "NameOwnerChanged", "get_id": "GetId", "device-name": "DeviceName", "2fa": "X2fa", "login1": "Login1"} {
+		if exported := _ExportedName(name); exported != expected {
+			t.Error("#1 Failed:", name, exported)
+		}
+	}
+	for name, expected := range map[string]string{"xml_data": "xmlData", "type": "", "err": "", "Name": "name", "": ""} {
+		if param := _ParamName(name); param != expected {
+			t.Error("#2 Failed:", name, param)
+		}
+	}
+	for name, expected := range map[string]string{"NetworkManager": "NETWORK_MANAGER", "Calc": "CALC", "UDisks2": "UDISKS2"} {
+		if constName := _ConstName(name); constName != expected {
+			t.Error("#3 Failed:", name, constName)
+		}
+	}
+	for sig, expected := range map[string]string{"a{sv}": "map[string]dbus.Variant", "aay": "[][]byte", "h": "dbus.UnixFD"} {
+		if goType, e := _GoType(sig); e != nil || goType != expected {
+			t.Error("#4 Failed:", sig, goType, e)
+		}
+	}
+	if _, e := _GoType("ii"); e == nil {
+		t.Error("#5 Failed")
+	}
+}
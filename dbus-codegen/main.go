@@ -0,0 +1,135 @@
+// Command dbus-codegen generates typed Go clients of D-Bus interfaces from
+// their introspection data, read from a file or from an object on a bus:
+//
+//	dbus-codegen -package calc calc.xml > calc.go
+//	dbus-codegen -package notify -dest org.freedesktop.Notifications \
+//		-path /org/freedesktop/Notifications
+//
+// Each interface becomes a client type named after the last component of
+// the interface name, with a method for each method of the interface, a
+// Watch method and a struct for each signal, and Get and Set methods for
+// the properties. The standard interfaces the dbus package implements are
+// skipped.
+//
+// With -server, it also generates server skeletons: an interface for the
+// objects serving each interface to implement, a function exporting them
+// under the method names and with the introspection data of the interface,
+// and functions emitting its signals.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/norisatir/go-dbus"
+)
+
+var (
+	pkg        = flag.String("package", "main", "package of the generated code")
+	output     = flag.String("o", "", "file to write to instead of the standard output")
+	dest       = flag.String("dest", "", "introspect the object of this connection instead of reading a file")
+	path       = flag.String("path", "/", "path of the object introspected with -dest")
+	system     = flag.Bool("system", false, "introspect on the system bus instead of the session bus")
+	interfaces = flag.String("interfaces", "", "comma separated interfaces to generate, all by default")
+	client     = flag.Bool("client", true, "generate clients")
+	server     = flag.Bool("server", false, "generate server skeletons")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: dbus-codegen [flags] [file.xml]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if (*dest == "") == (flag.NArg() != 1) {
+		usage()
+	}
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "dbus-codegen:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var data []byte
+	var err error
+	if *dest != "" {
+		data, err = _IntrospectObject(*dest, *path, *system)
+	} else {
+		data, err = ioutil.ReadFile(flag.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+
+	ifaces, err := _ParseIntrospection(data)
+	if err != nil {
+		return err
+	}
+	if *interfaces != "" {
+		ifaces = _SelectInterfaces(ifaces, strings.Split(*interfaces, ","))
+	}
+	if len(ifaces) == 0 {
+		return errors.New("no interfaces to generate")
+	}
+	g, err := _NewGenerator(*pkg, ifaces, *client, *server)
+	if err != nil {
+		return err
+	}
+	src, err := g.Generate()
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(*output, src, 0644)
+}
+
+// _IntrospectObject returns the introspection document of the object at
+// path of the connection dest.
+func _IntrospectObject(dest, path string, system bool) ([]byte, error) {
+	bus := dbus.SessionBus
+	if system {
+		bus = dbus.SystemBus
+	}
+	conn, err := dbus.Connect(bus)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = conn.Initialize(); err != nil {
+		return nil, err
+	}
+	ret, err := conn.Call(dest, path, "org.freedesktop.DBus.Introspectable", "Introspect")
+	if err != nil {
+		return nil, err
+	}
+	var data string
+	if err = dbus.Store(ret, &data); err != nil {
+		return nil, err
+	}
+	return []byte(data), nil
+}
+
+// _SelectInterfaces returns the interfaces of ifaces named in names.
+func _SelectInterfaces(ifaces []interfaceXML, names []string) []interfaceXML {
+	selected := make([]interfaceXML, 0, len(names))
+	for _, iface := range ifaces {
+		for _, name := range names {
+			if iface.Name == strings.TrimSpace(name) {
+				selected = append(selected, iface)
+				break
+			}
+		}
+	}
+	return selected
+}
@@ -1,14 +1,36 @@
 package dbus
 
 import (
-	"bytes"
+	"bufio"
+	"context"
+	"encoding/binary"
 	"errors"
-	"fmt"
 	"net"
 	"os"
-	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrDuplicateHello is returned when Hello is called on a connection which
+// already sent it. The bus disconnects clients saying Hello twice.
+var ErrDuplicateHello = errors.New("DuplicateHello")
+
+// ErrTooManyPendingCalls is returned for method calls made while
+// MaxPendingCalls calls wait for their replies.
+var ErrTooManyPendingCalls = errors.New("TooManyPendingCalls")
+
+// ErrTooManyMatchRules is returned by AddSignalHandler once MaxMatchRules
+// handlers were added.
+var ErrTooManyMatchRules = errors.New("TooManyMatchRules")
+
+// ErrClosed is returned for calls made on a connection which was closed.
+var ErrClosed = errors.New("ConnectionClosed")
+
+// ErrCallTimeout is returned by method calls whose reply did not arrive
+// within the call timeout.
+var ErrCallTimeout = errors.New("CallTimeout")
+
 type StandardBus int
 
 const (
@@ -95,25 +117,217 @@ const dbusXMLIntro = `
   </interface>
 </node>`
 
-type signalHandler struct {
+// msgQueueSize is the number of received messages that may be queued ahead
+// of the dispatcher.
+const msgQueueSize = 64
+
+// methodCall is a call waiting for its reply. The callback is called with
+// nil if the connection fails first.
+type methodCall struct {
+	msg      *Message
+	sent     time.Time
+	callback func(*Message)
+}
+
+// SignalHandler is a handler added with AddSignalHandler, which can be
+// passed to RemoveSignalHandler.
+type SignalHandler struct {
 	mr   MatchRule
 	proc func(*Message)
+	seq  uint64
 }
 
+// A Connection is safe for concurrent use: methods may be called, signals
+// emitted and handlers added from any number of goroutines, including from
+// signal handlers. Its exported fields must be set before Initialize.
 type Connection struct {
+	// RecycleMessages makes the dispatcher reuse received signal messages
+	// once all handlers returned, which saves allocations for high signal
+	// rates. Handlers must then use Message.Clone to keep a message or its
+	// Params. It must be set before Initialize.
+	RecycleMessages bool
+
+	// ReadBufferSize is the initial size of the receive buffer, which grows
+	// to hold the largest message received. Zero selects
+	// DEFAULT_READ_BUFFER_SIZE.
+	ReadBufferSize int
+
+	// MaxReadBufferSize is the largest receive buffer kept between messages.
+	// After a larger message the buffer shrinks back to ReadBufferSize. Zero
+	// selects DEFAULT_MAX_READ_BUFFER_SIZE.
+	MaxReadBufferSize int
+
+	// WriteQueueSize is the number of outgoing messages which may wait for
+	// the writer. Zero selects DEFAULT_WRITE_QUEUE_SIZE.
+	WriteQueueSize int
+
+	// WriteQueuePolicy decides what sending does while the write queue is
+	// full.
+	WriteQueuePolicy QueuePolicy
+
+	// Authenticators are the SASL mechanisms tried in order until the
+	// server accepts one. Nil selects AuthExternal alone. It must be set
+	// before Initialize.
+	Authenticators []Authenticator
+
+	// AuthTimeout bounds the authentication handshake in Initialize, so that
+	// a server which accepts the connection but never answers does not
+	// block forever. Zero selects DEFAULT_AUTH_TIMEOUT, a negative value
+	// disables the timeout.
+	AuthTimeout time.Duration
+
+	// AllowAnonymous lets the other end of connections made with
+	// AcceptPeer authenticate with ANONYMOUS, rather than only with
+	// EXTERNAL as the same user. It must be set before Initialize.
+	AllowAnonymous bool
+
+	// CallTimeout bounds the wait for the reply of a method call, after
+	// which the call fails with ErrCallTimeout. Zero selects
+	// DEFAULT_CALL_TIMEOUT, a negative value disables the timeout.
+	// CallMethodWithTimeout overrides it for a single call.
+	CallTimeout time.Duration
+
+	// CallFlags are set on every method call the connection makes, like
+	// NO_AUTO_START or ALLOW_INTERACTIVE_AUTHORIZATION. NO_REPLY_EXPECTED
+	// is ignored there; CallWithFlags sets it for single calls.
+	CallFlags MessageFlag
+
+	// ByteOrder is the byte order of the messages sent which do not set
+	// their own. Nil selects little endian. Received messages are decoded
+	// in whichever byte order they were sent.
+	ByteOrder binary.ByteOrder
+
+	// MaxPendingCalls limits the method calls waiting for their replies.
+	// Zero means no limit.
+	MaxPendingCalls int
+
+	// MaxMatchRules limits the signal handlers which can be added,
+	// including those the connection adds to track the owners of
+	// well-known senders. Zero means no limit.
+	MaxMatchRules int
+
+	// MaxQueuedSignals limits the received signals waiting for the
+	// dispatcher. Once reached, further signals are dropped rather than
+	// stalling the receiver, and counted in DebugInfo and Stats. Replies
+	// are never dropped. Zero means signals wait for room in the queue. It
+	// must be set before Initialize.
+	MaxQueuedSignals int
+
+	// ViolationPolicy decides what happens to received messages which break
+	// the specification but can still be decoded.
+	ViolationPolicy ViolationPolicy
+
+	// OrphanedReply, if set, is called by the receiver with method returns
+	// and errors whose reply serial matches no pending call. They usually
+	// come from calls which timed out or were abandoned, or from a peer
+	// replying twice; Sender and ReplySerial identify them. It must be set
+	// before Initialize.
+	OrphanedReply func(msg *Message)
+
+	// NameAcquired and NameLost, if set, are called by the dispatcher when
+	// the bus reports that the connection got or lost a well-known name,
+	// like after RequestName. They must be set before Initialize.
+	NameAcquired func(name string)
+	NameLost     func(name string)
+
+	// Reconnect makes connections opened with Connect or ConnectWithDialer
+	// dial the bus again when the connection to it breaks, like when the
+	// bus restarts. Once authenticated, the connection says Hello, adds
+	// the match rules of its signal handlers and requests the names it
+	// held again before anything else is sent. Calls pending when it
+	// broke fail, and so do calls made until it is connected again. It
+	// must be set before Initialize.
+	Reconnect bool
+
+	// ReconnectDelay is the wait between attempts to reconnect. Zero
+	// selects DEFAULT_RECONNECT_DELAY.
+	ReconnectDelay time.Duration
+
+	// Reconnected, if set, is called once the connection was
+	// re-established after it broke with err. It must be set before
+	// Initialize.
+	Reconnected func(err error)
+
+	// Logger, if set, receives reports of what the connection cannot
+	// return to any caller: authentication and connection failures,
+	// dropped messages, replies nobody waits for and replies which could
+	// not be sent. It must be set before Initialize.
+	Logger Logger
+
+	// StateChanged, if set, is called with each change of the state of
+	// the connection, with the error which ended or broke it. Changes
+	// are delivered in order, but asynchronously, so the connection may
+	// have changed again meanwhile. It must be set before Initialize.
+	StateChanged func(state ConnectionState, err error)
+
 	addressMap        map[string]string
+	peer              bool
+	peerServer        bool
 	uniqName          string
-	methodCallReplies map[uint32](func(msg *Message))
-	signalMatchRules  []signalHandler
+	names             map[string]bool
+	requested         map[string]NameFlag
+	namesMutex        sync.Mutex
+	methodCallReplies replyTable
+	signalHandlers    handlerIndex
+	dispatchScratch   []*SignalHandler
+	matchesSent       bool
+	handlersMutex     sync.Mutex
+	msgChan           chan *Message
 	conn              net.Conn
-	buffer            *bytes.Buffer
+	serial            uint32
+	reader            *bufio.Reader
+	fdReader          *fdReader
+	unixFDs           bool
+	readBuffer        []byte
+	writeQueue        chan *writeRequest
 	proxy             *Interface
+	initOnce          sync.Once
+	initErr           error
+	helloSent         bool
+	droppedSignals    uint64
+	stats             connStats
+	closed            chan struct{}
+	closeErr          error
+	started           bool
+	state             ConnectionState
+	stateChanges      []stateChange
+	notifying         bool
+	monitor           chan *Message
+	monitoring        bool
+	filters           []*Filter
+	filtersMutex      sync.Mutex
+	shutdown          bool
+	dial              Dialer
+	address           string
+	workers           sync.WaitGroup
+	stateMutex        sync.Mutex
+	exports           map[string]map[string]*exportedInterface
+	managers          map[string]bool
+	exportsMutex      sync.Mutex
+	intros            map[introKey]Introspect
+	introWatches      map[string]uint64
+	introsMutex       sync.Mutex
+	owners            map[string]*nameOwner
+	ownersMutex       sync.Mutex
 }
 
 type Object struct {
+	conn  *Connection
 	dest  string
 	path  string
 	intro Introspect
+	mutex sync.Mutex
+}
+
+// _Introspect returns the introspection data of the object, introspecting
+// it on first use. Failures are retried on the next use.
+func (p *Object) _Introspect() Introspect {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.intro == nil && p.conn != nil {
+		p.intro = p.conn._CachedIntrospect(p.dest, p.path)
+	}
+	return p.intro
 }
 
 type Interface struct {
@@ -122,12 +336,22 @@ type Interface struct {
 	intro InterfaceData
 }
 
+// Connect opens a connection to the standard bus, which must be
+// initialized before use.
 func Connect(busType StandardBus) (*Connection, error) {
+	return ConnectWithDialer(busType, net.Dial)
+}
+
+// ConnectWithDialer opens a connection to the standard bus like Connect,
+// but opens its stream with dial.
+func ConnectWithDialer(busType StandardBus, dial Dialer) (*Connection, error) {
 	var address string
 
 	switch busType {
 	case SessionBus:
-		address = os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+		if address = os.Getenv("DBUS_SESSION_BUS_ADDRESS"); len(address) == 0 {
+			address = _SessionBusAddress()
+		}
 
 	case SystemBus:
 		if address = os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"); len(address) == 0 {
@@ -141,130 +365,660 @@ func Connect(busType StandardBus) (*Connection, error) {
 	if len(address) == 0 {
 		return nil, errors.New("Unknown bus address")
 	}
-	transport := address[:strings.Index(address, ":")]
-
 	bus := new(Connection)
-	bus.addressMap = make(map[string]string)
-	for _, pair := range strings.Split(address[len(transport)+1:], ",") {
-		pair := strings.Split(pair, "=")
-		bus.addressMap[pair[0]] = pair[1]
-	}
-
-	var ok bool
-	if address, ok = bus.addressMap["path"]; ok {
-	} else if address, ok = bus.addressMap["abstract"]; ok {
-		address = "@" + address
-	} else {
-		return nil, errors.New("Unknown address key")
-	}
-
 	var err error
-	if bus.conn, err = net.Dial(transport, address); err != nil {
+	if bus.conn, bus.addressMap, err = _Dial(dial, address); err != nil {
 		return nil, err
 	}
+	bus.dial = dial
+	bus.address = address
 
 	return bus, nil
 }
 
+// ConnectTo returns a connection over the established stream conn, like
+// one end of a socketpair or of an SSH tunnel. Initialize authenticates
+// over it as with connections Connect opens.
+func ConnectTo(conn net.Conn) *Connection {
+	bus := new(Connection)
+	bus.conn = conn
+	bus.addressMap = make(map[string]string)
+	return bus
+}
+
+// Initialize authenticates, says Hello to the bus and starts receiving
+// messages. Only the first call does so; later ones return its result.
 func (p *Connection) Initialize() error {
-	p.methodCallReplies = make(map[uint32]func(*Message))
-	p.signalMatchRules = make([]signalHandler, 0)
+	p.initOnce.Do(func() {
+		p.initErr = p._Initialize()
+	})
+	return p.initErr
+}
+
+func (p *Connection) _Initialize() error {
+	p.names = make(map[string]bool)
+	queueSize := msgQueueSize
+	if p.MaxQueuedSignals > queueSize {
+		queueSize = p.MaxQueuedSignals
+	}
+	p.msgChan = make(chan *Message, queueSize)
+	p.closed = make(chan struct{})
 	p.proxy = p._GetProxy()
-	p.buffer = bytes.NewBuffer([]byte{})
-	err := p._Auth()
+	var err error
+	if p.peerServer {
+		p.unixFDs, err = _AuthenticateClient(p.conn, p.AllowAnonymous, p._AuthTimeout())
+	} else {
+		p.unixFDs, err = p._Auth(p.conn)
+	}
 	if err != nil {
+		p._Logf("authentication failed: %v", err)
 		return err
 	}
-	go p._RunLoop()
-	p._SendHello()
+	p._InitReader()
+	p._StartWriter()
+	p.stateMutex.Lock()
+	p.started = true
+	p.stateMutex.Unlock()
+	p._Go(p._RunLoop)
+	if !p.peer {
+		if err := p._SendHello(); err != nil {
+			return err
+		}
+		if err := p._SendPendingMatches(); err != nil {
+			return err
+		}
+		if err := p._ResolveOwners(); err != nil {
+			return err
+		}
+	}
+	p.stateMutex.Lock()
+	p._ChangeState(STATE_CONNECTED, nil)
+	p.stateMutex.Unlock()
 	return nil
 }
 
-func (p *Connection) _Auth() error {
+// _Go runs worker, one of the goroutines serving the connection to the bus,
+// which _Reconnect waits for before replacing it.
+func (p *Connection) _Go(worker func()) {
+	p.workers.Add(1)
+	go func() {
+		defer p.workers.Done()
+		worker()
+	}()
+}
+
+// _Auth authenticates to the bus over conn and reports whether it agreed
+// to pass file descriptors.
+func (p *Connection) _Auth(conn net.Conn) (bool, error) {
 	auth := new(authState)
-	auth.AddAuthenticator(new(AuthExternal))
+	if p.Authenticators == nil {
+		auth.AddAuthenticator(new(AuthExternal))
+	}
+	for _, a := range p.Authenticators {
+		auth.AddAuthenticator(a)
+	}
+	_, auth.negotiateUnixFDs = conn.(*net.UnixConn)
+
+	err := auth.Authenticate(conn, p._AuthTimeout())
+	return auth.unixFDs, err
+}
+
+func (p *Connection) _AuthTimeout() time.Duration {
+	if p.AuthTimeout == 0 {
+		return DEFAULT_AUTH_TIMEOUT
+	}
+	return p.AuthTimeout
+}
+
+const DEFAULT_AUTH_TIMEOUT = 5 * time.Second
+
+// DEFAULT_CALL_TIMEOUT matches the default reply timeout of libdbus.
+const DEFAULT_CALL_TIMEOUT = 25 * time.Second
+
+// _CallTimeout returns the effective timeout for timeout, where zero selects
+// the connection's default. The result is zero if there is no timeout.
+func (p *Connection) _CallTimeout(timeout time.Duration) time.Duration {
+	if timeout == 0 {
+		timeout = p.CallTimeout
+	}
+	if timeout == 0 {
+		timeout = DEFAULT_CALL_TIMEOUT
+	}
+	if timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+const (
+	DEFAULT_READ_BUFFER_SIZE     = 4096
+	DEFAULT_MAX_READ_BUFFER_SIZE = 1 << 20
+)
+
+func (p *Connection) _InitReader() {
+	if p.ReadBufferSize <= 0 {
+		p.ReadBufferSize = DEFAULT_READ_BUFFER_SIZE
+	}
+	if p.MaxReadBufferSize <= 0 {
+		p.MaxReadBufferSize = DEFAULT_MAX_READ_BUFFER_SIZE
+	}
+	if p.unixFDs {
+		p.fdReader = _NewFDReader(p.conn.(*net.UnixConn))
+		p.reader = bufio.NewReaderSize(p.fdReader, p.ReadBufferSize)
+	} else {
+		p.reader = bufio.NewReaderSize(p.conn, p.ReadBufferSize)
+	}
+	p.readBuffer = make([]byte, p.ReadBufferSize)
+}
 
-	return auth.Authenticate(p.conn)
+// ViolationPolicy selects how a connection treats received messages which
+// break the specification.
+type ViolationPolicy int
+
+const (
+	VIOLATION_CLOSE ViolationPolicy = iota // close the connection
+	VIOLATION_DROP                         // discard the message
+	VIOLATION_LOG                          // log the violation and deliver the message
+)
+
+func (p *Connection) _MessageReceiver() {
+	defer func() {
+		if p.monitor != nil {
+			close(p.monitor)
+		}
+	}()
+	for {
+		msg, e := p._ReadMessage()
+		if e != nil {
+			p._Fail(e)
+			return
+		}
+		if !p._Filter(msg) {
+			continue
+		}
+		if p.monitor != nil {
+			select {
+			case p.monitor <- msg:
+			case <-p.closed:
+				return
+			}
+			continue
+		}
+		// Replies skip the dispatch queue, so that signal handlers can
+		// make calls without waiting for their own replies.
+		if (msg.Type == METHOD_RETURN || msg.Type == ERROR) && !p._IsEavesdropped(msg) {
+			p._MessageDispatch(msg)
+			continue
+		}
+		if msg.Type == SIGNAL && p.MaxQueuedSignals > 0 && len(p.msgChan) >= p.MaxQueuedSignals {
+			atomic.AddUint64(&p.droppedSignals, 1)
+			p._Logf("dropped signal %s.%s from %s: queue full", msg.Iface, msg.Member, msg.Sender)
+			_CloseFDs(msg)
+			if p.RecycleMessages {
+				_ReleaseMessage(msg)
+			}
+			continue
+		}
+		select {
+		case p.msgChan <- msg:
+		case <-p.closed:
+			return
+		}
+	}
 }
 
-func (p *Connection) _MessageReceiver(msgChan chan *Message) {
+// _ReadMessage reads the next message from the socket, dropping those which
+// break the specification if ViolationPolicy says so.
+func (p *Connection) _ReadMessage() (*Message, error) {
 	for {
-		msg, e := p._PopMessage()
-		if e == nil {
-			msgChan <- msg
-			continue // might be another msg in p.buffer
+		buff, e := _ReadMessageInto(p.reader, p.readBuffer)
+		if e != nil {
+			return nil, e
+		}
+		msg := NewMessage()
+		if p.RecycleMessages {
+			msg = _GetPooledMessage()
+		}
+		if p.fdReader != nil {
+			msg.fds = p.fdReader.fds
+		}
+		// Messages are framed by the lengths in their header, so a
+		// malformed one leaves no safe point to resume reading at.
+		_, aliased, e := _UnmarshalAliasing(msg, buff)
+		// Buffers which large byte arrays of the message point into are
+		// left to it, like those too large to keep between messages.
+		if aliased || cap(buff) > p.MaxReadBufferSize {
+			p.readBuffer = make([]byte, p.ReadBufferSize)
+		} else {
+			p.readBuffer = buff
+		}
+		if p.fdReader != nil {
+			p.fdReader._Take(len(msg.fds))
+		}
+		if _, ok := e.(*ViolationError); e == nil || ok {
+			p.stats._CountReceived(msg.Type, len(buff))
+		} else {
+			p.stats._CountReceived(INVALID, len(buff))
+		}
+		if v, ok := e.(*ViolationError); ok {
+			switch p.ViolationPolicy {
+			case VIOLATION_DROP:
+				p._Logf("dropped message: %v in %s from %s", v, msg.Member, msg.Sender)
+				_CloseFDs(msg)
+				if p.RecycleMessages {
+					_ReleaseMessage(msg)
+				}
+				continue
+			case VIOLATION_LOG:
+				p._LogViolation(v, msg)
+				e = nil
+			}
+		}
+		if e != nil {
+			return nil, e
 		}
-		p._UpdateBuffer()
+		return msg, nil
 	}
 }
 
 func (p *Connection) _RunLoop() {
-	msgChan := make(chan *Message)
-	go p._MessageReceiver(msgChan)
+	p._Go(p._MessageReceiver)
 	for {
 		select {
-		case msg := <-msgChan:
+		case msg := <-p.msgChan:
 			p._MessageDispatch(msg)
+		case <-p.closed:
+			return
+		}
+	}
+}
+
+// Done returns a channel which is closed once the connection failed or
+// was closed. Err then returns the reason. Once a connection with Reconnect
+// set is connected again, Done returns a new channel.
+func (p *Connection) Done() <-chan struct{} {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	return p.closed
+}
+
+// Err returns the error which ended the connection, like io.EOF if the bus
+// hung up, or nil while it is usable. With Reconnect set, it returns the
+// error until the connection is re-established.
+func (p *Connection) Err() error {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	return p.closeErr
+}
+
+// Close closes the connection. The receiver, writer and dispatcher stop,
+// pending calls fail with ErrClosed, and so do calls made afterwards. It
+// does not wait for signal handlers which are running to return, so it may
+// be called from one. It also stops a connection with Reconnect set from
+// reconnecting.
+func (p *Connection) Close() error {
+	p.stateMutex.Lock()
+	p.shutdown = true
+	if p.closeErr != nil {
+		// Reconnecting; calls fail with ErrClosed from now on.
+		p.closeErr = ErrClosed
+		p._ChangeState(STATE_DISCONNECTED, ErrClosed)
+	}
+	p.stateMutex.Unlock()
+	p._Fail(ErrClosed)
+	return nil
+}
+
+// _Fail marks the connection as ended by err, closes the socket, which
+// stops the receiver, writer and dispatcher, and fails all pending calls.
+// Only the first error is kept. Connections with Reconnect set which were
+// connected start reconnecting, unless they were closed.
+func (p *Connection) _Fail(err error) {
+	p.stateMutex.Lock()
+	if p.closeErr != nil {
+		p.stateMutex.Unlock()
+		return
+	}
+	p.closeErr = err
+	if p.closed != nil {
+		close(p.closed)
+	}
+	conn := p.conn
+	if err != ErrClosed {
+		p._Logf("connection failed: %v", err)
+	}
+	reconnect := p.Reconnect && p.dial != nil && p.state == STATE_CONNECTED && !p.shutdown && !p.monitoring
+	if reconnect {
+		p._ChangeState(STATE_RECONNECTING, err)
+	} else {
+		p._ChangeState(STATE_DISCONNECTED, err)
+	}
+	p.stateMutex.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+
+	serials := make([]uint32, 0)
+	p.methodCallReplies.Range(func(serial uint32, call *methodCall) {
+		serials = append(serials, serial)
+	})
+	for _, serial := range serials {
+		if call, ok := p.methodCallReplies.Remove(serial); ok {
+			call.callback(nil)
 		}
 	}
+	if reconnect {
+		go p._Reconnect(err)
+	}
+}
+
+// _CallErr returns the error failing calls which were pending when the
+// connection ended. The connection may have been re-established meanwhile,
+// which does not bring back their replies.
+func (p *Connection) _CallErr() error {
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return ErrDisconnected
 }
 
 func (p *Connection) _MessageDispatch(msg *Message) {
 	if msg == nil {
 		return
 	}
+	if p._IsEavesdropped(msg) {
+		p._DispatchToHandlers(msg, true)
+		return
+	}
 
 	switch msg.Type {
-	case METHOD_RETURN:
+	case METHOD_CALL:
+		p._HandleMethodCall(msg)
+	case METHOD_RETURN, ERROR:
 		rs := msg.replySerial
-		if replyFunc, ok := p.methodCallReplies[rs]; ok {
-			replyFunc(msg)
-			delete(p.methodCallReplies, rs)
+		if call, ok := p.methodCallReplies.Remove(rs); ok {
+			p.stats._CountReply(call)
+			call.callback(msg)
+		} else if p.OrphanedReply != nil {
+			p.OrphanedReply(msg)
+		} else {
+			p._Logf("reply to unknown serial %d from %s", rs, msg.Sender)
 		}
 	case SIGNAL:
-		for _, handler := range p.signalMatchRules {
-			if handler.mr._Match(msg) {
-				handler.proc(msg)
-			}
+		if !p.peer {
+			p._UpdateOwnedNames(msg)
 		}
-	case ERROR:
-		fmt.Println("ERROR")
+		p._DispatchToHandlers(msg, false)
 	}
 }
 
-func (p *Connection) _PopMessage() (*Message, error) {
-	msg, n, err := _Unmarshal(p.buffer.Bytes())
-	if err != nil {
-		return nil, err
+// _DispatchToHandlers calls the handlers whose rules match msg. Messages
+// addressed to other connections, which the bus only sends for rules with
+// Eavesdrop set, are only passed to the handlers of such rules, whatever
+// their type. Rules whose sender is a well-known name only match the
+// messages of its owner.
+func (p *Connection) _DispatchToHandlers(msg *Message, eavesdropped bool) {
+	p.handlersMutex.Lock()
+	handlers := p.signalHandlers.Lookup(p.dispatchScratch[:0], msg)
+	p.handlersMutex.Unlock()
+	for _, handler := range handlers {
+		if (!eavesdropped || handler.mr.Eavesdrop) && p._IsFromSender(msg, handler.mr.Sender) {
+			handler.proc(msg)
+		}
+	}
+	p.dispatchScratch = handlers
+	if p.RecycleMessages {
+		_ReleaseMessage(msg)
 	}
-	p.buffer.Read(make([]byte, n)) // remove first n bytes
-	return msg, nil
 }
 
-func (p *Connection) _UpdateBuffer() error {
-	//	_, e := p.buffer.ReadFrom(p.conn);
-	buff := make([]byte, 4096)
-	n, e := p.conn.Read(buff)
-	p.buffer.Write(buff[0:n])
-	return e
+// _IsEavesdropped reports whether msg is addressed to another connection.
+// Nothing is until the bus assigned the connection its unique name.
+func (p *Connection) _IsEavesdropped(msg *Message) bool {
+	if p.peer || msg.Dest == "" {
+		return false
+	}
+	p.namesMutex.Lock()
+	defer p.namesMutex.Unlock()
+	return p.uniqName != "" && msg.Dest != p.uniqName && !p.names[msg.Dest]
 }
 
-func (p *Connection) _SendSync(msg *Message, callback func(*Message)) error {
-	seri := uint32(msg.serial)
-	recvChan := make(chan int)
-	p.methodCallReplies[seri] = func(rmsg *Message) {
-		callback(rmsg)
-		recvChan <- 0
+// _UpdateOwnedNames tracks the well-known names held by the connection from
+// the NameAcquired and NameLost signals the bus sends to it.
+func (p *Connection) _UpdateOwnedNames(msg *Message) {
+	// Any peer can send signals to the connection, so only those of the
+	// bus itself are trusted.
+	if msg.Sender != "org.freedesktop.DBus" || msg.Iface != "org.freedesktop.DBus" || len(msg.Params) == 0 {
+		return
+	}
+	name, ok := msg.Params[0].(string)
+	if !ok {
+		return
+	}
+
+	var notify func(string)
+	p.namesMutex.Lock()
+	// Signals addressed to another connection, as eavesdropped, do not
+	// concern this one. The unique name is only unknown before the reply
+	// to Hello.
+	if msg.Dest != "" && p.uniqName != "" && msg.Dest != p.uniqName {
+		p.namesMutex.Unlock()
+		return
+	}
+	switch msg.Member {
+	case "NameAcquired":
+		p.names[name] = true
+		notify = p.NameAcquired
+	case "NameLost":
+		delete(p.names, name)
+		notify = p.NameLost
+	}
+	p.namesMutex.Unlock()
+	if notify != nil {
+		notify(name)
+	}
+}
+
+// UniqueName returns the unique name the bus assigned to the connection, or
+// an empty string before Initialize.
+func (p *Connection) UniqueName() string {
+	p.namesMutex.Lock()
+	defer p.namesMutex.Unlock()
+	return p.uniqName
+}
+
+// _IsSelf reports whether dest is the unique name of the connection or one of
+// the well-known names it owns.
+func (p *Connection) _IsSelf(dest string) bool {
+	p.namesMutex.Lock()
+	defer p.namesMutex.Unlock()
+	return dest != "" && (dest == p.uniqName || p.names[dest])
+}
+
+// _NextSerial returns the serial for the next message sent on the
+// connection. Serials must not be 0, so that is skipped when the counter
+// wraps around.
+func (p *Connection) _NextSerial() uint32 {
+	for {
+		if serial := atomic.AddUint32(&p.serial, 1); serial != 0 {
+			return serial
+		}
+	}
+}
+
+// _AddPendingCall assigns msg a serial and registers callback for its
+// reply. Once the counter wrapped around, serials of calls still waiting for
+// their replies are skipped, since their replies could not be told apart.
+func (p *Connection) _AddPendingCall(msg *Message, callback func(*Message)) {
+	call := &methodCall{msg, time.Now(), callback}
+	for {
+		msg.serial = p._NextSerial()
+		if p.methodCallReplies.Add(msg.serial, call) {
+			return
+		}
 	}
+}
 
-	buff, _ := msg._Marshal()
-	p.conn.Write(buff)
-	<-recvChan // synchronize
+// _SendAsync registers callback for the reply to msg and queues msg without
+// waiting for the reply. If done is not nil, the result of the write is sent
+// to it.
+func (p *Connection) _SendAsync(msg *Message, callback func(*Message), done chan error) error {
+	if p._IsHello(msg) && !p._ClaimHello() {
+		return ErrDuplicateHello
+	}
+	if p.MaxPendingCalls > 0 && p.methodCallReplies.Len() >= p.MaxPendingCalls {
+		return ErrTooManyPendingCalls
+	}
+
+	p._AddPendingCall(msg, callback)
+	// Calls added after _Fail drained the table would never complete.
+	if err := p.Err(); err != nil {
+		p.methodCallReplies.Remove(msg.serial)
+		return err
+	}
+	if p._IsSelf(msg.Dest) {
+		if err := p._CallSelf(msg); err != nil {
+			p.methodCallReplies.Remove(msg.serial)
+			return err
+		}
+		if done != nil {
+			done <- nil
+		}
+		return nil
+	}
+	if err := p._QueueMessage(msg, done); err != nil {
+		p.methodCallReplies.Remove(msg.serial)
+		return err
+	}
 	return nil
 }
 
+// _SendSync sends msg and waits for the reply, which is passed to callback.
+// Error replies are returned as errors instead.
+func (p *Connection) _SendSync(msg *Message, callback func(*Message)) error {
+	return p._SendSyncContext(context.Background(), msg, 0, callback)
+}
+
+// _SendSyncContext works like _SendSync, but gives up waiting once ctx is
+// done or the call timeout passes. The call is then unregistered, so a late
+// reply is an orphan.
+func (p *Connection) _SendSyncContext(ctx context.Context, msg *Message, timeout time.Duration, callback func(*Message)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var expired <-chan time.Time
+	if timeout = p._CallTimeout(timeout); timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	replies := make(chan *Message, 1)
+	done := make(chan error, 1)
+	err := p._SendAsync(msg, func(rmsg *Message) {
+		replies <- rmsg
+	}, done)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				p.methodCallReplies.Remove(msg.serial)
+				return err
+			}
+			done = nil
+		case rmsg := <-replies:
+			if rmsg == nil {
+				return p._CallErr()
+			}
+			if rmsg.Type == ERROR {
+				return _ReplyError(rmsg)
+			}
+			callback(rmsg)
+			return nil
+		case <-ctx.Done():
+			if _, ok := p.methodCallReplies.Remove(msg.serial); ok {
+				return ctx.Err()
+			}
+			// The reply arrived meanwhile and is being delivered.
+			ctx = context.Background()
+		case <-expired:
+			if _, ok := p.methodCallReplies.Remove(msg.serial); ok {
+				return ErrCallTimeout
+			}
+			expired = nil
+		}
+	}
+}
+
+// _AddMatches registers rules with the bus. The AddMatch calls are all sent
+// before waiting for any reply, so large rule sets only cost one round trip.
+// It returns the first error, of sending a call or replied by the bus.
+func (p *Connection) _AddMatches(rules []string) error {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var firstErr error
+	fail := func(err error) {
+		mutex.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mutex.Unlock()
+	}
+	for _, rule := range rules {
+		msg, err := p._NewMethodCall(p.proxy, "AddMatch", rule)
+		if err != nil {
+			fail(err)
+			break
+		}
+		wg.Add(1)
+		err = p._SendAsync(msg, func(reply *Message) {
+			if reply == nil {
+				fail(p._CallErr())
+			} else if reply.Type == ERROR {
+				fail(_ReplyError(reply))
+			}
+			wg.Done()
+		}, nil)
+		if err != nil {
+			wg.Done()
+			fail(err)
+			break
+		}
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// _IsHello reports whether msg calls the Hello method of the bus.
+func (p *Connection) _IsHello(msg *Message) bool {
+	return msg.Dest == "org.freedesktop.DBus" && msg.Member == "Hello" &&
+		(msg.Iface == "" || msg.Iface == "org.freedesktop.DBus")
+}
+
+// _ClaimHello marks Hello as sent and reports whether it was not before.
+func (p *Connection) _ClaimHello() bool {
+	p.namesMutex.Lock()
+	defer p.namesMutex.Unlock()
+	sent := p.helloSent
+	p.helloSent = true
+	return !sent
+}
+
 func (p *Connection) _SendHello() error {
-	p.CallMethod(p.proxy, "Hello")
+	ret, err := p.CallMethod(p.proxy, "Hello")
+	if err != nil {
+		return err
+	}
+	if len(ret) > 0 {
+		name, _ := ret[0].(string)
+		p.namesMutex.Lock()
+		p.uniqName = name
+		p.namesMutex.Unlock()
+	}
 	return nil
 }
 
@@ -291,7 +1045,11 @@ func (p *Connection) _GetIntrospect(dest string, path string) Introspect {
 
 func (p *Connection) Interface(obj *Object, name string) *Interface {
 
-	if obj == nil || obj.intro == nil {
+	if obj == nil {
+		return nil
+	}
+	intro := obj._Introspect()
+	if intro == nil {
 		return nil
 	}
 
@@ -299,7 +1057,7 @@ func (p *Connection) Interface(obj *Object, name string) *Interface {
 	iface.obj = obj
 	iface.name = name
 
-	data := obj.intro.GetInterfaceData(name)
+	data := intro.GetInterfaceData(name)
 	if nil == data {
 		return nil
 	}
@@ -323,30 +1081,192 @@ func (p *Connection) _GetProxy() *Interface {
 	return iface
 }
 
-func (p *Connection) CallMethod(iface *Interface, name string, args ...interface{}) ([]interface{}, error) {
+// _NewMethodCall returns a message calling the method name of iface.
+func (p *Connection) _NewMethodCall(iface *Interface, name string, args ...interface{}) (*Message, error) {
 	method := iface.intro.GetMethodData(name)
 	if nil == method {
 		return nil, errors.New("Invalid Method")
 	}
 
+	return _NewCall(iface.obj.dest, iface.obj.path, iface.name, name, method.GetInSignature(), args), nil
+}
+
+// _NewCall returns a method call message.
+func _NewCall(dest, path, iface, member, sig string, args []interface{}) *Message {
 	msg := NewMessage()
 
 	msg.Type = METHOD_CALL
-	msg.Path = iface.obj.path
-	msg.Iface = iface.name
-	msg.Dest = iface.obj.dest
-	msg.Member = name
-	msg.Sig = method.GetInSignature()
+	msg.Path = path
+	msg.Iface = iface
+	msg.Dest = dest
+	msg.Member = member
+	msg.Sig = sig
 	if len(args) > 0 {
 		msg.Params = args[:]
 	}
+	return msg
+}
+
+func (p *Connection) CallMethod(iface *Interface, name string, args ...interface{}) ([]interface{}, error) {
+	return p._CallMethod(context.Background(), 0, iface, name, args...)
+}
+
+// CallMethodWithContext works like CallMethod, but returns ctx.Err() if ctx
+// is canceled or its deadline passes before the reply arrives.
+func (p *Connection) CallMethodWithContext(ctx context.Context, iface *Interface, name string, args ...interface{}) ([]interface{}, error) {
+	return p._CallMethod(ctx, 0, iface, name, args...)
+}
+
+// CallMethodWithTimeout works like CallMethod, but waits at most timeout for
+// the reply instead of the connection's CallTimeout. A negative timeout
+// waits forever.
+func (p *Connection) CallMethodWithTimeout(timeout time.Duration, iface *Interface, name string, args ...interface{}) ([]interface{}, error) {
+	return p._CallMethod(context.Background(), timeout, iface, name, args...)
+}
+
+// CallMethodWithFlags works like CallMethod, but sets flags on the call
+// in addition to CallFlags. With NO_REPLY_EXPECTED, it returns once the call
+// was written without waiting for a reply.
+func (p *Connection) CallMethodWithFlags(flags MessageFlag, iface *Interface, name string, args ...interface{}) ([]interface{}, error) {
+	msg, err := p._NewMethodCall(iface, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	msg.Flags = flags
+	return p._Invoke(context.Background(), 0, msg)
+}
+
+func (p *Connection) _CallMethod(ctx context.Context, timeout time.Duration, iface *Interface, name string, args ...interface{}) ([]interface{}, error) {
+	msg, err := p._NewMethodCall(iface, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	return p._Invoke(ctx, timeout, msg)
+}
+
+// _Invoke sends the method call msg, with CallFlags added to its flags, and
+// returns the values of the reply. Calls flagged NO_REPLY_EXPECTED are not
+// tracked and return nothing once written.
+func (p *Connection) _Invoke(ctx context.Context, timeout time.Duration, msg *Message) ([]interface{}, error) {
+	msg.Flags |= p.CallFlags &^ NO_REPLY_EXPECTED
+	if msg.Flags&NO_REPLY_EXPECTED != 0 {
+		if p._IsSelf(msg.Dest) {
+			msg.serial = p._NextSerial()
+			return nil, p._CallSelf(msg)
+		}
+		return nil, p._SendUntracked(msg)
+	}
 
 	var ret []interface{}
-	p._SendSync(msg, func(reply *Message) {
+	err := p._SendSyncContext(ctx, msg, timeout, func(reply *Message) {
 		ret = reply.Params
 	})
+	return ret, err
+}
+
+// PendingCall is a method call made with CallMethodAsync.
+type PendingCall struct {
+	done chan struct{}
+	once sync.Once
+	ret  []interface{}
+	err  error
+}
+
+// Done returns a channel which is closed once the reply arrived or the call
+// failed.
+func (p *PendingCall) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait waits for the call to complete and returns the values of the reply.
+func (p *PendingCall) Wait() ([]interface{}, error) {
+	<-p.done
+	return p.ret, p.err
+}
+
+// _Complete sets the result of the call. Only the first result counts.
+func (p *PendingCall) _Complete(ret []interface{}, err error) {
+	p.once.Do(func() {
+		p.ret, p.err = ret, err
+		close(p.done)
+	})
+}
+
+// CallMethodAsync sends a method call and returns without waiting for the
+// reply, so that many calls can be in flight without a goroutine each. The
+// call fails with ErrCallTimeout after the connection's CallTimeout.
+func (p *Connection) CallMethodAsync(iface *Interface, name string, args ...interface{}) *PendingCall {
+	call := &PendingCall{done: make(chan struct{})}
+	msg, err := p._NewMethodCall(iface, name, args...)
+	if err != nil {
+		call._Complete(nil, err)
+		return call
+	}
+
+	timeout := p._CallTimeout(0)
+	var timer *time.Timer
+	if timeout > 0 {
+		// Armed only once the call is registered, but created first so
+		// that the reply callback can always stop it.
+		timer = time.AfterFunc(timeout, func() {
+			if _, ok := p.methodCallReplies.Remove(msg.serial); ok {
+				call._Complete(nil, ErrCallTimeout)
+			}
+		})
+		timer.Stop()
+	}
+	// Write errors close the connection, which fails the call.
+	err = p._SendAsync(msg, func(reply *Message) {
+		if timer != nil {
+			timer.Stop()
+		}
+		if reply == nil {
+			call._Complete(nil, p._CallErr())
+		} else if reply.Type == ERROR {
+			call._Complete(nil, _ReplyError(reply))
+		} else {
+			call._Complete(reply.Params, nil)
+		}
+	}, nil)
+	if err != nil {
+		call._Complete(nil, err)
+		return call
+	}
+	if timer != nil {
+		timer.Reset(timeout)
+	}
+	return call
+}
+
+// Call calls a method without introspecting the object first, so it also
+// works with services which do not implement Introspectable. The signature
+// of the arguments is inferred from their Go types; use CallWithSignature
+// where that is ambiguous, like for object paths. CallMethod remains the
+// way to call methods of an introspected Interface.
+func (p *Connection) Call(dest, path, iface, member string, args ...interface{}) ([]interface{}, error) {
+	sig, err := _InferSignature(args)
+	if err != nil {
+		return nil, err
+	}
+	return p.CallWithSignature(dest, path, iface, member, sig, args...)
+}
 
-	return ret, nil
+// CallWithSignature works like Call, but marshals args with the signature
+// sig.
+func (p *Connection) CallWithSignature(dest, path, iface, member, sig string, args ...interface{}) ([]interface{}, error) {
+	return p.CallWithFlags(0, dest, path, iface, member, sig, args...)
+}
+
+// CallWithFlags works like CallWithSignature, but sets flags on the call
+// in addition to CallFlags. With NO_REPLY_EXPECTED, it returns once the call
+// was written without waiting for a reply.
+func (p *Connection) CallWithFlags(flags MessageFlag, dest, path, iface, member, sig string, args ...interface{}) ([]interface{}, error) {
+	if err := _CheckArgs(sig, args); err != nil {
+		return nil, err
+	}
+	msg := _NewCall(dest, path, iface, member, sig, args)
+	msg.Flags = flags
+	return p._Invoke(context.Background(), 0, msg)
 }
 
 func (p *Connection) EmitSignal(iface *Interface, name string, args ...interface{}) error {
@@ -365,24 +1285,146 @@ func (p *Connection) EmitSignal(iface *Interface, name string, args ...interface
 	msg.Member = name
 	msg.Sig = signal.GetSignature()
 	msg.Params = args[:]
+	return p._SendUntracked(msg)
+}
+
+// Emit broadcasts the signal member of the interface iface from the object
+// at path, with args marshalled with the signature sig, without needing
+// introspection data like EmitSignal. Nothing is sent before Initialize.
+func (p *Connection) Emit(path, iface, member, sig string, args ...interface{}) error {
+	if err := _CheckArgs(sig, args); err != nil {
+		return err
+	}
+	return p._EmitSignal(path, iface, member, sig, args...)
+}
 
-	buff, _ := msg._Marshal()
-	_, err := p.conn.Write(buff)
+// _EmitSignal broadcasts a signal from the object at path. Nothing is sent
+// before Initialize, as there is nobody to receive it yet.
+func (p *Connection) _EmitSignal(path, iface, member, sig string, args ...interface{}) error {
+	p.stateMutex.Lock()
+	started := p.started
+	p.stateMutex.Unlock()
+	if !started {
+		return nil
+	}
 
-	return err
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = path
+	msg.Iface = iface
+	msg.Member = member
+	msg.Sig = sig
+	msg.Params = args
+	return p._SendUntracked(msg)
 }
 
+// _SendUntracked queues msg, a signal or a call expecting no reply, and
+// waits until it is written.
+func (p *Connection) _SendUntracked(msg *Message) error {
+	msg.serial = p._NextSerial()
+
+	closed := p.Done()
+	done := make(chan error, 1)
+	if err := p._QueueMessage(msg, done); err != nil {
+		return err
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-closed:
+		return p._CallErr()
+	}
+}
+
+// GetObject returns the object at path of dest. It is introspected when
+// Interface first looks up one of its interfaces, so that objects only
+// addressed by name with Call cost no round trip. Introspection data is
+// cached until the owner of dest changes or InvalidateIntrospection drops
+// it.
 func (p *Connection) GetObject(dest string, path string) *Object {
 
 	obj := new(Object)
+	obj.conn = p
 	obj.path = path
 	obj.dest = dest
-	obj.intro = p._GetIntrospect(dest, path)
 
 	return obj
 }
 
-func (p *Connection) AddSignalHandler(mr *MatchRule, proc func(*Message)) {
-	p.signalMatchRules = append(p.signalMatchRules, signalHandler{*mr, proc})
-	p.CallMethod(p.proxy, "AddMatch", mr._ToString())
+// AddSignalHandler registers proc to be called for signals matching mr, and
+// adds mr to the match rules of the bus. Handlers may be added before
+// Initialize, their rules are then registered together once connected.
+// It fails with ErrTooManyMatchRules once MaxMatchRules handlers were added,
+// or with the error of AddMatch.
+//
+// Signals carry the unique name of their sender. For a rule whose sender is
+// a well-known name, the connection tracks the owner of the name with a
+// NameOwnerChanged handler of its own, and only passes proc the signals of
+// the current owner, including those the bus delivers for broader rules or
+// sends directly to the connection.
+func (p *Connection) AddSignalHandler(mr *MatchRule, proc func(*Message)) (*SignalHandler, error) {
+	handler := &SignalHandler{mr: *mr, proc: proc}
+	p.handlersMutex.Lock()
+	if p.MaxMatchRules > 0 && p.signalHandlers.Len() >= p.MaxMatchRules {
+		p.handlersMutex.Unlock()
+		return nil, ErrTooManyMatchRules
+	}
+	p.signalHandlers.Add(handler)
+	matchesSent := p.matchesSent
+	p.handlersMutex.Unlock()
+	if matchesSent {
+		if _, err := p.CallMethod(p.proxy, "AddMatch", mr._ToString()); err != nil {
+			p.handlersMutex.Lock()
+			p.signalHandlers.Remove(handler)
+			p.handlersMutex.Unlock()
+			return nil, err
+		}
+	}
+	if err := p._WatchSender(mr.Sender); err != nil {
+		p.RemoveSignalHandler(handler)
+		return nil, err
+	}
+	return handler, nil
+}
+
+// RemoveSignalHandler removes handlers added with AddSignalHandler, and
+// removes their match rules from the bus. Handlers which were removed
+// before are ignored. A signal being dispatched may still reach a handler
+// removed meanwhile. If RemoveMatch fails for some rules, the others are
+// still removed and the first error is returned.
+func (p *Connection) RemoveSignalHandler(handlers ...*SignalHandler) error {
+	removed := make([]*SignalHandler, 0, len(handlers))
+	p.handlersMutex.Lock()
+	for _, handler := range handlers {
+		if handler != nil && p.signalHandlers.Remove(handler) {
+			removed = append(removed, handler)
+		}
+	}
+	matchesSent := p.matchesSent
+	p.handlersMutex.Unlock()
+	var firstErr error
+	for _, handler := range removed {
+		if matchesSent {
+			if _, err := p.CallMethod(p.proxy, "RemoveMatch", handler.mr._ToString()); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		if err := p._UnwatchSender(handler.mr.Sender); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// _SendPendingMatches registers the rules of all handlers added before the
+// connection was initialized.
+func (p *Connection) _SendPendingMatches() error {
+	p.handlersMutex.Lock()
+	p.matchesSent = true
+	rules := make([]string, 0)
+	for _, handler := range p.signalHandlers.All() {
+		rules = append(rules, handler.mr._ToString())
+	}
+	p.handlersMutex.Unlock()
+	return p._AddMatches(rules)
 }
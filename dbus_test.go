@@ -1,7 +1,18 @@
 package dbus
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestDBus(t *testing.T) {
@@ -25,3 +36,1143 @@ func TestDBus(t *testing.T) {
 
 	con.CallMethod(inf, "Notify", "dbus.go", uint32(0), "info", "test", "test_body", []string{}, map[uint32]interface{}{}, int32(2000))
 }
+
+func TestSelfCall(t *testing.T) {
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Type == METHOD_CALL && msg.Dest != "org.freedesktop.DBus" {
+			t.Error("#1 Failed: self call sent to the bus:", msg.Member)
+		}
+		if msg.Member == "AddMatch" {
+			bus.Reply(msg, "")
+		}
+	})
+	if e := con.Export(testCalc{}, "/calc", "org.example.Calc"); e != nil {
+		t.Fatal(e)
+	}
+
+	ret, e := con.Call(con.UniqueName(), "/calc", "org.example.Calc", "Add", int32(1), int32(2))
+	if e != nil || len(ret) != 1 || ret[0] != int32(3) {
+		t.Error("#2 Failed:", ret, e)
+	}
+	if _, e := con.Call(con.UniqueName(), "/calc", "org.example.Calc", "Div", int32(1), int32(0)); e == nil {
+		t.Error("#3 Failed")
+	}
+
+	// Calls from the dispatcher, which handles incoming calls, do not
+	// wait for themselves.
+	results := make(chan error, 1)
+	if _, e := con.AddSignalHandler(&MatchRule{Member: "Changed"}, func(*Message) {
+		_, e := con.Call(con.UniqueName(), "/calc", "org.example.Calc", "Add", int32(1), int32(2))
+		results <- e
+	}); e != nil {
+		t.Fatal(e)
+	}
+	bus.Emit("/", "org.example.Iface", "Changed", "")
+	select {
+	case e := <-results:
+		if e != nil {
+			t.Error("#4 Failed:", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("#4 Failed: no reply")
+	}
+
+	if _, e := con.CallWithFlags(NO_REPLY_EXPECTED, con.UniqueName(), "/calc", "org.example.Calc", "Add", "ii", int32(1), int32(2)); e != nil {
+		t.Error("#5 Failed:", e)
+	}
+}
+
+func TestOwnedNames(t *testing.T) {
+	con := new(Connection)
+	con.names = make(map[string]bool)
+	con.uniqName = ":1.42"
+
+	acquired := NewMessage()
+	acquired.Type = SIGNAL
+	acquired.Sender = "org.freedesktop.DBus"
+	acquired.Dest = ":1.42"
+	acquired.Iface = "org.freedesktop.DBus"
+	acquired.Member = "NameAcquired"
+	acquired.Params = []interface{}{"org.example.Foo"}
+	con._UpdateOwnedNames(acquired)
+	if !con._IsSelf("org.example.Foo") {
+		t.Error("#1 Failed")
+	}
+
+	acquired.Member = "NameLost"
+	con._UpdateOwnedNames(acquired)
+	if con._IsSelf("org.example.Foo") {
+		t.Error("#2 Failed")
+	}
+
+	// Forged by another peer, or addressed to another connection.
+	acquired.Member = "NameAcquired"
+	acquired.Sender = ":1.66"
+	con._UpdateOwnedNames(acquired)
+	acquired.Sender = "org.freedesktop.DBus"
+	acquired.Dest = ":1.7"
+	con._UpdateOwnedNames(acquired)
+	if con._IsSelf("org.example.Foo") {
+		t.Error("#3 Failed")
+	}
+}
+
+func TestMessageReceiverSlowPeer(t *testing.T) {
+	client, server := net.Pipe()
+	con := new(Connection)
+	con.msgChan = make(chan *Message, msgQueueSize)
+	con.conn = client
+	con._InitReader()
+
+	done := make(chan int)
+	go func() {
+		con._MessageReceiver()
+		done <- 0
+	}()
+
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Member = "Foo"
+	buff, _ := msg._Marshal()
+	for _, b := range buff {
+		server.Write([]byte{b})
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case recv := <-con.msgChan:
+		if recv.Member != "Foo" {
+			t.Error("#1 Failed:", recv.Member)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("#1 Failed: no message")
+	}
+
+	server.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("#2 Failed: receiver did not stop")
+	}
+}
+
+func TestMessageReceiverMalformed(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	con := new(Connection)
+	con.msgChan = make(chan *Message, msgQueueSize)
+	con.conn = client
+	con._InitReader()
+
+	done := make(chan int)
+	go func() {
+		con._MessageReceiver()
+		done <- 0
+	}()
+
+	// A signal with signature "s" but a four byte body of zeros.
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Member = "Foo"
+	msg.Sig = "u"
+	msg.Params = []interface{}{uint32(0)}
+	buff, _ := msg._Marshal()
+	i := bytes.Index(buff, []byte("\x08\x01g\x00\x01u"))
+	buff[i+5] = 's'
+	go server.Write(buff)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("#1 Failed: receiver did not stop")
+	}
+	if _, ok := con.Err().(*MalformedError); !ok {
+		t.Error("#2 Failed:", con.Err())
+	}
+	if len(con.msgChan) != 0 {
+		t.Error("#3 Failed:", len(con.msgChan))
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	client, server := net.Pipe()
+	con := new(Connection)
+	con.conn = client
+
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Iface = "org.example.Iface"
+	msg.Member = "Foo"
+	msg.Sig = "ayuay"
+	large := make([]byte, largeArraySize+3)
+	large[len(large)-1] = 0xff
+	msg.Params = []interface{}{large, uint32(7), []interface{}{byte(1), byte(2), byte(3)}}
+
+	go con._WriteMessage(msg)
+	recv, e := _ReadMessage(server)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if recv.Member != "Foo" || len(recv.Params) != 3 {
+		t.Fatal("#2 Failed:", recv.Member, len(recv.Params))
+	}
+	if b := recv.Params[0].([]byte); !bytes.Equal(b, large) {
+		t.Error("#3 Failed:", len(b))
+	}
+	if recv.Params[1] != uint32(7) || !bytes.Equal(recv.Params[2].([]byte), []byte{1, 2, 3}) {
+		t.Error("#4 Failed:", recv.Params[1:])
+	}
+
+	var buff bytes.Buffer
+	r, _ := recv.ByteArrayReader(0)
+	if n, _ := r.WriteTo(&buff); n != int64(len(large)) {
+		t.Error("#5 Failed:", n)
+	}
+	if _, e := recv.ByteArrayReader(1); e != ErrNotByteArray {
+		t.Error("#6 Failed:", e)
+	}
+}
+
+func TestReceiveLargeByteArray(t *testing.T) {
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "AddMatch" {
+			bus.Reply(msg, "")
+		}
+	})
+	received := make(chan []byte, 2)
+	if _, e := con.AddSignalHandler(NewMatchRule().WithInterface("org.example.Thing"), func(msg *Message) {
+		received <- msg.Params[0].([]byte)
+	}); e != nil {
+		t.Fatal(e)
+	}
+
+	first := bytes.Repeat([]byte{1}, 2*largeArraySize)
+	second := bytes.Repeat([]byte{2}, 2*largeArraySize)
+	bus.Emit("/thing", "org.example.Thing", "Blob", "ay", first)
+	bus.Emit("/thing", "org.example.Thing", "Blob", "ay", second)
+	b1, b2 := <-received, <-received
+	// Sliced out of the receive buffer, which must not be reused.
+	if cap(b1) != len(b1) || !bytes.Equal(b1, first) {
+		t.Error("#1 Failed:", len(b1), cap(b1))
+	}
+	if !bytes.Equal(b2, second) {
+		t.Error("#2 Failed:", len(b2))
+	}
+}
+
+func TestNextSerial(t *testing.T) {
+	con := new(Connection)
+	if s := con._NextSerial(); s != 1 {
+		t.Error("#1 Failed:", s)
+	}
+
+	con.serial = 0xfffffffe
+	if s := con._NextSerial(); s != 0xffffffff {
+		t.Error("#2 Failed:", s)
+	}
+	if s := con._NextSerial(); s != 1 {
+		t.Error("#3 Failed:", s)
+	}
+
+	other := new(Connection)
+	if s := other._NextSerial(); s != 1 {
+		t.Error("#4 Failed:", s)
+	}
+}
+
+func TestPendingMatchesPipelined(t *testing.T) {
+	const n = 50
+	var calls []*Message
+	con, _ := newTestBus(t, func(bus *testBus, msg *Message) {
+		if msg.Member != "AddMatch" {
+			bus.Reply(msg, "")
+			return
+		}
+		// Only answer once every rule arrived, which would never happen
+		// if the client waited for each reply.
+		calls = append(calls, msg)
+		if len(calls) == n {
+			for _, call := range calls {
+				bus.Reply(call, "")
+			}
+		}
+	})
+
+	for i := 0; i < n; i++ {
+		con.AddSignalHandler(&MatchRule{Type: "signal", Member: fmt.Sprint("Member", i)}, func(*Message) {})
+	}
+
+	done := make(chan error)
+	go func() { done <- con.Initialize() }()
+	select {
+	case e := <-done:
+		if e != nil {
+			t.Fatal("#1 Failed:", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("#1 Failed: Initialize did not return")
+	}
+	if len(calls) != n || calls[n-1].Params[0] != "type='signal',member='Member49'" {
+		t.Error("#2 Failed:", len(calls))
+	}
+}
+
+func TestPendingMatchRefused(t *testing.T) {
+	con, _ := newTestBus(t, func(bus *testBus, msg *Message) {
+		switch {
+		case msg.Member == "AddMatch" && strings.Contains(msg.Params[0].(string), "eavesdrop"):
+			bus.Send(_NewErrorReply(msg, "org.freedesktop.DBus.Error.AccessDenied", "no eavesdropping"))
+		default:
+			bus.Reply(msg, "")
+		}
+	})
+	con.AddSignalHandler(&MatchRule{Type: "signal", Member: "Fine"}, func(*Message) {})
+	con.AddSignalHandler(&MatchRule{Type: "signal", Eavesdrop: true}, func(*Message) {})
+
+	e := con.Initialize()
+	if err, ok := e.(*Error); !ok || err.Name != "org.freedesktop.DBus.Error.AccessDenied" {
+		t.Error("#1 Failed:", e)
+	}
+}
+
+func TestReadBufferSizing(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	con := new(Connection)
+	con.msgChan = make(chan *Message)
+	con.conn = client
+	con.ReadBufferSize = 128
+	con.MaxReadBufferSize = 512
+	con._InitReader()
+	go con._MessageReceiver()
+
+	send := func(size int) *Message {
+		msg := NewMessage()
+		msg.Type = SIGNAL
+		msg.Path = "/org/example"
+		msg.Member = fmt.Sprint("Size", size)
+		msg.Sig = "s"
+		msg.Params = []interface{}{strings.Repeat("x", size)}
+		buff, _ := msg._Marshal()
+		go server.Write(buff)
+		return <-con.msgChan
+	}
+
+	first := send(10)
+	if cap(con.readBuffer) != 128 {
+		t.Error("#1 Failed:", cap(con.readBuffer))
+	}
+	send(300)
+	if cap(con.readBuffer) <= 128 || cap(con.readBuffer) > 512 {
+		t.Error("#2 Failed:", cap(con.readBuffer))
+	}
+	large := send(2000)
+	if cap(con.readBuffer) != 128 {
+		t.Error("#3 Failed:", cap(con.readBuffer))
+	}
+	if first.Member != "Size10" || len(first.Params[0].(string)) != 10 || len(large.Params[0].(string)) != 2000 {
+		t.Error("#4 Failed:", first.Member)
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	con, _ := newTestConnection(t, nil)
+	if name := con.UniqueName(); name != ":1.1" {
+		t.Error("#1 Failed:", name)
+	}
+}
+
+func TestConnectionLost(t *testing.T) {
+	con, _ := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "GetNameOwner" {
+			bus.conn.Close()
+		}
+	})
+
+	done := make(chan error)
+	go func() {
+		_, e := con.CallMethod(con.proxy, "GetNameOwner", "org.example.Name")
+		done <- e
+	}()
+	select {
+	case e := <-done:
+		if e == nil {
+			t.Error("#1 Failed: no error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("#1 Failed: call did not return")
+	}
+
+	select {
+	case <-con.Done():
+	case <-time.After(time.Second):
+		t.Fatal("#2 Failed: connection not closed")
+	}
+	if con.Err() == nil {
+		t.Error("#3 Failed")
+	}
+	if _, e := con.CallMethod(con.proxy, "GetNameOwner", "org.example.Name"); e == nil {
+		t.Error("#4 Failed: call on closed connection")
+	}
+}
+
+func TestOrphanedReply(t *testing.T) {
+	serials := make(chan uint32, 1)
+	con, _ := newTestBus(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "GetNameOwner" {
+			serials <- msg.Serial()
+			bus.Reply(msg, "s", ":1.2")
+			bus.Reply(msg, "s", ":1.2")
+		}
+	})
+	orphans := make(chan *Message, 1)
+	con.OrphanedReply = func(msg *Message) { orphans <- msg }
+	if e := con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+
+	if _, e := con.CallMethod(con.proxy, "GetNameOwner", "org.example.Name"); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	select {
+	case msg := <-orphans:
+		if serial := <-serials; msg.Type != METHOD_RETURN || msg.ReplySerial() != serial {
+			t.Error("#2 Failed:", msg.Type, msg.ReplySerial(), serial)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("#2 Failed: no orphaned reply")
+	}
+}
+
+func TestMessageReceiverSplit(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	con := new(Connection)
+	con.msgChan = make(chan *Message, msgQueueSize)
+	con.conn = client
+	con.ReadBufferSize = 64
+	con.MaxReadBufferSize = 256
+	con._InitReader()
+	go con._MessageReceiver()
+
+	rnd := rand.New(rand.NewSource(2))
+	msgs := _SplitTestMessages(rnd, 200, con.ReadBufferSize)
+	var buff bytes.Buffer
+	for _, msg := range msgs {
+		b, _ := msg._Marshal()
+		buff.Write(b)
+	}
+	go func() {
+		data := buff.Bytes()
+		for len(data) > 0 {
+			n := 1 + rnd.Intn(100)
+			if n > len(data) {
+				n = len(data)
+			}
+			if _, e := server.Write(data[:n]); e != nil {
+				return
+			}
+			data = data[n:]
+		}
+	}()
+
+	for i, want := range msgs {
+		select {
+		case got := <-con.msgChan:
+			_CheckSplitMessage(t, i, want, got)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("#%d Failed: no message", i)
+		}
+	}
+	if cap(con.readBuffer) > con.MaxReadBufferSize {
+		t.Error("#1 Failed:", cap(con.readBuffer))
+	}
+}
+
+func TestInitializeTwice(t *testing.T) {
+	con, _ := newTestConnection(t, nil)
+	if e := con.Initialize(); e != nil {
+		t.Error("#1 Failed:", e)
+	}
+	if name := con.UniqueName(); name != ":1.1" {
+		t.Error("#2 Failed:", name)
+	}
+	if _, e := con.CallMethod(con.proxy, "Hello"); e != ErrDuplicateHello {
+		t.Error("#3 Failed:", e)
+	}
+}
+
+func TestAuthTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go io.Copy(ioutil.Discard, server) // accept but never answer
+
+	con := new(Connection)
+	con.conn = client
+	con.AuthTimeout = 50 * time.Millisecond
+	done := make(chan error)
+	go func() { done <- con.Initialize() }()
+	select {
+	case e := <-done:
+		if e != ErrAuthTimeout {
+			t.Error("#1 Failed:", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("#1 Failed: Initialize did not return")
+	}
+}
+
+type testAuthenticator struct {
+	name      string
+	challenge string
+}
+
+func (p *testAuthenticator) Mechanism() string    { return p.name }
+func (p *testAuthenticator) Authenticate() string { return "" }
+func (p *testAuthenticator) HandleData(challenge string) (string, error) {
+	p.challenge = challenge
+	return "726573706f6e7365", nil
+}
+
+func TestAuthenticators(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	lines := make(chan string, 10)
+	go func() {
+		reader := bufio.NewReader(server)
+		reader.ReadByte()
+		replies := []string{"REJECTED TEST\r\n", "DATA 6368616c6c656e6765\r\n", "OK 0123456789abcdef0123456789abcdef\r\n"}
+		for _, reply := range replies {
+			line, e := reader.ReadString('\n')
+			if e != nil {
+				return
+			}
+			lines <- strings.TrimSpace(line)
+			server.Write([]byte(reply))
+		}
+		line, _ := reader.ReadString('\n')
+		lines <- strings.TrimSpace(line)
+	}()
+
+	auth := &testAuthenticator{name: "TEST"}
+	con := new(Connection)
+	con.conn = client
+	con.Authenticators = []Authenticator{&testAuthenticator{name: "OTHER"}, auth}
+	if _, e := con._Auth(client); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	expected := []string{"AUTH OTHER", "AUTH TEST", "DATA 726573706f6e7365", "BEGIN"}
+	for i, line := range expected {
+		if received := <-lines; received != line {
+			t.Error("#2 Failed:", i, received)
+		}
+	}
+	if auth.challenge != "6368616c6c656e6765" {
+		t.Error("#3 Failed:", auth.challenge)
+	}
+}
+
+func TestViolationPolicy(t *testing.T) {
+	receive := func(policy ViolationPolicy) (*Connection, *Message) {
+		client, server := net.Pipe()
+		t.Cleanup(func() { server.Close() })
+		con := new(Connection)
+		con.msgChan = make(chan *Message, msgQueueSize)
+		con.conn = client
+		con.ViolationPolicy = policy
+		con._InitReader()
+		go con._MessageReceiver()
+
+		server.Write(_ViolatingMessage("Bad"))
+		valid := NewMessage()
+		valid.Type = SIGNAL
+		valid.Path = "/org/example"
+		valid.Member = "Good"
+		buff, _ := valid._Marshal()
+		server.Write(buff)
+
+		select {
+		case msg := <-con.msgChan:
+			return con, msg
+		case <-time.After(100 * time.Millisecond):
+			return con, nil
+		}
+	}
+
+	con, msg := receive(VIOLATION_CLOSE)
+	if _, ok := con.Err().(*ViolationError); !ok || msg != nil {
+		t.Error("#1 Failed:", con.Err(), msg)
+	}
+	con, msg = receive(VIOLATION_DROP)
+	if con.Err() != nil || msg == nil || msg.Member != "Good" {
+		t.Error("#2 Failed:", con.Err(), msg)
+	}
+	con, msg = receive(VIOLATION_LOG)
+	if con.Err() != nil || msg == nil || msg.Member != "Bad" {
+		t.Error("#3 Failed:", con.Err(), msg)
+	}
+}
+
+func TestResourceLimits(t *testing.T) {
+	block := make(chan int)
+	con, bus := newTestBus(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "GetNameOwner" {
+			<-block
+		}
+		bus.Reply(msg, "s", ":1.2")
+	})
+	con.MaxPendingCalls = 1
+	con.MaxMatchRules = 1
+	con.MaxQueuedSignals = 2
+	if e := con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+
+	if _, e := con.AddSignalHandler(&MatchRule{Member: "Foo"}, func(*Message) {}); e != nil {
+		t.Error("#1 Failed:", e)
+	}
+	if _, e := con.AddSignalHandler(&MatchRule{Member: "Bar"}, func(*Message) {}); e != ErrTooManyMatchRules {
+		t.Error("#2 Failed:", e)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, e := con.CallMethod(con.proxy, "GetNameOwner", "org.example.Name")
+		done <- e
+	}()
+	for con.methodCallReplies.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, e := con.CallMethod(con.proxy, "ListNames"); e != ErrTooManyPendingCalls {
+		t.Error("#3 Failed:", e)
+	}
+	close(block)
+	if e := <-done; e != nil {
+		t.Error("#4 Failed:", e)
+	}
+
+	// Stall the dispatcher so that signals pile up.
+	stall := make(chan int)
+	con.handlersMutex.Lock()
+	go func() {
+		<-stall
+		con.handlersMutex.Unlock()
+	}()
+	for i := 0; i < 5; i++ {
+		bus.Emit("/org/example", "org.example.Iface", "Foo", "")
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadUint64(&con.droppedSignals) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(stall)
+	if n := con.DebugInfo().DroppedSignals; n == 0 {
+		t.Error("#5 Failed:", n)
+	}
+}
+
+func TestSerialCollision(t *testing.T) {
+	con := new(Connection)
+	// Calls made before the counter wrapped are still waiting.
+	for _, serial := range []uint32{1, 2, 4} {
+		con.methodCallReplies.Add(serial, &methodCall{})
+	}
+	con.serial = 0xfffffffd
+
+	var serials []uint32
+	for i := 0; i < 4; i++ {
+		msg := NewMessage()
+		con._AddPendingCall(msg, nil)
+		serials = append(serials, msg.Serial())
+	}
+	if fmt.Sprint(serials) != "[4294967294 4294967295 3 5]" {
+		t.Error("#1 Failed:", serials)
+	}
+
+	// Simulate a long lived connection by advancing the counter in large
+	// steps; replies are matched to the call with their serial each time.
+	con = new(Connection)
+	old := NewMessage()
+	con._AddPendingCall(old, nil)
+	for step := uint32(0); step < 4; step++ {
+		atomic.AddUint32(&con.serial, 0x40000000-1)
+		msg := NewMessage()
+		con._AddPendingCall(msg, nil)
+		if msg.Serial() == 0 || msg.Serial() == old.Serial() {
+			t.Errorf("#2-%d Failed: %d", step, msg.Serial())
+		}
+		con.methodCallReplies.Remove(msg.Serial())
+	}
+	if call, ok := con.methodCallReplies.Remove(old.Serial()); !ok || call.msg != old {
+		t.Error("#3 Failed")
+	}
+}
+
+func TestClose(t *testing.T) {
+	called := make(chan int)
+	con, _ := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "GetNameOwner" {
+			called <- 0 // never answered
+		}
+	})
+
+	done := make(chan error)
+	go func() {
+		_, e := con.CallMethod(con.proxy, "GetNameOwner", "org.example.Name")
+		done <- e
+	}()
+	<-called
+	if e := con.Close(); e != nil {
+		t.Error("#1 Failed:", e)
+	}
+	select {
+	case e := <-done:
+		if e != ErrClosed {
+			t.Error("#2 Failed:", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("#2 Failed: call not failed")
+	}
+	if con.Err() != ErrClosed || con.methodCallReplies.Len() != 0 {
+		t.Error("#3 Failed:", con.Err(), con.methodCallReplies.Len())
+	}
+	if _, e := con.CallMethod(con.proxy, "ListNames"); e != ErrClosed {
+		t.Error("#4 Failed:", e)
+	}
+	if e := con.Close(); e != nil {
+		t.Error("#5 Failed:", e)
+	}
+
+	// A connection closed before Initialize.
+	con, _ = newTestBus(t, nil)
+	con.Close()
+	if e := con.Initialize(); e == nil {
+		t.Error("#6 Failed")
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		switch msg.Member {
+		case "GetNameOwner":
+			bus.Reply(msg, "s", msg.Params[0])
+		case "AddMatch":
+			bus.Reply(msg, "")
+		}
+	})
+
+	// A handler which makes a call itself.
+	handled := make(chan error, 1)
+	con.AddSignalHandler(&MatchRule{Member: "Call"}, func(*Message) {
+		_, e := con.CallMethod(con.proxy, "GetNameOwner", "org.example.Handler")
+		handled <- e
+	})
+
+	const goroutines, calls = 16, 50
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func(g int) {
+			for i := 0; i < calls; i++ {
+				name := fmt.Sprintf("org.example.N%d_%d", g, i)
+				ret, e := con.CallMethod(con.proxy, "GetNameOwner", name)
+				if e != nil || len(ret) != 1 || ret[0] != name {
+					errs <- fmt.Errorf("call %s: %v %v", name, ret, e)
+					return
+				}
+				switch i % 10 {
+				case 0:
+					e = con.EmitSignal(con.proxy, "NameLost", name)
+				case 5:
+					_, e = con.AddSignalHandler(&MatchRule{Member: name}, func(*Message) {})
+				}
+				if e != nil {
+					errs <- e
+					return
+				}
+			}
+			errs <- nil
+		}(g)
+	}
+	bus.Emit("/org/example", "org.example.Iface", "Call", "")
+
+	for g := 0; g < goroutines; g++ {
+		select {
+		case e := <-errs:
+			if e != nil {
+				t.Error("#1 Failed:", e)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("#1 Failed: calls did not return")
+		}
+	}
+	select {
+	case e := <-handled:
+		if e != nil {
+			t.Error("#2 Failed:", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("#2 Failed: handler did not return")
+	}
+}
+
+func TestCallMethodWithContext(t *testing.T) {
+	calls := make(chan *Message, 1)
+	con, bus := newTestBus(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "GetNameOwner" {
+			calls <- msg // answered late
+		}
+	})
+	orphans := make(chan *Message, 1)
+	con.OrphanedReply = func(msg *Message) { orphans <- msg }
+	if e := con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, e := con.CallMethodWithContext(ctx, con.proxy, "GetNameOwner", "org.example.Name"); e != context.DeadlineExceeded {
+		t.Error("#1 Failed:", e)
+	}
+	if n := con.methodCallReplies.Len(); n != 0 {
+		t.Error("#2 Failed:", n)
+	}
+
+	bus.Reply(<-calls, "s", ":1.2")
+	select {
+	case <-orphans:
+	case <-time.After(time.Second):
+		t.Error("#3 Failed: late reply not orphaned")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, e := con.CallMethodWithContext(ctx, con.proxy, "GetNameOwner", "org.example.Name"); e != context.Canceled {
+		t.Error("#4 Failed:", e)
+	}
+}
+
+func TestCallMethodAsync(t *testing.T) {
+	var held []*Message
+	con, _ := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "GetConnectionUnixUser" {
+			bus.Send(_NewErrorReply(msg, "org.freedesktop.DBus.Error.NameHasNoOwner", "no owner"))
+		}
+		if msg.Member != "GetNameOwner" {
+			return
+		}
+		// Answer in reverse order once all calls arrived.
+		held = append(held, msg)
+		if len(held) == 10 {
+			for i := len(held) - 1; i >= 0; i-- {
+				bus.Reply(held[i], "s", held[i].Params[0])
+			}
+		}
+	})
+
+	calls := make([]*PendingCall, 10)
+	for i := range calls {
+		calls[i] = con.CallMethodAsync(con.proxy, "GetNameOwner", fmt.Sprint("org.example.N", i))
+	}
+	for i, call := range calls {
+		select {
+		case <-call.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("#%d Failed: no reply", i)
+		}
+		ret, e := call.Wait()
+		if e != nil || len(ret) != 1 || ret[0] != fmt.Sprint("org.example.N", i) {
+			t.Errorf("#%d Failed: %v %v", i, ret, e)
+		}
+	}
+
+	if _, e := con.CallMethodAsync(con.proxy, "NoSuchMethod").Wait(); e == nil {
+		t.Error("#11 Failed")
+	}
+	if _, e := con.CallMethodAsync(con.proxy, "GetConnectionUnixUser", ":1.2").Wait(); e == nil || e.Error() != "org.freedesktop.DBus.Error.NameHasNoOwner: no owner" {
+		t.Error("#12 Failed:", e)
+	}
+	con.Close()
+	if _, e := con.CallMethodAsync(con.proxy, "ListNames").Wait(); e != ErrClosed {
+		t.Error("#13 Failed:", e)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	calls := make(chan *Message, 4)
+	con, bus := newTestBus(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "GetNameOwner" {
+			calls <- msg // never answered in time
+		}
+	})
+	orphans := make(chan *Message, 4)
+	con.OrphanedReply = func(msg *Message) { orphans <- msg }
+	con.CallTimeout = 20 * time.Millisecond
+	if e := con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+
+	if _, e := con.CallMethod(con.proxy, "GetNameOwner", "org.example.Name"); e != ErrCallTimeout {
+		t.Error("#1 Failed:", e)
+	}
+	if _, e := con.CallMethodAsync(con.proxy, "GetNameOwner", "org.example.Name").Wait(); e != ErrCallTimeout {
+		t.Error("#2 Failed:", e)
+	}
+	if n := con.methodCallReplies.Len(); n != 0 {
+		t.Error("#3 Failed:", n)
+	}
+	for i := 0; i < 2; i++ {
+		bus.Reply(<-calls, "s", ":1.2")
+		select {
+		case <-orphans:
+		case <-time.After(time.Second):
+			t.Error("#4 Failed: late reply not orphaned")
+		}
+	}
+
+	// A per call timeout overrides the default.
+	go func() {
+		msg := <-calls
+		time.Sleep(50 * time.Millisecond)
+		bus.Reply(msg, "s", ":1.2")
+	}()
+	ret, e := con.CallMethodWithTimeout(time.Second, con.proxy, "GetNameOwner", "org.example.Name")
+	if e != nil || len(ret) != 1 || ret[0] != ":1.2" {
+		t.Error("#5 Failed:", ret, e)
+	}
+}
+
+func TestCall(t *testing.T) {
+	con, _ := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Iface != "org.example.Calc" {
+			return
+		}
+		switch msg.Sig {
+		case "ii":
+			bus.Reply(msg, "i", msg.Params[0].(int32)+msg.Params[1].(int32))
+		case "o":
+			bus.Reply(msg, "s", string(msg.Params[0].(ObjectPath)))
+		case "s":
+			bus.Send(_NewErrorReply(msg, "org.example.Error.Bad", "bad "+msg.Params[0].(string)))
+		}
+	})
+
+	ret, e := con.Call("org.example.Calc", "/calc", "org.example.Calc", "Add", int32(2), int32(3))
+	if e != nil || len(ret) != 1 || ret[0] != int32(5) {
+		t.Error("#1 Failed:", ret, e)
+	}
+	ret, e = con.CallWithSignature("org.example.Calc", "/calc", "org.example.Calc", "Path", "o", "/a/b")
+	if e != nil || len(ret) != 1 || ret[0] != "/a/b" {
+		t.Error("#2 Failed:", ret, e)
+	}
+	if _, e := con.Call("org.example.Calc", "/calc", "org.example.Calc", "Add", 2); e == nil {
+		t.Error("#3 Failed")
+	}
+	if _, e := con.CallWithSignature("org.example.Calc", "/calc", "org.example.Calc", "Add", "ii", int32(2)); e == nil {
+		t.Error("#4 Failed")
+	}
+	if _, e := con.CallWithSignature("org.example.Calc", "/calc", "org.example.Calc", "Add", "a", int32(2)); e == nil {
+		t.Error("#5 Failed")
+	}
+	if _, e := con.Call("org.example.Calc", "calc", "org.example.Calc", "Add"); e == nil {
+		t.Error("#6 Failed")
+	}
+	con.CallTimeout = -1
+	_, e = con.Call("org.example.Calc", "/calc", "org.example.Calc", "Add", "x")
+	if de, ok := e.(*Error); !ok || de.Name != "org.example.Error.Bad" || de.Message() != "bad x" {
+		t.Error("#7 Failed:", e)
+	}
+}
+
+func TestRemoveSignalHandler(t *testing.T) {
+	matches := make(chan *Message, 4)
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "AddMatch" || msg.Member == "RemoveMatch" {
+			matches <- msg
+			bus.Reply(msg, "")
+		}
+	})
+	signals := make(chan *Message, 4)
+	mr := &MatchRule{Type: "signal", Interface: "org.example.Iface", Member: "Changed"}
+	handler, e := con.AddSignalHandler(mr, func(msg *Message) { signals <- msg })
+	if e != nil {
+		t.Fatal(e)
+	}
+	<-matches
+
+	if e := con.RemoveSignalHandler(handler); e != nil {
+		t.Error("#1 Failed:", e)
+	}
+	if msg := <-matches; msg.Member != "RemoveMatch" || msg.Params[0] != mr._ToString() {
+		t.Error("#2 Failed:", msg.Member, msg.Params)
+	}
+	if e := con.RemoveSignalHandler(handler); e != nil {
+		t.Error("#3 Failed:", e)
+	}
+	select {
+	case msg := <-matches:
+		t.Error("#4 Failed:", msg.Member)
+	default:
+	}
+
+	// Signals are dispatched in order, so Changed is handled before Other.
+	others := make(chan *Message, 1)
+	if _, e := con.AddSignalHandler(&MatchRule{Member: "Other"}, func(msg *Message) { others <- msg }); e != nil {
+		t.Fatal(e)
+	}
+	<-matches
+	bus.Emit("/", "org.example.Iface", "Changed", "")
+	bus.Emit("/", "org.example.Iface", "Other", "")
+	select {
+	case <-others:
+	case <-time.After(time.Second):
+		t.Fatal("#5 Failed: no signal")
+	}
+	select {
+	case <-signals:
+		t.Error("#6 Failed: removed handler called")
+	default:
+	}
+}
+
+func TestSignalHandlerMatchErrors(t *testing.T) {
+	removed := make(chan string, 4)
+	con, _ := newTestConnection(t, func(bus *testBus, msg *Message) {
+		rule, _ := msg.Params[0].(string)
+		switch {
+		case strings.Contains(rule, "Refused"):
+			bus.Send(_NewErrorReply(msg, "org.freedesktop.DBus.Error.LimitsExceeded", "too many"))
+		case msg.Member == "RemoveMatch":
+			removed <- rule
+			bus.Send(_NewErrorReply(msg, "org.freedesktop.DBus.Error.MatchRuleNotFound", "gone"))
+		default:
+			bus.Reply(msg, "")
+		}
+	})
+
+	if handler, e := con.AddSignalHandler(&MatchRule{Member: "Refused"}, func(*Message) {}); e == nil || handler != nil {
+		t.Error("#1 Failed:", handler, e)
+	}
+	if n := con.signalHandlers.Len(); n != 0 {
+		t.Error("#2 Failed:", n)
+	}
+
+	first, _ := con.AddSignalHandler(&MatchRule{Member: "First"}, func(*Message) {})
+	second, _ := con.AddSignalHandler(&MatchRule{Member: "Second"}, func(*Message) {})
+	if e := con.RemoveSignalHandler(first, second); e == nil {
+		t.Error("#3 Failed")
+	}
+	if r1, r2 := <-removed, <-removed; r1 != "member='First'" || r2 != "member='Second'" {
+		t.Error("#4 Failed:", r1, r2)
+	}
+}
+
+type testCounter struct {
+	calls chan string
+}
+
+func (p *testCounter) Count(s string) { p.calls <- s }
+
+func TestCallFlags(t *testing.T) {
+	calls := make(chan *Message, 4)
+	con, _ := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Iface != "org.example.Iface" {
+			return
+		}
+		calls <- msg
+		if msg.Flags&NO_REPLY_EXPECTED == 0 {
+			bus.Reply(msg, "")
+		}
+	})
+	con.CallFlags = NO_AUTO_START | NO_REPLY_EXPECTED
+	if _, e := con.Call("org.example", "/org/example", "org.example.Iface", "Plain"); e != nil {
+		t.Error("#1 Failed:", e)
+	}
+	if msg := <-calls; msg.Flags != NO_AUTO_START {
+		t.Error("#2 Failed:", msg.Flags)
+	}
+	if _, e := con.CallWithFlags(ALLOW_INTERACTIVE_AUTHORIZATION, "org.example", "/org/example", "org.example.Iface", "Auth", ""); e != nil {
+		t.Error("#3 Failed:", e)
+	}
+	if msg := <-calls; msg.Flags != NO_AUTO_START|ALLOW_INTERACTIVE_AUTHORIZATION {
+		t.Error("#4 Failed:", msg.Flags)
+	}
+	ret, e := con.CallWithFlags(NO_REPLY_EXPECTED, "org.example", "/org/example", "org.example.Iface", "Quiet", "s", "x")
+	if e != nil || ret != nil || con.methodCallReplies.Len() != 0 {
+		t.Error("#5 Failed:", ret, e)
+	}
+	if msg := <-calls; msg.Flags != NO_AUTO_START|NO_REPLY_EXPECTED || msg.Member != "Quiet" {
+		t.Error("#6 Failed:", msg.Flags, msg.Member)
+	}
+
+	// Calls which expect no reply are still handled.
+	client, server := newTestPeers(t)
+	counter := &testCounter{make(chan string, 1)}
+	if e := server.Export(counter, "/counter", "org.example.Counter"); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := client.CallWithFlags(NO_REPLY_EXPECTED, "", "/counter", "org.example.Counter", "Count", "s", "one"); e != nil {
+		t.Error("#7 Failed:", e)
+	}
+	select {
+	case s := <-counter.calls:
+		if s != "one" {
+			t.Error("#8 Failed:", s)
+		}
+	case <-time.After(time.Second):
+		t.Error("#8 Failed: not called")
+	}
+}
+
+func TestEavesdrop(t *testing.T) {
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "AddMatch" {
+			bus.Reply(msg, "")
+		}
+	})
+	eavesdropped := make(chan *Message, 4)
+	if _, e := con.AddSignalHandler(NewMatchRule().WithInterface("org.example.Thing").WithEavesdrop(true), func(msg *Message) { eavesdropped <- msg }); e != nil {
+		t.Fatal(e)
+	}
+	received := make(chan *Message, 4)
+	if _, e := con.AddSignalHandler(NewMatchRule().WithInterface("org.example.Thing"), func(msg *Message) { received <- msg }); e != nil {
+		t.Fatal(e)
+	}
+
+	call := NewMessage()
+	call.Type = METHOD_CALL
+	call.Path = "/thing"
+	call.Iface = "org.example.Thing"
+	call.Member = "Frob"
+	call.Sender = ":1.7"
+	call.Dest = ":1.8"
+	bus.Send(call)
+	// A reply to another connection must not complete a call of ours with
+	// the same serial.
+	pending := con.CallMethodAsync(con.proxy, "ListNames")
+	reply := NewMessage()
+	reply.Type = METHOD_RETURN
+	reply.Iface = "org.example.Thing"
+	reply.replySerial = atomic.LoadUint32(&con.serial)
+	reply.Dest = ":1.7"
+	bus.Send(reply)
+	bus.Emit("/thing", "org.example.Thing", "Changed", "")
+
+	for i, expected := range []MessageType{METHOD_CALL, METHOD_RETURN, SIGNAL} {
+		if msg := <-eavesdropped; msg.Type != expected {
+			t.Error("#1 Failed:", i, msg.Type)
+		}
+	}
+	if msg := <-received; msg.Type != SIGNAL || msg.Member != "Changed" {
+		t.Error("#2 Failed:", msg.Type)
+	}
+	select {
+	case msg := <-received:
+		t.Error("#3 Failed:", msg.Type)
+	case <-pending.Done():
+		t.Error("#4 Failed: call completed by another reply")
+	default:
+	}
+}
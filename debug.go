@@ -0,0 +1,129 @@
+package dbus
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// PendingCallInfo describes a method call still waiting for its reply.
+type PendingCallInfo struct {
+	Serial uint32
+	Dest   string
+	Path   string
+	Iface  string
+	Member string
+	Age    time.Duration
+}
+
+// DebugInfo is a snapshot of the internal state of a Connection, meant for
+// diagnosing stuck services.
+type DebugInfo struct {
+	UniqueName    string
+	OwnedNames    []string
+	PendingCalls  []PendingCallInfo
+	MatchRules    []string
+	QueueLength   int
+	QueueCapacity int
+	// DroppedSignals counts the signals dropped because more than
+	// MaxQueuedSignals were waiting for the dispatcher.
+	DroppedSignals uint64
+	// Exports maps the paths of exported objects to their interfaces,
+	// including the object managers added with ExportObjectManager.
+	Exports map[string][]string
+}
+
+// DebugInfo returns a snapshot of the pending calls, registered match rules,
+// exported objects and dispatcher queue of the connection. Pending calls are
+// ordered oldest first, and interfaces by name.
+func (p *Connection) DebugInfo() DebugInfo {
+	info := DebugInfo{}
+	now := time.Now()
+
+	p.namesMutex.Lock()
+	info.UniqueName = p.uniqName
+	for name := range p.names {
+		info.OwnedNames = append(info.OwnedNames, name)
+	}
+	p.namesMutex.Unlock()
+	sort.Strings(info.OwnedNames)
+
+	p.methodCallReplies.Range(func(serial uint32, call *methodCall) {
+		info.PendingCalls = append(info.PendingCalls, PendingCallInfo{
+			Serial: serial,
+			Dest:   call.msg.Dest,
+			Path:   call.msg.Path,
+			Iface:  call.msg.Iface,
+			Member: call.msg.Member,
+			Age:    now.Sub(call.sent),
+		})
+	})
+	sort.Sort(byAge(info.PendingCalls))
+
+	p.handlersMutex.Lock()
+	for _, handler := range p.signalHandlers.All() {
+		info.MatchRules = append(info.MatchRules, handler.mr._ToString())
+	}
+	p.handlersMutex.Unlock()
+
+	info.Exports = make(map[string][]string)
+	p.exportsMutex.Lock()
+	for path, ifaces := range p.exports {
+		for iface := range ifaces {
+			info.Exports[path] = append(info.Exports[path], iface)
+		}
+	}
+	for path := range p.managers {
+		info.Exports[path] = append(info.Exports[path], OBJECT_MANAGER_INTERFACE)
+	}
+	p.exportsMutex.Unlock()
+	for _, ifaces := range info.Exports {
+		sort.Strings(ifaces)
+	}
+
+	info.QueueLength = len(p.msgChan)
+	info.QueueCapacity = cap(p.msgChan)
+	info.DroppedSignals = atomic.LoadUint64(&p.droppedSignals)
+
+	return info
+}
+
+func (p DebugInfo) String() string {
+	buff := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(buff, "unique name: %s\n", p.UniqueName)
+	for _, name := range p.OwnedNames {
+		fmt.Fprintf(buff, "owned name: %s\n", name)
+	}
+	fmt.Fprintf(buff, "dispatch queue: %d/%d\n", p.QueueLength, p.QueueCapacity)
+	if p.DroppedSignals > 0 {
+		fmt.Fprintf(buff, "dropped signals: %d\n", p.DroppedSignals)
+	}
+	fmt.Fprintf(buff, "pending calls: %d\n", len(p.PendingCalls))
+	for _, call := range p.PendingCalls {
+		fmt.Fprintf(buff, "    serial=%d age=%v dest=%s path=%s member=%s.%s\n",
+			call.Serial, call.Age, call.Dest, call.Path, call.Iface, call.Member)
+	}
+	fmt.Fprintf(buff, "match rules: %d\n", len(p.MatchRules))
+	for _, rule := range p.MatchRules {
+		fmt.Fprintf(buff, "    %s\n", rule)
+	}
+	paths := make([]string, 0, len(p.Exports))
+	for path := range p.Exports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	fmt.Fprintf(buff, "exported objects: %d\n", len(paths))
+	for _, path := range paths {
+		fmt.Fprintf(buff, "    %s %s\n", path, strings.Join(p.Exports[path], " "))
+	}
+	return buff.String()
+}
+
+type byAge []PendingCallInfo
+
+func (p byAge) Len() int           { return len(p) }
+func (p byAge) Less(i, j int) bool { return p[i].Age > p[j].Age }
+func (p byAge) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
@@ -0,0 +1,59 @@
+package dbus
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugInfo(t *testing.T) {
+	con := new(Connection)
+	con.uniqName = ":1.7"
+	con.msgChan = make(chan *Message, msgQueueSize)
+
+	for i, age := range []time.Duration{time.Second, time.Minute} {
+		msg := NewMessage()
+		msg.Dest = "org.example.Foo"
+		msg.Member = "Bar"
+		con.methodCallReplies.Add(uint32(i+1), &methodCall{msg, time.Now().Add(-age), nil})
+	}
+	con.signalHandlers.Add(&SignalHandler{mr: MatchRule{Type: "signal", Member: "Baz"}})
+	con.msgChan <- NewMessage()
+
+	info := con.DebugInfo()
+	if ":1.7" != info.UniqueName {
+		t.Error("#1 Failed:", info.UniqueName)
+	}
+	if len(info.PendingCalls) != 2 || info.PendingCalls[0].Serial != 2 || info.PendingCalls[0].Age < time.Minute {
+		t.Error("#2 Failed:", info.PendingCalls)
+	}
+	if len(info.MatchRules) != 1 || info.MatchRules[0] != "type='signal',member='Baz'" {
+		t.Error("#3 Failed:", info.MatchRules)
+	}
+	if info.QueueLength != 1 || info.QueueCapacity != msgQueueSize {
+		t.Error("#4 Failed:", info.QueueLength, info.QueueCapacity)
+	}
+	if len(info.Exports) != 0 {
+		t.Error("#5 Failed:", info.Exports)
+	}
+
+	if e := con.ExportObjectManager("/calc"); e != nil {
+		t.Fatal(e)
+	}
+	for _, iface := range []string{"org.example.Calc", "org.example.Alt"} {
+		if e := con.Export(testCalc{}, "/calc/main", iface); e != nil {
+			t.Fatal(e)
+		}
+	}
+	info = con.DebugInfo()
+	if !reflect.DeepEqual(info.Exports, map[string][]string{
+		"/calc":      {OBJECT_MANAGER_INTERFACE},
+		"/calc/main": {"org.example.Alt", "org.example.Calc"},
+	}) {
+		t.Error("#6 Failed:", info.Exports)
+	}
+	if !strings.HasSuffix(info.String(), "exported objects: 2\n    /calc "+OBJECT_MANAGER_INTERFACE+"\n    /calc/main org.example.Alt org.example.Calc\n") {
+		t.Error("#7 Failed:", info.String())
+	}
+}
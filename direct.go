@@ -0,0 +1,32 @@
+package dbus
+
+import (
+	"net"
+)
+
+// ConnectPeer returns a connection to another application over conn,
+// without a bus in between, like the connections of dconf or ibus.
+// Initialize authenticates as the client but does not say Hello, so the
+// connection has no unique name and calls and signals need no destination.
+// Both ends may export objects and call each other.
+func ConnectPeer(conn net.Conn) *Connection {
+	bus := ConnectTo(conn)
+	bus.peer = true
+	return bus
+}
+
+// AcceptPeer returns the end of a peer to peer connection which accepted
+// conn, the other end using ConnectPeer. Initialize authenticates the
+// client: EXTERNAL for clients running as the same user, which only works
+// on unix sockets, and ANONYMOUS if AllowAnonymous is set.
+func AcceptPeer(conn net.Conn) *Connection {
+	bus := ConnectPeer(conn)
+	bus.peerServer = true
+	return bus
+}
+
+// IsPeerToPeer reports whether the connection was made by ConnectPeer or
+// AcceptPeer rather than to a bus.
+func (p *Connection) IsPeerToPeer() bool {
+	return p.peer
+}
@@ -0,0 +1,119 @@
+package dbus
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestPeers returns the two ends of a peer to peer connection over a
+// unix socket, initialized.
+func newTestPeers(t *testing.T) (*Connection, *Connection) {
+	l, e := net.Listen("unix", filepath.Join(t.TempDir(), "peer"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+	conn, e := net.Dial("unix", l.Addr().String())
+	if e != nil {
+		t.Fatal(e)
+	}
+	client := ConnectPeer(conn)
+	server := AcceptPeer(<-accepted)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.Initialize() }()
+	if e := client.Initialize(); e != nil {
+		t.Fatal("client:", e)
+	}
+	if e := <-errs; e != nil {
+		t.Fatal("server:", e)
+	}
+	return client, server
+}
+
+func TestPeerToPeer(t *testing.T) {
+	client, server := newTestPeers(t)
+	if !client.IsPeerToPeer() || !server.IsPeerToPeer() || client.UniqueName() != "" {
+		t.Error("#1 Failed")
+	}
+	if !client.SupportsUnixFDs() || !server.SupportsUnixFDs() {
+		t.Error("#2 Failed")
+	}
+
+	if e := server.Export(testCalc{}, "/calc", "org.test.Calc"); e != nil {
+		t.Fatal(e)
+	}
+	if e := client.Export(testCalc{}, "/calc", "org.test.Calc"); e != nil {
+		t.Fatal(e)
+	}
+	ret, e := client.Call("", "/calc", "org.test.Calc", "Add", int32(1), int32(2))
+	if e != nil || len(ret) != 1 || ret[0] != int32(3) {
+		t.Error("#3 Failed:", ret, e)
+	}
+	ret, e = server.Call("", "/calc", "org.test.Calc", "Add", int32(3), int32(4))
+	if e != nil || len(ret) != 1 || ret[0] != int32(7) {
+		t.Error("#4 Failed:", ret, e)
+	}
+
+	_, e = client.Call("", "/calc", "org.test.Calc", "Sqrt", int32(-1))
+	if de, ok := e.(*Error); !ok || de.Name != "org.example.Calc.Error.Negative" || len(de.Body) != 2 {
+		t.Error("#5 Failed:", e)
+	}
+
+	received := make(chan *Message, 1)
+	client.AddSignalHandler(&MatchRule{Type: "signal", Interface: "org.test.Calc"}, func(msg *Message) {
+		received <- msg
+	})
+	if e := server._EmitSignal("/calc", "org.test.Calc", "Changed", "i", int32(5)); e != nil {
+		t.Fatal("#6 Failed:", e)
+	}
+	select {
+	case msg := <-received:
+		if msg.Member != "Changed" || msg.Params[0] != int32(5) {
+			t.Error("#7 Failed:", msg)
+		}
+	case <-time.After(time.Second):
+		t.Error("#7 Failed: no signal")
+	}
+}
+
+func TestAuthenticateClient(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	errs := make(chan error, 1)
+	go func() {
+		_, e := _AuthenticateClient(server, false, time.Second)
+		errs <- e
+	}()
+	con := ConnectPeer(client)
+	con.Authenticators = []Authenticator{new(AuthAnonymous)}
+	if _, e := con._Auth(client); e != ErrAuthFailed {
+		t.Error("#1 Failed:", e)
+	}
+
+	client, server = net.Pipe()
+	defer client.Close()
+	go func() {
+		_, e := _AuthenticateClient(server, true, time.Second)
+		errs <- e
+	}()
+	con = ConnectPeer(client)
+	con.Authenticators = []Authenticator{new(AuthExternal), new(AuthAnonymous)}
+	if _, e := con._Auth(client); e != nil {
+		t.Error("#2 Failed:", e)
+	}
+	if e := <-errs; e != nil {
+		t.Error("#3 Failed:", e)
+	}
+}
@@ -0,0 +1,67 @@
+package dbus
+
+// Names of errors which buses and services commonly reply with.
+const (
+	ERROR_SERVICE_UNKNOWN    = "org.freedesktop.DBus.Error.ServiceUnknown"
+	ERROR_NAME_HAS_NO_OWNER  = "org.freedesktop.DBus.Error.NameHasNoOwner"
+	ERROR_NO_REPLY           = "org.freedesktop.DBus.Error.NoReply"
+	ERROR_ACCESS_DENIED      = "org.freedesktop.DBus.Error.AccessDenied"
+	ERROR_NOT_SUPPORTED      = "org.freedesktop.DBus.Error.NotSupported"
+	ERROR_PROPERTY_READ_ONLY = "org.freedesktop.DBus.Error.PropertyReadOnly"
+)
+
+// Error is an error reply. Method calls answered with one return it, so
+// that callers can tell errors apart by Name:
+//
+//	if e, ok := err.(*dbus.Error); ok && e.Name == dbus.ERROR_SERVICE_UNKNOWN {
+//		...
+//	}
+//
+// Body holds the values of the reply, by convention a message string.
+type Error struct {
+	Name string
+	Body []interface{}
+}
+
+// NewError returns an error named name with the values of body.
+func NewError(name string, body ...interface{}) *Error {
+	return &Error{name, body}
+}
+
+// Message returns the message of the error, the first value of its body if
+// that is a string.
+func (p *Error) Message() string {
+	if len(p.Body) > 0 {
+		if text, ok := p.Body[0].(string); ok {
+			return text
+		}
+	}
+	return ""
+}
+
+func (p *Error) Error() string {
+	if text := p.Message(); text != "" {
+		return p.Name + ": " + text
+	}
+	return p.Name
+}
+
+// _ReplyError returns the error of the error reply msg.
+func _ReplyError(msg *Message) *Error {
+	return &Error{msg.ErrorName, msg.Params}
+}
+
+// _ErrorReply returns the error reply to call for err. An *Error keeps its
+// name and body, other errors, and those whose name or body can not be
+// sent, become ERROR_FAILED with the text of err.
+func _ErrorReply(call *Message, err error) *Message {
+	if e, ok := err.(*Error); ok && ValidateErrorName(e.Name) == nil {
+		if sig, serr := _InferSignature(e.Body); serr == nil {
+			reply := _NewErrorReply(call, e.Name, "")
+			reply.Sig = sig
+			reply.Params = e.Body
+			return reply
+		}
+	}
+	return _NewErrorReply(call, ERROR_FAILED, err.Error())
+}
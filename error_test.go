@@ -0,0 +1,21 @@
+package dbus
+
+import (
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	e := NewError(ERROR_SERVICE_UNKNOWN, "The name org.example was not provided")
+	if e.Message() != "The name org.example was not provided" {
+		t.Error("#1 Failed:", e.Message())
+	}
+	if e.Error() != "org.freedesktop.DBus.Error.ServiceUnknown: The name org.example was not provided" {
+		t.Error("#2 Failed:", e.Error())
+	}
+	if e := NewError(ERROR_FAILED, int32(1)); e.Message() != "" || e.Error() != ERROR_FAILED {
+		t.Error("#3 Failed:", e.Error())
+	}
+	if e := NewError(ERROR_FAILED); e.Error() != ERROR_FAILED {
+		t.Error("#4 Failed:", e.Error())
+	}
+}
@@ -0,0 +1,330 @@
+package dbus
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+var (
+	ErrNotExported   = errors.New("NotExported")
+	ErrNotExportable = errors.New("NotExportable")
+)
+
+var (
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+	dbusErrorType = reflect.TypeOf((*Error)(nil))
+)
+
+// exportedMethod is a method of a Go value callable over the bus.
+type exportedMethod struct {
+	fn         reflect.Value
+	in         []reflect.Type
+	inSig      string
+	outSig     string
+	returnsErr bool
+	// inArgs and outArgs are the signatures of the single arguments and
+	// results, for introspection.
+	inArgs  []string
+	outArgs []string
+}
+
+// exportedInterface is a Go value exported as an interface of an object.
+type exportedInterface struct {
+	value   interface{}
+	methods map[string]*exportedMethod
+	// introspection is the <interface> element describing the interface,
+	// if given to ExportMethods.
+	introspection string
+}
+
+// _NewExportedInterface collects the exported methods of v whose arguments
+// and results have D-Bus signatures. A last result of type error or *Error
+// fails the call when it is not nil. Other methods are not callable over the
+// bus.
+func _NewExportedInterface(v interface{}) *exportedInterface {
+	ei := &exportedInterface{value: v, methods: make(map[string]*exportedMethod)}
+	rv := reflect.ValueOf(v)
+	for i := 0; i < rv.NumMethod(); i++ {
+		name := rv.Type().Method(i).Name
+		if ValidateMemberName(name) != nil {
+			continue
+		}
+		if method := _NewExportedMethod(rv.Method(i)); method != nil {
+			ei.methods[name] = method
+		}
+	}
+	return ei
+}
+
+func _NewExportedMethod(fn reflect.Value) *exportedMethod {
+	t := fn.Type()
+	method := &exportedMethod{fn: fn}
+	for i := 0; i < t.NumIn(); i++ {
+		sig, e := _SignatureOf(t.In(i))
+		if e != nil {
+			return nil
+		}
+		method.in = append(method.in, t.In(i))
+		method.inSig += sig
+		method.inArgs = append(method.inArgs, sig)
+	}
+	nout := t.NumOut()
+	if nout > 0 && (t.Out(nout-1) == errorType || t.Out(nout-1) == dbusErrorType) {
+		method.returnsErr = true
+		nout--
+	}
+	for i := 0; i < nout; i++ {
+		sig, e := _SignatureOf(t.Out(i))
+		if e != nil {
+			return nil
+		}
+		method.outSig += sig
+		method.outArgs = append(method.outArgs, sig)
+	}
+	return method
+}
+
+// _Call calls the method with the arguments of call and returns the reply.
+// A method which panics fails the call rather than the process.
+func (p *exportedMethod) _Call(call *Message) (reply *Message) {
+	defer func() {
+		if r := recover(); r != nil {
+			reply = _NewErrorReply(call, ERROR_FAILED, fmt.Sprint("method panicked: ", r))
+		}
+	}()
+	if call.Sig != p.inSig {
+		return _NewErrorReply(call, ERROR_INVALID_ARGS,
+			"Expected signature '"+p.inSig+"', got '"+call.Sig+"'")
+	}
+	args := make([]reflect.Value, len(p.in))
+	ptrs := make([]interface{}, len(p.in))
+	for i, t := range p.in {
+		ptr := reflect.New(t)
+		args[i] = ptr.Elem()
+		ptrs[i] = ptr.Interface()
+	}
+	if err := Store(call.Params, ptrs...); err != nil {
+		return _NewErrorReply(call, ERROR_INVALID_ARGS, err.Error())
+	}
+
+	// The last parameter of a variadic method is the slice itself.
+	var out []reflect.Value
+	if p.fn.Type().IsVariadic() {
+		out = p.fn.CallSlice(args)
+	} else {
+		out = p.fn.Call(args)
+	}
+	if p.returnsErr {
+		if err := out[len(out)-1]; !err.IsNil() {
+			return _ErrorReply(call, err.Interface().(error))
+		}
+		out = out[:len(out)-1]
+	}
+	reply = _NewMethodReturn(call)
+	reply.Sig = p.outSig
+	for _, v := range out {
+		reply.Params = append(reply.Params, _WireValue(v))
+	}
+	return reply
+}
+
+// Export makes the exported methods of v callable by other connections as
+// the methods of the interface iface on the object at path, replacing what
+// was exported there before. Methods are called from the dispatcher.
+// Arguments are stored into the parameters of a method as Store does, and
+// its results form the reply; if the last result is an error which is not
+// nil, the caller gets an error reply instead. An *Error is sent with its
+// name and body, other errors as ERROR_FAILED with their text. Methods
+// whose parameters or results have no D-Bus signature, like int or func
+// types, are not exported. The variadic parameter of a method takes an
+// array, and a method which panics fails the call with ERROR_FAILED.
+//
+// An object exported below a path passed to ExportObjectManager is
+// announced with the InterfacesAdded signal.
+func (p *Connection) Export(v interface{}, path, iface string) error {
+	if err := ValidateObjectPath(path); err != nil {
+		return err
+	}
+	if err := ValidateInterfaceName(iface); err != nil {
+		return err
+	}
+	return p._ExportInterface(_NewExportedInterface(v), path, iface)
+}
+
+// ExportMethods exports the functions of methods, by member name, as the
+// methods of the interface iface on the object at path, as Export does with
+// the methods of a value. Member names need not be Go names, and it fails
+// with ErrNotExportable for functions whose parameters or results have no
+// D-Bus signature. If introspection is not empty, it is the <interface>
+// element describing iface in the introspection data of the object, instead
+// of the one generated from the functions.
+func (p *Connection) ExportMethods(methods map[string]interface{}, introspection, path, iface string) error {
+	if err := ValidateObjectPath(path); err != nil {
+		return err
+	}
+	if err := ValidateInterfaceName(iface); err != nil {
+		return err
+	}
+	ei := &exportedInterface{methods, make(map[string]*exportedMethod), introspection}
+	for name, fn := range methods {
+		if err := ValidateMemberName(name); err != nil {
+			return err
+		}
+		v := reflect.ValueOf(fn)
+		if v.Kind() != reflect.Func || v.IsNil() {
+			return ErrNotExportable
+		}
+		if ei.methods[name] = _NewExportedMethod(v); ei.methods[name] == nil {
+			return ErrNotExportable
+		}
+	}
+	return p._ExportInterface(ei, path, iface)
+}
+
+func (p *Connection) _ExportInterface(ei *exportedInterface, path, iface string) error {
+	p.exportsMutex.Lock()
+	if p.exports == nil {
+		p.exports = make(map[string]map[string]*exportedInterface)
+	}
+	if p.exports[path] == nil {
+		p.exports[path] = make(map[string]*exportedInterface)
+	}
+	p.exports[path][iface] = ei
+	manager := p._ManagerOf(path)
+	p.exportsMutex.Unlock()
+
+	if manager != "" {
+		return p._EmitInterfacesAdded(manager, path, iface)
+	}
+	return nil
+}
+
+// Unexport removes the interface iface from the object at path. An object
+// below an object manager is announced as gone with the InterfacesRemoved
+// signal.
+func (p *Connection) Unexport(path, iface string) error {
+	p.exportsMutex.Lock()
+	if _, ok := p.exports[path][iface]; !ok {
+		p.exportsMutex.Unlock()
+		return ErrNotExported
+	}
+	delete(p.exports[path], iface)
+	if len(p.exports[path]) == 0 {
+		delete(p.exports, path)
+	}
+	manager := p._ManagerOf(path)
+	p.exportsMutex.Unlock()
+
+	if manager != "" {
+		return p._EmitSignal(manager, OBJECT_MANAGER_INTERFACE, "InterfacesRemoved", "oas",
+			path, []interface{}{iface})
+	}
+	return nil
+}
+
+// ExportObjectManager implements org.freedesktop.DBus.ObjectManager on the
+// object at path, for the objects exported below it. Objects exported
+// later, or unexported, are announced with its signals.
+func (p *Connection) ExportObjectManager(path string) error {
+	if err := ValidateObjectPath(path); err != nil {
+		return err
+	}
+	p.exportsMutex.Lock()
+	defer p.exportsMutex.Unlock()
+	if p.managers == nil {
+		p.managers = make(map[string]bool)
+	}
+	p.managers[path] = true
+	return nil
+}
+
+// _ManagerOf returns the closest object manager above path, or an empty
+// string if there is none. The caller must hold exportsMutex.
+func (p *Connection) _ManagerOf(path string) string {
+	for parent := ObjectPath(path).Parent(); parent != ""; parent = parent.Parent() {
+		if p.managers[string(parent)] {
+			return string(parent)
+		}
+	}
+	return ""
+}
+
+// _ManagedObjects returns the objects exported below the object manager at
+// path, in the form of the reply to GetManagedObjects. Exported interfaces
+// have no properties, so their property dicts are empty.
+func (p *Connection) _ManagedObjects(path string) []interface{} {
+	p.exportsMutex.Lock()
+	defer p.exportsMutex.Unlock()
+	paths := make([]string, 0, len(p.exports))
+	for child := range p.exports {
+		if child != path && p._ManagerOf(child) == path {
+			paths = append(paths, child)
+		}
+	}
+	sort.Strings(paths)
+
+	objects := make([]interface{}, 0, len(paths))
+	for _, child := range paths {
+		names := make([]string, 0, len(p.exports[child]))
+		for name := range p.exports[child] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		ifaces := make([]interface{}, len(names))
+		for i, name := range names {
+			ifaces[i] = []interface{}{name, []interface{}{}}
+		}
+		objects = append(objects, []interface{}{child, ifaces})
+	}
+	return objects
+}
+
+func (p *Connection) _EmitInterfacesAdded(manager, path, iface string) error {
+	return p._EmitSignal(manager, OBJECT_MANAGER_INTERFACE, "InterfacesAdded", "oa{sa{sv}}",
+		path, []interface{}{[]interface{}{iface, []interface{}{}}})
+}
+
+// _CallExported answers a method call to an exported object. It returns
+// nil if nothing is exported at the path of call.
+func (p *Connection) _CallExported(call *Message) *Message {
+	p.exportsMutex.Lock()
+	isManager := p.managers[call.Path]
+	ifaces, ok := p.exports[call.Path]
+	var method *exportedMethod
+	var iface *exportedInterface
+	if call.Iface == "" {
+		// Without an interface, any method of that name will do.
+		names := make([]string, 0, len(ifaces))
+		for name := range ifaces {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if method = ifaces[name].methods[call.Member]; method != nil {
+				break
+			}
+		}
+	} else if iface = ifaces[call.Iface]; iface != nil {
+		method = iface.methods[call.Member]
+	}
+	p.exportsMutex.Unlock()
+
+	switch {
+	case isManager && call.Member == "GetManagedObjects" && (call.Iface == OBJECT_MANAGER_INTERFACE || method == nil):
+		reply := _NewMethodReturn(call)
+		reply.Sig = "a{oa{sa{sv}}}"
+		reply.Params = []interface{}{p._ManagedObjects(call.Path)}
+		return reply
+	case !ok && !isManager:
+		return nil
+	case method != nil:
+		return method._Call(call)
+	case call.Iface != "" && iface == nil && !(isManager && call.Iface == OBJECT_MANAGER_INTERFACE):
+		return _NewErrorReply(call, ERROR_UNKNOWN_INTERFACE,
+			"Unknown interface '"+call.Iface+"' on object '"+call.Path+"'")
+	}
+	return _NewErrorReply(call, ERROR_UNKNOWN_METHOD,
+		"Unknown method '"+call.Member+"' on interface '"+call.Iface+"'")
+}
@@ -0,0 +1,163 @@
+package dbus
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPoint struct {
+	X, Y int32
+}
+
+type testCalc struct{}
+
+func (testCalc) Add(a, b int32) int32 { return a + b }
+
+func (testCalc) Div(a, b int32) (int32, error) {
+	if b == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return a / b, nil
+}
+
+func (testCalc) Move(p testPoint, by map[string]int32) (testPoint, []string) {
+	return testPoint{p.X + by["x"], p.Y + by["y"]}, []string{"moved"}
+}
+
+func (testCalc) Sqrt(a int32) (int32, *Error) {
+	if a < 0 {
+		return 0, NewError("org.example.Calc.Error.Negative", "negative argument", a)
+	}
+	return 1, nil
+}
+
+func (testCalc) Check(a int32) error {
+	if a < 0 {
+		return NewError("not an error name", "negative argument")
+	}
+	return nil
+}
+
+func (testCalc) Ignored(n int) int { return n }
+
+func (testCalc) Join(sep string, parts ...string) string { return strings.Join(parts, sep) }
+
+func (testCalc) Crash() { panic("crashed") }
+
+func TestExport(t *testing.T) {
+	messages := make(chan *Message, 8)
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Type != METHOD_CALL {
+			messages <- msg
+		}
+	})
+	next := func(n int) *Message {
+		select {
+		case msg := <-messages:
+			return msg
+		case <-time.After(time.Second):
+			t.Fatalf("#%d Failed: no message", n)
+		}
+		return nil
+	}
+	call := func(path, iface, member, sig string, params ...interface{}) *Message {
+		msg := NewMessage()
+		msg.Type = METHOD_CALL
+		msg.Path = path
+		msg.Iface = iface
+		msg.Member = member
+		msg.Sig = sig
+		msg.Params = params
+		bus.Send(msg)
+		return msg
+	}
+
+	if e := con.ExportObjectManager("/calc"); e != nil {
+		t.Fatal(e)
+	}
+	if e := con.Export(testCalc{}, "/calc/main", "org.example.Calc"); e != nil {
+		t.Fatal(e)
+	}
+	if msg := next(1); msg.Type != SIGNAL || msg.Member != "InterfacesAdded" || msg.Path != "/calc" || msg.Params[0] != ObjectPath("/calc/main") {
+		t.Error("#1 Failed:", msg.Type, msg.Member, msg.Params)
+	}
+
+	tests := []struct {
+		call   *Message
+		err    string
+		params []interface{}
+	}{
+		{call("/calc/main", "org.example.Calc", "Add", "ii", int32(2), int32(3)), "", []interface{}{int32(5)}},
+		{call("/calc/main", "", "Add", "ii", int32(2), int32(3)), "", []interface{}{int32(5)}},
+		{call("/calc/main", "org.example.Calc", "Div", "ii", int32(1), int32(0)), ERROR_FAILED, []interface{}{"division by zero"}},
+		{call("/calc/main", "org.example.Calc", "Add", "s", "2"), ERROR_INVALID_ARGS, nil},
+		{call("/calc/main", "org.example.Calc", "Ignored", "x", int64(1)), ERROR_UNKNOWN_METHOD, nil},
+		{call("/calc/main", "org.example.Other", "Add", "ii", int32(2), int32(3)), ERROR_UNKNOWN_INTERFACE, nil},
+		{call("/calc/other", "org.example.Calc", "Add", "ii", int32(2), int32(3)), ERROR_UNKNOWN_OBJECT, nil},
+		{call("/calc/main", "org.example.Calc", "Move", "(ii)a{si}",
+			[]interface{}{int32(1), int32(2)}, []interface{}{[]interface{}{"x", int32(10)}}),
+			"", []interface{}{[]interface{}{int32(11), int32(2)}, []interface{}{"moved"}}},
+		{call("/calc", OBJECT_MANAGER_INTERFACE, "GetManagedObjects", ""), "", []interface{}{[]interface{}{
+			[]interface{}{ObjectPath("/calc/main"), []interface{}{[]interface{}{"org.example.Calc", []interface{}{}}}},
+		}}},
+		{call("/calc/main", "org.example.Calc", "Sqrt", "i", int32(-4)), "org.example.Calc.Error.Negative", []interface{}{"negative argument", int32(-4)}},
+		{call("/calc/main", "org.example.Calc", "Sqrt", "i", int32(4)), "", []interface{}{int32(1)}},
+		{call("/calc/main", "org.example.Calc", "Check", "i", int32(-4)), ERROR_FAILED, []interface{}{"not an error name: negative argument"}},
+		{call("/calc/main", "org.example.Calc", "Join", "sas", "-", []interface{}{"a", "b"}), "", []interface{}{"a-b"}},
+		{call("/calc/main", "org.example.Calc", "Crash", ""), ERROR_FAILED, []interface{}{"method panicked: crashed"}},
+	}
+	for i, test := range tests {
+		reply := next(i + 2)
+		if reply.ReplySerial() != test.call.Serial() || reply.ErrorName != test.err {
+			t.Errorf("#%d Failed: %q %v", i+2, reply.ErrorName, reply.Params)
+			continue
+		}
+		if test.params != nil && !reflect.DeepEqual(reply.Params, test.params) {
+			t.Errorf("#%d Failed: %#v", i+2, reply.Params)
+		}
+	}
+
+	if e := con.Unexport("/calc/main", "org.example.Calc"); e != nil {
+		t.Error("#20 Failed:", e)
+	}
+	if msg := next(21); msg.Type != SIGNAL || msg.Member != "InterfacesRemoved" || msg.Params[0] != ObjectPath("/calc/main") {
+		t.Error("#21 Failed:", msg.Type, msg.Member, msg.Params)
+	}
+	if e := con.Unexport("/calc/main", "org.example.Calc"); e != ErrNotExported {
+		t.Error("#22 Failed:", e)
+	}
+	stale := call("/calc/main", "org.example.Calc", "Add", "ii", int32(2), int32(3))
+	if reply := next(23); reply.ReplySerial() != stale.Serial() || reply.ErrorName != ERROR_UNKNOWN_OBJECT {
+		t.Error("#23 Failed:", reply.ErrorName)
+	}
+	if e := con.Export(testCalc{}, "calc", "org.example.Calc"); e == nil {
+		t.Error("#24 Failed")
+	}
+}
+
+func TestSignatureOf(t *testing.T) {
+	tests := []struct {
+		v   interface{}
+		sig string
+	}{
+		{byte(0), "y"},
+		{ObjectPath("/"), "o"},
+		{[]string{}, "as"},
+		{map[string]interface{}{}, "a{sv}"},
+		{map[string]Variant{}, "a{sv}"},
+		{testPoint{}, "(ii)"},
+		{[]testPoint{}, "a(ii)"},
+		{int(0), ""},
+		{map[testPoint]string{}, ""},
+		{struct{}{}, ""},
+	}
+	for i, test := range tests {
+		sig, e := _SignatureOf(reflect.TypeOf(test.v))
+		if sig != test.sig || (e == nil) != (test.sig != "") {
+			t.Errorf("#%d Failed: %q %v", i+1, sig, e)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package dbus
+
+// Filter is a function added with AddFilter.
+type Filter struct {
+	filter func(*Message) bool
+}
+
+// AddFilter adds filter, which is called with every received message before
+// it is dispatched, in the order the messages were received, and also in
+// monitor mode. Returning false swallows the message. Filters run in the
+// order they were added, until one swallows the message, on the goroutine
+// reading from the socket: they must not block, nor wait for replies,
+// which that goroutine reads. The filter can be passed to RemoveFilter.
+func (p *Connection) AddFilter(filter func(*Message) bool) *Filter {
+	f := &Filter{filter}
+	p.filtersMutex.Lock()
+	defer p.filtersMutex.Unlock()
+	// Copied, so that _Filter can run the filters without the lock.
+	filters := make([]*Filter, len(p.filters), len(p.filters)+1)
+	copy(filters, p.filters)
+	p.filters = append(filters, f)
+	return f
+}
+
+// RemoveFilter removes filters added with AddFilter. Filters which were
+// removed before are ignored.
+func (p *Connection) RemoveFilter(filters ...*Filter) {
+	p.filtersMutex.Lock()
+	defer p.filtersMutex.Unlock()
+	kept := make([]*Filter, 0, len(p.filters))
+	for _, f := range p.filters {
+		removed := false
+		for _, r := range filters {
+			removed = removed || f == r
+		}
+		if !removed {
+			kept = append(kept, f)
+		}
+	}
+	p.filters = kept
+}
+
+// _Filter runs the filters over msg and reports whether it is kept. Swallowed
+// messages are released.
+func (p *Connection) _Filter(msg *Message) bool {
+	p.filtersMutex.Lock()
+	filters := p.filters
+	p.filtersMutex.Unlock()
+	for _, f := range filters {
+		if !f.filter(msg) {
+			_CloseFDs(msg)
+			if p.RecycleMessages {
+				_ReleaseMessage(msg)
+			}
+			return false
+		}
+	}
+	return true
+}
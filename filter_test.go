@@ -0,0 +1,55 @@
+package dbus
+
+import (
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		switch msg.Member {
+		case "AddMatch", "Ping":
+			bus.Reply(msg, "")
+		}
+	})
+	received := make(chan string, 4)
+	if _, e := con.AddSignalHandler(NewMatchRule().WithInterface("org.example.Thing"), func(msg *Message) { received <- msg.Member }); e != nil {
+		t.Fatal(e)
+	}
+
+	seen := make(chan MessageType, 8)
+	first := con.AddFilter(func(msg *Message) bool {
+		seen <- msg.Type
+		return true
+	})
+	second := con.AddFilter(func(msg *Message) bool { return msg.Member != "Dropped" })
+	third := con.AddFilter(func(msg *Message) bool {
+		if msg.Member == "Dropped" {
+			t.Error("#1 Failed: filter called after the message was swallowed")
+		}
+		return true
+	})
+
+	bus.Emit("/thing", "org.example.Thing", "Dropped", "")
+	bus.Emit("/thing", "org.example.Thing", "Kept", "")
+	if member := <-received; member != "Kept" {
+		t.Error("#2 Failed:", member)
+	}
+	if _, e := con.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", PEER_INTERFACE, "Ping"); e != nil {
+		t.Error("#3 Failed:", e)
+	}
+	for i, expected := range []MessageType{SIGNAL, SIGNAL, METHOD_RETURN} {
+		if typ := <-seen; typ != expected {
+			t.Error("#4 Failed:", i, typ)
+		}
+	}
+
+	con.RemoveFilter(second, third, second)
+	bus.Emit("/thing", "org.example.Thing", "Dropped", "")
+	if member := <-received; member != "Dropped" {
+		t.Error("#5 Failed:", member)
+	}
+	con.RemoveFilter(first)
+	if len(con.filters) != 0 {
+		t.Error("#6 Failed:", con.filters)
+	}
+}
@@ -0,0 +1,228 @@
+package dbus
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var typeNames = map[byte]string{
+	'y': "byte",
+	'b': "boolean",
+	'n': "int16",
+	'q': "uint16",
+	'i': "int32",
+	'u': "uint32",
+	'x': "int64",
+	't': "uint64",
+	'd': "double",
+	's': "string",
+	'o': "object_path",
+	'g': "signature",
+	'h': "unix_fd",
+	'v': "variant",
+	'a': "array",
+	'(': "struct",
+	'{': "dict_entry",
+}
+
+type formatItem struct {
+	label    string
+	value    string
+	children []formatItem
+	close    string
+}
+
+// FormatParams renders values decoded with signature sig in a human readable
+// form, one value per line, each prefixed with its D-Bus type name.
+// Containers are printed with their elements indented below them.
+func FormatParams(sig string, params []interface{}) string {
+	items := make([]formatItem, 0)
+	for sigIdx, prmsIdx := 0, 0; sigIdx < len(sig); prmsIdx++ {
+		t, e := _GetSingleType(sig, sigIdx)
+		if e != nil {
+			items = append(items, formatItem{label: "invalid", value: fmt.Sprintf("%q", sig[sigIdx:])})
+			break
+		}
+		var val interface{}
+		if prmsIdx < len(params) {
+			val = params[prmsIdx]
+		}
+		items = append(items, _FormatValue(t, val))
+		sigIdx += len(t)
+	}
+
+	buff := bytes.NewBuffer([]byte{})
+	_WriteFormatItems(buff, items, 0)
+	return buff.String()
+}
+
+// FormatParams renders the message body as described for FormatParams.
+func (p *Message) FormatParams() string {
+	return FormatParams(p.Sig, p.Params)
+}
+
+func _FormatValue(sig string, val interface{}) formatItem {
+	item := formatItem{label: typeNames[sig[0]]}
+
+	switch sig[0] {
+	case 's', 'g':
+		item.value = fmt.Sprintf("%q", val)
+
+	case 'v':
+		valSig := _GuessSignature(val)
+		if variant, ok := val.(Variant); ok {
+			val, valSig = variant.Value, variant.Sig
+		}
+		inner := _FormatValue(valSig, val)
+		item.value = strings.TrimSpace(inner.label + " " + inner.value)
+		item.children = inner.children
+		item.close = inner.close
+
+	case 'a':
+		if b, ok := val.([]byte); ok {
+			if len(b) > 32 {
+				item.value = fmt.Sprintf("[%d bytes]", len(b))
+			} else {
+				item.value = fmt.Sprintf("[% x]", b)
+			}
+			break
+		}
+		slice, ok := val.([]interface{})
+		if !ok {
+			item.value = fmt.Sprintf("%v", val)
+			break
+		}
+		if '{' == sig[1] {
+			item.label = "dict"
+			item.value = "{"
+			item.close = "}"
+			keySig, _ := _GetSingleType(sig, 2)
+			valSig, _ := _GetSingleType(sig, 2+len(keySig))
+			for _, v := range slice {
+				entry, ok := v.([]interface{})
+				if !ok || len(entry) != 2 || len(keySig) == 0 || len(valSig) == 0 {
+					item.children = append(item.children, formatItem{label: "?", value: fmt.Sprintf("%v", v)})
+					continue
+				}
+				key := _FormatValue(keySig, entry[0])
+				child := _FormatValue(valSig, entry[1])
+				child.label, child.value = key.value, strings.TrimSpace(child.label+" "+child.value)
+				item.children = append(item.children, child)
+			}
+			break
+		}
+		item.value = "["
+		item.close = "]"
+		for _, v := range slice {
+			item.children = append(item.children, _FormatValue(sig[1:], v))
+		}
+
+	case '(':
+		slice, ok := val.([]interface{})
+		if !ok {
+			item.value = fmt.Sprintf("%v", val)
+			break
+		}
+		item.value = "("
+		item.close = ")"
+		fieldSig := sig[1 : len(sig)-1]
+		for sigIdx, i := 0, 0; sigIdx < len(fieldSig) && i < len(slice); i++ {
+			t, e := _GetSingleType(fieldSig, sigIdx)
+			if e != nil {
+				break
+			}
+			item.children = append(item.children, _FormatValue(t, slice[i]))
+			sigIdx += len(t)
+		}
+
+	default:
+		if "" == item.label {
+			item.label = "?"
+		}
+		item.value = fmt.Sprintf("%v", val)
+	}
+
+	return item
+}
+
+// _GuessSignature returns the signature of the wire type a value most likely
+// has, for values marshalled or formatted without a signature.
+func _GuessSignature(val interface{}) string {
+	switch val.(type) {
+	case Variant:
+		return "v"
+	case byte:
+		return "y"
+	case bool:
+		return "b"
+	case int16:
+		return "n"
+	case uint16:
+		return "q"
+	case int32:
+		return "i"
+	case uint32:
+		return "u"
+	case int64:
+		return "x"
+	case uint64:
+		return "t"
+	case float64:
+		return "d"
+	case string:
+		return "s"
+	case ObjectPath:
+		return "o"
+	case Signature:
+		return "g"
+	case UnixFD:
+		return "h"
+	case []byte:
+		return "ay"
+	case map[string]string:
+		return "a{ss}"
+	case map[string]interface{}, map[string]Variant:
+		return "a{sv}"
+	case []interface{}:
+		return "av"
+	}
+	t := reflect.TypeOf(val)
+	if t == nil {
+		return "?"
+	}
+	switch {
+	case _IsStruct(val) && t.Kind() == reflect.Ptr:
+		t = t.Elem()
+	case t.Kind() == reflect.Array:
+		// Arrays marshal like the slices of their elements.
+		t = reflect.SliceOf(t.Elem())
+	case !_IsStruct(val) && t.Kind() != reflect.Map && t.Kind() != reflect.Slice:
+		return "?"
+	}
+	if sig, e := _SignatureOf(t); e == nil {
+		return sig
+	}
+	return "?"
+}
+
+func _WriteFormatItems(buff *bytes.Buffer, items []formatItem, depth int) {
+	width := 0
+	for _, item := range items {
+		if len(item.label) > width {
+			width = len(item.label)
+		}
+	}
+
+	indent := strings.Repeat("    ", depth)
+	for _, item := range items {
+		line := fmt.Sprintf("%s%-*s %s", indent, width, item.label, item.value)
+		buff.WriteString(strings.TrimRight(line, " "))
+		buff.WriteByte('\n')
+		if item.close != "" {
+			_WriteFormatItems(buff, item.children, depth+1)
+			buff.WriteString(indent + item.close + "\n")
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package dbus
+
+import (
+	"testing"
+)
+
+func TestFormatParams(t *testing.T) {
+	str := FormatParams("uiso", []interface{}{uint32(1), int32(-2), "foo", "/org/foo"})
+	expected := "uint32      1\nint32       -2\nstring      \"foo\"\nobject_path /org/foo\n"
+	if str != expected {
+		t.Errorf("#1 Failed\n%s", str)
+	}
+
+	str = FormatParams("a{sv}", []interface{}{[]interface{}{[]interface{}{"urgency", byte(2)}}})
+	expected = "dict {\n    \"urgency\" variant byte 2\n}\n"
+	if str != expected {
+		t.Errorf("#2 Failed\n%s", str)
+	}
+
+	str = FormatParams("a(su)", []interface{}{[]interface{}{[]interface{}{"a", uint32(7)}}})
+	expected = "array [\n    struct (\n        string \"a\"\n        uint32 7\n    )\n]\n"
+	if str != expected {
+		t.Errorf("#3 Failed\n%s", str)
+	}
+}
+
+func TestFormatByteArray(t *testing.T) {
+	str := FormatParams("ayay", []interface{}{[]byte{1, 0xff}, make([]byte, 100)})
+	expected := "array [01 ff]\narray [100 bytes]\n"
+	if str != expected {
+		t.Errorf("#1 Failed\n%s", str)
+	}
+}
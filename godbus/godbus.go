@@ -0,0 +1,183 @@
+// Package godbus mirrors the most commonly used parts of the godbus/dbus API
+// on top of go-dbus, so that applications written against godbus/dbus can be
+// ported by changing their import path.
+//
+// As with godbus/dbus, method calls are not checked against introspection
+// data: the signature of the arguments is inferred from their Go types.
+package godbus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/norisatir/go-dbus"
+)
+
+var ErrInvalidMethod = errors.New("InvalidMethod")
+
+// ObjectPath is the godbus name for a D-Bus object path. It is the same
+// type as dbus.ObjectPath, so that paths passed as arguments are marshalled
+// as object paths and those received can be stored into it.
+type ObjectPath = dbus.ObjectPath
+
+// Flags are the header flags accepted by BusObject.Call.
+type Flags byte
+
+const (
+	FlagNoReplyExpected               Flags = dbus.NO_REPLY_EXPECTED
+	FlagNoAutoStart                   Flags = dbus.NO_AUTO_START
+	FlagAllowInteractiveAuthorization Flags = dbus.ALLOW_INTERACTIVE_AUTHORIZATION
+)
+
+// Conn is a connection to a message bus.
+type Conn struct {
+	conn *dbus.Connection
+}
+
+// BusObject is a remote object on which methods can be invoked.
+type BusObject interface {
+	Call(method string, flags Flags, args ...interface{}) *Call
+	Destination() string
+	Path() ObjectPath
+}
+
+// Call represents a completed method call.
+type Call struct {
+	Destination string
+	Path        ObjectPath
+	Method      string
+	Args        []interface{}
+	Err         error
+	Body        []interface{}
+}
+
+// Signal is a received signal.
+type Signal struct {
+	Sender string
+	Path   ObjectPath
+	Name   string
+	Body   []interface{}
+}
+
+type object struct {
+	conn *Conn
+	dest string
+	path ObjectPath
+}
+
+// SessionBus returns a new connection to the session bus.
+func SessionBus() (*Conn, error) {
+	return connect(dbus.SessionBus)
+}
+
+// SystemBus returns a new connection to the system bus.
+func SystemBus() (*Conn, error) {
+	return connect(dbus.SystemBus)
+}
+
+func connect(busType dbus.StandardBus) (*Conn, error) {
+	conn, err := dbus.Connect(busType)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.Initialize(); err != nil {
+		return nil, err
+	}
+	return &Conn{conn}, nil
+}
+
+// Connection returns the underlying go-dbus connection.
+func (c *Conn) Connection() *dbus.Connection {
+	return c.conn
+}
+
+// Object returns the object identified by the given destination and path.
+func (c *Conn) Object(dest string, path ObjectPath) BusObject {
+	return &object{conn: c, dest: dest, path: path}
+}
+
+// BusObject returns the object of the message bus itself.
+func (c *Conn) BusObject() BusObject {
+	return c.Object("org.freedesktop.DBus", "/org/freedesktop/DBus")
+}
+
+// Signal registers ch to receive the signals delivered to the connection.
+// As with godbus/dbus, no match rule is added: the bus only delivers the
+// signals matching the rules of the connection, like those of its signal
+// handlers, and those addressed to it. Signals are sent to ch as they are
+// received, and dropped while ch is full.
+func (c *Conn) Signal(ch chan<- *Signal) {
+	c.conn.AddFilter(func(msg *dbus.Message) bool {
+		if msg.Type != dbus.SIGNAL {
+			return true
+		}
+		signal := &Signal{
+			Sender: msg.Sender,
+			Path:   ObjectPath(msg.Path),
+			Name:   msg.Iface + "." + msg.Member,
+			Body:   msg.Params,
+		}
+		select {
+		case ch <- signal:
+		default:
+		}
+		return true
+	})
+}
+
+func (o *object) Destination() string { return o.dest }
+
+func (o *object) Path() ObjectPath { return o.path }
+
+// Call invokes method, given as the interface name and member joined by a
+// dot, with the given args and waits for the reply, unless flags include
+// FlagNoReplyExpected.
+func (o *object) Call(method string, flags Flags, args ...interface{}) *Call {
+	call := &Call{
+		Destination: o.dest,
+		Path:        o.path,
+		Method:      method,
+		Args:        args,
+	}
+
+	i := strings.LastIndex(method, ".")
+	if i <= 0 {
+		call.Err = ErrInvalidMethod
+		return call
+	}
+
+	sig, err := signature(args)
+	if err != nil {
+		call.Err = err
+		return call
+	}
+	call.Body, call.Err = o.conn.conn.CallWithFlags(dbus.MessageFlag(flags), o.dest, string(o.path), method[:i], method[i+1:], sig, args...)
+	return call
+}
+
+// signature returns the signature of args, inferred from their Go types.
+func signature(args []interface{}) (string, error) {
+	sig := ""
+	for _, arg := range args {
+		s := dbus.NewVariant(arg).Sig
+		if strings.Contains(s, "?") {
+			return "", fmt.Errorf("cannot infer signature of %T", arg)
+		}
+		sig += s
+	}
+	return sig, nil
+}
+
+// Store stores the body of the reply into the given pointers.
+func (c *Call) Store(retvalues ...interface{}) error {
+	if c.Err != nil {
+		return c.Err
+	}
+	return Store(c.Body, retvalues...)
+}
+
+// Store copies the values of src into the values pointed to by dest.
+func Store(src []interface{}, dest ...interface{}) error {
+	return dbus.Store(src, dest...)
+}
@@ -0,0 +1,141 @@
+package godbus
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/norisatir/go-dbus"
+)
+
+func TestCallInvalidMethod(t *testing.T) {
+	obj := new(Conn).Object("org.example.Foo", "/org/example/Foo")
+	if obj.Destination() != "org.example.Foo" || obj.Path() != "/org/example/Foo" {
+		t.Error("#1 Failed")
+	}
+	call := obj.Call("NoInterface", 0)
+	if call.Err != ErrInvalidMethod {
+		t.Error("#2 Failed:", call.Err)
+	}
+	if e := call.Store(); e != ErrInvalidMethod {
+		t.Error("#3 Failed:", e)
+	}
+}
+
+func TestStore(t *testing.T) {
+	var path ObjectPath
+	var n uint32
+	if e := Store([]interface{}{dbus.ObjectPath("/org/example"), uint32(2)}, &path, &n); e != nil {
+		t.Error("#1 Failed:", e)
+	}
+	if path != "/org/example" || n != 2 {
+		t.Error("#2 Failed:", path, n)
+	}
+}
+
+type testPaths struct{}
+
+func (testPaths) Child(parent dbus.ObjectPath, name string) dbus.ObjectPath {
+	return parent + "/" + dbus.ObjectPath(name)
+}
+
+func (testPaths) Notify(actions []string, hints map[string]dbus.Variant) string {
+	return strings.Join(actions, ",") + " " + fmt.Sprint(hints["urgency"].Value)
+}
+
+// newTestConn returns a godbus connection to a peer exporting testPaths at
+// /paths, and the peer.
+func newTestConn(t *testing.T) (*Conn, *dbus.Connection) {
+	l, e := net.Listen("unix", filepath.Join(t.TempDir(), "peer"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+	conn, e := net.Dial("unix", l.Addr().String())
+	if e != nil {
+		t.Fatal(e)
+	}
+	client := dbus.ConnectPeer(conn)
+	server := dbus.AcceptPeer(<-accepted)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.Initialize() }()
+	if e := client.Initialize(); e != nil {
+		t.Fatal("client:", e)
+	}
+	if e := <-errs; e != nil {
+		t.Fatal("server:", e)
+	}
+	if e := server.Export(testPaths{}, "/paths", "org.example.Paths"); e != nil {
+		t.Fatal(e)
+	}
+	return &Conn{client}, server
+}
+
+func TestCallObjectPath(t *testing.T) {
+	conn, _ := newTestConn(t)
+	var child ObjectPath
+	call := conn.Object("", "/paths").Call("org.example.Paths.Child", 0, ObjectPath("/org/example"), "child")
+	if e := call.Store(&child); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if child != "/org/example/child" {
+		t.Error("#2 Failed:", child)
+	}
+}
+
+func TestCallSlices(t *testing.T) {
+	conn, _ := newTestConn(t)
+	var text string
+	call := conn.Object("", "/paths").Call("org.example.Paths.Notify", 0,
+		[]string{"default", "Open"}, map[string]dbus.Variant{"urgency": dbus.NewVariant(byte(2))})
+	if e := call.Store(&text); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if text != "default,Open 2" {
+		t.Error("#2 Failed:", text)
+	}
+}
+
+func TestCallWithoutIntrospection(t *testing.T) {
+	conn, _ := newTestConn(t)
+	if call := conn.Object("", "/unexported").Call("org.freedesktop.DBus.Peer.Ping", 0); call.Err != nil {
+		t.Error("#1 Failed:", call.Err)
+	}
+	if call := conn.Object("", "/paths").Call("org.example.Paths.Child", 0, struct{}{}); call.Err == nil {
+		t.Error("#2 Failed")
+	}
+}
+
+func TestSignal(t *testing.T) {
+	conn, server := newTestConn(t)
+	signals := make(chan *Signal, 1)
+	conn.Signal(signals)
+
+	server.Emit("/paths", "org.example.Paths", "Added", "o", dbus.ObjectPath("/paths/a"))
+	server.Emit("/paths", "org.example.Paths", "Added", "o", dbus.ObjectPath("/paths/b"))
+	// The second signal is dropped rather than stalling the receiver.
+	if call := conn.Object("", "/").Call("org.freedesktop.DBus.Peer.Ping", 0); call.Err != nil {
+		t.Fatal("#1 Failed:", call.Err)
+	}
+	signal := <-signals
+	if signal.Path != "/paths" || signal.Name != "org.example.Paths.Added" || signal.Body[0] != ObjectPath("/paths/a") {
+		t.Error("#2 Failed:", signal)
+	}
+	select {
+	case signal := <-signals:
+		t.Error("#3 Failed:", signal)
+	default:
+	}
+}
@@ -0,0 +1,107 @@
+package dbus
+
+import (
+	"sort"
+)
+
+// handlerKey is the interface, member and path a match rule requires, empty
+// strings standing for rules which do not restrict them.
+type handlerKey struct {
+	iface  string
+	member string
+	path   string
+}
+
+// handlerIndex holds the signal handlers of a connection indexed by the
+// interface, member and path of their match rules, so that dispatching a
+// signal only looks at handlers which may match it. The zero value is ready
+// to use.
+type handlerIndex struct {
+	buckets map[handlerKey][]*SignalHandler
+	seq     uint64
+	count   int
+}
+
+// Add registers handler.
+func (p *handlerIndex) Add(handler *SignalHandler) {
+	if p.buckets == nil {
+		p.buckets = make(map[handlerKey][]*SignalHandler)
+	}
+	p.seq++
+	p.count++
+	handler.seq = p.seq
+	key := handlerKey{handler.mr.Interface, handler.mr.Member, handler.mr.Path}
+	p.buckets[key] = append(p.buckets[key], handler)
+}
+
+// Remove unregisters handler and reports whether it was registered.
+func (p *handlerIndex) Remove(handler *SignalHandler) bool {
+	key := handlerKey{handler.mr.Interface, handler.mr.Member, handler.mr.Path}
+	bucket := p.buckets[key]
+	for i, h := range bucket {
+		if h != handler {
+			continue
+		}
+		bucket = append(bucket[:i:i], bucket[i+1:]...)
+		if len(bucket) == 0 {
+			delete(p.buckets, key)
+		} else {
+			p.buckets[key] = bucket
+		}
+		p.count--
+		return true
+	}
+	return false
+}
+
+// Lookup appends the handlers whose rules match msg to dst, in the order
+// they were added.
+func (p *handlerIndex) Lookup(dst []*SignalHandler, msg *Message) []*SignalHandler {
+	start := len(dst)
+	for _, iface := range [2]string{msg.Iface, ""} {
+		for _, member := range [2]string{msg.Member, ""} {
+			for _, path := range [2]string{msg.Path, ""} {
+				for _, handler := range p.buckets[handlerKey{iface, member, path}] {
+					if handler.mr._Match(msg) {
+						dst = append(dst, handler)
+					}
+				}
+				if path == "" {
+					break
+				}
+			}
+			if member == "" {
+				break
+			}
+		}
+		if iface == "" {
+			break
+		}
+	}
+	found := bySeq(dst[start:])
+	if len(found) > 1 {
+		sort.Sort(found)
+	}
+	return dst
+}
+
+// Len returns the number of handlers.
+func (p *handlerIndex) Len() int {
+	return p.count
+}
+
+// All returns every handler in the order they were added.
+func (p *handlerIndex) All() []*SignalHandler {
+	all := make([]*SignalHandler, 0)
+	for _, bucket := range p.buckets {
+		all = append(all, bucket...)
+	}
+	sort.Sort(bySeq(all))
+	return all
+}
+
+type bySeq []*SignalHandler
+
+func (p bySeq) Len() int           { return len(p) }
+func (p bySeq) Less(i, j int) bool { return p[i].seq < p[j].seq }
+func (p bySeq) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
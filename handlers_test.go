@@ -0,0 +1,66 @@
+package dbus
+
+import (
+	"testing"
+)
+
+func TestHandlerIndex(t *testing.T) {
+	var index handlerIndex
+	rules := []MatchRule{
+		{Type: "signal", Interface: "org.example.A", Member: "Changed"},
+		{Type: "signal"},
+		{Type: "signal", Member: "Changed", Path: "/org/example/b"},
+		{Type: "signal", Interface: "org.example.B"},
+		{Type: "signal", Interface: "org.example.A", Path: "/org/example/a"},
+	}
+	for _, mr := range rules {
+		index.Add(&SignalHandler{mr: mr})
+	}
+
+	check := func(n int, iface, member, path string, expected ...uint64) {
+		msg := NewMessage()
+		msg.Type = SIGNAL
+		msg.Iface = iface
+		msg.Member = member
+		msg.Path = path
+		found := index.Lookup(nil, msg)
+		if len(found) != len(expected) {
+			t.Errorf("#%d Failed: %d handlers", n, len(found))
+			return
+		}
+		for i, handler := range found {
+			if handler.seq != expected[i] {
+				t.Errorf("#%d Failed: handler %d is %d", n, i, handler.seq)
+			}
+		}
+	}
+	check(1, "org.example.A", "Changed", "/org/example/a", 1, 2, 5)
+	check(2, "org.example.A", "Changed", "/org/example/b", 1, 2, 3)
+	check(3, "org.example.B", "Other", "/", 2, 4)
+	check(4, "org.example.C", "Changed", "/", 2)
+
+	if all := index.All(); len(all) != 5 || all[0].seq != 1 || all[4].seq != 5 {
+		t.Error("#5 Failed")
+	}
+}
+
+func TestHandlerIndexRemove(t *testing.T) {
+	var index handlerIndex
+	a := &SignalHandler{mr: MatchRule{Member: "Changed"}}
+	b := &SignalHandler{mr: MatchRule{Member: "Changed"}}
+	index.Add(a)
+	index.Add(b)
+
+	if !index.Remove(a) || index.Remove(a) {
+		t.Error("#1 Failed")
+	}
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Member = "Changed"
+	if found := index.Lookup(nil, msg); len(found) != 1 || found[0] != b || index.Len() != 1 {
+		t.Error("#2 Failed:", found)
+	}
+	if !index.Remove(b) || index.Len() != 0 || len(index.All()) != 0 {
+		t.Error("#3 Failed")
+	}
+}
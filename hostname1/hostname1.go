@@ -0,0 +1,109 @@
+// Package hostname1 is a client of systemd-hostnamed on the system bus,
+// which reads and sets the host name and related machine metadata.
+//
+// Setters take an interactive flag, which lets polkit ask the user to
+// authenticate if the caller is not privileged.
+package hostname1
+
+import (
+	"errors"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION          = "org.freedesktop.hostname1"
+	PATH                 = "/org/freedesktop/hostname1"
+	INTERFACE            = "org.freedesktop.hostname1"
+	PROPERTIES_INTERFACE = "org.freedesktop.DBus.Properties"
+)
+
+var (
+	ErrNoService = errors.New("NoHostnamed")
+	ErrNoReply   = errors.New("EmptyReply")
+)
+
+// Client is the hostnamed service.
+type Client struct {
+	conn  *dbus.Connection
+	iface *dbus.Interface
+	props *dbus.Interface
+}
+
+// NewClient returns the service reached through conn, which must be an
+// initialized connection to the system bus.
+func NewClient(conn *dbus.Connection) (*Client, error) {
+	obj := conn.GetObject(DESTINATION, PATH)
+	iface := conn.Interface(obj, INTERFACE)
+	props := conn.Interface(obj, PROPERTIES_INTERFACE)
+	if iface == nil || props == nil {
+		return nil, ErrNoService
+	}
+	return &Client{conn, iface, props}, nil
+}
+
+func (p *Client) _GetString(name string) (string, error) {
+	ret, err := p.conn.CallMethod(p.props, "Get", INTERFACE, name)
+	if err != nil {
+		return "", err
+	}
+	if len(ret) == 0 {
+		return "", ErrNoReply
+	}
+	var s string
+	err = dbus.Store(ret[:1], &s)
+	return s, err
+}
+
+// Hostname returns the current host name.
+func (p *Client) Hostname() (string, error) { return p._GetString("Hostname") }
+
+// StaticHostname returns the host name configured in /etc/hostname.
+func (p *Client) StaticHostname() (string, error) { return p._GetString("StaticHostname") }
+
+// PrettyHostname returns the free form host name shown to users.
+func (p *Client) PrettyHostname() (string, error) { return p._GetString("PrettyHostname") }
+
+// IconName returns the icon name of the machine.
+func (p *Client) IconName() (string, error) { return p._GetString("IconName") }
+
+// Chassis returns the chassis type, like "laptop" or "server".
+func (p *Client) Chassis() (string, error) { return p._GetString("Chassis") }
+
+// KernelName returns the kernel name, like "Linux".
+func (p *Client) KernelName() (string, error) { return p._GetString("KernelName") }
+
+// OperatingSystemPrettyName returns the name of the operating system.
+func (p *Client) OperatingSystemPrettyName() (string, error) {
+	return p._GetString("OperatingSystemPrettyName")
+}
+
+func (p *Client) _Set(method, value string, interactive bool) error {
+	_, err := p.conn.CallMethod(p.iface, method, value, interactive)
+	return err
+}
+
+// SetHostname sets the transient host name.
+func (p *Client) SetHostname(name string, interactive bool) error {
+	return p._Set("SetHostname", name, interactive)
+}
+
+// SetStaticHostname sets the host name configured in /etc/hostname.
+func (p *Client) SetStaticHostname(name string, interactive bool) error {
+	return p._Set("SetStaticHostname", name, interactive)
+}
+
+// SetPrettyHostname sets the free form host name.
+func (p *Client) SetPrettyHostname(name string, interactive bool) error {
+	return p._Set("SetPrettyHostname", name, interactive)
+}
+
+// SetIconName sets the icon name of the machine.
+func (p *Client) SetIconName(name string, interactive bool) error {
+	return p._Set("SetIconName", name, interactive)
+}
+
+// SetChassis sets the chassis type.
+func (p *Client) SetChassis(chassis string, interactive bool) error {
+	return p._Set("SetChassis", chassis, interactive)
+}
@@ -0,0 +1,98 @@
+package dbus
+
+// introKey identifies the introspection data of an object.
+type introKey struct {
+	dest string
+	path string
+}
+
+// _CachedIntrospect returns the introspection data of the object at path of
+// dest, introspecting it only if it is not cached yet. Data is cached once
+// the connection watches the owner of dest, so that it is dropped when
+// the service restarts. The watch is installed first, and data is not
+// cached if it was invalidated while the object was introspected.
+func (p *Connection) _CachedIntrospect(dest, path string) Introspect {
+	key := introKey{dest, path}
+	p.introsMutex.Lock()
+	intro, ok := p.intros[key]
+	p.introsMutex.Unlock()
+	if ok {
+		return intro
+	}
+
+	if !p._WatchOwner(dest) {
+		return p._GetIntrospect(dest, path)
+	}
+	p.introsMutex.Lock()
+	changes := p.introWatches[dest]
+	p.introsMutex.Unlock()
+	intro = p._GetIntrospect(dest, path)
+	if intro == nil {
+		return nil
+	}
+	p.introsMutex.Lock()
+	if p.introWatches[dest] == changes {
+		if p.intros == nil {
+			p.intros = make(map[introKey]Introspect)
+		}
+		p.intros[key] = intro
+	}
+	p.introsMutex.Unlock()
+	return intro
+}
+
+// _WatchOwner invalidates the introspection data cached for dest whenever
+// the bus reports a change of its owner, and reports whether data of dest
+// may be cached. Peers have no bus, and their objects are never cached.
+func (p *Connection) _WatchOwner(dest string) bool {
+	if p.peer || dest == "" {
+		return false
+	}
+	p.introsMutex.Lock()
+	if _, ok := p.introWatches[dest]; ok {
+		p.introsMutex.Unlock()
+		return true
+	}
+	if p.introWatches == nil {
+		p.introWatches = make(map[string]uint64)
+	}
+	p.introWatches[dest] = 0
+	p.introsMutex.Unlock()
+
+	mr := &MatchRule{
+		Type:      "signal",
+		Sender:    "org.freedesktop.DBus",
+		Interface: "org.freedesktop.DBus",
+		Member:    "NameOwnerChanged",
+		Path:      "/org/freedesktop/DBus",
+		Args:      map[int]string{0: dest},
+	}
+	_, err := p.AddSignalHandler(mr, func(msg *Message) {
+		p.InvalidateIntrospection(dest, "")
+	})
+	if err != nil {
+		p.introsMutex.Lock()
+		delete(p.introWatches, dest)
+		p.introsMutex.Unlock()
+		return false
+	}
+	return true
+}
+
+// InvalidateIntrospection drops the introspection data cached for the
+// object at path of dest, or for all objects of dest if path is empty, so
+// that GetObject introspects them again. Data is dropped by itself when
+// the owner of dest changes.
+func (p *Connection) InvalidateIntrospection(dest, path string) {
+	p.introsMutex.Lock()
+	defer p.introsMutex.Unlock()
+	// Introspections in progress count any invalidation as stale.
+	if changes, ok := p.introWatches[dest]; ok {
+		p.introWatches[dest] = changes + 1
+	}
+	for key := range p.intros {
+		if key.dest == dest && (path == "" || key.path == path) {
+			delete(p.intros, key)
+		}
+	}
+}
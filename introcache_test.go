@@ -0,0 +1,151 @@
+package dbus
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIntrospectionCache(t *testing.T) {
+	var introspected int32
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		switch msg.Member {
+		case "Introspect":
+			atomic.AddInt32(&introspected, 1)
+			bus.Reply(msg, "s", `<node><interface name="org.example.Iface"><method name="A"/></interface></node>`)
+		case "AddMatch":
+			bus.Reply(msg, "")
+		}
+	})
+
+	if con.Interface(con.GetObject("org.example", "/a"), "org.example.Iface") == nil {
+		t.Fatal("#1 Failed")
+	}
+	con.Interface(con.GetObject("org.example", "/a"), "org.example.Iface")
+	if n := atomic.LoadInt32(&introspected); n != 1 {
+		t.Error("#2 Failed:", n)
+	}
+	con.Interface(con.GetObject("org.example", "/b"), "org.example.Iface")
+	if n := atomic.LoadInt32(&introspected); n != 2 {
+		t.Error("#3 Failed:", n)
+	}
+
+	con.InvalidateIntrospection("org.example", "/a")
+	con.Interface(con.GetObject("org.example", "/a"), "org.example.Iface")
+	con.Interface(con.GetObject("org.example", "/b"), "org.example.Iface")
+	if n := atomic.LoadInt32(&introspected); n != 3 {
+		t.Error("#4 Failed:", n)
+	}
+
+	// A restart of the service drops everything cached for it.
+	bus.Emit("/org/freedesktop/DBus", "org.freedesktop.DBus", "NameOwnerChanged", "sss", "org.example", ":1.5", ":1.6")
+	for i := 0; ; i++ {
+		con.introsMutex.Lock()
+		n := len(con.intros)
+		con.introsMutex.Unlock()
+		if n == 0 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("#5 Failed: cache not invalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	con.Interface(con.GetObject("org.example", "/a"), "org.example.Iface")
+	if n := atomic.LoadInt32(&introspected); n != 4 {
+		t.Error("#6 Failed:", n)
+	}
+	if len(con.introWatches) != 1 {
+		t.Error("#7 Failed:", con.introWatches)
+	}
+}
+
+func TestIntrospectionCacheOwner(t *testing.T) {
+	var mutex sync.Mutex
+	calls := make([]string, 0)
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		mutex.Lock()
+		calls = append(calls, msg.Member)
+		mutex.Unlock()
+		switch msg.Member {
+		case "Introspect":
+			bus.Reply(msg, "s", `<node><interface name="org.example.Iface"><method name="A"/></interface></node>`)
+		case "AddMatch":
+			bus.Reply(msg, "")
+		}
+	})
+	barrier := make(chan bool, 1)
+	if _, e := con.AddSignalHandler(NewMatchRule().WithMember("Barrier"), func(*Message) { barrier <- true }); e != nil {
+		t.Fatal(e)
+	}
+	introspect := func() {
+		con.Interface(con.GetObject("org.example", "/a"), "org.example.Iface")
+	}
+
+	// The owner is watched before the object is introspected.
+	introspect()
+	mutex.Lock()
+	if len(calls) != 3 || calls[1] != "AddMatch" || calls[2] != "Introspect" {
+		t.Error("#1 Failed:", calls)
+	}
+	mutex.Unlock()
+
+	// Only the bus reports owner changes.
+	bus.EmitFrom(":1.9", "/org/freedesktop/DBus", "org.freedesktop.DBus", "NameOwnerChanged", "sss", "org.example", ":1.6", ":1.9")
+	bus.Emit("/", "org.example.Test", "Barrier", "")
+	<-barrier
+	introspect()
+	mutex.Lock()
+	if n := len(calls); n != 3 {
+		t.Error("#2 Failed:", calls)
+	}
+	mutex.Unlock()
+
+	// An invalidation while introspecting is not overwritten.
+	con.introsMutex.Lock()
+	changes := con.introWatches["org.example"]
+	con.introsMutex.Unlock()
+	con.InvalidateIntrospection("org.example", "")
+	con.introsMutex.Lock()
+	if n := con.introWatches["org.example"]; n != changes+1 {
+		t.Error("#3 Failed:", n)
+	}
+	con.introsMutex.Unlock()
+}
+
+func TestLazyIntrospection(t *testing.T) {
+	var introspected int32
+	con, _ := newTestConnection(t, func(bus *testBus, msg *Message) {
+		switch msg.Member {
+		case "Introspect":
+			if atomic.AddInt32(&introspected, 1) == 1 {
+				bus.Send(_NewErrorReply(msg, ERROR_SERVICE_UNKNOWN, "not yet"))
+				return
+			}
+			bus.Reply(msg, "s", `<node><interface name="org.example.Iface"><method name="A"/></interface></node>`)
+		case "AddMatch", "A":
+			bus.Reply(msg, "")
+		}
+	})
+
+	obj := con.GetObject("org.example", "/a")
+	if _, e := con.Call("org.example", "/a", "org.example.Iface", "A"); e != nil {
+		t.Error("#1 Failed:", e)
+	}
+	if n := atomic.LoadInt32(&introspected); n != 0 {
+		t.Error("#2 Failed:", n)
+	}
+	if con.Interface(obj, "org.example.Iface") != nil {
+		t.Error("#3 Failed: failed introspection")
+	}
+	if con.Interface(obj, "org.example.Iface") == nil {
+		t.Error("#4 Failed: introspection not retried")
+	}
+	if con.Interface(obj, "org.example.Missing") != nil {
+		t.Error("#5 Failed")
+	}
+	if n := atomic.LoadInt32(&introspected); n != 2 {
+		t.Error("#6 Failed:", n)
+	}
+}
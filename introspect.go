@@ -1,52 +1,86 @@
 package dbus
 
 import (
-	"bytes"
 	"encoding/xml"
+	"errors"
+	"io"
 	"strings"
+	"sync"
 )
 
 type annotationData struct {
-	Name  string `xml:"attr"`
-	Value string `xml:"attr"`
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
 }
 
 type argData struct {
-	Name      string `xml:"attr"`
-	Type      string `xml:"attr"`
-	Direction string `xml:"attr"`
+	Name       string           `xml:"name,attr"`
+	Type       string           `xml:"type,attr"`
+	Direction  string           `xml:"direction,attr"`
+	Annotation []annotationData `xml:"annotation"`
 }
 
 type methodData struct {
-	Name       string `xml:"attr"`
-	Arg        []argData
-	Annotation annotationData
+	Name       string           `xml:"name,attr"`
+	Arg        []argData        `xml:"arg"`
+	Annotation []annotationData `xml:"annotation"`
 }
 
 type signalData struct {
-	Name string `xml:"attr"`
-	Arg  []argData
+	Name       string           `xml:"name,attr"`
+	Arg        []argData        `xml:"arg"`
+	Annotation []annotationData `xml:"annotation"`
+}
+
+type propertyData struct {
+	Name       string           `xml:"name,attr"`
+	Type       string           `xml:"type,attr"`
+	Access     string           `xml:"access,attr"`
+	Annotation []annotationData `xml:"annotation"`
 }
 
 type interfaceData struct {
-	Name   string `xml:"attr"`
-	Method []methodData
-	Signal []signalData
+	Name       string           `xml:"name,attr"`
+	Method     []methodData     `xml:"method"`
+	Signal     []signalData     `xml:"signal"`
+	Property   []propertyData   `xml:"property"`
+	Annotation []annotationData `xml:"annotation"`
+}
+
+type nodeData struct {
+	Name      string          `xml:"name,attr"`
+	Interface []interfaceData `xml:"interface"`
+	Node      []nodeData      `xml:"node"`
 }
 
+// introspect holds an introspection document. Interfaces are only decoded
+// when they are first looked up, as documents of some services describe
+// hundreds of interfaces of which callers use few. The whole document is
+// decoded when it is walked, and child nodes are held decoded.
 type introspect struct {
-	Name      string `xml:"attr"`
-	Interface []interfaceData
-	Node      []*introspect
+	data       string
+	mutex      sync.Mutex
+	interfaces map[string]*interfaceData
+	node       *nodeData
 }
 
 type Introspect interface {
 	GetInterfaceData(name string) InterfaceData
+	// GetName returns the name attribute of the node, which is a relative
+	// path for child nodes and usually empty for the root.
+	GetName() string
+	GetInterfaceNames() []string
+	GetChildren() []Introspect
 }
 
 type InterfaceData interface {
 	GetMethodData(name string) MethodData
 	GetSignalData(name string) SignalData
+	GetPropertyData(name string) PropertyData
+	GetMethods() []MethodData
+	GetSignals() []SignalData
+	GetProperties() []PropertyData
+	GetAnnotation(name string) string
 	GetName() string
 }
 
@@ -54,32 +88,185 @@ type MethodData interface {
 	GetName() string
 	GetInSignature() string
 	GetOutSignature() string
+	GetArgs() []ArgData
+	GetAnnotation(name string) string
 }
 
 type SignalData interface {
+	GetName() string
 	GetSignature() string
+	GetArgs() []ArgData
+	GetAnnotation(name string) string
 }
 
+type PropertyData interface {
+	GetName() string
+	GetSignature() string
+	// GetAccess returns "read", "write" or "readwrite".
+	GetAccess() string
+	GetAnnotation(name string) string
+}
+
+type ArgData interface {
+	// GetName returns the name of the argument, which may be empty.
+	GetName() string
+	GetSignature() string
+	// GetDirection returns "in" or "out". Arguments of signals go out.
+	GetDirection() string
+	GetAnnotation(name string) string
+}
+
+var ErrIntrospectNoNode = errors.New("IntrospectNoNode")
+
+// NewIntrospect returns the introspection data of the document xmlIntro.
+// Only the root element is checked here, interfaces are decoded on demand.
 func NewIntrospect(xmlIntro string) (Introspect, error) {
-	intro := new(introspect)
-	buff := bytes.NewBufferString(xmlIntro)
-	err := xml.Unmarshal(buff, intro)
-	if err != nil {
+	decoder := xml.NewDecoder(strings.NewReader(xmlIntro))
+	if _, err := _NextStartElement(decoder, "node"); err != nil {
 		return nil, err
 	}
 
+	intro := new(introspect)
+	intro.data = xmlIntro
+	intro.interfaces = make(map[string]*interfaceData)
 	return intro, nil
 }
 
-func (p introspect) GetInterfaceData(name string) InterfaceData {
-	for _, v := range p.Interface {
-		if v.Name == name {
-			return v
+// _NextStartElement returns the next start element read from decoder, which
+// must be named name.
+func _NextStartElement(decoder *xml.Decoder, name string) (*xml.StartElement, error) {
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, ErrIntrospectNoNode
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			if start.Name.Local != name {
+				return nil, ErrIntrospectNoNode
+			}
+			return &start, nil
+		}
+	}
+}
+
+// _DecodeInterface streams through the document up to the interface named
+// name, skipping every other element, and decodes only that interface.
+func (p *introspect) _DecodeInterface(name string) *interfaceData {
+	decoder := xml.NewDecoder(strings.NewReader(p.data))
+	if _, err := _NextStartElement(decoder, "node"); err != nil {
+		return nil
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "interface" && _GetAttr(t, "name") == name {
+				data := new(interfaceData)
+				if decoder.DecodeElement(data, &t) != nil {
+					return nil
+				}
+				return data
+			}
+			if decoder.Skip() != nil {
+				return nil
+			}
+		case xml.EndElement:
+			return nil // end of the root node
+		}
+	}
+}
+
+func _GetAttr(start xml.StartElement, name string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func (p *introspect) GetInterfaceData(name string) InterfaceData {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	data, ok := p.interfaces[name]
+	if !ok {
+		if p.node != nil {
+			data = p.node._InterfaceData(name)
+		} else {
+			data = p._DecodeInterface(name)
+		}
+		p.interfaces[name] = data
+	}
+	if data == nil {
+		return nil
+	}
+	return *data
+}
+
+// _Node returns the whole document, decoding it on first use.
+func (p *introspect) _Node() *nodeData {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.node == nil {
+		p.node = new(nodeData)
+		if xml.Unmarshal([]byte(p.data), p.node) != nil {
+			p.node = new(nodeData)
+		}
+	}
+	return p.node
+}
+
+func (p *introspect) GetName() string { return p._Node().Name }
+
+func (p *introspect) GetInterfaceNames() []string {
+	node := p._Node()
+	names := make([]string, len(node.Interface))
+	for i, v := range node.Interface {
+		names[i] = v.Name
+	}
+	return names
+}
+
+// GetChildren returns the child nodes of the document. Nodes listed by name
+// only have no interfaces; introspect their own objects for them.
+func (p *introspect) GetChildren() []Introspect {
+	node := p._Node()
+	children := make([]Introspect, len(node.Node))
+	for i := range node.Node {
+		children[i] = &introspect{node: &node.Node[i], interfaces: make(map[string]*interfaceData)}
+	}
+	return children
+}
+
+func (p *nodeData) _InterfaceData(name string) *interfaceData {
+	for i := range p.Interface {
+		if p.Interface[i].Name == name {
+			return &p.Interface[i]
 		}
 	}
 	return nil
 }
 
+// _Annotation returns the value of the annotation named name, or an empty
+// string if there is none.
+func _Annotation(annotations []annotationData, name string) string {
+	for _, v := range annotations {
+		if v.Name == name {
+			return v.Value
+		}
+	}
+	return ""
+}
+
 func (p interfaceData) GetMethodData(name string) MethodData {
 	for _, v := range p.Method {
 		if v.GetName() == name {
@@ -98,11 +285,83 @@ func (p interfaceData) GetSignalData(name string) SignalData {
 	return nil
 }
 
+func (p interfaceData) GetPropertyData(name string) PropertyData {
+	for _, v := range p.Property {
+		if v.GetName() == name {
+			return v
+		}
+	}
+	return nil
+}
+
+func (p interfaceData) GetMethods() []MethodData {
+	methods := make([]MethodData, len(p.Method))
+	for i, v := range p.Method {
+		methods[i] = v
+	}
+	return methods
+}
+
+func (p interfaceData) GetSignals() []SignalData {
+	signals := make([]SignalData, len(p.Signal))
+	for i, v := range p.Signal {
+		signals[i] = v
+	}
+	return signals
+}
+
+func (p interfaceData) GetProperties() []PropertyData {
+	properties := make([]PropertyData, len(p.Property))
+	for i, v := range p.Property {
+		properties[i] = v
+	}
+	return properties
+}
+
+func (p interfaceData) GetAnnotation(name string) string {
+	return _Annotation(p.Annotation, name)
+}
+
 func (p interfaceData) GetName() string { return p.Name }
 
+// _IsDirection reports whether the argument goes in direction dir, "in" or
+// "out". Arguments without a direction attribute go in direction def, which
+// is "in" for methods.
+func (p argData) _IsDirection(dir, def string) bool {
+	if p.Direction == "" {
+		return dir == def
+	}
+	return strings.ToLower(p.Direction) == dir
+}
+
+// _Args returns args with their directions normalized, def being the
+// direction of arguments without one.
+func _Args(args []argData, def string) []ArgData {
+	ret := make([]ArgData, len(args))
+	for i, v := range args {
+		if v.Direction == "" {
+			v.Direction = def
+		} else {
+			v.Direction = strings.ToLower(v.Direction)
+		}
+		ret[i] = v
+	}
+	return ret
+}
+
+func (p argData) GetName() string { return p.Name }
+
+func (p argData) GetSignature() string { return p.Type }
+
+func (p argData) GetDirection() string { return p.Direction }
+
+func (p argData) GetAnnotation(name string) string {
+	return _Annotation(p.Annotation, name)
+}
+
 func (p methodData) GetInSignature() (sig string) {
 	for _, v := range p.Arg {
-		if strings.ToUpper(v.Direction) == "IN" {
+		if v._IsDirection("in", "in") {
 			sig += v.Type
 		}
 	}
@@ -111,13 +370,19 @@ func (p methodData) GetInSignature() (sig string) {
 
 func (p methodData) GetOutSignature() (sig string) {
 	for _, v := range p.Arg {
-		if strings.ToUpper(v.Direction) == "OUT" {
+		if v._IsDirection("out", "in") {
 			sig += v.Type
 		}
 	}
 	return
 }
 
+func (p methodData) GetArgs() []ArgData { return _Args(p.Arg, "in") }
+
+func (p methodData) GetAnnotation(name string) string {
+	return _Annotation(p.Annotation, name)
+}
+
 func (p methodData) GetName() string { return p.Name }
 
 func (p signalData) GetSignature() (sig string) {
@@ -127,4 +392,20 @@ func (p signalData) GetSignature() (sig string) {
 	return
 }
 
+func (p signalData) GetArgs() []ArgData { return _Args(p.Arg, "out") }
+
+func (p signalData) GetAnnotation(name string) string {
+	return _Annotation(p.Annotation, name)
+}
+
 func (p signalData) GetName() string { return p.Name }
+
+func (p propertyData) GetName() string { return p.Name }
+
+func (p propertyData) GetSignature() string { return p.Type }
+
+func (p propertyData) GetAccess() string { return p.Access }
+
+func (p propertyData) GetAnnotation(name string) string {
+	return _Annotation(p.Annotation, name)
+}
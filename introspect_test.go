@@ -76,3 +76,139 @@ func TestIntrospect(t *testing.T) {
 	}
 
 }
+
+func TestIntrospectLazy(t *testing.T) {
+	intro, e := NewIntrospect(`<node>
+	  <interface name="org.example.First">
+	    <method name="A"><arg type="s" direction="in"/></method>
+	  </interface>
+	  <interface name="org.example.Second">
+	    <method name="B"><arg type="u" direction="out"/></method>
+	  </interface>
+	</node>`)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if intf := intro.GetInterfaceData("org.example.Second"); intf == nil || intf.GetMethodData("B").GetOutSignature() != "u" {
+		t.Error("#2 Failed: second interface not decoded")
+	}
+	if intf := intro.GetInterfaceData("org.example.Missing"); intf != nil {
+		t.Error("#3 Failed: unknown interface found")
+	}
+	if len(intro.(*introspect).interfaces) != 2 {
+		t.Error("#4 Failed: unrequested interface decoded")
+	}
+
+	if _, e := NewIntrospect("<interface/>"); e != ErrIntrospectNoNode {
+		t.Error("#5 Failed:", e)
+	}
+}
+
+func TestArgDirection(t *testing.T) {
+	intro, e := NewIntrospect(`<node>
+	  <interface name="org.example.Iface">
+	    <method name="Defaults">
+	      <arg name="a" type="s"/>
+	      <arg name="b" type="u" direction="OUT"/>
+	      <arg name="c" type="i" direction="In"/>
+	    </method>
+	  </interface>
+	</node>`)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	meth := intro.GetInterfaceData("org.example.Iface").GetMethodData("Defaults")
+	if sig := meth.GetInSignature(); sig != "si" {
+		t.Error("#2 Failed:", sig)
+	}
+	if sig := meth.GetOutSignature(); sig != "u" {
+		t.Error("#3 Failed:", sig)
+	}
+}
+
+func TestIntrospectDocument(t *testing.T) {
+	intro, e := NewIntrospect(introStr)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if intro.GetName() != "/org/freedesktop/sample_object" {
+		t.Error("#1 Failed:", intro.GetName())
+	}
+	if names := intro.GetInterfaceNames(); len(names) != 1 || names[0] != "org.freedesktop.SampleInterface" {
+		t.Error("#2 Failed:", names)
+	}
+	children := intro.GetChildren()
+	if len(children) != 2 || children[0].GetName() != "child_of_sample_object" || children[1].GetName() != "another_child_of_sample_object" {
+		t.Fatal("#3 Failed:", children)
+	}
+	if len(children[0].GetInterfaceNames()) != 0 || len(children[0].GetChildren()) != 0 {
+		t.Error("#4 Failed")
+	}
+
+	intf := intro.GetInterfaceData("org.freedesktop.SampleInterface")
+	if len(intf.GetMethods()) != 3 || len(intf.GetSignals()) != 1 || len(intf.GetProperties()) != 1 {
+		t.Error("#5 Failed:", intf)
+	}
+	prop := intf.GetPropertyData("Bar")
+	if prop == nil || prop.GetSignature() != "y" || prop.GetAccess() != "readwrite" {
+		t.Error("#6 Failed:", prop)
+	}
+	meth := intf.GetMethodData("Frobate")
+	if meth.GetAnnotation("org.freedesktop.DBus.Deprecated") != "true" || meth.GetAnnotation("org.example.Missing") != "" {
+		t.Error("#7 Failed")
+	}
+	args := meth.GetArgs()
+	if len(args) != 3 || args[0].GetName() != "foo" || args[0].GetDirection() != "in" || args[2].GetSignature() != "a{us}" || args[2].GetDirection() != "out" {
+		t.Error("#8 Failed:", args)
+	}
+	if args := intf.GetSignalData("Changed").GetArgs(); len(args) != 1 || args[0].GetName() != "new_value" || args[0].GetDirection() != "out" {
+		t.Error("#9 Failed:", args)
+	}
+}
+
+func TestIntrospectNested(t *testing.T) {
+	intro, e := NewIntrospect(`<node>
+	  <interface name="org.example.Root">
+	    <annotation name="org.example.Tag" value="root"/>
+	  </interface>
+	  <node name="child">
+	    <interface name="org.example.Child">
+	      <property name="Size" type="t" access="read">
+	        <annotation name="org.freedesktop.DBus.Property.EmitsChangedSignal" value="const"/>
+	      </property>
+	      <method name="Set">
+	        <arg name="size" type="t">
+	          <annotation name="org.example.Unit" value="bytes"/>
+	        </arg>
+	      </method>
+	    </interface>
+	    <node name="grandchild"/>
+	  </node>
+	</node>`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if intro.GetInterfaceData("org.example.Root").GetAnnotation("org.example.Tag") != "root" {
+		t.Error("#1 Failed")
+	}
+	if intro.GetInterfaceData("org.example.Child") != nil {
+		t.Error("#2 Failed: child interface found on the root")
+	}
+	children := intro.GetChildren()
+	if len(children) != 1 || children[0].GetName() != "child" {
+		t.Fatal("#3 Failed:", children)
+	}
+	child := children[0].GetInterfaceData("org.example.Child")
+	if child == nil {
+		t.Fatal("#4 Failed")
+	}
+	if prop := child.GetPropertyData("Size"); prop.GetAnnotation("org.freedesktop.DBus.Property.EmitsChangedSignal") != "const" {
+		t.Error("#5 Failed:", prop)
+	}
+	if arg := child.GetMethodData("Set").GetArgs()[0]; arg.GetAnnotation("org.example.Unit") != "bytes" || arg.GetDirection() != "in" {
+		t.Error("#6 Failed:", arg)
+	}
+	if grandchildren := children[0].GetChildren(); len(grandchildren) != 1 || grandchildren[0].GetName() != "grandchild" {
+		t.Error("#7 Failed:", grandchildren)
+	}
+}
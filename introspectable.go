@@ -0,0 +1,157 @@
+package dbus
+
+import (
+	"sort"
+	"strings"
+)
+
+const INTROSPECTABLE_INTERFACE = "org.freedesktop.DBus.Introspectable"
+
+const introspectDocType = `<!DOCTYPE node PUBLIC "-//freedesktop//DTD D-BUS Object Introspection 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/introspect.dtd">
+`
+
+// standardIntrospect describes the interfaces the connection implements on
+// every object.
+const standardIntrospect = `  <interface name="org.freedesktop.DBus.Peer">
+    <method name="Ping"/>
+    <method name="GetMachineId">
+      <arg name="machine_uuid" type="s" direction="out"/>
+    </method>
+  </interface>
+  <interface name="org.freedesktop.DBus.Introspectable">
+    <method name="Introspect">
+      <arg name="xml_data" type="s" direction="out"/>
+    </method>
+  </interface>
+`
+
+// objectManagerIntrospect describes the interface of objects passed to
+// ExportObjectManager.
+const objectManagerIntrospect = `  <interface name="org.freedesktop.DBus.ObjectManager">
+    <method name="GetManagedObjects">
+      <arg name="objects" type="a{oa{sa{sv}}}" direction="out"/>
+    </method>
+    <signal name="InterfacesAdded">
+      <arg name="object" type="o"/>
+      <arg name="interfaces" type="a{sa{sv}}"/>
+    </signal>
+    <signal name="InterfacesRemoved">
+      <arg name="object" type="o"/>
+      <arg name="interfaces" type="as"/>
+    </signal>
+  </interface>
+`
+
+// _IntrospectExported answers an Introspect call with the document
+// _IntrospectXML generates. It returns nil if there is nothing to describe
+// at the path of call, or if the object exports Introspectable itself.
+func (p *Connection) _IntrospectExported(call *Message) *Message {
+	data, ok := p._IntrospectXML(call.Path)
+	if !ok {
+		return nil
+	}
+	reply := _NewMethodReturn(call)
+	reply.Sig = "s"
+	reply.Params = []interface{}{data}
+	return reply
+}
+
+// _IntrospectXML generates the introspection document of the object at
+// path from the signatures of its exported methods, with a node for each
+// child below which objects are exported. Arguments are unnamed, as Go does
+// not keep the names of parameters; interfaces exported by ExportMethods
+// with introspection data are described by it instead.
+func (p *Connection) _IntrospectXML(path string) (string, bool) {
+	p.exportsMutex.Lock()
+	defer p.exportsMutex.Unlock()
+	ifaces := p.exports[path]
+	if _, ok := ifaces[INTROSPECTABLE_INTERFACE]; ok {
+		return "", false
+	}
+	children := p._ChildNodes(path)
+	if len(ifaces) == 0 && !p.managers[path] && len(children) == 0 {
+		return "", false
+	}
+
+	names := make([]string, 0, len(ifaces))
+	for name := range ifaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := new(strings.Builder)
+	b.WriteString(introspectDocType)
+	b.WriteString("<node>\n")
+	b.WriteString(standardIntrospect)
+	if p.managers[path] {
+		b.WriteString(objectManagerIntrospect)
+	}
+	for _, name := range names {
+		if intro := strings.TrimSpace(ifaces[name].introspection); intro != "" {
+			b.WriteString("  " + intro + "\n")
+			continue
+		}
+		b.WriteString("  <interface name=\"" + name + "\">\n")
+		methods := ifaces[name].methods
+		members := make([]string, 0, len(methods))
+		for member := range methods {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		for _, member := range members {
+			method := methods[member]
+			if len(method.inArgs)+len(method.outArgs) == 0 {
+				b.WriteString("    <method name=\"" + member + "\"/>\n")
+				continue
+			}
+			b.WriteString("    <method name=\"" + member + "\">\n")
+			for _, sig := range method.inArgs {
+				b.WriteString("      <arg type=\"" + sig + "\" direction=\"in\"/>\n")
+			}
+			for _, sig := range method.outArgs {
+				b.WriteString("      <arg type=\"" + sig + "\" direction=\"out\"/>\n")
+			}
+			b.WriteString("    </method>\n")
+		}
+		b.WriteString("  </interface>\n")
+	}
+	for _, child := range children {
+		b.WriteString("  <node name=\"" + child + "\"/>\n")
+	}
+	b.WriteString("</node>\n")
+	return b.String(), true
+}
+
+// _ChildNodes returns the names of the children of path below which
+// objects or object managers are exported, sorted. The caller must hold
+// exportsMutex.
+func (p *Connection) _ChildNodes(path string) []string {
+	prefix := path + "/"
+	if path == "/" {
+		prefix = "/"
+	}
+	seen := make(map[string]bool)
+	add := func(other string) {
+		if other == path || !strings.HasPrefix(other, prefix) {
+			return
+		}
+		name := other[len(prefix):]
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[:i]
+		}
+		seen[name] = true
+	}
+	for other := range p.exports {
+		add(other)
+	}
+	for other := range p.managers {
+		add(other)
+	}
+	children := make([]string, 0, len(seen))
+	for name := range seen {
+		children = append(children, name)
+	}
+	sort.Strings(children)
+	return children
+}
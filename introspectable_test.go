@@ -0,0 +1,89 @@
+package dbus
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIntrospectExported(t *testing.T) {
+	client, server := newTestPeers(t)
+	if e := server.ExportObjectManager("/calc"); e != nil {
+		t.Fatal(e)
+	}
+	if e := server.Export(testCalc{}, "/calc/main", "org.example.Calc"); e != nil {
+		t.Fatal(e)
+	}
+
+	ret, e := client.Call("", "/calc/main", INTROSPECTABLE_INTERFACE, "Introspect")
+	if e != nil || len(ret) != 1 {
+		t.Fatal("#1 Failed:", ret, e)
+	}
+	intro, e := NewIntrospect(ret[0].(string))
+	if e != nil {
+		t.Fatal("#2 Failed:", e)
+	}
+	method := intro.GetInterfaceData("org.example.Calc").GetMethodData("Move")
+	if method == nil || method.GetInSignature() != "(ii)a{si}" || method.GetOutSignature() != "(ii)as" {
+		t.Error("#3 Failed:", method)
+	}
+	if intro.GetInterfaceData("org.example.Calc").GetMethodData("Ignored") != nil {
+		t.Error("#4 Failed")
+	}
+	if intro.GetInterfaceData(PEER_INTERFACE).GetMethodData("Ping") == nil {
+		t.Error("#5 Failed")
+	}
+
+	data, ok := server._IntrospectXML("/calc")
+	if !ok || !strings.Contains(data, `<interface name="`+OBJECT_MANAGER_INTERFACE+`">`) || !strings.Contains(data, `<node name="main"/>`) {
+		t.Error("#6 Failed:", data)
+	}
+	data, ok = server._IntrospectXML("/")
+	if !ok || !strings.Contains(data, `<node name="calc"/>`) || strings.Contains(data, OBJECT_MANAGER_INTERFACE) {
+		t.Error("#7 Failed:", data)
+	}
+	if _, e := client.Call("", "/other", INTROSPECTABLE_INTERFACE, "Introspect"); e == nil || e.(*Error).Name != ERROR_UNKNOWN_OBJECT {
+		t.Error("#8 Failed:", e)
+	}
+
+	// Objects may still implement Introspectable themselves.
+	if e := server.Export(testIntrospectable{}, "/calc/main", INTROSPECTABLE_INTERFACE); e != nil {
+		t.Fatal(e)
+	}
+	if ret, e := client.Call("", "/calc/main", INTROSPECTABLE_INTERFACE, "Introspect"); e != nil || ret[0] != "<node/>" {
+		t.Error("#9 Failed:", ret, e)
+	}
+}
+
+type testIntrospectable struct{}
+
+func (testIntrospectable) Introspect() string { return "<node/>" }
+
+func TestExportMethods(t *testing.T) {
+	client, server := newTestPeers(t)
+	add := func(a, b int32) (int32, error) { return a + b, nil }
+	intro := `<interface name="org.example.Adder">
+    <method name="add_two">
+      <arg name="a" type="i" direction="in"/>
+      <arg name="b" type="i" direction="in"/>
+      <arg name="sum" type="i" direction="out"/>
+    </method>
+  </interface>`
+	if e := server.ExportMethods(map[string]interface{}{"add_two": add}, intro, "/adder", "org.example.Adder"); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if ret, e := client.Call("", "/adder", "org.example.Adder", "add_two", int32(1), int32(2)); e != nil || len(ret) != 1 || ret[0] != int32(3) {
+		t.Error("#2 Failed:", ret, e)
+	}
+	if data, ok := server._IntrospectXML("/adder"); !ok || !strings.Contains(data, `<arg name="sum" type="i" direction="out"/>`) {
+		t.Error("#3 Failed:", data)
+	}
+	if e := server.ExportMethods(map[string]interface{}{"Bad": func(c chan int) {}}, "", "/adder", "org.example.Bad"); e != ErrNotExportable {
+		t.Error("#4 Failed:", e)
+	}
+	if e := server.ExportMethods(map[string]interface{}{"Bad": 1}, "", "/adder", "org.example.Bad"); e != ErrNotExportable {
+		t.Error("#5 Failed:", e)
+	}
+	if e := server.ExportMethods(map[string]interface{}{"a.b": add}, "", "/adder", "org.example.Bad"); e == nil {
+		t.Error("#6 Failed")
+	}
+}
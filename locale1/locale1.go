@@ -0,0 +1,120 @@
+// Package locale1 is a client of systemd-localed on the system bus, which
+// reads and sets the system locale and keyboard layouts.
+//
+// Setters take an interactive flag, which lets polkit ask the user to
+// authenticate if the caller is not privileged.
+package locale1
+
+import (
+	"errors"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION          = "org.freedesktop.locale1"
+	PATH                 = "/org/freedesktop/locale1"
+	INTERFACE            = "org.freedesktop.locale1"
+	PROPERTIES_INTERFACE = "org.freedesktop.DBus.Properties"
+)
+
+var (
+	ErrNoService = errors.New("NoLocaled")
+	ErrNoReply   = errors.New("EmptyReply")
+)
+
+// X11Keyboard is the keyboard configuration of the X server.
+type X11Keyboard struct {
+	Layout  string
+	Model   string
+	Variant string
+	Options string
+}
+
+// Client is the localed service.
+type Client struct {
+	conn  *dbus.Connection
+	iface *dbus.Interface
+	props *dbus.Interface
+}
+
+// NewClient returns the service reached through conn, which must be an
+// initialized connection to the system bus.
+func NewClient(conn *dbus.Connection) (*Client, error) {
+	obj := conn.GetObject(DESTINATION, PATH)
+	iface := conn.Interface(obj, INTERFACE)
+	props := conn.Interface(obj, PROPERTIES_INTERFACE)
+	if iface == nil || props == nil {
+		return nil, ErrNoService
+	}
+	return &Client{conn, iface, props}, nil
+}
+
+func (p *Client) _Get(name string, dest interface{}) error {
+	ret, err := p.conn.CallMethod(p.props, "Get", INTERFACE, name)
+	if err != nil {
+		return err
+	}
+	if len(ret) == 0 {
+		return ErrNoReply
+	}
+	return dbus.Store(ret[:1], dest)
+}
+
+// Locale returns the locale settings, like "LANG=en_US.UTF-8".
+func (p *Client) Locale() ([]string, error) {
+	var locale []string
+	err := p._Get("Locale", &locale)
+	return locale, err
+}
+
+// VConsoleKeymap returns the keymap of the virtual console.
+func (p *Client) VConsoleKeymap() (string, error) {
+	var keymap string
+	err := p._Get("VConsoleKeymap", &keymap)
+	return keymap, err
+}
+
+// X11Keyboard returns the keyboard configuration of the X server.
+func (p *Client) X11Keyboard() (*X11Keyboard, error) {
+	kbd := new(X11Keyboard)
+	for _, v := range []struct {
+		name string
+		dest *string
+	}{
+		{"X11Layout", &kbd.Layout},
+		{"X11Model", &kbd.Model},
+		{"X11Variant", &kbd.Variant},
+		{"X11Options", &kbd.Options},
+	} {
+		if err := p._Get(v.name, v.dest); err != nil {
+			return nil, err
+		}
+	}
+	return kbd, nil
+}
+
+// SetLocale sets the locale settings, each of the form "LANG=de_DE.UTF-8".
+func (p *Client) SetLocale(locale []string, interactive bool) error {
+	settings := make([]interface{}, len(locale))
+	for i, v := range locale {
+		settings[i] = v
+	}
+	_, err := p.conn.CallMethod(p.iface, "SetLocale", settings, interactive)
+	return err
+}
+
+// SetVConsoleKeyboard sets the keymap of the virtual console. If convert is
+// set, the X server keyboard is set to the closest match.
+func (p *Client) SetVConsoleKeyboard(keymap, toggle string, convert, interactive bool) error {
+	_, err := p.conn.CallMethod(p.iface, "SetVConsoleKeyboard", keymap, toggle, convert, interactive)
+	return err
+}
+
+// SetX11Keyboard sets the keyboard configuration of the X server. If convert
+// is set, the virtual console keymap is set to the closest match.
+func (p *Client) SetX11Keyboard(kbd *X11Keyboard, convert, interactive bool) error {
+	_, err := p.conn.CallMethod(p.iface, "SetX11Keyboard",
+		kbd.Layout, kbd.Model, kbd.Variant, kbd.Options, convert, interactive)
+	return err
+}
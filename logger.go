@@ -0,0 +1,30 @@
+package dbus
+
+import (
+	"log"
+)
+
+// Logger receives what a connection has to report but cannot return to a
+// caller, like messages it drops or why it failed. *log.Logger implements
+// it.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// _Logf reports an event to the Logger of the connection, if any.
+func (p *Connection) _Logf(format string, args ...interface{}) {
+	if p.Logger != nil {
+		p.Logger.Printf("dbus: "+format, args...)
+	}
+}
+
+// _LogViolation reports a received message which breaks the specification
+// but is delivered anyway. Without a Logger, it goes to the standard
+// logger, as VIOLATION_LOG asks for it to be seen.
+func (p *Connection) _LogViolation(v *ViolationError, msg *Message) {
+	if p.Logger == nil {
+		log.Printf("dbus: %v in %s from %s", v, msg.Member, msg.Sender)
+		return
+	}
+	p._Logf("%v in %s from %s", v, msg.Member, msg.Sender)
+}
@@ -0,0 +1,57 @@
+package dbus
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testLogger chan string
+
+func (p testLogger) Printf(format string, args ...interface{}) {
+	p <- fmt.Sprintf(format, args...)
+}
+
+func TestLoggerOrphanedReply(t *testing.T) {
+	con, _ := newTestBus(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "GetNameOwner" {
+			bus.Reply(msg, "s", ":1.2")
+			bus.Reply(msg, "s", ":1.2")
+		}
+	})
+	logger := make(testLogger, 4)
+	con.Logger = logger
+	if e := con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+
+	if _, e := con.CallMethod(con.proxy, "GetNameOwner", "org.example.Name"); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	select {
+	case line := <-logger:
+		if !strings.HasPrefix(line, "dbus: reply to unknown serial") {
+			t.Error("#2 Failed:", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("#2 Failed: nothing logged")
+	}
+
+	con.Close()
+	select {
+	case line := <-logger:
+		t.Error("#3 Failed: closing logged", line)
+	default:
+	}
+}
+
+func TestLoggerNil(t *testing.T) {
+	con := new(Connection)
+	con._Logf("nothing %d", 1)
+	con.Logger = make(testLogger, 1)
+	con._LogViolation(&ViolationError{"bad"}, &Message{Member: "Bad", Sender: ":1.2"})
+	if line := <-con.Logger.(testLogger); !strings.Contains(line, "in Bad from :1.2") {
+		t.Error("#1 Failed:", line)
+	}
+}
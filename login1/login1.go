@@ -0,0 +1,148 @@
+// Package login1 wraps the systemd-logind manager on the system bus:
+// enumerating sessions, seats and users, taking inhibitor locks and
+// watching for suspend and shutdown.
+package login1
+
+import (
+	"errors"
+	"os"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION       = "org.freedesktop.login1"
+	PATH              = "/org/freedesktop/login1"
+	MANAGER_INTERFACE = "org.freedesktop.login1.Manager"
+)
+
+var (
+	ErrNoManager = errors.New("NoLoginManager")
+
+	// ErrUnixFDUnsupported is returned by Inhibit, whose reply carries a
+	// file descriptor, on connections which cannot receive them.
+	ErrUnixFDUnsupported = dbus.ErrUnixFDsUnsupported
+)
+
+// Inhibitor lock modes.
+const (
+	MODE_BLOCK = "block"
+	MODE_DELAY = "delay"
+)
+
+// Session is an entry of ListSessions.
+type Session struct {
+	ID   string
+	UID  uint32
+	User string
+	Seat string
+	Path string
+}
+
+// Seat is an entry of ListSeats.
+type Seat struct {
+	ID   string
+	Path string
+}
+
+// User is an entry of ListUsers.
+type User struct {
+	UID  uint32
+	Name string
+	Path string
+}
+
+// Manager is the logind manager object.
+type Manager struct {
+	conn  *dbus.Connection
+	iface *dbus.Interface
+}
+
+// NewManager returns the manager reached through conn, which must be an
+// initialized connection to the system bus.
+func NewManager(conn *dbus.Connection) (*Manager, error) {
+	obj := conn.GetObject(DESTINATION, PATH)
+	iface := conn.Interface(obj, MANAGER_INTERFACE)
+	if iface == nil {
+		return nil, ErrNoManager
+	}
+	return &Manager{conn, iface}, nil
+}
+
+func (p *Manager) _List(method string, dest interface{}) error {
+	ret, err := p.conn.CallMethod(p.iface, method)
+	if err != nil {
+		return err
+	}
+	return dbus.Store(ret, dest)
+}
+
+// ListSessions returns the current sessions.
+func (p *Manager) ListSessions() ([]Session, error) {
+	var sessions []Session
+	err := p._List("ListSessions", &sessions)
+	return sessions, err
+}
+
+// ListSeats returns the available seats.
+func (p *Manager) ListSeats() ([]Seat, error) {
+	var seats []Seat
+	err := p._List("ListSeats", &seats)
+	return seats, err
+}
+
+// ListUsers returns the users logged in.
+func (p *Manager) ListUsers() ([]User, error) {
+	var users []User
+	err := p._List("ListUsers", &users)
+	return users, err
+}
+
+// Inhibit takes an inhibitor lock on the colon separated operations what,
+// like "sleep:shutdown", which is held until the returned file is closed.
+// The lock is passed as a file descriptor, so this fails with
+// ErrUnixFDUnsupported on connections which cannot receive them.
+func (p *Manager) Inhibit(what, who, why, mode string) (*os.File, error) {
+	if !p.conn.SupportsUnixFDs() {
+		return nil, ErrUnixFDUnsupported
+	}
+	ret, err := p.conn.CallMethod(p.iface, "Inhibit", what, who, why, mode)
+	if err != nil {
+		return nil, err
+	}
+	var fd dbus.UnixFD
+	if err = dbus.Store(ret, &fd); err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "inhibitor"), nil
+}
+
+// OnPrepareForSleep calls proc with true before the system suspends and
+// with false after it resumed. Programs holding a delay lock must release it
+// from proc for the suspend to proceed. The handler can be passed to
+// RemoveSignalHandler to stop watching.
+func (p *Manager) OnPrepareForSleep(proc func(start bool)) (*dbus.SignalHandler, error) {
+	return p._AddBoolSignalHandler("PrepareForSleep", proc)
+}
+
+// OnPrepareForShutdown calls proc with true before the system shuts down,
+// and with false if the shutdown was cancelled.
+func (p *Manager) OnPrepareForShutdown(proc func(start bool)) (*dbus.SignalHandler, error) {
+	return p._AddBoolSignalHandler("PrepareForShutdown", proc)
+}
+
+func (p *Manager) _AddBoolSignalHandler(member string, proc func(bool)) (*dbus.SignalHandler, error) {
+	mr := &dbus.MatchRule{
+		Type:      "signal",
+		Sender:    DESTINATION,
+		Interface: MANAGER_INTERFACE,
+		Member:    member,
+		Path:      PATH,
+	}
+	return p.conn.AddSignalHandler(mr, func(msg *dbus.Message) {
+		var start bool
+		if dbus.Store(msg.Params, &start) == nil {
+			proc(start)
+		}
+	})
+}
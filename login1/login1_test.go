@@ -0,0 +1,46 @@
+package login1
+
+import (
+	"testing"
+
+	"github.com/norisatir/go-dbus"
+)
+
+func TestListSessionsReply(t *testing.T) {
+	ret := []interface{}{[]interface{}{
+		[]interface{}{"2", uint32(1000), "alice", "seat0", "/org/freedesktop/login1/session/_32"},
+	}}
+	var sessions []Session
+	if e := dbus.Store(ret, &sessions); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if len(sessions) != 1 || sessions[0].UID != 1000 || sessions[0].Seat != "seat0" {
+		t.Error("#2 Failed:", sessions)
+	}
+}
+
+func TestInhibitUnsupported(t *testing.T) {
+	if _, e := (&Manager{conn: new(dbus.Connection)}).Inhibit("sleep", "test", "testing", MODE_DELAY); e != ErrUnixFDUnsupported {
+		t.Error("#1 Failed:", e)
+	}
+}
+
+func TestPrepareHandlers(t *testing.T) {
+	conn := new(dbus.Connection)
+	// One rule for the signal and one to track the owner of login1.
+	conn.MaxMatchRules = 2
+	manager := &Manager{conn: conn}
+	sleep, e := manager.OnPrepareForSleep(func(bool) {})
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if _, e = manager.OnPrepareForShutdown(func(bool) {}); e != dbus.ErrTooManyMatchRules {
+		t.Error("#2 Failed:", e)
+	}
+	if e = conn.RemoveSignalHandler(sleep); e != nil {
+		t.Error("#3 Failed:", e)
+	}
+	if _, e = manager.OnPrepareForShutdown(func(bool) {}); e != nil {
+		t.Error("#4 Failed:", e)
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
+	"reflect"
+	"sort"
 	"strings"
+	"unicode/utf8"
 )
 
 func _Align(length int, index int) int {
@@ -27,106 +31,391 @@ func _AppendAlign(length int, buff *bytes.Buffer) {
 	}
 }
 
-func _AppendString(buff *bytes.Buffer, str string) {
-	_AppendAlign(4, buff)
-	binary.Write(buff, binary.LittleEndian, int32(len(str)))
-	buff.Write([]byte(str))
+// encoder marshals values in the byte order order, collecting the file
+// descriptors of unix_fd values in fds.
+type encoder struct {
+	order binary.ByteOrder
+	fds   []int
+}
+
+// _NewEncoder returns an encoder for the byte order order, little endian if
+// it is nil.
+func _NewEncoder(order binary.ByteOrder) *encoder {
+	if order == nil {
+		order = binary.LittleEndian
+	}
+	return &encoder{order: order}
+}
+
+func (p *encoder) _AppendString(buff *bytes.Buffer, str string) {
+	p._AppendUint32(buff, uint32(len(str)))
+	buff.WriteString(str)
 	buff.WriteByte(0)
 }
 
 func _AppendSignature(buff *bytes.Buffer, sig string) {
 	_AppendByte(buff, byte(len(sig)))
-	buff.Write([]byte(sig))
+	buff.WriteString(sig)
 	buff.WriteByte(0)
 }
 
-func _AppendByte(buff *bytes.Buffer, b byte) { binary.Write(buff, binary.LittleEndian, b) }
+func _AppendByte(buff *bytes.Buffer, b byte) { buff.WriteByte(b) }
 
-func _AppendUint32(buff *bytes.Buffer, ui uint32) {
-	_AppendAlign(4, buff)
-	binary.Write(buff, binary.LittleEndian, ui)
+// _AppendUint16, _AppendUint32 and _AppendUint64 append an aligned integer
+// in place, as binary.Write or a local array passed to the byte order would
+// allocate for every value.
+func (p *encoder) _AppendUint16(buff *bytes.Buffer, q uint16) {
+	_AppendAlign(2, buff)
+	pos := buff.Len()
+	buff.Write(zeroPadding[:2])
+	p.order.PutUint16(buff.Bytes()[pos:], q)
 }
 
-func _AppendInt32(buff *bytes.Buffer, i int32) {
+func (p *encoder) _AppendUint32(buff *bytes.Buffer, ui uint32) {
 	_AppendAlign(4, buff)
-	binary.Write(buff, binary.LittleEndian, i)
+	pos := buff.Len()
+	buff.Write(zeroPadding[:4])
+	p.order.PutUint32(buff.Bytes()[pos:], ui)
 }
 
-func _AppendArray(buff *bytes.Buffer, align int, proc func(b *bytes.Buffer)) {
-	_AppendAlign(4, buff)
+func (p *encoder) _AppendUint64(buff *bytes.Buffer, t uint64) {
+	_AppendAlign(8, buff)
+	pos := buff.Len()
+	buff.Write(zeroPadding[:8])
+	p.order.PutUint64(buff.Bytes()[pos:], t)
+}
+
+func (p *encoder) _AppendInt32(buff *bytes.Buffer, i int32) {
+	p._AppendUint32(buff, uint32(i))
+}
+
+// _AppendArray appends an array whose elements are appended by proc. The
+// padding from the length to the first element, aligned to align, is not
+// part of the array length.
+func (p *encoder) _AppendArray(buff *bytes.Buffer, align int, proc func(b *bytes.Buffer)) {
+	p._AppendUint32(buff, 0) // replaced with the array length
+	pos := buff.Len() - 4
 	_AppendAlign(align, buff)
-	b := bytes.NewBuffer(buff.Bytes())
-	b.Write([]byte("ABCD")) // "ABCD" will be replaced with array-size.
-	pos1 := b.Len()
-	proc(b)
-	pos2 := b.Len()
-	binary.Write(buff, binary.LittleEndian, int32(pos2-pos1))
-	buff.Write(b.Bytes()[pos1:pos2])
+	start := buff.Len()
+	proc(buff)
+	p.order.PutUint32(buff.Bytes()[pos:], uint32(buff.Len()-start))
+}
+
+// basicGoTypes are the Go types the fixed size basic types are marshalled
+// from.
+var basicGoTypes = map[byte]reflect.Type{
+	'y': reflect.TypeOf(byte(0)),
+	'b': reflect.TypeOf(false),
+	'n': reflect.TypeOf(int16(0)),
+	'q': reflect.TypeOf(uint16(0)),
+	'i': reflect.TypeOf(int32(0)),
+	'u': reflect.TypeOf(uint32(0)),
+	'x': reflect.TypeOf(int64(0)),
+	't': reflect.TypeOf(uint64(0)),
+	'd': reflect.TypeOf(float64(0)),
+}
+
+// _ConvertBasic returns val as a value of the Go type t of the basic type
+// c. Values of named types with the same kind as t are converted, other
+// types are an error.
+func _ConvertBasic(val interface{}, c byte, t reflect.Type) (interface{}, error) {
+	v := reflect.ValueOf(val)
+	switch {
+	case !v.IsValid() || v.Kind() != t.Kind():
+		return nil, fmt.Errorf("cannot marshal %T as %s", val, typeNames[c])
+	case v.Type() != t:
+		return v.Convert(t).Interface(), nil
+	}
+	return val, nil
+}
+
+// _AlignOf returns the alignment of the type starting with t.
+func _AlignOf(t byte) int {
+	switch t {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 'h', 's', 'o', 'a':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 1
+}
+
+// _AppendValue appends val as a little endian value of the complete type
+// starting sig, and returns the length of that type.
+func _AppendValue(buff *bytes.Buffer, sig string, val interface{}) (int, error) {
+	return _NewEncoder(nil)._AppendValue(buff, sig, val)
 }
 
-func _AppendValue(buff *bytes.Buffer, sig string, val interface{}) (sigOffset int, e error) {
+func (p *encoder) _AppendValue(buff *bytes.Buffer, sig string, val interface{}) (sigOffset int, e error) {
 	if len(sig) == 0 {
 		return 0, errors.New("Invalid Signature")
 	}
 
-	e = nil
+	if v := reflect.ValueOf(val); v.Kind() == reflect.Ptr && !v.IsNil() {
+		val = v.Elem().Interface()
+	}
+	if t, ok := basicGoTypes[sig[0]]; ok {
+		if val, e = _ConvertBasic(val, sig[0], t); e != nil {
+			return 0, e
+		}
+	}
 
 	switch sig[0] {
 	case 'y': // byte
 		_AppendByte(buff, val.(byte))
 		sigOffset = 1
 
+	case 'b': // bool
+		var v uint32
+		if val.(bool) {
+			v = 1
+		}
+		p._AppendUint32(buff, v)
+		sigOffset = 1
+
+	case 'n': // int16
+		p._AppendUint16(buff, uint16(val.(int16)))
+		sigOffset = 1
+
+	case 'q': // uint16
+		p._AppendUint16(buff, val.(uint16))
+		sigOffset = 1
+
+	case 'x': // int64
+		p._AppendUint64(buff, uint64(val.(int64)))
+		sigOffset = 1
+
+	case 't': // uint64
+		p._AppendUint64(buff, val.(uint64))
+		sigOffset = 1
+
+	case 'd': // double
+		p._AppendUint64(buff, math.Float64bits(val.(float64)))
+		sigOffset = 1
+
 	case 's': // string
-		_AppendString(buff, val.(string))
+		str, ok := val.(string)
+		if !ok {
+			return 0, fmt.Errorf("cannot marshal %T as a string", val)
+		}
+		p._AppendString(buff, str)
+		sigOffset = 1
+
+	case 'o': // object path
+		var path string
+		switch v := val.(type) {
+		case ObjectPath:
+			path = string(v)
+		case string:
+			path = v
+		default:
+			return 0, fmt.Errorf("cannot marshal %T as an object path", val)
+		}
+		if e := ValidateObjectPath(path); e != nil {
+			return 0, e
+		}
+		p._AppendString(buff, path)
+		sigOffset = 1
+
+	case 'g': // signature
+		var str string
+		switch v := val.(type) {
+		case Signature:
+			str = string(v)
+		case string:
+			str = v
+		default:
+			return 0, fmt.Errorf("cannot marshal %T as a signature", val)
+		}
+		if e := Signature(str).Validate(); e != nil {
+			return 0, e
+		}
+		_AppendSignature(buff, str)
+		sigOffset = 1
+
+	case 'v': // variant
+		variant, ok := val.(Variant)
+		if !ok {
+			variant = NewVariant(val)
+		}
+		if "?" == variant.Sig {
+			return 0, errors.New("Unsupported variant value")
+		}
+		if e := _CheckVariantSignature(variant.Sig); e != nil {
+			return 0, e
+		}
+		_AppendSignature(buff, variant.Sig)
+		if _, e := p._AppendValue(buff, variant.Sig, variant.Value); e != nil {
+			return 0, e
+		}
 		sigOffset = 1
 
 	case 'u': // uint32
-		_AppendUint32(buff, val.(uint32))
+		p._AppendUint32(buff, val.(uint32))
+		sigOffset = 1
+
+	case 'h': // unix fd
+		fd, ok := val.(UnixFD)
+		if !ok {
+			return 0, fmt.Errorf("cannot marshal %T as a unix fd", val)
+		}
+		idx := len(p.fds)
+		for i, f := range p.fds {
+			if f == int(fd) {
+				idx = i
+			}
+		}
+		if idx == len(p.fds) {
+			if idx == MAX_UNIX_FDS {
+				return 0, fmt.Errorf("more than %d unix fds", MAX_UNIX_FDS)
+			}
+			p.fds = append(p.fds, int(fd))
+		}
+		p._AppendUint32(buff, uint32(idx))
 		sigOffset = 1
 
 	case 'i': // int32
-		_AppendInt32(buff, val.(int32))
+		p._AppendInt32(buff, val.(int32))
 		sigOffset = 1
 
 	case 'a': // ary
-		sigBlock, _ := _GetSigBlock(sig, 1)
-		_AppendArray(buff, 1, func(b *bytes.Buffer) {
-			if slice, ok := val.([]interface{}); ok && slice != nil {
-				for _, v := range slice {
-					_AppendValue(b, sigBlock, v)
+		sigBlock, e := _GetSingleType(sig, 1)
+		if e != nil {
+			return 0, e
+		}
+		if b, ok := val.([]byte); ok && "y" == sigBlock {
+			p._AppendUint32(buff, uint32(len(b)))
+			buff.Write(b)
+			sigOffset = 2
+			break
+		}
+		slice, ok := val.([]interface{})
+		if v := reflect.ValueOf(val); !ok && val != nil {
+			switch {
+			case v.Kind() == reflect.Map && '{' == sigBlock[0]:
+				slice = _MapEntries(v)
+			case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+				slice = _Elements(v)
+			default:
+				return 0, fmt.Errorf("cannot marshal %T as %s", val, "a"+sigBlock)
+			}
+		}
+		p._AppendArray(buff, _AlignOf(sigBlock[0]), func(b *bytes.Buffer) {
+			for _, v := range slice {
+				if _, e = p._AppendValue(b, sigBlock, v); e != nil {
+					return
 				}
 			}
 		})
+		if e != nil {
+			return 0, e
+		}
 		sigOffset = 1 + len(sigBlock)
 
-	case '(': // struct FIXME: nested struct not support
+	case '(', '{': // struct, dict entry
 		_AppendAlign(8, buff)
-		structSig, _ := _GetStructSig(sig, 0)
-		for i, s := range structSig {
-			_AppendValue(buff, string(s), val.([]interface{})[i])
+		t, e := _GetSingleType(sig, 0)
+		if e != nil {
+			return 0, e
 		}
-		sigOffset = 2 + len(structSig)
-
-	case '{':
-		_AppendAlign(8, buff)
-		dictSig, _ := _GetDictSig(sig, 0)
-		for i, s := range dictSig {
-			_AppendValue(buff, string(s), val.([]interface{})[i])
+		fields, ok := val.([]interface{})
+		if v := reflect.ValueOf(val); !ok && v.Kind() == reflect.Struct {
+			fields, ok = _WireValue(v).([]interface{})
+		} else if !ok && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) {
+			fields, ok = _Elements(v), true
+		}
+		if !ok {
+			return 0, fmt.Errorf("cannot marshal %T as %s", val, t)
+		}
+		types, _ := ParseSignature(t[1 : len(t)-1])
+		if len(types) != len(fields) {
+			return 0, fmt.Errorf("%s needs %d fields, got %d", t, len(types), len(fields))
 		}
-		sigOffset = 2 + len(dictSig)
+		if e = p._AppendFields(buff, t[1:len(t)-1], fields); e != nil {
+			return 0, e
+		}
+		sigOffset = len(t)
 	}
 
 	return
 }
 
-func _AppendParamsData(buff *bytes.Buffer, sig string, params []interface{}) {
+// _Elements returns the elements of the slice or array v.
+func _Elements(v reflect.Value) []interface{} {
+	elems := make([]interface{}, v.Len())
+	for i := range elems {
+		elems[i] = v.Index(i).Interface()
+	}
+	return elems
+}
+
+// _MapEntries returns the dict entries of the map v, sorted by key.
+func _MapEntries(v reflect.Value) []interface{} {
+	keys := _SortedMapKeys(v)
+	entries := make([]interface{}, len(keys))
+	for i, k := range keys {
+		entries[i] = []interface{}{k.Interface(), v.MapIndex(k).Interface()}
+	}
+	return entries
+}
+
+// _SortedMapKeys returns the keys of the map v in order, so that maps
+// marshal the same every time. Keys of kinds without an order keep the
+// order of iteration.
+func _SortedMapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.String:
+			return a.String() < b.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.Bool:
+			return !a.Bool() && b.Bool()
+		}
+		return false
+	})
+	return keys
+}
+
+// _AppendFields appends the fields of a struct or dict entry, whose
+// signature sig may contain any complete types.
+func (p *encoder) _AppendFields(buff *bytes.Buffer, sig string, fields []interface{}) error {
+	for sigIdx, i := 0, 0; sigIdx < len(sig) && i < len(fields); i++ {
+		offset, e := p._AppendValue(buff, sig[sigIdx:], fields[i])
+		if e != nil {
+			return e
+		}
+		sigIdx += offset
+	}
+	return nil
+}
+
+// _AppendParamsData appends params as little endian values of the
+// signature sig.
+func _AppendParamsData(buff *bytes.Buffer, sig string, params []interface{}) error {
+	return _NewEncoder(nil)._AppendParamsData(buff, sig, params)
+}
+
+func (p *encoder) _AppendParamsData(buff *bytes.Buffer, sig string, params []interface{}) error {
 	sigOffset := 0
 	prmsOffset := 0
 	sigLen := len(sig)
 	for ; sigOffset < sigLen; prmsOffset++ {
-		offset, _ := _AppendValue(buff, sig[sigOffset:len(sig)], params[prmsOffset])
+		offset, e := p._AppendValue(buff, sig[sigOffset:len(sig)], params[prmsOffset])
+		if e != nil {
+			return e
+		}
 		sigOffset += offset
 	}
+	return nil
 }
 
 func _GetByte(buff []byte, index int) (byte, error) {
@@ -136,64 +425,60 @@ func _GetByte(buff []byte, index int) (byte, error) {
 	return buff[index], nil
 }
 
-func _GetInt16(buff []byte, index int) (int16, error) {
+func (p *decoder) _GetInt16(buff []byte, index int) (int16, error) {
 	if len(buff) <= index+2-1 {
 		return 0, errors.New("index error")
 	}
-	var n int16
-	e := binary.Read(bytes.NewBuffer(buff[index:len(buff)]), binary.LittleEndian, &n)
-	if e != nil {
-		return 0, e
-	}
-	return n, nil
+	return int16(p._Order().Uint16(buff[index:])), nil
 }
 
-func _GetUint16(buff []byte, index int) (uint16, error) {
+func (p *decoder) _GetUint16(buff []byte, index int) (uint16, error) {
 	if len(buff) <= index+2-1 {
 		return 0, errors.New("index error")
 	}
-	var q uint16
-	e := binary.Read(bytes.NewBuffer(buff[index:len(buff)]), binary.LittleEndian, &q)
-	if e != nil {
-		return 0, e
+	return p._Order().Uint16(buff[index:]), nil
+}
+
+func (p *decoder) _GetInt32(buff []byte, index int) (int32, error) {
+	if len(buff) <= index+4-1 {
+		return 0, errors.New("index error")
 	}
-	return q, nil
+	return int32(p._Order().Uint32(buff[index:])), nil
 }
 
-func _GetInt32(buff []byte, index int) (int32, error) {
+func (p *decoder) _GetUint32(buff []byte, index int) (uint32, error) {
 	if len(buff) <= index+4-1 {
 		return 0, errors.New("index error")
 	}
-	var l int32
-	e := binary.Read(bytes.NewBuffer(buff[index:len(buff)]), binary.LittleEndian, &l)
-	if e != nil {
-		return 0, e
+	return p._Order().Uint32(buff[index:]), nil
+}
+
+func (p *decoder) _GetInt64(buff []byte, index int) (int64, error) {
+	if len(buff) <= index+8-1 {
+		return 0, errors.New("index error")
 	}
-	return l, nil
+	return int64(p._Order().Uint64(buff[index:])), nil
 }
 
-func _GetUint32(buff []byte, index int) (uint32, error) {
-	if len(buff) <= index+4-1 {
+func (p *decoder) _GetUint64(buff []byte, index int) (uint64, error) {
+	if len(buff) <= index+8-1 {
 		return 0, errors.New("index error")
 	}
-	var u uint32
-	e := binary.Read(bytes.NewBuffer(buff[index:len(buff)]), binary.LittleEndian, &u)
-	if e != nil {
-		return 0, e
+	return p._Order().Uint64(buff[index:]), nil
+}
+
+func (p *decoder) _GetDouble(buff []byte, index int) (float64, error) {
+	if len(buff) <= index+8-1 {
+		return 0, errors.New("index error")
 	}
-	return u, nil
+	return math.Float64frombits(p._Order().Uint64(buff[index:])), nil
 }
 
-func _GetBoolean(buff []byte, index int) (bool, error) {
+func (p *decoder) _GetBoolean(buff []byte, index int) (bool, error) {
 	if len(buff) <= index+4-1 {
 		return false, errors.New("index error")
 	}
-	var v int32
-	e := binary.Read(bytes.NewBuffer(buff[index:len(buff)]), binary.LittleEndian, &v)
-	if e != nil {
-		return false, e
-	}
-	return 0 != v, nil
+	return 0 != p._Order().Uint32(buff[index:]), nil
 }
 
 func _GetString(buff []byte, index int, size int) (string, error) {
@@ -203,90 +488,146 @@ func _GetString(buff []byte, index int, size int) (string, error) {
 	return string(buff[index : index+size]), nil
 }
 
-func _GetStructSig(sig string, startIdx int) (string, error) {
-	if len(sig) <= startIdx || '(' != sig[startIdx] {
-		return "<nil>", errors.New("index error")
-	}
-	sigIdx := startIdx + 1
-	for depth := 0; sigIdx < len(sig); sigIdx++ {
-		switch sig[sigIdx] {
-		case ')':
-			if depth == 0 {
-				return sig[startIdx+1 : sigIdx], nil
-			}
-			depth--
-		case '(':
-			depth++
-		}
-	}
+// decoder records the protocol violations found while parsing: values
+// which can be decoded, but which a conforming peer never sends.
+type decoder struct {
+	order     binary.ByteOrder
+	fds       []int // received with the message, for unix_fd values
+	violation error
+	variants  int  // depth of the variants being decoded
+	alias     bool // large byte arrays may be sliced out of the buffer
+	aliased   bool // some were
+}
 
-	return "<nil>", errors.New("parse error")
+// _Order returns the byte order decoded, little endian unless set.
+func (p *decoder) _Order() binary.ByteOrder {
+	if p.order == nil {
+		return binary.LittleEndian
+	}
+	return p.order
 }
 
-func _GetDictSig(sig string, startIdx int) (string, error) {
-	if len(sig) <= startIdx || '{' != sig[startIdx] {
-		return "<nil>", errors.New("index error")
+func (p *decoder) _Violation(format string, args ...interface{}) {
+	if p.violation == nil {
+		p.violation = &ViolationError{fmt.Sprintf(format, args...)}
 	}
-	sigIdx := startIdx + 1
-	for depth := 0; sigIdx < len(sig); sigIdx++ {
-		switch sig[sigIdx] {
-		case '}':
-			if depth == 0 {
-				return sig[startIdx+1 : sigIdx], nil
-			}
-			depth--
-		case '{':
-			depth++
+}
+
+// _Pad aligns index to n, checking that the padding skipped is zero.
+func (p *decoder) _Pad(buff []byte, n int, index int) int {
+	aligned := _Align(n, index)
+	for i := index; i < aligned && i < len(buff); i++ {
+		if buff[i] != 0 {
+			p._Violation("non-zero padding at %d", i)
+			break
 		}
 	}
+	return aligned
+}
 
-	return "<nil>", errors.New("parse error")
+// _CheckString checks a string, object path or signature of type t, which
+// was followed by the byte term.
+func (p *decoder) _CheckString(t byte, str string, term byte, index int) {
+	switch {
+	case term != 0:
+		p._Violation("string at %d is not terminated", index)
+	case strings.IndexByte(str, 0) >= 0:
+		p._Violation("string at %d contains a nul byte", index)
+	case t == 's' && !utf8.ValidString(str):
+		p._Violation("string at %d is not valid UTF-8", index)
+	case t == 'o' && ValidateObjectPath(str) != nil:
+		p._Violation("invalid object path at %d", index)
+	case t == 'g' && Signature(str).Validate() != nil:
+		p._Violation("invalid signature at %d", index)
+	}
 }
 
-func _GetSigBlock(sig string, index int) (string, error) {
-	switch sig[index] {
-	case '(':
-		str, e := _GetStructSig(sig, index)
+// _GetStringValue decodes the string, object path or signature of type t at
+// index, returning it and the index following it.
+func (p *decoder) _GetStringValue(buff []byte, t byte, index int) (string, int, error) {
+	start, size := index, 0
+	if t == 'g' {
+		b, e := _GetByte(buff, index)
 		if e != nil {
-			return "", e
+			return "", index, e
 		}
-		return strings.Join([]string{"(", str, ")"}, ""), nil
-
-	case '{':
-		str, e := _GetDictSig(sig, index)
+		start, size = index+1, int(b)
+	} else {
+		index = p._Pad(buff, 4, index)
+		n, e := p._GetInt32(buff, index)
 		if e != nil {
-			return "", e
+			return "", index, e
 		}
-		return strings.Join([]string{"{", str, "}"}, ""), nil
-
+		if n < 0 {
+			return "", index, errors.New("index error")
+		}
+		start, size = index+4, int(n)
 	}
-
-	// default
-	return sig[index : index+1], nil
+	if len(buff) <= start+size {
+		return "", index, errors.New("index error")
+	}
+	str := string(buff[start : start+size])
+	p._CheckString(t, str, buff[start+size], index)
+	return str, start + size + 1, nil
 }
 
-func _GetVariant(buff []byte, index int) (vals []interface{}, retidx int, e error) {
+func (p *decoder) _GetVariant(buff []byte, index int) (variant Variant, retidx int, e error) {
 	retidx = index
+	if len(buff) <= retidx {
+		return variant, index, errors.New("index error")
+	}
 	sigSize := int(buff[retidx])
 	retidx++
-	sig := string(buff[retidx : retidx+sigSize])
-	vals, retidx, e = Parse(buff, sig, retidx+sigSize+1)
-	return
+	if len(buff) <= retidx+sigSize {
+		return variant, index, errors.New("index error")
+	}
+	variant.Sig = string(buff[retidx : retidx+sigSize])
+	if e = _CheckVariantSignature(variant.Sig); e != nil {
+		return variant, index, e
+	}
+	if p.variants++; p.variants > MAX_VARIANT_NESTING {
+		return variant, index, ErrVariantNesting
+	}
+	vals, retidx, e := p._Parse(buff, variant.Sig, retidx+sigSize+1)
+	p.variants--
+	if e != nil {
+		return variant, index, e
+	}
+	variant.Value = vals[0]
+	return variant, retidx, nil
+}
+
+// Parse decodes the values of signature sig from buff, starting at index.
+// Protocol violations which do not prevent decoding are ignored.
+func Parse(buff []byte, sig string, index int) ([]interface{}, int, error) {
+	return new(decoder)._Parse(buff, sig, index)
 }
 
-func Parse(buff []byte, sig string, index int) (slice []interface{}, bufIdx int, err error) {
-	slice = make([]interface{}, 0)
+// _ParseAppend works like Parse, but appends the values to dst.
+func _ParseAppend(dst []interface{}, buff []byte, sig string, index int) ([]interface{}, int, error) {
+	return new(decoder)._ParseAppend(dst, buff, sig, index)
+}
+
+func (p *decoder) _Parse(buff []byte, sig string, index int) ([]interface{}, int, error) {
+	return p._ParseAppend(make([]interface{}, 0), buff, sig, index)
+}
+
+func (p *decoder) _ParseAppend(dst []interface{}, buff []byte, sig string, index int) (slice []interface{}, bufIdx int, err error) {
+	slice = dst
 	bufIdx = index
 	for sigIdx := 0; sigIdx < len(sig); {
 		switch sig[sigIdx] {
 		case 'b': // bool
-			bufIdx = _Align(4, bufIdx)
-			b, e := _GetBoolean(buff, bufIdx)
+			bufIdx = p._Pad(buff, 4, bufIdx)
+			b, e := p._GetUint32(buff, bufIdx)
 			if e != nil {
 				err = e
 				return
 			}
-			slice = append(slice, bool(b))
+			if b > 1 {
+				p._Violation("boolean value %d at %d", b, bufIdx)
+			}
+			slice = append(slice, b != 0)
 			bufIdx += 4
 			sigIdx++
 
@@ -301,8 +642,8 @@ func Parse(buff []byte, sig string, index int) (slice []interface{}, bufIdx int,
 			sigIdx++
 
 		case 'n': // int16
-			bufIdx = _Align(2, bufIdx)
-			n, e := _GetInt16(buff, bufIdx)
+			bufIdx = p._Pad(buff, 2, bufIdx)
+			n, e := p._GetInt16(buff, bufIdx)
 			if e != nil {
 				err = e
 				return
@@ -312,8 +653,8 @@ func Parse(buff []byte, sig string, index int) (slice []interface{}, bufIdx int,
 			sigIdx++
 
 		case 'q': // uint16
-			bufIdx = _Align(2, bufIdx)
-			q, e := _GetUint16(buff, bufIdx)
+			bufIdx = p._Pad(buff, 2, bufIdx)
+			q, e := p._GetUint16(buff, bufIdx)
 			if e != nil {
 				err = e
 				return
@@ -322,118 +663,175 @@ func Parse(buff []byte, sig string, index int) (slice []interface{}, bufIdx int,
 			bufIdx += 2
 			sigIdx++
 
-		case 'u': // uint32
-			bufIdx = _Align(4, bufIdx)
-			u, e := _GetUint32(buff, bufIdx)
+		case 'i': // int32
+			bufIdx = p._Pad(buff, 4, bufIdx)
+			i, e := p._GetInt32(buff, bufIdx)
 			if e != nil {
 				err = e
 				return
 			}
-			slice = append(slice, u)
+			slice = append(slice, i)
+			bufIdx += 4
+			sigIdx++
+
+		case 'h': // unix fd, as an index into the fds of the message
+			bufIdx = p._Pad(buff, 4, bufIdx)
+			h, e := p._GetUint32(buff, bufIdx)
+			if e != nil {
+				err = e
+				return
+			}
+			if int(h) >= len(p.fds) {
+				err = fmt.Errorf("unix fd index %d out of range", h)
+				return
+			}
+			slice = append(slice, UnixFD(p.fds[h]))
 			bufIdx += 4
 			sigIdx++
 
-		case 's', 'o': // string, object
-			bufIdx = _Align(4, bufIdx)
+		case 'x': // int64
+			bufIdx = p._Pad(buff, 8, bufIdx)
+			x, e := p._GetInt64(buff, bufIdx)
+			if e != nil {
+				err = e
+				return
+			}
+			slice = append(slice, x)
+			bufIdx += 8
+			sigIdx++
 
-			size, e := _GetInt32(buff, bufIdx)
+		case 't': // uint64
+			bufIdx = p._Pad(buff, 8, bufIdx)
+			t, e := p._GetUint64(buff, bufIdx)
 			if e != nil {
 				err = e
 				return
 			}
+			slice = append(slice, t)
+			bufIdx += 8
+			sigIdx++
 
-			str, e := _GetString(buff, bufIdx+4, int(size))
+		case 'd': // double
+			bufIdx = p._Pad(buff, 8, bufIdx)
+			d, e := p._GetDouble(buff, bufIdx)
 			if e != nil {
 				err = e
 				return
 			}
-			slice = append(slice, str)
-			bufIdx += (4 + int(size) + 1)
+			slice = append(slice, d)
+			bufIdx += 8
 			sigIdx++
 
-		case 'g': // signature
-			size, e := _GetByte(buff, bufIdx)
+		case 'u': // uint32
+			bufIdx = p._Pad(buff, 4, bufIdx)
+			u, e := p._GetUint32(buff, bufIdx)
 			if e != nil {
 				err = e
 				return
 			}
+			slice = append(slice, u)
+			bufIdx += 4
+			sigIdx++
 
-			str, e := _GetString(buff, bufIdx+1, int(size))
+		case 's', 'o', 'g': // string, object, signature
+			str, idx, e := p._GetStringValue(buff, sig[sigIdx], bufIdx)
 			if e != nil {
 				err = e
 				return
 			}
-			slice = append(slice, str)
-			bufIdx += (1 + int(size) + 1)
+			switch sig[sigIdx] {
+			case 'o':
+				slice = append(slice, ObjectPath(str))
+			case 'g':
+				slice = append(slice, Signature(str))
+			default:
+				slice = append(slice, str)
+			}
+			bufIdx = idx
 			sigIdx++
 
 		case 'a': // array
-			startIdx := _Align(4, bufIdx)
-			arySize, e := _GetInt32(buff, startIdx)
+			startIdx := p._Pad(buff, 4, bufIdx)
+			arySize, e := p._GetInt32(buff, startIdx)
 			if e != nil {
 				err = e
 				return
 			}
 
-			sigBlock, e := _GetSigBlock(sig, sigIdx+1)
+			sigBlock, e := _GetSingleType(sig, sigIdx+1)
 			if e != nil {
 				err = e
 				return
 			}
 
-			aryIdx := startIdx + 4
+			if "y" == sigBlock { // byte arrays are taken at once
+				dataIdx := startIdx + 4
+				aryEnd := dataIdx + int(arySize)
+				if arySize < 0 || arySize > MAX_ARRAY_LENGTH || len(buff) < aryEnd {
+					err = errors.New("index error")
+					return
+				}
+				// Sliced only out of buffers mostly made of it, so
+				// that a small array does not hold on to a large
+				// buffer, and capped, so that appending to it copies.
+				if p.alias && arySize >= largeArraySize && 2*int(arySize) >= cap(buff) {
+					slice = append(slice, buff[dataIdx:aryEnd:aryEnd])
+					p.aliased = true
+				} else {
+					slice = append(slice, append([]byte(nil), buff[dataIdx:aryEnd]...))
+				}
+				bufIdx = aryEnd
+				sigIdx += 2
+				continue
+			}
+
+			aryStart := p._Pad(buff, _AlignOf(sigBlock[0]), startIdx+4)
+			aryEnd := aryStart + int(arySize)
+			if arySize < 0 || arySize > MAX_ARRAY_LENGTH || len(buff) < aryEnd {
+				err = errors.New("index error")
+				return
+			}
+			aryIdx := aryStart
 			tmpSlice := make([]interface{}, 0)
-			for aryIdx < (startIdx+4)+int(arySize) {
-				retSlice, retidx, e := Parse(buff, sigBlock, aryIdx)
+			for aryIdx < aryEnd {
+				// Elements are appended in place, rather than parsed
+				// into slices of their own and copied.
+				retSlice, retidx, e := p._ParseAppend(tmpSlice, buff[:aryEnd], sigBlock, aryIdx)
 				if e != nil {
 					err = e
 					return
 				}
-				tmpSlice = append(tmpSlice, retSlice...)
+				if retidx == aryIdx {
+					err = errors.New("empty array element")
+					return
+				}
+				tmpSlice = retSlice
 				aryIdx = retidx
 			}
 			bufIdx = aryIdx
 			sigIdx += (1 + len(sigBlock))
 			slice = append(slice, tmpSlice)
 
-		case '(': // struct
-			idx := _Align(8, bufIdx)
-			stSig, e := _GetStructSig(sig, sigIdx)
-			if e != nil {
-				err = e
-				return
-			}
-
-			retSlice, retidx, e := Parse(buff, stSig, idx)
+		case '(', '{': // struct, dict entry
+			idx := p._Pad(buff, 8, bufIdx)
+			t, e := _GetSingleType(sig, sigIdx)
 			if e != nil {
 				err = e
 				return
 			}
 
-			bufIdx = retidx
-			sigIdx += (len(stSig) + 2)
-			slice = append(slice, retSlice)
-
-		case '{': // dict
-			idx := _Align(8, bufIdx)
-			stSig, e := _GetDictSig(sig, sigIdx)
-			if e != nil {
-				err = e
-				return
-			}
-
-			retSlice, retidx, e := Parse(buff, stSig, idx)
+			retSlice, retidx, e := p._Parse(buff, t[1:len(t)-1], idx)
 			if e != nil {
 				err = e
 				return
 			}
 
 			bufIdx = retidx
-			sigIdx += (len(stSig) + 2)
+			sigIdx += len(t)
 			slice = append(slice, retSlice)
 
 		case 'v': // variant
-			vals, idx, e := _GetVariant(buff, bufIdx)
+			variant, idx, e := p._GetVariant(buff, bufIdx)
 			if e != nil {
 				err = e
 				return
@@ -441,12 +839,207 @@ func Parse(buff []byte, sig string, index int) (slice []interface{}, bufIdx int,
 
 			bufIdx = idx
 			sigIdx++
-			slice = append(slice, vals...)
+			slice = append(slice, variant)
 
 		default:
-			fmt.Println(sig[sigIdx])
 			return nil, index, errors.New("unknown type")
 		}
 	}
 	return
 }
+
+// _InferSignature returns the signature for args, as inferred from their Go
+// types by _GuessSignature.
+func _InferSignature(args []interface{}) (string, error) {
+	sig := ""
+	for _, arg := range args {
+		s := _GuessSignature(arg)
+		if "?" == s {
+			return "", fmt.Errorf("cannot infer signature of %T", arg)
+		}
+		sig += s
+	}
+	return sig, nil
+}
+
+// _CheckArgs checks that sig is made of one complete type for each of args.
+func _CheckArgs(sig string, args []interface{}) error {
+	n := 0
+	for i := 0; i < len(sig); n++ {
+		t, e := _GetSingleType(sig, i)
+		if e != nil {
+			return errors.New("Invalid Signature")
+		}
+		i += len(t)
+	}
+	if n != len(args) {
+		return fmt.Errorf("signature %q needs %d arguments, got %d", sig, n, len(args))
+	}
+	return nil
+}
+
+var (
+	objectPathType = reflect.TypeOf(ObjectPath(""))
+	signatureType  = reflect.TypeOf(Signature(""))
+)
+
+// _StructFields returns the indices of the fields of the struct type t which
+// are D-Bus struct fields, in order. Unexported fields and fields tagged
+// `dbus:"-"` are skipped.
+func _StructFields(t reflect.Type) []int {
+	indices := make([]int, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("dbus") == "-" {
+			continue
+		}
+		indices = append(indices, i)
+	}
+	return indices
+}
+
+// _IsStruct tells whether val is a struct or a non-nil pointer to one.
+func _IsStruct(val interface{}) bool {
+	v := reflect.ValueOf(val)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v.Kind() == reflect.Struct
+}
+
+// _SignatureOf returns the signature of values of the Go type t, as they
+// are marshalled after conversion by _WireValue.
+func _SignatureOf(t reflect.Type) (string, error) {
+	switch t {
+	case variantType:
+		return "v", nil
+	case unixFDType:
+		return "h", nil
+	}
+	switch t.Kind() {
+	case reflect.Uint8:
+		return "y", nil
+	case reflect.Bool:
+		return "b", nil
+	case reflect.Int16:
+		return "n", nil
+	case reflect.Uint16:
+		return "q", nil
+	case reflect.Int32:
+		return "i", nil
+	case reflect.Uint32:
+		return "u", nil
+	case reflect.Int64:
+		return "x", nil
+	case reflect.Uint64:
+		return "t", nil
+	case reflect.Float64:
+		return "d", nil
+	case reflect.String:
+		switch t {
+		case objectPathType:
+			return "o", nil
+		case signatureType:
+			return "g", nil
+		}
+		return "s", nil
+	case reflect.Slice:
+		elem, e := _SignatureOf(t.Elem())
+		if e != nil {
+			return "", e
+		}
+		return "a" + elem, nil
+	case reflect.Map:
+		key, e := _SignatureOf(t.Key())
+		if e != nil {
+			return "", e
+		}
+		if len(key) != 1 || key == "v" {
+			return "", fmt.Errorf("no signature for map key %s", t.Key())
+		}
+		elem, e := _SignatureOf(t.Elem())
+		if e != nil {
+			return "", e
+		}
+		return "a{" + key + elem + "}", nil
+	case reflect.Struct:
+		sig := ""
+		for _, i := range _StructFields(t) {
+			field, e := _SignatureOf(t.Field(i).Type)
+			if e != nil {
+				return "", e
+			}
+			sig += field
+		}
+		if sig == "" {
+			return "", fmt.Errorf("no signature for empty struct %s", t)
+		}
+		return "(" + sig + ")", nil
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "v", nil
+		}
+	}
+	return "", fmt.Errorf("no signature for type %s", t)
+}
+
+// _WireValue converts v into the representation the marshaller expects for
+// the signature returned by _SignatureOf: named types become their basic
+// types, slices other than []byte and structs become []interface{}, and
+// maps become slices of dict entries.
+func _WireValue(v reflect.Value) interface{} {
+	if v.Type() == variantType {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Uint8:
+		return byte(v.Uint())
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int16:
+		return int16(v.Int())
+	case reflect.Uint16:
+		return uint16(v.Uint())
+	case reflect.Int32:
+		return int32(v.Int())
+	case reflect.Uint32:
+		return uint32(v.Uint())
+	case reflect.Int64:
+		return v.Int()
+	case reflect.Uint64:
+		return v.Uint()
+	case reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Bytes()
+		}
+		slice := make([]interface{}, v.Len())
+		for i := range slice {
+			slice[i] = _WireValue(v.Index(i))
+		}
+		return slice
+	case reflect.Map:
+		keys := _SortedMapKeys(v)
+		entries := make([]interface{}, len(keys))
+		for i, k := range keys {
+			entries[i] = []interface{}{_WireValue(k), _WireValue(v.MapIndex(k))}
+		}
+		return entries
+	case reflect.Struct:
+		indices := _StructFields(v.Type())
+		fields := make([]interface{}, len(indices))
+		for j, i := range indices {
+			fields[j] = _WireValue(v.Field(i))
+		}
+		return fields
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return _WireValue(v.Elem())
+	}
+	return v.Interface()
+}
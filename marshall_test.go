@@ -36,7 +36,7 @@ func TestAppendAlign(t *testing.T) {
 func checkAppendString(t *testing.T, input []string, expected string) {
 	buff := bytes.NewBuffer([]byte{})
 	for _, str := range input {
-		_AppendString(buff, str)
+		_NewEncoder(nil)._AppendString(buff, str)
 	}
 	if !bytes.Equal([]byte(expected), buff.Bytes()) {
 		t.Error("Failed:expected", []byte(expected), ", actual:", buff.Bytes())
@@ -62,12 +62,12 @@ func TestAppendByte(t *testing.T) {
 
 func TestAppendUint32(t *testing.T) {
 	buff := bytes.NewBuffer([]byte{})
-	_AppendUint32(buff, 1)
+	_NewEncoder(nil)._AppendUint32(buff, 1)
 	if !bytes.Equal([]byte("\x01\x00\x00\x00"), buff.Bytes()) {
 		t.Error("#1 Failed")
 	}
 	_AppendByte(buff, 2)
-	_AppendUint32(buff, 0xffffffff)
+	_NewEncoder(nil)._AppendUint32(buff, 0xffffffff)
 	if !bytes.Equal([]byte("\x01\x00\x00\x00\x02\x00\x00\x00\xff\xff\xff\xff"), buff.Bytes()) {
 		t.Error("#2 Failed")
 	}
@@ -75,7 +75,7 @@ func TestAppendUint32(t *testing.T) {
 
 func TestAppendInt32(t *testing.T) {
 	buff := bytes.NewBuffer([]byte{})
-	_AppendInt32(buff, int32(-1))
+	_NewEncoder(nil)._AppendInt32(buff, int32(-1))
 	if !bytes.Equal([]byte("\xff\xff\xff\xff"), buff.Bytes()) {
 		t.Error("#1 Failed")
 	}
@@ -97,7 +97,7 @@ func TestAppendArray(t *testing.T) {
 	_AppendByte(buff, 4)
 	_AppendByte(buff, 5)
 
-	_AppendArray(buff, 1,
+	_NewEncoder(nil)._AppendArray(buff, 1,
 		func(b *bytes.Buffer) {
 			t.Log(b.Bytes())
 			_AppendAlign(8, b)
@@ -125,11 +125,119 @@ func TestAppendValue(t *testing.T) {
 	slice = append(slice, []interface{}{"test2", uint32(2)})
 	slice = append(slice, []interface{}{"test3", uint32(3)})
 	_AppendValue(buff, "a(su)", slice)
-	if !bytes.Equal([]byte("\x34\x00\x00\x00\x00\x00\x00\x00\x05\x00\x00\x00test1\x00\x00\x00\x01\x00\x00\x00\x05\x00\x00\x00test2\x00\x00\x00\x02\x00\x00\x00\x05\x00\x00\x00test3\x00\x00\x00\x03\x00\x00\x00"), buff.Bytes()) {
+	if !bytes.Equal([]byte("\x30\x00\x00\x00\x00\x00\x00\x00\x05\x00\x00\x00test1\x00\x00\x00\x01\x00\x00\x00\x05\x00\x00\x00test2\x00\x00\x00\x02\x00\x00\x00\x05\x00\x00\x00test3\x00\x00\x00\x03\x00\x00\x00"), buff.Bytes()) {
 		t.Error("#2 Failed", buff.Bytes())
 	}
 }
 
+func TestAppendDict(t *testing.T) {
+	buff := bytes.NewBuffer([]byte{})
+	dict := []interface{}{
+		[]interface{}{"urgency", byte(2)},
+		[]interface{}{"transient", true},
+		[]interface{}{"category", "im"},
+	}
+	_AppendValue(buff, "a{sv}", dict)
+	if size := buff.Bytes()[0]; size != uint8(buff.Len()-8) {
+		t.Error("#1 Failed: array length includes padding", size, buff.Len())
+	}
+
+	slice, _, e := Parse(buff.Bytes(), "a{sv}", 0)
+	if e != nil {
+		t.Fatal("#2 Failed:", e)
+	}
+	if !reflect.DeepEqual(_Unwrap(slice[0]), dict) {
+		t.Error("#3 Failed:", slice[0])
+	}
+}
+
+func TestAppendMap(t *testing.T) {
+	props := map[string]interface{}{"urgency": byte(2), "category": "im"}
+	buff := new(bytes.Buffer)
+	if _, e := _AppendValue(buff, "a{sv}", props); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	slice, _, e := Parse(buff.Bytes(), "a{sv}", 0)
+	if e != nil {
+		t.Fatal("#2 Failed:", e)
+	}
+	expected := []interface{}{
+		[]interface{}{"category", "im"},
+		[]interface{}{"urgency", byte(2)},
+	}
+	if !reflect.DeepEqual(_Unwrap(slice[0]), expected) {
+		t.Error("#3 Failed:", slice[0])
+	}
+
+	var variants map[string]Variant
+	if e := Store(slice, &variants); e != nil {
+		t.Fatal("#4 Failed:", e)
+	}
+	if variants["urgency"] != (Variant{"y", byte(2)}) {
+		t.Error("#5 Failed:", variants)
+	}
+	buff.Reset()
+	if _, e := _AppendValue(buff, "a{sv}", variants); e != nil {
+		t.Fatal("#6 Failed:", e)
+	}
+	if again, _, _ := Parse(buff.Bytes(), "a{sv}", 0); !reflect.DeepEqual(again, slice) {
+		t.Error("#7 Failed:", again)
+	}
+
+	buff.Reset()
+	if _, e := _AppendValue(buff, "a{us}", map[uint32]string{2: "b", 1: "a"}); e != nil {
+		t.Fatal("#8 Failed:", e)
+	}
+	var codes map[uint32]string
+	if slice, _, e = Parse(buff.Bytes(), "a{us}", 0); e != nil || Store(slice, &codes) != nil {
+		t.Fatal("#9 Failed:", e)
+	}
+	if entries := slice[0].([]interface{}); len(entries) != 2 || entries[0].([]interface{})[0] != uint32(1) || codes[2] != "b" {
+		t.Error("#10 Failed:", slice[0], codes)
+	}
+
+	sig, e := _InferSignature([]interface{}{props, variants, codes})
+	if e != nil || sig != "a{sv}a{sv}a{us}" {
+		t.Error("#11 Failed:", sig, e)
+	}
+}
+
+func TestInferSignature(t *testing.T) {
+	type point struct{ X, Y int32 }
+	for i, test := range []struct {
+		arg interface{}
+		sig string
+	}{
+		{[]string{"a"}, "as"},
+		{[]uint32{1}, "au"},
+		{[]ObjectPath{"/a"}, "ao"},
+		{[]Variant{NewVariant("a")}, "av"},
+		{[][]byte{[]byte("a")}, "aay"},
+		{[2]int32{1, 2}, "ai"},
+		{[]point{{1, 2}}, "a(ii)"},
+		{map[string][]string{"a": {"b"}}, "a{sas}"},
+		{&point{1, 2}, "(ii)"},
+	} {
+		if sig, e := _InferSignature([]interface{}{test.arg}); e != nil || sig != test.sig {
+			t.Errorf("#%d Failed: %q %v", i+1, sig, e)
+		}
+	}
+	if _, e := _InferSignature([]interface{}{[]int{1}}); e == nil {
+		t.Error("#10 Failed")
+	}
+	if _, e := _InferSignature([]interface{}{nil}); e == nil {
+		t.Error("#11 Failed")
+	}
+
+	buff := new(bytes.Buffer)
+	if _, e := _AppendValue(buff, "v", NewVariant([2]string{"a", "b"})); e != nil {
+		t.Fatal("#12 Failed:", e)
+	}
+	if slice, _, e := Parse(buff.Bytes(), "v", 0); e != nil || !reflect.DeepEqual(slice[0], Variant{"as", []interface{}{"a", "b"}}) {
+		t.Error("#13 Failed:", slice, e)
+	}
+}
+
 func TestGetByte(t *testing.T) {
 	if b, _ := _GetByte([]byte("\x00\x11"), 1); b != 0x11 {
 		t.Errorf("#1 Failed 0x%X != 0x11", b)
@@ -140,14 +248,14 @@ func TestGetByte(t *testing.T) {
 }
 
 func TestGetBoolean(t *testing.T) {
-	b, e := _GetBoolean([]byte("\x01\x00\x00\x00"), 0)
+	b, e := new(decoder)._GetBoolean([]byte("\x01\x00\x00\x00"), 0)
 	if e != nil {
 		t.Error("#1-1 Failed")
 	}
 	if true != b {
 		t.Error("#1-2 Failed")
 	}
-	_, e = _GetBoolean([]byte("\x01\x00\x00\x00"), 1)
+	_, e = new(decoder)._GetBoolean([]byte("\x01\x00\x00\x00"), 1)
 	if e == nil {
 		t.Error("#2 Failed")
 	}
@@ -164,52 +272,43 @@ func TestGetString(t *testing.T) {
 	}
 }
 
-func TestGetStructSig(t *testing.T) {
+func TestGetSingleType(t *testing.T) {
 	var str string
 	var e error
-	str, _ = _GetStructSig("(yyy)(yyy)", 0)
-	if "yyy" != str {
+	str, _ = _GetSingleType("(yyy)(yyy)", 0)
+	if "(yyy)" != str {
 		t.Error("#1 Failed:", str)
 	}
 
-	str, _ = _GetStructSig("(y(ppp))yy", 0)
-	if "y(ppp)" != str {
+	str, _ = _GetSingleType("(y(sss))yy", 0)
+	if "(y(sss))" != str {
 		t.Error("#2 Failed:", str)
 	}
 
-	str, _ = _GetStructSig("((test))yy", 0)
-	if "(test)" != str {
+	str, _ = _GetSingleType("123aa{sv}yy", 3)
+	if "aa{sv}" != str {
 		t.Error("#3 Failed:", str)
 	}
 
-	str, _ = _GetStructSig("123((test))yy", 3)
-	if "(test)" != str {
+	str, _ = _GetSingleType("a{sv}", 1)
+	if "{sv}" != str {
 		t.Error("#4 Failed:", str)
 	}
 
-	_, e = _GetStructSig("((test)(test)", 0)
+	_, e = _GetSingleType("((s)(s)", 0)
 	if e == nil {
 		t.Error("#5 Failed")
 	}
 
-	_, e = _GetStructSig("((test(test", 0)
+	_, e = _GetSingleType("((s(s", 0)
 	if e == nil {
 		t.Error("#6 Failed")
 	}
 
-}
-
-func TestGetSigBlock(t *testing.T) {
-	var str string
-	str, _ = _GetSigBlock("123a3", 3)
-	if "a" != str {
-		t.Error("#1 Failed:", str)
-	}
-	str, _ = _GetSigBlock("123(abc)", 3)
-	if "(abc)" != str {
-		t.Error("#2 Failed:", str)
+	_, e = _GetSingleType("a", 0)
+	if e == nil {
+		t.Error("#7 Failed")
 	}
-
 }
 
 // sliceRef([1,2,3], 1) => 2
@@ -254,7 +353,7 @@ func TestParse(t *testing.T) {
 		t.Error("#3-4 Failed:")
 	}
 
-	ret, _, e := Parse([]byte("\x22\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x04\x00\x00\x00true\x00\x00\x00\x00\x00\x00\x00\x00\x05\x00\x00\x00false\x00"), "a(bs)", 0)
+	ret, _, e := Parse([]byte("\x1e\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x04\x00\x00\x00true\x00\x00\x00\x00\x00\x00\x00\x00\x05\x00\x00\x00false\x00"), "a(bs)", 0)
 	if e != nil {
 		t.Error(e.Error())
 	}
@@ -281,9 +380,9 @@ func TestParse(t *testing.T) {
 }
 
 func TestGetVariant(t *testing.T) {
-	val, index, _ := _GetVariant([]byte("\x00\x00\x01s\x00\x00\x00\x00\x04\x00\x00\x00test\x00"), 2)
-	str, ok := val[0].(string)
-	if !ok {
+	val, index, _ := new(decoder)._GetVariant([]byte("\x00\x00\x01s\x00\x00\x00\x00\x04\x00\x00\x00test\x00"), 2)
+	str, ok := val.Value.(string)
+	if !ok || val.Sig != "s" {
 		t.Error("#1-1 Failed")
 	}
 	if "test" != str {
@@ -299,14 +398,14 @@ func TestParseVariant(t *testing.T) {
 	if nil != e {
 		t.Error("#1 Failed")
 	}
-	if "test" != vec[0].(string) {
+	if vec[0] != (Variant{"s", "test"}) {
 		t.Error("#2 Failed")
 	}
-	if 3 != vec[1].(byte) {
+	if vec[1] != (Variant{"y", byte(3)}) {
 		t.Error("#3 Failed")
 	}
-	if 4 != vec[2].(uint32) {
-		t.Error("#4 Failed", vec[2].(uint32))
+	if vec[2] != (Variant{"u", uint32(4)}) {
+		t.Error("#4 Failed", vec[2])
 	}
 }
 
@@ -318,10 +417,23 @@ func TestParseNumber(t *testing.T) {
 	if uint32(4) != sliceRef(vec, 0).(uint32) {
 		t.Error("#1 Failed", sliceRef(vec, 0).(uint32))
 	}
+
+	buff := bytes.NewBuffer([]byte{})
+	params := []interface{}{int32(-2), uint64(1) << 40, int64(-3), float64(0.5)}
+	for i, sig := range "itxd" {
+		_AppendValue(buff, string(sig), params[i])
+	}
+	vec, _, e = Parse(buff.Bytes(), "itxd", 0)
+	if nil != e {
+		t.Error("#2 Failed:", e)
+	}
+	if !reflect.DeepEqual(params, vec) {
+		t.Error("#3 Failed:", vec)
+	}
 }
 
 func TestGetUint32(t *testing.T) {
-	u, e := _GetUint32([]byte("\x04\x00\x00\x00"), 0)
+	u, e := new(decoder)._GetUint32([]byte("\x04\x00\x00\x00"), 0)
 	if e != nil {
 		t.Error("Failed", e.Error())
 	}
@@ -331,7 +443,7 @@ func TestGetUint32(t *testing.T) {
 }
 
 func TestGetInt32(t *testing.T) {
-	i, e := _GetInt32([]byte("\x04\x00\x00\x00"), 0)
+	i, e := new(decoder)._GetInt32([]byte("\x04\x00\x00\x00"), 0)
 	if e != nil {
 		t.Error("Failed")
 	}
@@ -339,3 +451,161 @@ func TestGetInt32(t *testing.T) {
 		t.Error("#1 Failed", i)
 	}
 }
+
+func TestAppendNested(t *testing.T) {
+	buff := bytes.NewBuffer([]byte{})
+	subject := []interface{}{
+		"system-bus-name",
+		[]interface{}{[]interface{}{"name", ":1.42"}},
+	}
+	lists := []interface{}{[]interface{}{"a", "b"}, []interface{}{"c"}}
+	_AppendValue(buff, "(sa{sv})", subject)
+	_AppendValue(buff, "aas", lists)
+
+	slice, _, e := Parse(buff.Bytes(), "(sa{sv})aas", 0)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if !reflect.DeepEqual(_Unwrap(slice[0]), subject) {
+		t.Error("#2 Failed:", slice[0])
+	}
+	if !reflect.DeepEqual(slice[1], lists) {
+		t.Error("#3 Failed:", slice[1])
+	}
+}
+
+func TestAppendNestedGo(t *testing.T) {
+	type level uint32
+	type entry struct {
+		Name  string
+		Props map[string]interface{}
+	}
+	sig := "a(sa{sv})a{sas}aa{sv}vaau"
+	params := []interface{}{
+		[]entry{{"a", map[string]interface{}{"x": int32(1)}}, {"b", nil}},
+		map[string][]string{"k": {"v1", "v2"}},
+		[]map[string]Variant{{"y": NewVariant(byte(1))}},
+		Variant{"a(ii)", [][]int32{{1, 2}, {3, 4}}},
+		[][]level{{1}, {}, {2, 3}},
+	}
+	buff := new(bytes.Buffer)
+	if e := _AppendParamsData(buff, sig, params); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	slice, _, e := Parse(buff.Bytes(), sig, 0)
+	if e != nil {
+		t.Fatal("#2 Failed:", e)
+	}
+
+	var entries []entry
+	var lists map[string][]string
+	var dicts []map[string]byte
+	var pairs [][]int32
+	var levels [][]level
+	if e := Store(slice, &entries, &lists, &dicts, &pairs, &levels); e != nil {
+		t.Fatal("#3 Failed:", e)
+	}
+	if len(entries) != 2 || entries[0].Props["x"] != int32(1) || entries[1].Name != "b" || len(entries[1].Props) != 0 {
+		t.Error("#4 Failed:", entries)
+	}
+	if !reflect.DeepEqual(lists, map[string][]string{"k": {"v1", "v2"}}) {
+		t.Error("#5 Failed:", lists)
+	}
+	if !reflect.DeepEqual(dicts, []map[string]byte{{"y": 1}}) {
+		t.Error("#6 Failed:", dicts)
+	}
+	if !reflect.DeepEqual(pairs, [][]int32{{1, 2}, {3, 4}}) {
+		t.Error("#7 Failed:", pairs)
+	}
+	if !reflect.DeepEqual(levels, [][]level{{1}, {}, {2, 3}}) {
+		t.Error("#8 Failed:", levels)
+	}
+
+	if e := _AppendParamsData(new(bytes.Buffer), "au", []interface{}{[]string{"x"}}); e == nil {
+		t.Error("#9 Failed")
+	}
+	if e := _AppendParamsData(new(bytes.Buffer), "as", []interface{}{"x"}); e == nil {
+		t.Error("#10 Failed")
+	}
+}
+
+func TestParseVariantNesting(t *testing.T) {
+	v := NewVariant(int32(1))
+	for i := 0; i < MAX_VARIANT_NESTING; i++ {
+		v = Variant{"v", v}
+	}
+	buff := new(bytes.Buffer)
+	if _, e := _AppendValue(buff, "v", v); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if _, _, e := Parse(buff.Bytes(), "v", 0); e != ErrVariantNesting {
+		t.Error("#2 Failed:", e)
+	}
+	if _, _, e := Parse(buff.Bytes()[3:], "v", 0); e != nil {
+		t.Error("#3 Failed:", e)
+	}
+}
+
+func TestAppendStringMap(t *testing.T) {
+	buff := bytes.NewBuffer([]byte{})
+	_AppendValue(buff, "v", map[string]string{"b": "2", "a": "1"})
+
+	slice, _, e := Parse(buff.Bytes(), "v", 0)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	expected := []interface{}{[]interface{}{"a", "1"}, []interface{}{"b", "2"}}
+	if !reflect.DeepEqual(slice[0], Variant{"a{ss}", expected}) {
+		t.Error("#2 Failed:", slice[0])
+	}
+}
+
+func TestMarshalStruct(t *testing.T) {
+	type inner struct {
+		Id uint32
+	}
+	type outer struct {
+		Name    string
+		Skipped int     `dbus:"-"`
+		hidden  float64 // unexported
+		Inner   inner
+	}
+	src := outer{"foo", 1, 2.5, inner{7}}
+
+	sig, e := _InferSignature([]interface{}{src, &src})
+	if e != nil || sig != "(s(u))(s(u))" {
+		t.Fatal("#1 Failed:", sig, e)
+	}
+
+	buff := new(bytes.Buffer)
+	if e := _AppendParamsData(buff, "(s(u))a(s(u))", []interface{}{src, []interface{}{&src}}); e != nil {
+		t.Fatal("#2 Failed:", e)
+	}
+	slice, _, e := new(decoder)._Parse(buff.Bytes(), "(s(u))a(s(u))", 0)
+	if e != nil {
+		t.Fatal("#3 Failed:", e)
+	}
+	expected := []interface{}{"foo", []interface{}{uint32(7)}}
+	if !reflect.DeepEqual(slice[0], expected) {
+		t.Error("#4 Failed:", slice[0])
+	}
+
+	var dest outer
+	var dests []outer
+	if e := Store(slice, &dest, &dests); e != nil {
+		t.Fatal("#5 Failed:", e)
+	}
+	if dest.Name != "foo" || dest.Inner.Id != 7 || dest.Skipped != 0 || dest.hidden != 0 {
+		t.Error("#6 Failed:", dest)
+	}
+	if len(dests) != 1 || dests[0].Name != "foo" || dests[0].Inner.Id != 7 {
+		t.Error("#7 Failed:", dests)
+	}
+
+	if e := _AppendParamsData(new(bytes.Buffer), "(s)", []interface{}{src}); e == nil {
+		t.Error("#8 Failed")
+	}
+	if e := _AppendParamsData(new(bytes.Buffer), "(su)", []interface{}{"foo"}); e == nil {
+		t.Error("#9 Failed")
+	}
+}
@@ -1,8 +1,12 @@
 package dbus
 
-import "reflect"
-import "fmt"
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
 
 var typeMap = map[MessageType]string{
 	INVALID:       "invalid",
@@ -12,32 +16,252 @@ var typeMap = map[MessageType]string{
 	ERROR:         "error",
 }
 
+var ErrMatchRuleSyntax = errors.New("MatchRuleSyntax")
+
+// MAX_MATCH_ARG is the highest argument number match rules can refer to.
+const MAX_MATCH_ARG = 63
+
+// MatchRule selects messages by the keys of a bus match rule. Empty fields
+// do not restrict the messages matched. Rules can be written as literals or
+// built with NewMatchRule and the With methods.
 type MatchRule struct {
 	Type      string
+	Sender    string
 	Interface string
 	Member    string
 	Path      string
+	// PathNamespace matches the object path and all paths below it.
+	PathNamespace string
+	Destination   string
+	// Args matches messages whose string argument N is Args[N].
+	Args map[int]string
+	// ArgPaths matches messages whose string or object path argument N is
+	// ArgPaths[N], or a path below or above it when one of them ends with
+	// a slash.
+	ArgPaths map[int]string
+	// Arg0Namespace matches messages whose first argument is this bus or
+	// interface name, or a name below it in dotted notation.
+	Arg0Namespace string
+	// Eavesdrop asks the bus to also deliver messages addressed to other
+	// connections, which it only allows to privileged connections. Those
+	// messages, method calls and replies included, are only passed to the
+	// handlers of such rules. Buses which implement BecomeMonitor may
+	// ignore it.
+	Eavesdrop bool
+}
+
+// NewMatchRule returns an empty rule, which matches every message.
+func NewMatchRule() *MatchRule {
+	return new(MatchRule)
+}
+
+// WithType restricts the rule to messages of type t, like "signal".
+func (p *MatchRule) WithType(t string) *MatchRule { p.Type = t; return p }
+
+// WithSender restricts the rule to messages from sender.
+func (p *MatchRule) WithSender(sender string) *MatchRule { p.Sender = sender; return p }
+
+// WithInterface restricts the rule to messages of iface.
+func (p *MatchRule) WithInterface(iface string) *MatchRule { p.Interface = iface; return p }
+
+// WithMember restricts the rule to messages for member.
+func (p *MatchRule) WithMember(member string) *MatchRule { p.Member = member; return p }
+
+// WithPath restricts the rule to messages of the object at path.
+func (p *MatchRule) WithPath(path string) *MatchRule { p.Path = path; return p }
+
+// WithPathNamespace restricts the rule to messages of the object at path
+// and the objects below it.
+func (p *MatchRule) WithPathNamespace(path string) *MatchRule { p.PathNamespace = path; return p }
+
+// WithDestination restricts the rule to messages addressed to dest.
+func (p *MatchRule) WithDestination(dest string) *MatchRule { p.Destination = dest; return p }
+
+// WithArg restricts the rule to messages whose string argument n is value.
+func (p *MatchRule) WithArg(n int, value string) *MatchRule {
+	if p.Args == nil {
+		p.Args = make(map[int]string)
+	}
+	p.Args[n] = value
+	return p
+}
+
+// WithArgPath restricts the rule to messages whose argument n is the path
+// value, as described for ArgPaths.
+func (p *MatchRule) WithArgPath(n int, value string) *MatchRule {
+	if p.ArgPaths == nil {
+		p.ArgPaths = make(map[int]string)
+	}
+	p.ArgPaths[n] = value
+	return p
+}
+
+// WithArg0Namespace restricts the rule to messages whose first argument is
+// the name ns or a name below it.
+func (p *MatchRule) WithArg0Namespace(ns string) *MatchRule { p.Arg0Namespace = ns; return p }
+
+// WithEavesdrop sets whether the rule asks for messages addressed to other
+// connections.
+func (p *MatchRule) WithEavesdrop(eavesdrop bool) *MatchRule { p.Eavesdrop = eavesdrop; return p }
+
+// _QuoteMatchValue quotes a value of a match rule. Apostrophes can not
+// appear inside quotes, so they are written as an escaped apostrophe
+// between two quoted parts.
+func _QuoteMatchValue(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
 }
 
 func (p *MatchRule) _ToString() string {
 	strslice := []string{}
+	add := func(key, value string) {
+		if "" != value {
+			strslice = append(strslice, key+"="+_QuoteMatchValue(value))
+		}
+	}
 
-	v := reflect.Indirect(reflect.ValueOf(p))
-	t := v.Type()
-	for i:=0; i<v.NumField(); i++{
-		str, ok := v.Field(i).Interface().(string)
-		if ok && "" != str{
-			strslice = append(strslice, (fmt.Sprintf("%s='%s'", strings.ToLower(t.Field(i).Name), str)))
-		}	
+	add("type", p.Type)
+	add("sender", p.Sender)
+	add("interface", p.Interface)
+	add("member", p.Member)
+	add("path", p.Path)
+	add("path_namespace", p.PathNamespace)
+	add("destination", p.Destination)
+	for _, n := range _SortedArgs(p.Args) {
+		add(fmt.Sprintf("arg%d", n), p.Args[n])
 	}
-	
+	for _, n := range _SortedArgs(p.ArgPaths) {
+		add(fmt.Sprintf("arg%dpath", n), p.ArgPaths[n])
+	}
+	add("arg0namespace", p.Arg0Namespace)
+	if p.Eavesdrop {
+		add("eavesdrop", "true")
+	}
+
 	return strings.Join(strslice, ",")
 }
 
+func _SortedArgs(args map[int]string) []int {
+	ns := make([]int, 0, len(args))
+	for n := range args {
+		ns = append(ns, n)
+	}
+	sort.Ints(ns)
+	return ns
+}
+
+// ParseMatchRule parses a match rule in the format the bus accepts, the
+// inverse of the strings AddSignalHandler sends. Outside of quotes a
+// backslash escapes an apostrophe; inside quotes every character but the
+// closing apostrophe is literal. Malformed rules, unknown keys and
+// invalid values fail with ErrMatchRuleSyntax.
+func ParseMatchRule(rule string) (*MatchRule, error) {
+	mr := new(MatchRule)
+
+	for i := 0; i < len(rule); {
+		eq := strings.IndexByte(rule[i:], '=')
+		if eq < 0 {
+			return nil, ErrMatchRuleSyntax
+		}
+		key := strings.TrimSpace(rule[i : i+eq])
+		i += eq + 1
+
+		var value []byte
+		quoted := false
+	scan:
+		for ; i < len(rule); i++ {
+			c := rule[i]
+			switch {
+			case c == '\'':
+				quoted = !quoted
+			case quoted:
+				value = append(value, c)
+			case c == ',':
+				break scan
+			case c == '\\' && i+1 < len(rule) && rule[i+1] == '\'':
+				value = append(value, '\'')
+				i++
+			default:
+				value = append(value, c)
+			}
+		}
+		if quoted {
+			return nil, ErrMatchRuleSyntax
+		}
+		i++ // the comma
+
+		if e := mr._Set(key, string(value)); e != nil {
+			return nil, e
+		}
+	}
+	return mr, nil
+}
+
+// _Set sets the key of a parsed match rule.
+func (p *MatchRule) _Set(key, value string) error {
+	switch key {
+	case "type":
+		p.Type = value
+	case "sender":
+		p.Sender = value
+	case "interface":
+		p.Interface = value
+	case "member":
+		p.Member = value
+	case "path":
+		p.Path = value
+	case "path_namespace":
+		p.PathNamespace = value
+	case "destination":
+		p.Destination = value
+	case "arg0namespace":
+		p.Arg0Namespace = value
+	case "eavesdrop":
+		switch value {
+		case "true":
+			p.Eavesdrop = true
+		case "false":
+			p.Eavesdrop = false
+		default:
+			return ErrMatchRuleSyntax
+		}
+	default:
+		if n, ok := _MatchArgKey(key, ""); ok {
+			p.WithArg(n, value)
+		} else if n, ok := _MatchArgKey(key, "path"); ok {
+			p.WithArgPath(n, value)
+		} else {
+			return ErrMatchRuleSyntax
+		}
+	}
+	return nil
+}
+
+// _MatchArgKey parses the key "argN" followed by suffix.
+func _MatchArgKey(key, suffix string) (int, bool) {
+	if !strings.HasPrefix(key, "arg") || !strings.HasSuffix(key, suffix) {
+		return 0, false
+	}
+	digits := key[3 : len(key)-len(suffix)]
+	if digits == "" || len(digits) > 2 || (len(digits) == 2 && digits[0] == '0') {
+		return 0, false
+	}
+	n, e := strconv.Atoi(digits)
+	if e != nil || n > MAX_MATCH_ARG {
+		return 0, false
+	}
+	return n, true
+}
+
+// _Match reports whether msg matches the rule. A sender which is a
+// well-known name can not be checked against the unique name messages carry,
+// so the connection checks it against the owner of the name.
 func (p *MatchRule) _Match(msg *Message) bool {
 	if p.Type != "" && p.Type != typeMap[msg.Type] {
 		return false
 	}
+	if strings.HasPrefix(p.Sender, ":") && p.Sender != msg.Sender {
+		return false
+	}
 	if p.Interface != "" && p.Interface != msg.Iface {
 		return false
 	}
@@ -47,5 +271,63 @@ func (p *MatchRule) _Match(msg *Message) bool {
 	if p.Path != "" && p.Path != msg.Path {
 		return false
 	}
+	if p.PathNamespace != "" && p.PathNamespace != "/" && msg.Path != p.PathNamespace &&
+		!strings.HasPrefix(msg.Path, p.PathNamespace+"/") {
+		return false
+	}
+	if p.Destination != "" && p.Destination != msg.Dest {
+		return false
+	}
+	if len(p.Args) == 0 && len(p.ArgPaths) == 0 && p.Arg0Namespace == "" {
+		return true
+	}
+
+	types := _ArgTypes(msg.Sig)
+	arg := func(n int, allowed string) (string, bool) {
+		if n >= len(types) || n >= len(msg.Params) || strings.IndexByte(allowed, types[n]) < 0 {
+			return "", false
+		}
+		switch s := msg.Params[n].(type) {
+		case string:
+			return s, true
+		case ObjectPath:
+			return string(s), true
+		}
+		return "", false
+	}
+	for n, value := range p.Args {
+		if s, ok := arg(n, "s"); !ok || s != value {
+			return false
+		}
+	}
+	for n, value := range p.ArgPaths {
+		s, ok := arg(n, "so")
+		if !ok || !(s == value ||
+			strings.HasSuffix(s, "/") && strings.HasPrefix(value, s) ||
+			strings.HasSuffix(value, "/") && strings.HasPrefix(s, value)) {
+			return false
+		}
+	}
+	if p.Arg0Namespace != "" {
+		s, ok := arg(0, "s")
+		if !ok || s != p.Arg0Namespace && !strings.HasPrefix(s, p.Arg0Namespace+".") {
+			return false
+		}
+	}
 	return true
 }
+
+// _ArgTypes returns the first character of the type of each argument of
+// the signature sig.
+func _ArgTypes(sig string) []byte {
+	types := make([]byte, 0, len(sig))
+	for i := 0; i < len(sig); {
+		t, e := _GetSingleType(sig, i)
+		if e != nil {
+			break
+		}
+		types = append(types, sig[i])
+		i += len(t)
+	}
+	return types
+}
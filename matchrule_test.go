@@ -1,6 +1,7 @@
 package dbus
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -17,3 +18,101 @@ func TestToString(t *testing.T) {
 		t.Error("#1 Failed")
 	}
 }
+
+func TestMatchRuleEscaping(t *testing.T) {
+	mr := MatchRule{Type: "signal", Args: map[int]string{0: `it's a,b\c`}}
+	str := mr._ToString()
+	if str != `type='signal',arg0='it'\''s a,b\c'` {
+		t.Error("#1 Failed:", str)
+	}
+
+	parsed, e := ParseMatchRule(str)
+	if e != nil || !reflect.DeepEqual(*parsed, mr) {
+		t.Error("#2 Failed:", parsed, e)
+	}
+
+	parsed, e = ParseMatchRule(`type=signal,member='Foo',arg0=\'x`)
+	if e != nil || parsed.Type != "signal" || parsed.Member != "Foo" || parsed.Args[0] != "'x" {
+		t.Error("#3 Failed:", parsed, e)
+	}
+
+	for i, bad := range []string{"type", "type='signal", "foo='x'", "arg64='x'", "arg01='x'", "eavesdrop='yes'"} {
+		if _, e := ParseMatchRule(bad); e != ErrMatchRuleSyntax {
+			t.Errorf("#4-%d Failed: %q %v", i+1, bad, e)
+		}
+	}
+}
+
+func TestMatchArg0(t *testing.T) {
+	mr := &MatchRule{Member: "NameOwnerChanged", Args: map[int]string{0: "org.example.Name"}}
+	msg := NewMessage()
+	msg.Member = "NameOwnerChanged"
+	msg.Sig = "sss"
+	msg.Params = []interface{}{"org.example.Name", "", ":1.1"}
+	if !mr._Match(msg) {
+		t.Error("#1 Failed")
+	}
+	msg.Params[0] = "org.example.Other"
+	if mr._Match(msg) {
+		t.Error("#2 Failed")
+	}
+}
+
+func TestMatchRuleBuilder(t *testing.T) {
+	mr := NewMatchRule().WithType("signal").WithSender("org.example").
+		WithInterface("org.example.Iface").WithMember("Changed").
+		WithPathNamespace("/org/example").WithDestination(":1.5").
+		WithArg(2, "b").WithArg(1, "a").WithArgPath(0, "/org/").
+		WithArg0Namespace("org.example").WithEavesdrop(true)
+	str := mr._ToString()
+	expected := "type='signal',sender='org.example',interface='org.example.Iface',member='Changed'," +
+		"path_namespace='/org/example',destination=':1.5',arg1='a',arg2='b',arg0path='/org/'," +
+		"arg0namespace='org.example',eavesdrop='true'"
+	if str != expected {
+		t.Error("#1 Failed:", str)
+	}
+	parsed, e := ParseMatchRule(str)
+	if e != nil || !reflect.DeepEqual(parsed, mr) {
+		t.Error("#2 Failed:", parsed, e)
+	}
+}
+
+func TestMatchRuleKeys(t *testing.T) {
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Sender = ":1.7"
+	msg.Dest = ":1.5"
+	msg.Path = "/org/example/a"
+	msg.Sig = "sos"
+	msg.Params = []interface{}{"org.example.Foo", "/org/example/a", "x"}
+
+	tests := []struct {
+		mr    *MatchRule
+		match bool
+	}{
+		{NewMatchRule().WithSender(":1.7"), true},
+		{NewMatchRule().WithSender(":1.8"), false},
+		{NewMatchRule().WithSender("org.example"), true},
+		{NewMatchRule().WithPathNamespace("/org/example"), true},
+		{NewMatchRule().WithPathNamespace("/org/example/a"), true},
+		{NewMatchRule().WithPathNamespace("/org/ex"), false},
+		{NewMatchRule().WithPathNamespace("/"), true},
+		{NewMatchRule().WithDestination(":1.5"), true},
+		{NewMatchRule().WithDestination(":1.6"), false},
+		{NewMatchRule().WithArg(2, "x"), true},
+		{NewMatchRule().WithArg(1, "/org/example/a"), false},
+		{NewMatchRule().WithArg(3, "x"), false},
+		{NewMatchRule().WithArgPath(1, "/org/example/a"), true},
+		{NewMatchRule().WithArgPath(1, "/org/"), true},
+		{NewMatchRule().WithArgPath(1, "/org"), false},
+		{NewMatchRule().WithArgPath(0, "org.example.Foo"), true},
+		{NewMatchRule().WithArg0Namespace("org.example"), true},
+		{NewMatchRule().WithArg0Namespace("org.example.Foo"), true},
+		{NewMatchRule().WithArg0Namespace("org.ex"), false},
+	}
+	for i, test := range tests {
+		if test.mr._Match(msg) != test.match {
+			t.Errorf("#%d Failed: %s", i+1, test.mr._ToString())
+		}
+	}
+}
@@ -2,9 +2,58 @@ package dbus
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
 	"sync"
 )
 
+var ErrNotByteArray = errors.New("NotByteArray")
+
+// ErrShortMessage is returned when a buffer holds only the beginning of a
+// message. More data must be read before it can be decoded.
+var ErrShortMessage = errors.New("ShortMessage")
+
+// VersionError is returned for messages of another major protocol version,
+// whose layout may differ.
+type VersionError struct {
+	Version int
+}
+
+func (p *VersionError) Error() string {
+	return fmt.Sprintf("unsupported protocol version %d", p.Version)
+}
+
+// MalformedError is returned for messages which can not be decoded no matter
+// how much data is read. The connection can not be trusted after receiving
+// one, so it is closed.
+type MalformedError struct {
+	Reason string
+}
+
+func (p *MalformedError) Error() string {
+	return "malformed message: " + p.Reason
+}
+
+// ViolationError describes a message which could be decoded but breaks the
+// specification, like a boolean other than 0 or 1, a string which is not
+// valid UTF-8, or padding which is not zero. What the connection does with
+// such messages depends on its ViolationPolicy.
+type ViolationError struct {
+	Reason string
+}
+
+func (p *ViolationError) Error() string {
+	return "protocol violation: " + p.Reason
+}
+
+func _Malformed(format string, args ...interface{}) error {
+	return &MalformedError{fmt.Sprintf(format, args...)}
+}
+
 type MessageType int
 
 const (
@@ -17,14 +66,25 @@ const (
 
 type MessageFlag int
 
+// Flags of the message header. NO_REPLY_EXPECTED marks method calls whose
+// caller does not wait for the reply, so that none is sent. NO_AUTO_START
+// asks the bus not to start the destination service if it is not running.
+// ALLOW_INTERACTIVE_AUTHORIZATION lets the service prompt the user to
+// authorize the call, like through polkit, which may take a long time.
 const (
-	NO_REPLY_EXPECTED = 0x1
-	NO_AUTO_START     = 0x2
+	NO_REPLY_EXPECTED               = 0x1
+	NO_AUTO_START                   = 0x2
+	ALLOW_INTERACTIVE_AUTHORIZATION = 0x4
 )
 
+// PROTOCOL_VERSION is the major version of the protocol spoken.
+const PROTOCOL_VERSION = 1
+
 type Message struct {
-	Type        MessageType
-	Flags       MessageFlag
+	Type  MessageType
+	Flags MessageFlag
+	// Protocol is the major protocol version of the message, which is
+	// always PROTOCOL_VERSION for received messages.
 	Protocol    int
 	bodyLength  int
 	Path        string
@@ -33,103 +93,545 @@ type Message struct {
 	Member      string
 	Sig         string
 	Params      []interface{}
-	serial      int
+	body        []byte
+	serial      uint32
 	replySerial uint32
 	ErrorName   string
-	//	Sender;
-}
-
-var serialMutex sync.Mutex
-var messageSerial = int(0)
-
-func _GetNewSerial() int {
-	serialMutex.Lock()
-	messageSerial++
-	serial := messageSerial
-	serialMutex.Unlock()
-	return serial
+	// Sender is the unique name of the connection which sent a received
+	// message, as set by the bus.
+	Sender string
+	// Order is the byte order of the message. Messages are sent in little
+	// endian byte order if it is nil, or in the ByteOrder of the Connection.
+	Order binary.ByteOrder
+	// fds are the file descriptors received with the message; before it is
+	// decoded, those available to it.
+	fds []int
 }
 
+// NewMessage returns an empty message. Its serial is assigned by the
+// Connection sending it.
 func NewMessage() *Message {
 	msg := new(Message)
 
-	msg.serial = _GetNewSerial()
 	msg.replySerial = 0
 	msg.Flags = 0
-	msg.Protocol = 1
+	msg.Protocol = PROTOCOL_VERSION
 
 	msg.Params = make([]interface{}, 0)
 
 	return msg
 }
 
-func (p *Message) _BufferToMessage(buff []byte) (int, error) {
-	slice, bufIdx, e := Parse(buff, "yyyyuua(yv)", 0)
+func (p *Message) _BufferToMessage(d *decoder, buff []byte) (int, error) {
+	if len(buff) < fixedHeaderSize {
+		return 0, ErrShortMessage
+	}
+	order, e := _ByteOrder(buff[0])
 	if e != nil {
 		return 0, e
 	}
+	if e := _CheckProtocol(buff[3]); e != nil {
+		return 0, e
+	}
+	if e := _CheckLengths(buff); e != nil {
+		return 0, e
+	}
+	if len(buff) < _MessageSize(buff) {
+		return 0, ErrShortMessage
+	}
+	p.Order = order
+	d.order = order
+	unixFDs, bufIdx, e := p._ParseHeader(d, buff)
+	if e != nil {
+		return 0, e
+	}
+	if int(unixFDs) > len(p.fds) {
+		return 0, _Malformed("%d unix fds announced, %d received", unixFDs, len(p.fds))
+	}
+	p.fds = append([]int(nil), p.fds[:unixFDs]...)
+	d.fds = p.fds
 
-	p.Type = MessageType(slice[1].(byte))
-	p.Flags = MessageFlag(slice[2].(byte))
-	p.Protocol = int(slice[3].(byte))
-	p.bodyLength = int(slice[4].(uint32))
-	p.serial = int(slice[5].(uint32))
-
-	if vec, ok := slice[6].([]interface{}); ok {
-		for _, v := range vec {
-			tmpSlice := v.([]interface{})
-			t := int(tmpSlice[0].(byte))
-			val := tmpSlice[1]
-
-			switch t {
-			case 1:
-				p.Path = val.(string)
-			case 2:
-				p.Iface = val.(string)
-			case 3:
-				p.Member = val.(string)
-			case 4:
-				p.ErrorName = val.(string)
-			case 5:
-				p.replySerial = val.(uint32)
-			case 6:
-				p.Dest = val.(string)
-			case 7:
-				// FIXME
-			case 8:
-				p.Sig = val.(string)
-			}
-		}
+	idx := d._Pad(buff, 8, bufIdx)
+	if idx+p.bodyLength <= len(buff) && _IsFixedSignature(p.Sig) {
+		// Kept for Store; decoded values never alias buff otherwise, so
+		// that the receive buffer can be reused.
+		p.body = append(p.body[:0], buff[idx:idx+p.bodyLength]...)
 	}
-	idx := _Align(8, bufIdx)
 	if 0 < p.bodyLength {
-		p.Params, idx, _ = Parse(buff, p.Sig, idx)
+		start, end := idx, idx+p.bodyLength
+		p.Params, idx, e = d._ParseAppend(p.Params[:0], buff[:end], p.Sig, start)
+		if e != nil {
+			return 0, _Malformed("body of signature %q: %v", p.Sig, e)
+		}
+		if idx != end {
+			return 0, _Malformed("body of signature %q is %d bytes, not %d", p.Sig, idx-start, p.bodyLength)
+		}
 	}
-	return idx, nil
+	return idx, d.violation
+}
+
+// headerFieldTypes are the types of the header fields the specification
+// defines, by field code.
+var headerFieldTypes = [...]byte{1: 'o', 2: 's', 3: 's', 4: 's', 5: 'u', 6: 's', 7: 's', 8: 'g', 9: 'u'}
+
+// _ParseHeader decodes the fixed header and the header fields of the
+// message in buff into p. It returns the number of unix fds the message
+// announces and the index following the fields. Fields of the type the
+// specification defines are decoded directly, rather than into variants,
+// as every message received goes through here.
+func (p *Message) _ParseHeader(d *decoder, buff []byte) (unixFDs uint32, index int, e error) {
+	order := d._Order()
+	p.Type = MessageType(buff[1])
+	p.Flags = MessageFlag(buff[2])
+	p.Protocol = int(buff[3])
+	p.bodyLength = int(order.Uint32(buff[4:8]))
+	p.serial = order.Uint32(buff[8:12])
+
+	// The fields fit in buff, as checked by _CheckLengths.
+	fields := buff[:fixedHeaderSize+int(order.Uint32(buff[12:16]))]
+	index = fixedHeaderSize
+	for index < len(fields) {
+		index = d._Pad(fields, 8, index)
+		code, e := _GetByte(fields, index)
+		if e != nil {
+			return 0, 0, _Malformed("header: %v", e)
+		}
+
+		var val interface{}
+		var str string
+		var num uint32
+		isStr, isNum := false, false
+		if int(code) < len(headerFieldTypes) && headerFieldTypes[code] != 0 && index+3 < len(fields) &&
+			fields[index+1] == 1 && fields[index+2] == headerFieldTypes[code] && fields[index+3] == 0 {
+			if t := headerFieldTypes[code]; t == 'u' {
+				idx := d._Pad(fields, 4, index+4)
+				num, e = d._GetUint32(fields, idx)
+				index, isNum = idx+4, true
+			} else {
+				str, index, e = d._GetStringValue(fields, t, index+4)
+				isStr = true
+			}
+			if e != nil {
+				return 0, 0, _Malformed("header: %v", e)
+			}
+		} else {
+			var variant Variant
+			if variant, index, e = d._GetVariant(fields, index+1); e != nil {
+				return 0, 0, _Malformed("header: %v", e)
+			}
+			switch v := variant.Value.(type) {
+			case string:
+				str, isStr = v, true
+			case ObjectPath:
+				str, isStr = string(v), true
+			case Signature:
+				str, isStr = string(v), true
+			case uint32:
+				num, isNum = v, true
+			}
+			val = variant.Value
+		}
+
+		if (code != 5 && code <= 8 && !isStr) || ((code == 5 || code == 9) && !isNum) {
+			return 0, 0, _Malformed("header field %d has type %T", code, val)
+		}
+		switch code {
+		case 1:
+			p.Path = str
+		case 2:
+			p.Iface = str
+		case 3:
+			p.Member = str
+		case 4:
+			p.ErrorName = str
+		case 5:
+			p.replySerial = num
+		case 6:
+			p.Dest = str
+		case 7:
+			p.Sender = str
+		case 8:
+			if e := Signature(str).Validate(); e != nil {
+				return 0, 0, _Malformed("%v", e)
+			}
+			p.Sig = str
+		case 9:
+			unixFDs = num
+		}
+	}
+	return unixFDs, index, nil
 }
 
 func _Unmarshal(buff []byte) (*Message, int, error) {
-	msg := NewMessage()
-	idx, e := msg._BufferToMessage(buff)
+	return _UnmarshalInto(NewMessage(), buff)
+}
+
+// _UnmarshalInto decodes buff into msg, reusing its Params slice. It
+// returns ErrShortMessage if buff does not hold the whole message, or a
+// *MalformedError if the message can not be decoded. Messages with protocol
+// violations are decoded and returned along with a *ViolationError.
+func _UnmarshalInto(msg *Message, buff []byte) (*Message, int, error) {
+	idx, e := msg._BufferToMessage(new(decoder), buff)
+	if _, ok := e.(*ViolationError); ok {
+		return msg, idx, e
+	}
 	if e != nil {
 		return nil, 0, e
 	}
 	return msg, idx, nil
 }
 
+// _UnmarshalAliasing works like _UnmarshalInto, but byte arrays of at least
+// largeArraySize bytes, which make up most of buff, are sliced out of it
+// rather than copied. It reports whether any was, in which case buff must
+// not be reused.
+func _UnmarshalAliasing(msg *Message, buff []byte) (*Message, bool, error) {
+	d := &decoder{alias: true}
+	_, e := msg._BufferToMessage(d, buff)
+	if _, ok := e.(*ViolationError); ok {
+		return msg, d.aliased, e
+	}
+	if e != nil {
+		return nil, false, e
+	}
+	return msg, d.aliased, nil
+}
+
+var messagePool sync.Pool
+
+// _GetPooledMessage returns an empty message from the pool of recycled
+// messages.
+func _GetPooledMessage() *Message {
+	if msg, ok := messagePool.Get().(*Message); ok {
+		return msg
+	}
+	return &Message{Protocol: PROTOCOL_VERSION, Params: make([]interface{}, 0)}
+}
+
+// _ReleaseMessage resets msg and returns it to the pool. msg must not be
+// used afterwards.
+func _ReleaseMessage(msg *Message) {
+	for i := range msg.Params {
+		msg.Params[i] = nil
+	}
+	*msg = Message{Protocol: PROTOCOL_VERSION, Params: msg.Params[:0]}
+	messagePool.Put(msg)
+}
+
+// Serial returns the serial the sender assigned to the message.
+func (p *Message) Serial() uint32 {
+	return p.serial
+}
+
+// ReplySerial returns the serial of the call a method return or error
+// replies to.
+func (p *Message) ReplySerial() uint32 {
+	return p.replySerial
+}
+
+// Clone returns a copy of the message which is not affected when the
+// original is recycled. Signal handlers of connections with RecycleMessages
+// set must clone messages they retain after returning.
+func (p *Message) Clone() *Message {
+	msg := new(Message)
+	*msg = *p
+	msg.Params = append(make([]interface{}, 0, len(p.Params)), p.Params...)
+	return msg
+}
+
+// MAX_MESSAGE_SIZE is the largest message the specification allows.
+const MAX_MESSAGE_SIZE = 134217728
+
+// MAX_ARRAY_LENGTH is the largest array, including the header fields, the
+// specification allows.
+const MAX_ARRAY_LENGTH = 67108864
+
+// readChunkSize is how far reading a message may run ahead of the data
+// received, so that a header announcing a huge message does not make the
+// reader allocate all of it up front.
+const readChunkSize = 1 << 20
+
+// fixedHeaderSize is the size of the header up to and including the length
+// of the header fields array.
+const fixedHeaderSize = 16
+
+// Byte order flags, the first byte of a message.
+const (
+	LITTLE_ENDIAN = 'l'
+	BIG_ENDIAN    = 'B'
+)
+
+// _ByteOrder returns the byte order of the byte order flag, the first byte
+// of a message.
+func _ByteOrder(flag byte) (binary.ByteOrder, error) {
+	switch flag {
+	case LITTLE_ENDIAN:
+		return binary.LittleEndian, nil
+	case BIG_ENDIAN:
+		return binary.BigEndian, nil
+	}
+	return nil, _Malformed("invalid endianness flag %q", flag)
+}
+
+// _ByteOrderFlag returns the byte order flag of order.
+func _ByteOrderFlag(order binary.ByteOrder) byte {
+	if order == binary.BigEndian {
+		return BIG_ENDIAN
+	}
+	return LITTLE_ENDIAN
+}
+
+// _CheckProtocol checks the major protocol version, the fourth byte of a
+// message.
+func _CheckProtocol(version byte) error {
+	if version != PROTOCOL_VERSION {
+		return &VersionError{int(version)}
+	}
+	return nil
+}
+
+// _MessageSize returns the size of the message starting with the fixed
+// header in buff, which must hold at least fixedHeaderSize bytes. Sizes
+// beyond MAX_MESSAGE_SIZE are clamped to MAX_MESSAGE_SIZE+1, so that they
+// can not overflow.
+func _MessageSize(buff []byte) int {
+	order, _ := _ByteOrder(buff[0])
+	if order == nil {
+		order = binary.LittleEndian
+	}
+	bodyLength := uint64(order.Uint32(buff[4:8]))
+	fieldsLength := uint64(order.Uint32(buff[12:16]))
+	size := (fixedHeaderSize+fieldsLength+7)&^7 + bodyLength
+	if size > MAX_MESSAGE_SIZE {
+		return MAX_MESSAGE_SIZE + 1
+	}
+	return int(size)
+}
+
+// _ReadMessageData reads the raw bytes of exactly one message from r into a
+// new buffer.
+func _ReadMessageData(r io.Reader) ([]byte, error) {
+	return _ReadMessageInto(r, nil)
+}
+
+// _ReadMessageInto reads the raw bytes of exactly one message from r. The
+// fixed part of the header is read first to learn the sizes of the header
+// fields and the body, which are then read directly into buff if it is large
+// enough, or into a new buffer of the right size. It blocks until the whole
+// message is available.
+func _ReadMessageInto(r io.Reader, buff []byte) ([]byte, error) {
+	var header [fixedHeaderSize]byte
+	if _, e := io.ReadFull(r, header[:]); e != nil {
+		return nil, e
+	}
+
+	if _, e := _ByteOrder(header[0]); e != nil {
+		return nil, e
+	}
+	if e := _CheckProtocol(header[3]); e != nil {
+		return nil, e
+	}
+	if e := _CheckLengths(header[:]); e != nil {
+		return nil, e
+	}
+	size := _MessageSize(header[:])
+	if cap(buff) < size && size > readChunkSize {
+		return _ReadLargeMessage(r, header[:], size)
+	}
+	if cap(buff) < size {
+		buff = make([]byte, size)
+	}
+	buff = buff[:size]
+	copy(buff, header[:])
+	if _, e := io.ReadFull(r, buff[fixedHeaderSize:]); e != nil {
+		return nil, e
+	}
+	return buff, nil
+}
+
+// _ReadLargeMessage reads a message of size bytes into a buffer which grows
+// as the data arrives.
+func _ReadLargeMessage(r io.Reader, header []byte, size int) ([]byte, error) {
+	buff := make([]byte, fixedHeaderSize, readChunkSize)
+	copy(buff, header)
+	for len(buff) < size {
+		start := len(buff)
+		end := size
+		if cap(buff) == start {
+			grown := make([]byte, start, 2*cap(buff))
+			copy(grown, buff)
+			buff = grown
+		}
+		if end > cap(buff) {
+			end = cap(buff)
+		}
+		buff = buff[:end]
+		if _, e := io.ReadFull(r, buff[start:]); e != nil {
+			return nil, e
+		}
+	}
+	return buff, nil
+}
+
+// _CheckLengths checks the lengths of the header fields and the body in the
+// fixed header against the maxima of the specification.
+func _CheckLengths(header []byte) error {
+	order, e := _ByteOrder(header[0])
+	if e != nil {
+		return e
+	}
+	if fieldsLength := order.Uint32(header[12:16]); fieldsLength > MAX_ARRAY_LENGTH {
+		return _Malformed("header fields of %d bytes", fieldsLength)
+	}
+	if _MessageSize(header) > MAX_MESSAGE_SIZE {
+		return _Malformed("larger than %d bytes", MAX_MESSAGE_SIZE)
+	}
+	return nil
+}
+
+// _ReadMessage reads and decodes exactly one message from r.
+func _ReadMessage(r io.Reader) (*Message, error) {
+	buff, e := _ReadMessageData(r)
+	if e != nil {
+		return nil, e
+	}
+	msg, _, e := _Unmarshal(buff)
+	return msg, e
+}
+
+// headerSizeHint is a generous estimate of the size of a marshalled header,
+// used to pick the buffer size class for a message.
+const headerSizeHint = 256
+
 func (p *Message) _Marshal() ([]byte, error) {
-	buff := bytes.NewBuffer([]byte{})
-	_AppendByte(buff, byte('l')) // little Endian
+	buff, e := p._MarshalBuffer()
+	if e != nil {
+		return nil, e
+	}
+	ret := append([]byte(nil), buff.Bytes()...)
+	_PutBuffer(buff)
+	return ret, nil
+}
+
+// _MarshalBuffer marshals the message into a pooled buffer, which the caller
+// should hand back with _PutBuffer once it has been written.
+func (p *Message) _MarshalBuffer() (*bytes.Buffer, error) {
+	header, body, e := p._MarshalParts()
+	if e != nil {
+		return nil, e
+	}
+	defer body.Release()
+
+	buff := header
+	if buff.Cap()-buff.Len() < body.length {
+		buff = _GetBuffer(header.Len() + body.length)
+		buff.Write(header.Bytes())
+		_PutBuffer(header)
+	}
+	for _, segment := range body.segments {
+		buff.Write(segment)
+	}
+	return buff, nil
+}
+
+// largeArraySize is the size from which byte arrays passed as []byte are
+// not copied into the marshalled body, but written straight from the
+// caller's slice.
+const largeArraySize = 32 * 1024
+
+// messageBody is a marshalled message body. It is made of segments of
+// pooled buffers, between which large byte arrays are referenced rather
+// than copied, so that the whole body can be written with a vectored write.
+type messageBody struct {
+	segments net.Buffers
+	pooled   []*bytes.Buffer
+	length   int
+	fds      []int // passed along with the message
+}
+
+var zeroPadding [8]byte
+
+// _MarshalBody marshals params with the signature sig.
+func (p *encoder) _MarshalBody(sig string, params []interface{}) (*messageBody, error) {
+	if e := Signature(sig).Validate(); e != nil {
+		return nil, e
+	}
+	body := new(messageBody)
+
+	// The body starts 8-aligned, so marshalling it on its own yields the
+	// same padding as marshalling it in place. A new buffer following a
+	// byte array starts with as many bytes as the body is past its last
+	// 8-alignment, to keep the padding right; these are not written.
+	buff := _GetBuffer(0)
+	skip := 0
+	for sigIdx, prmsIdx := 0, 0; sigIdx < len(sig) && prmsIdx < len(params); prmsIdx++ {
+		if b, ok := params[prmsIdx].([]byte); ok && len(b) >= largeArraySize && strings.HasPrefix(sig[sigIdx:], "ay") {
+			p._AppendUint32(buff, uint32(len(b)))
+			body._AddBuffer(buff, skip)
+			body.segments = append(body.segments, b)
+			body.length += len(b)
+
+			skip = body.length % 8
+			buff = _GetBuffer(0)
+			buff.Write(zeroPadding[:skip])
+			sigIdx += 2
+			continue
+		}
+		offset, e := p._AppendValue(buff, sig[sigIdx:], params[prmsIdx])
+		if e != nil {
+			body._AddBuffer(buff, skip)
+			body.Release()
+			return nil, e
+		}
+		sigIdx += offset
+	}
+	body._AddBuffer(buff, skip)
+	body.fds = p.fds
+	return body, nil
+}
+
+func (p *messageBody) _AddBuffer(buff *bytes.Buffer, skip int) {
+	p.pooled = append(p.pooled, buff)
+	if buff.Len() > skip {
+		p.segments = append(p.segments, buff.Bytes()[skip:])
+		p.length += buff.Len() - skip
+	}
+}
+
+// Release hands the pooled buffers of the body back. The body must not be
+// used afterwards.
+func (p *messageBody) Release() {
+	for _, buff := range p.pooled {
+		_PutBuffer(buff)
+	}
+	p.pooled = nil
+	p.segments = nil
+}
+
+// _MarshalParts marshals the header, padded to the start of the body, and
+// the body separately, so that they can be written without first being
+// copied together.
+func (p *Message) _MarshalParts() (header *bytes.Buffer, body *messageBody, e error) {
+	enc := _NewEncoder(p.Order)
+	body, e = enc._MarshalBody(p.Sig, p.Params)
+	if e != nil {
+		return nil, nil, e
+	}
+
+	buff := _GetBuffer(headerSizeHint)
+	_AppendByte(buff, _ByteOrderFlag(enc.order))
 	_AppendByte(buff, byte(p.Type))
 	_AppendByte(buff, byte(p.Flags))
-	_AppendByte(buff, byte(p.Protocol))
+	if p.Protocol == 0 {
+		_AppendByte(buff, PROTOCOL_VERSION)
+	} else {
+		_AppendByte(buff, byte(p.Protocol))
+	}
 
-	tmpBuff := bytes.NewBuffer([]byte{})
-	_AppendParamsData(tmpBuff, p.Sig, p.Params)
-	_AppendUint32(buff, uint32(len(tmpBuff.Bytes())))
-	_AppendUint32(buff, uint32(p.serial))
+	enc._AppendUint32(buff, uint32(body.length))
+	enc._AppendUint32(buff, p.serial)
 
-	_AppendArray(buff, 1,
+	enc._AppendArray(buff, 1,
 		func(b *bytes.Buffer) {
 			if p.Path != "" {
 				_AppendAlign(8, b)
@@ -137,7 +639,7 @@ func (p *Message) _Marshal() ([]byte, error) {
 				_AppendByte(b, 1) // signature size
 				_AppendByte(b, 'o')
 				_AppendByte(b, 0)
-				_AppendString(b, p.Path)
+				enc._AppendString(b, p.Path)
 			}
 
 			if p.Iface != "" {
@@ -146,7 +648,7 @@ func (p *Message) _Marshal() ([]byte, error) {
 				_AppendByte(b, 1) // signature size
 				_AppendByte(b, 's')
 				_AppendByte(b, 0)
-				_AppendString(b, p.Iface)
+				enc._AppendString(b, p.Iface)
 			}
 
 			if p.Member != "" {
@@ -155,7 +657,16 @@ func (p *Message) _Marshal() ([]byte, error) {
 				_AppendByte(b, 1) // signature size
 				_AppendByte(b, 's')
 				_AppendByte(b, 0)
-				_AppendString(b, p.Member)
+				enc._AppendString(b, p.Member)
+			}
+
+			if p.ErrorName != "" {
+				_AppendAlign(8, b)
+				_AppendByte(b, 4) // error name
+				_AppendByte(b, 1) // signature size
+				_AppendByte(b, 's')
+				_AppendByte(b, 0)
+				enc._AppendString(b, p.ErrorName)
 			}
 
 			if p.replySerial != 0 {
@@ -164,7 +675,7 @@ func (p *Message) _Marshal() ([]byte, error) {
 				_AppendByte(b, 1) // signature size
 				_AppendByte(b, 'u')
 				_AppendByte(b, 0)
-				_AppendUint32(b, uint32(p.replySerial))
+				enc._AppendUint32(b, uint32(p.replySerial))
 			}
 
 			if p.Dest != "" {
@@ -173,7 +684,17 @@ func (p *Message) _Marshal() ([]byte, error) {
 				_AppendByte(b, 1) // signature size
 				_AppendByte(b, 's')
 				_AppendByte(b, 0)
-				_AppendString(b, p.Dest)
+				enc._AppendString(b, p.Dest)
+			}
+
+			// The bus replaces it with the actual sender.
+			if p.Sender != "" {
+				_AppendAlign(8, b)
+				_AppendByte(b, 7) // sender
+				_AppendByte(b, 1) // signature size
+				_AppendByte(b, 's')
+				_AppendByte(b, 0)
+				enc._AppendString(b, p.Sender)
 			}
 
 			if p.Sig != "" {
@@ -184,10 +705,33 @@ func (p *Message) _Marshal() ([]byte, error) {
 				_AppendByte(b, 0)
 				_AppendSignature(b, p.Sig)
 			}
+
+			if len(body.fds) != 0 {
+				_AppendAlign(8, b)
+				_AppendByte(b, 9) // unix fds
+				_AppendByte(b, 1) // signature size
+				_AppendByte(b, 'u')
+				_AppendByte(b, 0)
+				enc._AppendUint32(b, uint32(len(body.fds)))
+			}
 		})
 
 	_AppendAlign(8, buff)
-	_AppendParamsData(buff, p.Sig, p.Params)
 
-	return buff.Bytes(), nil
+	return buff, body, nil
+}
+
+// ByteArrayReader returns a reader over the byte array in Params at index,
+// which can be used to stream large arrays into files or other writers.
+// Large byte arrays received by a Connection are not copied out of the
+// buffer they were read into, which is left to the message.
+func (p *Message) ByteArrayReader(index int) (*bytes.Reader, error) {
+	if index < 0 || len(p.Params) <= index {
+		return nil, ErrNotByteArray
+	}
+	b, ok := p.Params[index].([]byte)
+	if !ok {
+		return nil, ErrNotByteArray
+	}
+	return bytes.NewReader(b), nil
 }
@@ -1,6 +1,17 @@
 package dbus
 
-import "testing"
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
 
 func TestUnmarshal(t *testing.T) {
 
@@ -27,6 +38,18 @@ func TestUnmarshal(t *testing.T) {
 	}
 }
 
+func TestUnmarshalSender(t *testing.T) {
+	teststr := "l\x04\x00\x01\x00\x00\x00\x00\x01\x00\x00\x00\x0e\x00\x00\x00\x07\x01s\x00\x05\x00\x00\x00:1.42\x00\x00\x00"
+
+	msg, _, e := _Unmarshal([]byte(teststr))
+	if nil != e {
+		t.Fatal("#1 Failed:", e)
+	}
+	if ":1.42" != msg.Sender {
+		t.Error("#2 Failed:", msg.Sender)
+	}
+}
+
 func TestMarshal(t *testing.T) {
 	teststr := "l\x01\x00\x01\x00\x00\x00\x00\x01\x00\x00\x00m\x00\x00\x00\x01\x01o\x00\x15\x00\x00\x00/org/freedesktop/DBus\x00\x00\x00\x02\x01s\x00\x14\x00\x00\x00org.freedesktop.DBus\x00\x00\x00\x00\x03\x01s\x00\x05\x00\x00\x00Hello\x00\x00\x00\x06\x01s\x00\x14\x00\x00\x00org.freedesktop.DBus\x00\x00\x00\x00"
 
@@ -44,3 +67,471 @@ func TestMarshal(t *testing.T) {
 		t.Error("#1 Failed\n", buff, "\n", []byte(teststr))
 	}
 }
+
+func TestReadMessage(t *testing.T) {
+	buff := bytes.NewBuffer([]byte{})
+	for i, member := range []string{"Foo", "Bar"} {
+		msg := NewMessage()
+		msg.Type = SIGNAL
+		msg.Path = "/org/example"
+		msg.Iface = "org.example.Iface"
+		msg.Member = member
+		msg.Sig = "su"
+		msg.Params = []interface{}{"value", uint32(i)}
+		b, _ := msg._Marshal()
+		buff.Write(b)
+	}
+
+	r := iotest.OneByteReader(buff)
+	for i, member := range []string{"Foo", "Bar"} {
+		msg, e := _ReadMessage(r)
+		if e != nil {
+			t.Fatalf("#%d-1 Failed: %v", i+1, e)
+		}
+		if msg.Member != member || len(msg.Params) != 2 || msg.Params[1] != uint32(i) {
+			t.Errorf("#%d-2 Failed: %v %v", i+1, msg.Member, msg.Params)
+		}
+	}
+	if _, e := _ReadMessage(r); e != io.EOF {
+		t.Error("#3 Failed:", e)
+	}
+}
+
+func TestCloneRecycledMessage(t *testing.T) {
+	orig := NewMessage()
+	orig.Type = SIGNAL
+	orig.Path = "/org/example"
+	orig.Member = "Foo"
+	orig.Sig = "su"
+	orig.Params = []interface{}{"bar", uint32(1)}
+	buff, _ := orig._Marshal()
+
+	msg, _, e := _UnmarshalInto(_GetPooledMessage(), buff)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	clone := msg.Clone()
+	_ReleaseMessage(msg)
+
+	if msg.Member != "" || len(msg.Params) != 0 {
+		t.Error("#2 Failed:", msg.Member, msg.Params)
+	}
+	if clone.Member != "Foo" || clone.Path != "/org/example" || len(clone.Params) != 2 || clone.Params[0] != "bar" {
+		t.Error("#3 Failed:", clone.Member, clone.Params)
+	}
+
+	reused, _, _ := _UnmarshalInto(_GetPooledMessage(), buff)
+	if reused.Params[0] != "bar" || clone.Params[0] != "bar" {
+		t.Error("#4 Failed:", reused.Params, clone.Params)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Iface = "org.example.Iface"
+	msg.Member = "Foo"
+	msg.Sig = "u"
+	msg.Params = []interface{}{uint32(7)}
+	buff, _ := msg._Marshal()
+
+	if _, _, e := _Unmarshal(buff); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if _, _, e := _Unmarshal(buff[:10]); e != ErrShortMessage {
+		t.Error("#2 Failed:", e)
+	}
+	if _, _, e := _Unmarshal(buff[:len(buff)-1]); e != ErrShortMessage {
+		t.Error("#3 Failed:", e)
+	}
+
+	// The body is longer than its signature says.
+	long := append(append([]byte(nil), buff...), 0, 0, 0, 0)
+	long[4] += 4
+	if _, _, e := _Unmarshal(long); e == nil {
+		t.Error("#4 Failed")
+	} else if _, ok := e.(*MalformedError); !ok {
+		t.Error("#4 Failed:", e)
+	}
+
+	// The path header field holds a uint32.
+	bad := append([]byte(nil), buff...)
+	i := bytes.Index(bad, []byte("\x01\x01o\x00"))
+	copy(bad[i+2:], "u")
+	if _, _, e := _Unmarshal(bad); e == nil {
+		t.Error("#5 Failed")
+	} else if _, ok := e.(*MalformedError); !ok {
+		t.Error("#5 Failed:", e)
+	}
+}
+
+func TestUnmarshalHeaderFields(t *testing.T) {
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Iface = "org.example.Iface"
+	msg.Member = "Foo"
+	buff, _ := msg._Marshal()
+
+	// Fields of unknown codes are skipped, and known fields of another
+	// string type than the specified one are accepted.
+	odd := append([]byte(nil), buff...)
+	odd[bytes.Index(odd, []byte("\x02\x01s\x00"))] = 10
+	odd[bytes.Index(odd, []byte("\x01\x01o\x00"))] = 2
+	recv, _, e := _Unmarshal(odd)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if recv.Path != "" || recv.Iface != "/org/example" || recv.Member != "Foo" {
+		t.Error("#2 Failed:", recv.Path, recv.Iface, recv.Member)
+	}
+
+	// The fields array ends within the member field.
+	short := append([]byte(nil), buff...)
+	short[12] -= 8
+	if _, _, e := _Unmarshal(short); e == nil {
+		t.Error("#3 Failed")
+	}
+}
+
+func TestUnmarshalAliasing(t *testing.T) {
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Iface = "org.example.Iface"
+	msg.Member = "Foo"
+	msg.Sig = "ayay"
+	msg.Params = []interface{}{make([]byte, largeArraySize), []byte{1, 2, 3}}
+	buff, _ := msg._Marshal()
+
+	recv, aliased, e := _UnmarshalAliasing(NewMessage(), buff)
+	if e != nil || !aliased {
+		t.Fatal("#1 Failed:", aliased, e)
+	}
+	if large := recv.Params[0].([]byte); &large[0] != &buff[len(buff)-len(large)-7] || cap(large) != len(large) {
+		t.Error("#2 Failed: large array copied")
+	}
+	if small := recv.Params[1].([]byte); &small[0] == &buff[len(buff)-3] {
+		t.Error("#3 Failed: small array aliased")
+	}
+
+	// Large arrays are copied out of buffers mostly holding other data.
+	padded := append(buff[:len(buff):len(buff)], make([]byte, 2*len(buff))...)
+	if _, aliased, _ := _UnmarshalAliasing(NewMessage(), padded[:len(buff)]); aliased {
+		t.Error("#4 Failed")
+	}
+	if _, _, e := _UnmarshalInto(NewMessage(), buff); e != nil {
+		t.Error("#5 Failed:", e)
+	}
+}
+
+// chunkReader returns the data of r in reads of random sizes up to max.
+type chunkReader struct {
+	r   io.Reader
+	rnd *rand.Rand
+	max int
+}
+
+func (p *chunkReader) Read(b []byte) (int, error) {
+	if n := 1 + p.rnd.Intn(p.max); n < len(b) {
+		b = b[:n]
+	}
+	return p.r.Read(b)
+}
+
+// _SplitTestMessages returns n signals whose header fields and bodies vary
+// in length, so that their padding differs, and some of which have bodies
+// larger than size.
+func _SplitTestMessages(rnd *rand.Rand, n, size int) []*Message {
+	msgs := make([]*Message, n)
+	for i := range msgs {
+		msg := NewMessage()
+		msg.Type = SIGNAL
+		msg.Path = "/org/example" + strings.Repeat("/x", rnd.Intn(8))
+		msg.Iface = "org.example.Iface" + strings.Repeat("x", rnd.Intn(8))
+		msg.Member = fmt.Sprint("Member", i)
+		msg.serial = uint32(i + 1)
+		switch i % 4 {
+		case 0:
+			msg.Sig = "s"
+			msg.Params = []interface{}{strings.Repeat("v", rnd.Intn(20))}
+		case 1:
+			msg.Sig = "yay"
+			data := make([]byte, rnd.Intn(3*size))
+			rnd.Read(data)
+			msg.Params = []interface{}{byte(i), data}
+		case 2:
+			msg.Sig = "ya(su)t"
+			msg.Params = []interface{}{byte(i), []interface{}{[]interface{}{"key", uint32(i)}}, uint64(i) << 40}
+		case 3: // no body
+		}
+		msgs[i] = msg
+	}
+	return msgs
+}
+
+func _CheckSplitMessage(t *testing.T, i int, want, got *Message) {
+	if got.Member != want.Member || got.Path != want.Path || got.Iface != want.Iface || got.Serial() != want.Serial() {
+		t.Fatalf("#%d Failed: %s %s %s %d", i, got.Path, got.Iface, got.Member, got.Serial())
+	}
+	if fmt.Sprint(got.Params) != fmt.Sprint(want.Params) {
+		t.Fatalf("#%d Failed: %v", i, got.Params)
+	}
+}
+
+func TestReadMessageSplit(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	msgs := _SplitTestMessages(rnd, 200, 64)
+	var buff bytes.Buffer
+	for _, msg := range msgs {
+		b, e := msg._Marshal()
+		if e != nil {
+			t.Fatal(e)
+		}
+		buff.Write(b)
+	}
+	data := buff.Bytes()
+
+	for _, max := range []int{1, 3, 7, 16, 100} {
+		r := &chunkReader{bytes.NewReader(data), rnd, max}
+		for i, want := range msgs {
+			got, e := _ReadMessage(r)
+			if e != nil {
+				t.Fatalf("#%d-%d Failed: %v", max, i, e)
+			}
+			_CheckSplitMessage(t, i, want, got)
+		}
+		if _, e := _ReadMessage(r); e != io.EOF {
+			t.Errorf("#%d Failed: %v", max, e)
+		}
+	}
+
+	// A stream ending inside the fixed header or inside the body is not a
+	// clean end of file.
+	first, _ := msgs[1]._Marshal()
+	for _, n := range []int{5, fixedHeaderSize + 3, len(first) - 1} {
+		if _, e := _ReadMessage(bytes.NewReader(first[:n])); e != io.ErrUnexpectedEOF {
+			t.Errorf("#%d Failed: %v", n, e)
+		}
+	}
+}
+
+func TestReadMessageTooLarge(t *testing.T) {
+	header := []byte("l\x04\x00\x01\xff\xff\xff\xff\x01\x00\x00\x00\xff\xff\xff\xff")
+	if _, e := _ReadMessage(bytes.NewReader(header)); e == nil {
+		t.Error("#1 Failed")
+	} else if _, ok := e.(*MalformedError); !ok {
+		t.Error("#1 Failed:", e)
+	}
+	if _, _, e := _Unmarshal(header); e == nil {
+		t.Error("#2 Failed")
+	} else if _, ok := e.(*MalformedError); !ok {
+		t.Error("#2 Failed:", e)
+	}
+}
+
+func TestEndianness(t *testing.T) {
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Iface = "org.example.Iface"
+	msg.Member = "Foo"
+	buff, _ := msg._Marshal()
+
+	buff[0] = 'x'
+	if _, e := _ReadMessage(bytes.NewReader(buff)); e == nil {
+		t.Error("#1 Failed")
+	} else if _, ok := e.(*MalformedError); !ok {
+		t.Error("#1 Failed:", e)
+	}
+	if _, _, e := _Unmarshal(buff); e == nil {
+		t.Error("#2 Failed")
+	} else if _, ok := e.(*MalformedError); !ok {
+		t.Error("#2 Failed:", e)
+	}
+
+}
+
+func TestBigEndian(t *testing.T) {
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Iface = "org.example.Iface"
+	msg.Member = "Foo"
+	msg.Sig = "nua{sv}(xd)"
+	msg.Params = []interface{}{
+		int16(-2),
+		uint32(0x01020304),
+		map[string]interface{}{"k": uint64(5)},
+		[]interface{}{int64(-6), 1.5},
+	}
+	msg.Order = binary.BigEndian
+	buff, e := msg._Marshal()
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if buff[0] != BIG_ENDIAN || !bytes.Contains(buff, []byte{1, 2, 3, 4}) {
+		t.Error("#2 Failed:", buff)
+	}
+
+	ret, e := _ReadMessage(bytes.NewReader(buff))
+	if e != nil {
+		t.Fatal("#3 Failed:", e)
+	}
+	if ret.Order != binary.BigEndian || ret.Path != msg.Path || ret.Member != msg.Member || ret.Sig != msg.Sig {
+		t.Error("#4 Failed:", ret)
+	}
+	expected := []interface{}{
+		int16(-2),
+		uint32(0x01020304),
+		[]interface{}{[]interface{}{"k", uint64(5)}},
+		[]interface{}{int64(-6), 1.5},
+	}
+	if !reflect.DeepEqual(_Unwrap(ret.Params), expected) {
+		t.Error("#5 Failed:", ret.Params)
+	}
+
+	msg.Sig = "qt"
+	msg.Params = []interface{}{uint16(7), uint64(8)}
+	buff, _ = msg._Marshal()
+	ret, _, e = _Unmarshal(buff)
+	if e != nil {
+		t.Fatal("#6 Failed:", e)
+	}
+	var q uint16
+	var x uint64
+	if e := ret.Store(&q, &x); e != nil || q != 7 || x != 8 {
+		t.Error("#7 Failed:", q, x, e)
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	msg := &Message{Type: SIGNAL, Path: "/org/example", Iface: "org.example.Iface", Member: "Foo"}
+	buff, _ := msg._Marshal()
+	if buff[3] != PROTOCOL_VERSION {
+		t.Error("#1 Failed:", buff[3])
+	}
+	if recv, _, e := _Unmarshal(buff); e != nil || recv.Protocol != PROTOCOL_VERSION {
+		t.Error("#2 Failed:", e)
+	}
+
+	buff[3] = 2
+	if _, e := _ReadMessage(bytes.NewReader(buff)); e == nil {
+		t.Error("#3 Failed")
+	} else if v, ok := e.(*VersionError); !ok || v.Version != 2 {
+		t.Error("#3 Failed:", e)
+	}
+	if _, _, e := _Unmarshal(buff); e == nil {
+		t.Error("#4 Failed")
+	} else if _, ok := e.(*VersionError); !ok {
+		t.Error("#4 Failed:", e)
+	}
+}
+
+// _ViolatingMessage returns a marshalled signal whose boolean argument is 2.
+func _ViolatingMessage(member string) []byte {
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Iface = "org.example.Iface"
+	msg.Member = member
+	msg.Sig = "b"
+	msg.Params = []interface{}{true}
+	buff, _ := msg._Marshal()
+	buff[len(buff)-4] = 2
+	return buff
+}
+
+func TestUnmarshalViolations(t *testing.T) {
+	recv, _, e := _Unmarshal(_ViolatingMessage("Foo"))
+	if _, ok := e.(*ViolationError); !ok {
+		t.Error("#1 Failed:", e)
+	}
+	if recv == nil || recv.Params[0] != true {
+		t.Fatal("#2 Failed:", recv)
+	}
+
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Iface = "org.example.Iface"
+	msg.Member = "Foo"
+	msg.Sig = "ys"
+	msg.Params = []interface{}{byte(1), "valid"}
+	buff, _ := msg._Marshal()
+	if _, _, e := _Unmarshal(buff); e != nil {
+		t.Fatal("#3 Failed:", e)
+	}
+
+	utf := append([]byte(nil), buff...)
+	utf[len(utf)-2] = 0xff
+	if _, _, e := _Unmarshal(utf); e == nil {
+		t.Error("#4 Failed")
+	} else if _, ok := e.(*ViolationError); !ok {
+		t.Error("#4 Failed:", e)
+	}
+
+	padding := append([]byte(nil), buff...)
+	padding[len(padding)-12] = 1 // between the byte and the string length
+	if _, _, e := _Unmarshal(padding); e == nil {
+		t.Error("#5 Failed")
+	} else if _, ok := e.(*ViolationError); !ok {
+		t.Error("#5 Failed:", e)
+	}
+}
+
+func TestReadMessageLengths(t *testing.T) {
+	// Header fields longer than any array may be.
+	header := []byte("l\x04\x00\x01\x00\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x05")
+	if _, e := _ReadMessage(bytes.NewReader(header)); e == nil {
+		t.Error("#1 Failed")
+	} else if _, ok := e.(*MalformedError); !ok {
+		t.Error("#1 Failed:", e)
+	}
+
+	// A body of 100MB is announced, but never sent.
+	header = []byte("l\x04\x00\x01\x00\x00\x40\x06\x01\x00\x00\x00\x00\x00\x00\x00")
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, e := _ReadMessage(bytes.NewReader(append(header, make([]byte, 100)...))); e != io.ErrUnexpectedEOF {
+		t.Error("#2 Failed:", e)
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 4*readChunkSize {
+		t.Error("#3 Failed:", n)
+	}
+
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Iface = "org.example.Iface"
+	msg.Member = "Large"
+	msg.Sig = "ay"
+	large := make([]byte, 3*readChunkSize+5)
+	large[len(large)-1] = 0xff
+	msg.Params = []interface{}{large}
+	buff, _ := msg._Marshal()
+	recv, e := _ReadMessage(iotest.HalfReader(bytes.NewReader(buff)))
+	if e != nil || !bytes.Equal(recv.Params[0].([]byte), large) {
+		t.Error("#4 Failed:", e)
+	}
+}
+
+func TestParseArrayBounds(t *testing.T) {
+	// The length runs past the end of the data.
+	if _, _, e := Parse([]byte("\x10\x00\x00\x00\x01\x00\x00\x00"), "au", 0); e == nil {
+		t.Error("#1 Failed")
+	}
+	// A negative length.
+	if _, _, e := Parse([]byte("\xff\xff\xff\xff\x01\x00\x00\x00"), "au", 0); e == nil {
+		t.Error("#2 Failed")
+	}
+	// The second element crosses the end of the array.
+	if _, _, e := Parse([]byte("\x06\x00\x00\x00\x01\x00\x00\x00\x02\x00\x00\x00"), "au", 0); e == nil {
+		t.Error("#3 Failed")
+	}
+	if ret, _, e := Parse([]byte("\x08\x00\x00\x00\x01\x00\x00\x00\x02\x00\x00\x00"), "au", 0); e != nil || len(ret[0].([]interface{})) != 2 {
+		t.Error("#4 Failed:", ret, e)
+	}
+}
@@ -0,0 +1,85 @@
+package dbus
+
+import (
+	"errors"
+	"time"
+)
+
+const MONITORING_INTERFACE = "org.freedesktop.DBus.Monitoring"
+
+// ErrMonitor is returned for messages sent by a connection in monitor mode,
+// which the bus would disconnect for sending anything.
+var ErrMonitor = errors.New("Monitor")
+
+// BecomeMonitor turns the connection into a monitor, which receives every
+// message on the bus matching one of rules, or all messages if there are
+// none, including method calls, returns and errors between other
+// connections. They are delivered to the returned channel instead of being
+// dispatched, in the order they were received, until the channel is closed
+// when the connection ends. The connection cannot send anything anymore,
+// and does not reconnect. Monitoring is usually only allowed to privileged
+// connections.
+func (p *Connection) BecomeMonitor(rules []MatchRule) (<-chan *Message, error) {
+	filters := make([]string, len(rules))
+	for i := range rules {
+		filters[i] = rules[i]._ToString()
+	}
+	msg := _NewCall("org.freedesktop.DBus", "/org/freedesktop/DBus", MONITORING_INTERFACE, "BecomeMonitor", "asu",
+		[]interface{}{filters, uint32(0)})
+
+	monitor := make(chan *Message, msgQueueSize)
+	replies := make(chan *Message, 1)
+	err := p._SendAsync(msg, func(reply *Message) {
+		if reply != nil && reply.Type == METHOD_RETURN {
+			// Called by the receiver, which thus delivers the
+			// messages following the reply to monitor.
+			p.monitor = monitor
+			p.stateMutex.Lock()
+			p.monitoring = true
+			p.stateMutex.Unlock()
+		}
+		replies <- reply
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired <-chan time.Time
+	if timeout := p._CallTimeout(0); timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case reply := <-replies:
+		if reply == nil {
+			return nil, p._CallErr()
+		}
+		if reply.Type == ERROR {
+			return nil, _ReplyError(reply)
+		}
+		return monitor, nil
+	case <-expired:
+		if _, ok := p.methodCallReplies.Remove(msg.serial); ok {
+			return nil, ErrCallTimeout
+		}
+		// The reply arrived meanwhile.
+		if reply := <-replies; reply != nil && reply.Type == METHOD_RETURN {
+			return monitor, nil
+		}
+		return nil, ErrCallTimeout
+	}
+}
+
+// _SendErr returns the error failing messages sent now, if any.
+func (p *Connection) _SendErr() error {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	if p.closeErr != nil {
+		return p.closeErr
+	}
+	if p.monitoring {
+		return ErrMonitor
+	}
+	return nil
+}
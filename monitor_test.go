@@ -0,0 +1,65 @@
+package dbus
+
+import (
+	"testing"
+)
+
+func TestBecomeMonitor(t *testing.T) {
+	filters := make(chan []interface{}, 1)
+	con, _ := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Member != "BecomeMonitor" {
+			return
+		}
+		filters <- msg.Params[0].([]interface{})
+		bus.Reply(msg, "")
+
+		call := NewMessage()
+		call.Type = METHOD_CALL
+		call.Path = "/thing"
+		call.Iface = "org.example.Thing"
+		call.Member = "Frob"
+		call.Sender = ":1.7"
+		call.Dest = ":1.8"
+		bus.Send(call)
+		reply := NewMessage()
+		reply.Type = METHOD_RETURN
+		reply.replySerial = call.serial
+		reply.Sender = ":1.8"
+		reply.Dest = ":1.7"
+		bus.Send(reply)
+		bus.Emit("/thing", "org.example.Thing", "Changed", "")
+		bus.conn.Close()
+	})
+
+	monitor, e := con.BecomeMonitor([]MatchRule{{Type: "method_call"}, {Type: "signal", Member: "Changed"}})
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if f := <-filters; len(f) != 2 || f[0] != "type='method_call'" || f[1] != "type='signal',member='Changed'" {
+		t.Error("#2 Failed:", f)
+	}
+	types := make([]MessageType, 0)
+	for msg := range monitor {
+		types = append(types, msg.Type)
+	}
+	if len(types) != 3 || types[0] != METHOD_CALL || types[1] != METHOD_RETURN || types[2] != SIGNAL {
+		t.Error("#3 Failed:", types)
+	}
+}
+
+func TestMonitorCannotSend(t *testing.T) {
+	con, _ := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "BecomeMonitor" {
+			bus.Reply(msg, "")
+		}
+	})
+	if _, e := con.BecomeMonitor(nil); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if _, e := con.Call("org.example", "/", "org.example.Thing", "Frob"); e != ErrMonitor {
+		t.Error("#2 Failed:", e)
+	}
+	if e := con.Emit("/", "org.example.Thing", "Changed", ""); e != ErrMonitor {
+		t.Error("#3 Failed:", e)
+	}
+}
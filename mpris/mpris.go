@@ -0,0 +1,252 @@
+// Package mpris controls media players implementing the MPRIS D-Bus
+// interface on the session bus.
+//
+// A Player caches the player properties and keeps them up to date from the
+// PropertiesChanged signals of the player, so that reading them does not
+// need a round trip.
+package mpris
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	NAME_PREFIX          = "org.mpris.MediaPlayer2."
+	PATH                 = "/org/mpris/MediaPlayer2"
+	PLAYER_INTERFACE     = "org.mpris.MediaPlayer2.Player"
+	PROPERTIES_INTERFACE = "org.freedesktop.DBus.Properties"
+)
+
+// Playback statuses.
+const (
+	STATUS_PLAYING = "Playing"
+	STATUS_PAUSED  = "Paused"
+	STATUS_STOPPED = "Stopped"
+)
+
+var (
+	ErrNoPlayer = errors.New("NoSuchPlayer")
+	ErrNoReply  = errors.New("EmptyReply")
+)
+
+// _BusInterface returns the interface of the message bus itself.
+func _BusInterface(conn *dbus.Connection) (*dbus.Interface, error) {
+	obj := conn.GetObject("org.freedesktop.DBus", "/org/freedesktop/DBus")
+	iface := conn.Interface(obj, "org.freedesktop.DBus")
+	if iface == nil {
+		return nil, ErrNoReply
+	}
+	return iface, nil
+}
+
+// ListPlayers returns the bus names of the running players.
+func ListPlayers(conn *dbus.Connection) ([]string, error) {
+	bus, err := _BusInterface(conn)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := conn.CallMethod(bus, "ListNames")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if err = dbus.Store(ret, &names); err != nil {
+		return nil, err
+	}
+	return _FilterPlayers(names), nil
+}
+
+func _FilterPlayers(names []string) []string {
+	players := make([]string, 0)
+	for _, name := range names {
+		if strings.HasPrefix(name, NAME_PREFIX) {
+			players = append(players, name)
+		}
+	}
+	return players
+}
+
+// Player is a media player.
+type Player struct {
+	conn   *dbus.Connection
+	name   string
+	owner  string
+	player *dbus.Interface
+	props  *dbus.Interface
+
+	handler  *dbus.SignalHandler
+	mutex    sync.Mutex
+	cache    map[string]interface{}
+	watchers []func(name string, value interface{})
+}
+
+// NewPlayer returns the player owning the bus name name, as returned by
+// ListPlayers. Its properties are cached and kept current until Close.
+func NewPlayer(conn *dbus.Connection, name string) (*Player, error) {
+	obj := conn.GetObject(name, PATH)
+	player := conn.Interface(obj, PLAYER_INTERFACE)
+	props := conn.Interface(obj, PROPERTIES_INTERFACE)
+	if player == nil || props == nil {
+		return nil, ErrNoPlayer
+	}
+
+	bus, err := _BusInterface(conn)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := conn.CallMethod(bus, "GetNameOwner", name)
+	if err != nil {
+		return nil, err
+	}
+	p := &Player{conn: conn, name: name, player: player, props: props}
+	if err = dbus.Store(ret, &p.owner); err != nil {
+		return nil, err
+	}
+
+	p.cache = make(map[string]interface{})
+	mr := &dbus.MatchRule{
+		Type:      "signal",
+		Sender:    p.owner,
+		Interface: PROPERTIES_INTERFACE,
+		Member:    "PropertiesChanged",
+		Path:      PATH,
+	}
+	if p.handler, err = conn.AddSignalHandler(mr, p._OnPropertiesChanged); err != nil {
+		return nil, err
+	}
+
+	ret, err = conn.CallMethod(props, "GetAll", PLAYER_INTERFACE)
+	var all map[string]interface{}
+	if err == nil {
+		err = dbus.Store(ret, &all)
+	}
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	p.mutex.Lock()
+	for k, v := range all {
+		if _, ok := p.cache[k]; !ok {
+			p.cache[k] = v
+		}
+	}
+	p.mutex.Unlock()
+	return p, nil
+}
+
+// Name returns the bus name of the player.
+func (p *Player) Name() string { return p.name }
+
+// Close stops watching the properties of the player.
+func (p *Player) Close() error {
+	return p.conn.RemoveSignalHandler(p.handler)
+}
+
+// _OnPropertiesChanged updates the cache from a PropertiesChanged signal
+// and calls the watchers. Invalidated properties are dropped from the
+// cache, to be fetched again when read.
+func (p *Player) _OnPropertiesChanged(msg *dbus.Message) {
+	if msg.Sender != p.owner {
+		return // another player
+	}
+	var iface string
+	var changed map[string]interface{}
+	var invalidated []string
+	if dbus.Store(msg.Params, &iface, &changed, &invalidated) != nil || iface != PLAYER_INTERFACE {
+		return
+	}
+
+	p.mutex.Lock()
+	for k, v := range changed {
+		p.cache[k] = v
+	}
+	for _, k := range invalidated {
+		delete(p.cache, k)
+	}
+	watchers := p.watchers
+	p.mutex.Unlock()
+
+	for _, watcher := range watchers {
+		for k, v := range changed {
+			watcher(k, v)
+		}
+		for _, k := range invalidated {
+			watcher(k, nil)
+		}
+	}
+}
+
+// Watch calls proc with the name and new value of each player property
+// that changes. The value is nil for properties whose new value was not
+// sent, which are fetched again by Property.
+func (p *Player) Watch(proc func(name string, value interface{})) {
+	p.mutex.Lock()
+	p.watchers = append(p.watchers, proc)
+	p.mutex.Unlock()
+}
+
+// Property returns the player property name, from the cache if possible.
+// It must not be called from functions passed to Watch.
+func (p *Player) Property(name string) (interface{}, error) {
+	p.mutex.Lock()
+	v, ok := p.cache[name]
+	p.mutex.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	ret, err := p.conn.CallMethod(p.props, "Get", PLAYER_INTERFACE, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, ErrNoReply
+	}
+	if err = dbus.Store(ret[:1], &v); err != nil {
+		return nil, err
+	}
+	p.mutex.Lock()
+	p.cache[name] = v
+	p.mutex.Unlock()
+	return v, nil
+}
+
+// PlaybackStatus returns one of STATUS_PLAYING, STATUS_PAUSED and
+// STATUS_STOPPED.
+func (p *Player) PlaybackStatus() (string, error) {
+	v, err := p.Property("PlaybackStatus")
+	if err != nil {
+		return "", err
+	}
+	var status string
+	err = dbus.Store([]interface{}{v}, &status)
+	return status, err
+}
+
+// Metadata returns the metadata of the current track, keyed by names like
+// "xesam:title" or "mpris:length".
+func (p *Player) Metadata() (map[string]interface{}, error) {
+	v, err := p.Property("Metadata")
+	if err != nil {
+		return nil, err
+	}
+	var metadata map[string]interface{}
+	err = dbus.Store([]interface{}{v}, &metadata)
+	return metadata, err
+}
+
+func (p *Player) _Call(method string) error {
+	_, err := p.conn.CallMethod(p.player, method)
+	return err
+}
+
+func (p *Player) Play() error      { return p._Call("Play") }
+func (p *Player) Pause() error     { return p._Call("Pause") }
+func (p *Player) PlayPause() error { return p._Call("PlayPause") }
+func (p *Player) Stop() error      { return p._Call("Stop") }
+func (p *Player) Next() error      { return p._Call("Next") }
+func (p *Player) Previous() error  { return p._Call("Previous") }
@@ -0,0 +1,48 @@
+package mpris
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/norisatir/go-dbus"
+)
+
+func TestFilterPlayers(t *testing.T) {
+	names := []string{":1.1", "org.freedesktop.DBus", "org.mpris.MediaPlayer2.vlc", "org.mpris.MediaPlayer2.mpv"}
+	players := _FilterPlayers(names)
+	if !reflect.DeepEqual(players, []string{"org.mpris.MediaPlayer2.vlc", "org.mpris.MediaPlayer2.mpv"}) {
+		t.Error("#1 Failed:", players)
+	}
+}
+
+func TestPropertiesChanged(t *testing.T) {
+	p := &Player{owner: ":1.7", cache: map[string]interface{}{"Volume": 1.0}}
+	var seen []string
+	p.Watch(func(name string, value interface{}) { seen = append(seen, name) })
+
+	msg := dbus.NewMessage()
+	msg.Sender = ":1.7"
+	msg.Params = []interface{}{
+		PLAYER_INTERFACE,
+		[]interface{}{[]interface{}{"PlaybackStatus", STATUS_PAUSED}},
+		[]interface{}{"Volume"},
+	}
+	p._OnPropertiesChanged(msg)
+
+	if status, _ := p.PlaybackStatus(); status != STATUS_PAUSED {
+		t.Error("#1 Failed:", status)
+	}
+	if _, ok := p.cache["Volume"]; ok {
+		t.Error("#2 Failed: invalidated property kept")
+	}
+	if !reflect.DeepEqual(seen, []string{"PlaybackStatus", "Volume"}) {
+		t.Error("#3 Failed:", seen)
+	}
+
+	msg.Sender = ":1.8"
+	msg.Params[1] = []interface{}{[]interface{}{"PlaybackStatus", STATUS_PLAYING}}
+	p._OnPropertiesChanged(msg)
+	if status, _ := p.PlaybackStatus(); status != STATUS_PAUSED {
+		t.Error("#4 Failed: signal of another player applied")
+	}
+}
@@ -0,0 +1,141 @@
+package dbus
+
+import (
+	"errors"
+	"strconv"
+)
+
+// NameFlag modifies how RequestName asks the bus for a name.
+type NameFlag uint32
+
+const (
+	// NAME_FLAG_ALLOW_REPLACEMENT lets another connection take the name
+	// away with NAME_FLAG_REPLACE_EXISTING.
+	NAME_FLAG_ALLOW_REPLACEMENT NameFlag = 1
+	// NAME_FLAG_REPLACE_EXISTING takes the name from its owner if the owner
+	// allowed replacement.
+	NAME_FLAG_REPLACE_EXISTING NameFlag = 2
+	// NAME_FLAG_DO_NOT_QUEUE fails the request instead of waiting in the
+	// queue for the name.
+	NAME_FLAG_DO_NOT_QUEUE NameFlag = 4
+)
+
+// RequestNameReply is the outcome of RequestName.
+type RequestNameReply uint32
+
+const (
+	// REQUEST_NAME_REPLY_PRIMARY_OWNER means the connection now owns the
+	// name.
+	REQUEST_NAME_REPLY_PRIMARY_OWNER RequestNameReply = 1
+	// REQUEST_NAME_REPLY_IN_QUEUE means the name is owned by another
+	// connection, and the connection gets it once the owner releases it.
+	REQUEST_NAME_REPLY_IN_QUEUE RequestNameReply = 2
+	// REQUEST_NAME_REPLY_EXISTS means the name is owned by another
+	// connection and the request was not queued.
+	REQUEST_NAME_REPLY_EXISTS RequestNameReply = 3
+	// REQUEST_NAME_REPLY_ALREADY_OWNER means the connection owned the name
+	// before.
+	REQUEST_NAME_REPLY_ALREADY_OWNER RequestNameReply = 4
+)
+
+var requestNameReplyNames = map[RequestNameReply]string{
+	REQUEST_NAME_REPLY_PRIMARY_OWNER: "PrimaryOwner",
+	REQUEST_NAME_REPLY_IN_QUEUE:      "InQueue",
+	REQUEST_NAME_REPLY_EXISTS:        "Exists",
+	REQUEST_NAME_REPLY_ALREADY_OWNER: "AlreadyOwner",
+}
+
+func (p RequestNameReply) String() string {
+	if name, ok := requestNameReplyNames[p]; ok {
+		return name
+	}
+	return "RequestNameReply(" + strconv.Itoa(int(p)) + ")"
+}
+
+// ReleaseNameReply is the outcome of ReleaseName.
+type ReleaseNameReply uint32
+
+const (
+	// RELEASE_NAME_REPLY_RELEASED means the connection released the name
+	// or left the queue for it.
+	RELEASE_NAME_REPLY_RELEASED ReleaseNameReply = 1
+	// RELEASE_NAME_REPLY_NON_EXISTENT means nobody owns the name.
+	RELEASE_NAME_REPLY_NON_EXISTENT ReleaseNameReply = 2
+	// RELEASE_NAME_REPLY_NOT_OWNER means the connection neither owns the
+	// name nor waits for it.
+	RELEASE_NAME_REPLY_NOT_OWNER ReleaseNameReply = 3
+)
+
+var releaseNameReplyNames = map[ReleaseNameReply]string{
+	RELEASE_NAME_REPLY_RELEASED:     "Released",
+	RELEASE_NAME_REPLY_NON_EXISTENT: "NonExistent",
+	RELEASE_NAME_REPLY_NOT_OWNER:    "NotOwner",
+}
+
+func (p ReleaseNameReply) String() string {
+	if name, ok := releaseNameReplyNames[p]; ok {
+		return name
+	}
+	return "ReleaseNameReply(" + strconv.Itoa(int(p)) + ")"
+}
+
+// ErrUnexpectedReply is returned when the bus answers with values of the
+// wrong type.
+var ErrUnexpectedReply = errors.New("UnexpectedReply")
+
+// RequestName asks the bus to assign the well-known name to the connection.
+// Whether it got the name is told by the reply; once it does, the bus sends
+// NameAcquired, and NameLost when the name is taken away again. Names the
+// connection got or waits for are requested again with the same flags when
+// it reconnects.
+func (p *Connection) RequestName(name string, flags NameFlag) (RequestNameReply, error) {
+	if err := ValidateBusName(name); err != nil {
+		return 0, err
+	}
+	code, err := p._CallBusCode("RequestName", name, uint32(flags))
+	if err == nil && RequestNameReply(code) != REQUEST_NAME_REPLY_EXISTS {
+		p.namesMutex.Lock()
+		if p.requested == nil {
+			p.requested = make(map[string]NameFlag)
+		}
+		p.requested[name] = flags
+		p.namesMutex.Unlock()
+	}
+	return RequestNameReply(code), err
+}
+
+// ReleaseName gives up the well-known name, or leaves the queue for it.
+func (p *Connection) ReleaseName(name string) (ReleaseNameReply, error) {
+	if err := ValidateBusName(name); err != nil {
+		return 0, err
+	}
+	p.namesMutex.Lock()
+	delete(p.requested, name)
+	p.namesMutex.Unlock()
+	code, err := p._CallBusCode("ReleaseName", name)
+	return ReleaseNameReply(code), err
+}
+
+// OwnsName reports whether the connection currently owns the well-known
+// name.
+func (p *Connection) OwnsName(name string) bool {
+	p.namesMutex.Lock()
+	defer p.namesMutex.Unlock()
+	return p.names[name]
+}
+
+// _CallBusCode calls a method of the bus which returns a single uint32.
+func (p *Connection) _CallBusCode(name string, args ...interface{}) (uint32, error) {
+	ret, err := p.CallMethod(p.proxy, name, args...)
+	if err != nil {
+		return 0, err
+	}
+	if len(ret) != 1 {
+		return 0, ErrUnexpectedReply
+	}
+	code, ok := ret[0].(uint32)
+	if !ok {
+		return 0, ErrUnexpectedReply
+	}
+	return code, nil
+}
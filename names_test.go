@@ -0,0 +1,84 @@
+package dbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestName(t *testing.T) {
+	owned := map[string]bool{}
+	con, _ := newTestBus(t, func(bus *testBus, msg *Message) {
+		if msg.Type != METHOD_CALL || msg.Dest != "org.freedesktop.DBus" {
+			return
+		}
+		name, _ := msg.Params[0].(string)
+		switch msg.Member {
+		case "RequestName":
+			switch {
+			case owned[name]:
+				bus.Reply(msg, "u", uint32(REQUEST_NAME_REPLY_ALREADY_OWNER))
+			case name == "org.example.Taken":
+				bus.Reply(msg, "u", uint32(REQUEST_NAME_REPLY_EXISTS))
+			default:
+				owned[name] = true
+				bus.Reply(msg, "u", uint32(REQUEST_NAME_REPLY_PRIMARY_OWNER))
+				bus.Emit("/org/freedesktop/DBus", "org.freedesktop.DBus", "NameAcquired", "s", name)
+			}
+		case "ReleaseName":
+			if !owned[name] {
+				bus.Reply(msg, "u", uint32(RELEASE_NAME_REPLY_NOT_OWNER))
+				return
+			}
+			delete(owned, name)
+			bus.Emit("/org/freedesktop/DBus", "org.freedesktop.DBus", "NameLost", "s", name)
+			bus.Reply(msg, "u", uint32(RELEASE_NAME_REPLY_RELEASED))
+		}
+	})
+	acquired := make(chan string, 1)
+	lost := make(chan string, 1)
+	con.NameAcquired = func(name string) { acquired <- name }
+	con.NameLost = func(name string) { lost <- name }
+	if e := con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+
+	if r, e := con.RequestName("org.example.Foo", NAME_FLAG_DO_NOT_QUEUE); e != nil || r != REQUEST_NAME_REPLY_PRIMARY_OWNER {
+		t.Error("#1 Failed:", r, e)
+	}
+	select {
+	case name := <-acquired:
+		if name != "org.example.Foo" || !con.OwnsName(name) {
+			t.Error("#2 Failed:", name)
+		}
+	case <-time.After(time.Second):
+		t.Error("#2 Failed: no NameAcquired")
+	}
+	if r, e := con.RequestName("org.example.Foo", 0); e != nil || r != REQUEST_NAME_REPLY_ALREADY_OWNER {
+		t.Error("#3 Failed:", r, e)
+	}
+	if r, e := con.RequestName("org.example.Taken", 0); e != nil || r != REQUEST_NAME_REPLY_EXISTS || r.String() != "Exists" {
+		t.Error("#4 Failed:", r, e)
+	}
+
+	if r, e := con.ReleaseName("org.example.Foo"); e != nil || r != RELEASE_NAME_REPLY_RELEASED {
+		t.Error("#5 Failed:", r, e)
+	}
+	select {
+	case name := <-lost:
+		if name != "org.example.Foo" || con.OwnsName(name) {
+			t.Error("#6 Failed:", name)
+		}
+	case <-time.After(time.Second):
+		t.Error("#6 Failed: no NameLost")
+	}
+	if r, e := con.ReleaseName("org.example.Foo"); e != nil || r != RELEASE_NAME_REPLY_NOT_OWNER {
+		t.Error("#7 Failed:", r, e)
+	}
+
+	if _, e := con.RequestName("not a name", 0); e == nil {
+		t.Error("#8 Failed")
+	}
+	if s := RequestNameReply(9).String(); s != "RequestNameReply(9)" {
+		t.Error("#9 Failed:", s)
+	}
+}
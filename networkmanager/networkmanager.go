@@ -0,0 +1,295 @@
+// Package networkmanager is a thin typed layer over NetworkManager on the
+// system bus: enumerating devices and saved connections, watching state
+// changes and activating connections.
+package networkmanager
+
+import (
+	"errors"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION                   = "org.freedesktop.NetworkManager"
+	PATH                          = "/org/freedesktop/NetworkManager"
+	INTERFACE                     = "org.freedesktop.NetworkManager"
+	SETTINGS_PATH                 = "/org/freedesktop/NetworkManager/Settings"
+	SETTINGS_INTERFACE            = "org.freedesktop.NetworkManager.Settings"
+	SETTINGS_CONNECTION_INTERFACE = "org.freedesktop.NetworkManager.Settings.Connection"
+	DEVICE_INTERFACE              = "org.freedesktop.NetworkManager.Device"
+	PROPERTIES_INTERFACE          = "org.freedesktop.DBus.Properties"
+
+	// NO_OBJECT is passed to ActivateConnection for arguments left for
+	// NetworkManager to choose.
+	NO_OBJECT = "/"
+)
+
+var (
+	ErrNoService = errors.New("NoNetworkManager")
+	ErrNoObject  = errors.New("NoSuchObject")
+	ErrNoReply   = errors.New("EmptyReply")
+)
+
+// State is the global networking state.
+type State uint32
+
+const (
+	STATE_UNKNOWN          State = 0
+	STATE_ASLEEP           State = 10
+	STATE_DISCONNECTED     State = 20
+	STATE_DISCONNECTING    State = 30
+	STATE_CONNECTING       State = 40
+	STATE_CONNECTED_LOCAL  State = 50
+	STATE_CONNECTED_SITE   State = 60
+	STATE_CONNECTED_GLOBAL State = 70
+)
+
+// DeviceState is the state of a device.
+type DeviceState uint32
+
+const (
+	DEVICE_STATE_UNKNOWN      DeviceState = 0
+	DEVICE_STATE_UNMANAGED    DeviceState = 10
+	DEVICE_STATE_UNAVAILABLE  DeviceState = 20
+	DEVICE_STATE_DISCONNECTED DeviceState = 30
+	DEVICE_STATE_PREPARE      DeviceState = 40
+	DEVICE_STATE_CONFIG       DeviceState = 50
+	DEVICE_STATE_NEED_AUTH    DeviceState = 60
+	DEVICE_STATE_IP_CONFIG    DeviceState = 70
+	DEVICE_STATE_IP_CHECK     DeviceState = 80
+	DEVICE_STATE_SECONDARIES  DeviceState = 90
+	DEVICE_STATE_ACTIVATED    DeviceState = 100
+	DEVICE_STATE_DEACTIVATING DeviceState = 110
+	DEVICE_STATE_FAILED       DeviceState = 120
+)
+
+// object is an object of the service with its Properties interface.
+type object struct {
+	conn  *dbus.Connection
+	path  string
+	props *dbus.Interface
+}
+
+func _GetInterface(conn *dbus.Connection, path, name string) (*dbus.Interface, error) {
+	obj := conn.GetObject(DESTINATION, path)
+	iface := conn.Interface(obj, name)
+	if iface == nil {
+		return nil, ErrNoObject
+	}
+	return iface, nil
+}
+
+func _NewObject(conn *dbus.Connection, path string) (*object, error) {
+	props, err := _GetInterface(conn, path, PROPERTIES_INTERFACE)
+	if err != nil {
+		return nil, err
+	}
+	return &object{conn, path, props}, nil
+}
+
+// _StoreProperty stores the property name of iface into dest.
+func (p *object) _StoreProperty(iface, name string, dest interface{}) error {
+	ret, err := p.conn.CallMethod(p.props, "Get", iface, name)
+	if err != nil {
+		return err
+	}
+	if len(ret) == 0 {
+		return ErrNoReply
+	}
+	return dbus.Store(ret[:1], dest)
+}
+
+func (p *object) _AddSignalHandler(iface, member string, proc func(*dbus.Message)) (*dbus.SignalHandler, error) {
+	mr := &dbus.MatchRule{
+		Type:      "signal",
+		Sender:    DESTINATION,
+		Interface: iface,
+		Member:    member,
+		Path:      p.path,
+	}
+	return p.conn.AddSignalHandler(mr, proc)
+}
+
+// Client is the NetworkManager service.
+type Client struct {
+	*object
+	iface    *dbus.Interface
+	settings *dbus.Interface
+}
+
+// NewClient returns the service reached through conn, which must be an
+// initialized connection to the system bus.
+func NewClient(conn *dbus.Connection) (*Client, error) {
+	obj, err := _NewObject(conn, PATH)
+	if err != nil {
+		return nil, ErrNoService
+	}
+	iface, err := _GetInterface(conn, PATH, INTERFACE)
+	if err != nil {
+		return nil, ErrNoService
+	}
+	settings, err := _GetInterface(conn, SETTINGS_PATH, SETTINGS_INTERFACE)
+	if err != nil {
+		return nil, ErrNoService
+	}
+	return &Client{obj, iface, settings}, nil
+}
+
+// State returns the global networking state.
+func (p *Client) State() (State, error) {
+	var state State
+	err := p._StoreProperty(INTERFACE, "State", &state)
+	return state, err
+}
+
+// OnStateChanged calls proc with the new global state each time it
+// changes. The handler can be passed to RemoveSignalHandler to stop
+// watching.
+func (p *Client) OnStateChanged(proc func(State)) (*dbus.SignalHandler, error) {
+	return p._AddSignalHandler(INTERFACE, "StateChanged", func(msg *dbus.Message) {
+		var state State
+		if dbus.Store(msg.Params, &state) == nil {
+			proc(state)
+		}
+	})
+}
+
+// Devices returns the network devices managed by NetworkManager.
+func (p *Client) Devices() ([]*Device, error) {
+	ret, err := p.conn.CallMethod(p.iface, "GetDevices")
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	if err = dbus.Store(ret, &paths); err != nil {
+		return nil, err
+	}
+	devices := make([]*Device, 0, len(paths))
+	for _, path := range paths {
+		device, err := NewDevice(p.conn, path)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// Connections returns the saved connection profiles.
+func (p *Client) Connections() ([]*SettingsConnection, error) {
+	ret, err := p.conn.CallMethod(p.settings, "ListConnections")
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	if err = dbus.Store(ret, &paths); err != nil {
+		return nil, err
+	}
+	conns := make([]*SettingsConnection, 0, len(paths))
+	for _, path := range paths {
+		iface, err := _GetInterface(p.conn, path, SETTINGS_CONNECTION_INTERFACE)
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, &SettingsConnection{p.conn, path, iface})
+	}
+	return conns, nil
+}
+
+// ActivateConnection activates the connection profile conn on device and
+// returns the path of the active connection. Either may be NO_OBJECT to let
+// NetworkManager pick one.
+func (p *Client) ActivateConnection(conn, device string) (string, error) {
+	ret, err := p.conn.CallMethod(p.iface, "ActivateConnection", conn, device, NO_OBJECT)
+	if err != nil {
+		return "", err
+	}
+	var active string
+	err = dbus.Store(ret, &active)
+	return active, err
+}
+
+// DeactivateConnection deactivates the active connection active.
+func (p *Client) DeactivateConnection(active string) error {
+	_, err := p.conn.CallMethod(p.iface, "DeactivateConnection", active)
+	return err
+}
+
+// Device is a network device.
+type Device struct {
+	*object
+}
+
+// NewDevice returns the device with the object path path.
+func NewDevice(conn *dbus.Connection, path string) (*Device, error) {
+	obj, err := _NewObject(conn, path)
+	if err != nil {
+		return nil, err
+	}
+	return &Device{obj}, nil
+}
+
+// Path returns the object path of the device.
+func (p *Device) Path() string { return p.path }
+
+// Interface returns the name of the kernel interface, like "eth0".
+func (p *Device) Interface() (string, error) {
+	var name string
+	err := p._StoreProperty(DEVICE_INTERFACE, "Interface", &name)
+	return name, err
+}
+
+// DeviceType returns the NM_DEVICE_TYPE of the device, 1 for ethernet and 2
+// for wifi.
+func (p *Device) DeviceType() (uint32, error) {
+	var t uint32
+	err := p._StoreProperty(DEVICE_INTERFACE, "DeviceType", &t)
+	return t, err
+}
+
+// State returns the state of the device.
+func (p *Device) State() (DeviceState, error) {
+	var state DeviceState
+	err := p._StoreProperty(DEVICE_INTERFACE, "State", &state)
+	return state, err
+}
+
+// OnStateChanged calls proc with the new and old state of the device and
+// the NM_DEVICE_STATE_REASON of each change.
+func (p *Device) OnStateChanged(proc func(state, old DeviceState, reason uint32)) (*dbus.SignalHandler, error) {
+	return p._AddSignalHandler(DEVICE_INTERFACE, "StateChanged", func(msg *dbus.Message) {
+		var state, old DeviceState
+		var reason uint32
+		if dbus.Store(msg.Params, &state, &old, &reason) == nil {
+			proc(state, old, reason)
+		}
+	})
+}
+
+// SettingsConnection is a saved connection profile.
+type SettingsConnection struct {
+	conn  *dbus.Connection
+	path  string
+	iface *dbus.Interface
+}
+
+// Path returns the object path of the profile, as passed to
+// ActivateConnection.
+func (p *SettingsConnection) Path() string { return p.path }
+
+// GetSettings returns the settings of the profile by setting name, like
+// "connection" or "802-11-wireless". Secrets are not included.
+func (p *SettingsConnection) GetSettings() (map[string]map[string]interface{}, error) {
+	ret, err := p.conn.CallMethod(p.iface, "GetSettings")
+	if err != nil {
+		return nil, err
+	}
+	return _NewSettings(ret)
+}
+
+// _NewSettings decodes the a{sa{sv}} reply of GetSettings.
+func _NewSettings(ret []interface{}) (map[string]map[string]interface{}, error) {
+	var settings map[string]map[string]interface{}
+	err := dbus.Store(ret, &settings)
+	return settings, err
+}
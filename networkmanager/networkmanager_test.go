@@ -0,0 +1,27 @@
+package networkmanager
+
+import (
+	"testing"
+)
+
+func TestNewSettings(t *testing.T) {
+	ret := []interface{}{[]interface{}{
+		[]interface{}{"connection", []interface{}{
+			[]interface{}{"id", "Home"},
+			[]interface{}{"autoconnect", true},
+		}},
+		[]interface{}{"802-11-wireless", []interface{}{
+			[]interface{}{"ssid", []byte("home")},
+		}},
+	}}
+	settings, e := _NewSettings(ret)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if settings["connection"]["id"] != "Home" || settings["connection"]["autoconnect"] != true {
+		t.Error("#2 Failed:", settings)
+	}
+	if ssid, _ := settings["802-11-wireless"]["ssid"].([]byte); string(ssid) != "home" {
+		t.Error("#3 Failed:", settings)
+	}
+}
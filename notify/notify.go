@@ -0,0 +1,206 @@
+// Package notify sends desktop notifications through the
+// org.freedesktop.Notifications service of the session bus.
+//
+//	conn, _ := dbus.Connect(dbus.SessionBus)
+//	conn.Initialize()
+//	n, _ := notify.New(conn)
+//	id, _ := n.Notify(&notify.Notification{
+//		AppName: "example",
+//		Summary: "Hello",
+//		Hints:   []notify.Hint{notify.UrgencyHint(notify.URGENCY_CRITICAL)},
+//		Timeout: -1,
+//	})
+package notify
+
+import (
+	"errors"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION = "org.freedesktop.Notifications"
+	PATH        = "/org/freedesktop/Notifications"
+	INTERFACE   = "org.freedesktop.Notifications"
+)
+
+var ErrNoService = errors.New("NoNotificationService")
+
+// Urgency is the value of the urgency hint.
+type Urgency byte
+
+const (
+	URGENCY_LOW Urgency = iota
+	URGENCY_NORMAL
+	URGENCY_CRITICAL
+)
+
+// CloseReason tells why a notification was closed.
+type CloseReason uint32
+
+const (
+	CLOSED_EXPIRED   CloseReason = 1
+	CLOSED_DISMISSED CloseReason = 2
+	CLOSED_BY_CALL   CloseReason = 3
+	CLOSED_UNDEFINED CloseReason = 4
+)
+
+// Hint is an entry of the hints dictionary of a notification. The helper
+// functions below return the standard hints with values of the types the
+// specification requires.
+type Hint struct {
+	Name  string
+	Value interface{}
+}
+
+func UrgencyHint(u Urgency) Hint { return Hint{"urgency", byte(u)} }
+
+func CategoryHint(category string) Hint { return Hint{"category", category} }
+
+func DesktopEntryHint(name string) Hint { return Hint{"desktop-entry", name} }
+
+func TransientHint(transient bool) Hint { return Hint{"transient", transient} }
+
+func ResidentHint(resident bool) Hint { return Hint{"resident", resident} }
+
+func SoundFileHint(path string) Hint { return Hint{"sound-file", path} }
+
+func SoundNameHint(name string) Hint { return Hint{"sound-name", name} }
+
+func SuppressSoundHint(suppress bool) Hint { return Hint{"suppress-sound", suppress} }
+
+// PositionHints returns the hints placing the notification at x, y on the
+// screen.
+func PositionHints(x, y int32) []Hint {
+	return []Hint{{"x", x}, {"y", y}}
+}
+
+// Notification describes a notification to show.
+type Notification struct {
+	AppName    string
+	ReplacesID uint32
+	AppIcon    string
+	Summary    string
+	Body       string
+	// Actions holds pairs of action keys and their labels.
+	Actions []string
+	Hints   []Hint
+	// Timeout is the display time in milliseconds, -1 lets the server
+	// decide and 0 never expires.
+	Timeout int32
+}
+
+// ServerInfo is the reply of GetServerInformation.
+type ServerInfo struct {
+	Name        string
+	Vendor      string
+	Version     string
+	SpecVersion string
+}
+
+// Notifier talks to the notification server.
+type Notifier struct {
+	conn  *dbus.Connection
+	iface *dbus.Interface
+}
+
+// New returns a Notifier using conn, which must be initialized. It fails
+// with ErrNoService if no notification server is running.
+func New(conn *dbus.Connection) (*Notifier, error) {
+	obj := conn.GetObject(DESTINATION, PATH)
+	iface := conn.Interface(obj, INTERFACE)
+	if iface == nil {
+		return nil, ErrNoService
+	}
+	return &Notifier{conn, iface}, nil
+}
+
+// Notify shows n and returns its id, which may be passed as ReplacesID of a
+// later notification to update it.
+func (p *Notifier) Notify(n *Notification) (uint32, error) {
+	ret, err := p.conn.CallMethod(p.iface, "Notify", _NotifyArgs(n)...)
+	if err != nil {
+		return 0, err
+	}
+	var id uint32
+	err = dbus.Store(ret, &id)
+	return id, err
+}
+
+// _NotifyArgs returns the arguments of the Notify call for n.
+func _NotifyArgs(n *Notification) []interface{} {
+	actions := make([]interface{}, len(n.Actions))
+	for i, v := range n.Actions {
+		actions[i] = v
+	}
+	hints := make([]interface{}, len(n.Hints))
+	for i, v := range n.Hints {
+		hints[i] = []interface{}{v.Name, v.Value}
+	}
+	return []interface{}{n.AppName, n.ReplacesID, n.AppIcon, n.Summary, n.Body,
+		actions, hints, n.Timeout}
+}
+
+// CloseNotification closes the notification with the given id.
+func (p *Notifier) CloseNotification(id uint32) error {
+	_, err := p.conn.CallMethod(p.iface, "CloseNotification", id)
+	return err
+}
+
+// GetCapabilities returns the optional features the server supports, like
+// "actions" or "body-markup".
+func (p *Notifier) GetCapabilities() ([]string, error) {
+	ret, err := p.conn.CallMethod(p.iface, "GetCapabilities")
+	if err != nil {
+		return nil, err
+	}
+	var caps []string
+	err = dbus.Store(ret, &caps)
+	return caps, err
+}
+
+// GetServerInformation describes the notification server.
+func (p *Notifier) GetServerInformation() (*ServerInfo, error) {
+	ret, err := p.conn.CallMethod(p.iface, "GetServerInformation")
+	if err != nil {
+		return nil, err
+	}
+	info := new(ServerInfo)
+	err = dbus.Store(ret, &info.Name, &info.Vendor, &info.Version, &info.SpecVersion)
+	return info, err
+}
+
+// OnActionInvoked calls proc with the notification id and action key each
+// time the user invokes an action. The handler can be passed to
+// RemoveSignalHandler to stop watching.
+func (p *Notifier) OnActionInvoked(proc func(id uint32, key string)) (*dbus.SignalHandler, error) {
+	return p._AddSignalHandler("ActionInvoked", func(msg *dbus.Message) {
+		var id uint32
+		var key string
+		if dbus.Store(msg.Params, &id, &key) == nil {
+			proc(id, key)
+		}
+	})
+}
+
+// OnNotificationClosed calls proc each time a notification is closed.
+func (p *Notifier) OnNotificationClosed(proc func(id uint32, reason CloseReason)) (*dbus.SignalHandler, error) {
+	return p._AddSignalHandler("NotificationClosed", func(msg *dbus.Message) {
+		var id uint32
+		var reason CloseReason
+		if dbus.Store(msg.Params, &id, &reason) == nil {
+			proc(id, reason)
+		}
+	})
+}
+
+func (p *Notifier) _AddSignalHandler(member string, proc func(*dbus.Message)) (*dbus.SignalHandler, error) {
+	mr := &dbus.MatchRule{
+		Type:      "signal",
+		Sender:    DESTINATION,
+		Interface: INTERFACE,
+		Member:    member,
+		Path:      PATH,
+	}
+	return p.conn.AddSignalHandler(mr, proc)
+}
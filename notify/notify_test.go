@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/norisatir/go-dbus"
+)
+
+func TestNotifyArgs(t *testing.T) {
+	n := &Notification{
+		AppName: "test",
+		Summary: "Summary",
+		Actions: []string{"default", "Open"},
+		Hints:   append(PositionHints(10, 20), UrgencyHint(URGENCY_CRITICAL)),
+		Timeout: -1,
+	}
+	args := _NotifyArgs(n)
+	if len(args) != 8 {
+		t.Fatal("#1 Failed:", len(args))
+	}
+	if !reflect.DeepEqual(args[5], []interface{}{"default", "Open"}) {
+		t.Error("#2 Failed:", args[5])
+	}
+	hints := []interface{}{
+		[]interface{}{"x", int32(10)},
+		[]interface{}{"y", int32(20)},
+		[]interface{}{"urgency", byte(2)},
+	}
+	if !reflect.DeepEqual(args[6], hints) {
+		t.Error("#3 Failed:", args[6])
+	}
+	if args[7] != int32(-1) {
+		t.Error("#4 Failed:", args[7])
+	}
+}
+
+func TestSignalHandlers(t *testing.T) {
+	conn := new(dbus.Connection)
+	// One rule for the signal and one to track the owner of the server.
+	conn.MaxMatchRules = 2
+	notifier := &Notifier{conn: conn}
+	invoked, e := notifier.OnActionInvoked(func(uint32, string) {})
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if _, e = notifier.OnNotificationClosed(func(uint32, CloseReason) {}); e != dbus.ErrTooManyMatchRules {
+		t.Error("#2 Failed:", e)
+	}
+	if e = conn.RemoveSignalHandler(invoked); e != nil {
+		t.Error("#3 Failed:", e)
+	}
+	if _, e = notifier.OnNotificationClosed(func(uint32, CloseReason) {}); e != nil {
+		t.Error("#4 Failed:", e)
+	}
+}
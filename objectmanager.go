@@ -0,0 +1,88 @@
+package dbus
+
+const OBJECT_MANAGER_INTERFACE = "org.freedesktop.DBus.ObjectManager"
+
+// ManagedObjects maps object paths to the properties of their interfaces
+// by interface name, as returned by GetManagedObjects.
+type ManagedObjects map[string]map[string]map[string]interface{}
+
+// InterfacesAdded is a decoded InterfacesAdded signal.
+type InterfacesAdded struct {
+	// Path is the object which gained the interfaces.
+	Path string
+	// Interfaces holds the properties of the added interfaces by name.
+	Interfaces map[string]map[string]interface{}
+}
+
+// InterfacesRemoved is a decoded InterfacesRemoved signal.
+type InterfacesRemoved struct {
+	// Path is the object which lost the interfaces.
+	Path string
+	// Interfaces lists the names of the removed interfaces.
+	Interfaces []string
+}
+
+// GetManagedObjects returns all objects below obj, which must implement
+// org.freedesktop.DBus.ObjectManager, with the properties of their
+// interfaces.
+func (p *Connection) GetManagedObjects(obj *Object) (ManagedObjects, error) {
+	ret, err := p.CallWithSignature(obj.dest, obj.path, OBJECT_MANAGER_INTERFACE, "GetManagedObjects", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) != 1 {
+		return nil, ErrUnexpectedReply
+	}
+	var objects ManagedObjects
+	if err = Store(ret, &objects); err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// WatchInterfaces calls added and removed with the InterfacesAdded and
+// InterfacesRemoved signals of the object manager obj, sent by the current
+// owner of the destination of obj. Either may be nil. Signals whose body
+// does not decode are ignored. The handlers can be passed to
+// RemoveSignalHandler to stop watching.
+func (p *Connection) WatchInterfaces(obj *Object, added func(*InterfacesAdded), removed func(*InterfacesRemoved)) ([]*SignalHandler, error) {
+	handlers := make([]*SignalHandler, 0, 2)
+	if added != nil {
+		handler, err := p.AddSignalHandler(_ObjectManagerRule(obj, "InterfacesAdded"), func(msg *Message) {
+			event := new(InterfacesAdded)
+			if Store(msg.Params, &event.Path, &event.Interfaces) != nil {
+				return
+			}
+			added(event)
+		})
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, handler)
+	}
+	if removed != nil {
+		handler, err := p.AddSignalHandler(_ObjectManagerRule(obj, "InterfacesRemoved"), func(msg *Message) {
+			event := new(InterfacesRemoved)
+			if Store(msg.Params, &event.Path, &event.Interfaces) != nil {
+				return
+			}
+			removed(event)
+		})
+		if err != nil {
+			p.RemoveSignalHandler(handlers...)
+			return nil, err
+		}
+		handlers = append(handlers, handler)
+	}
+	return handlers, nil
+}
+
+func _ObjectManagerRule(obj *Object, member string) *MatchRule {
+	return &MatchRule{
+		Type:      "signal",
+		Interface: OBJECT_MANAGER_INTERFACE,
+		Member:    member,
+		Path:      obj.path,
+		Sender:    obj.dest,
+	}
+}
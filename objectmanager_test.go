@@ -0,0 +1,114 @@
+package dbus
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManagedObjects(t *testing.T) {
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		switch msg.Member {
+		case "AddMatch":
+			bus.Reply(msg, "")
+		case "GetNameOwner":
+			bus.Reply(msg, "s", ":1.5")
+		case "GetManagedObjects":
+			if msg.Path != "/manager" || msg.Iface != OBJECT_MANAGER_INTERFACE {
+				return
+			}
+			bus.Reply(msg, "a{oa{sa{sv}}}", []interface{}{
+				[]interface{}{"/manager/a", []interface{}{
+					[]interface{}{"org.example.Thing", []interface{}{
+						[]interface{}{"Name", "a"},
+					}},
+				}},
+			})
+		}
+	})
+	obj := &Object{dest: "org.example", path: "/manager"}
+
+	objects, e := con.GetManagedObjects(obj)
+	if e != nil || len(objects) != 1 || objects["/manager/a"]["org.example.Thing"]["Name"] != "a" {
+		t.Error("#1 Failed:", objects, e)
+	}
+
+	added := make(chan *InterfacesAdded, 1)
+	removed := make(chan *InterfacesRemoved, 1)
+	_, e = con.WatchInterfaces(obj,
+		func(event *InterfacesAdded) { added <- event },
+		func(event *InterfacesRemoved) { removed <- event })
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	bus.EmitFrom(":1.5", "/manager", OBJECT_MANAGER_INTERFACE, "InterfacesAdded", "oa{sa{sv}}", "/manager/b",
+		[]interface{}{[]interface{}{"org.example.Thing", []interface{}{[]interface{}{"Name", "b"}}}})
+	select {
+	case event := <-added:
+		if event.Path != "/manager/b" || event.Interfaces["org.example.Thing"]["Name"] != "b" {
+			t.Error("#2 Failed:", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("#2 Failed: no event")
+	}
+
+	bus.EmitFrom(":1.5", "/manager", OBJECT_MANAGER_INTERFACE, "InterfacesRemoved", "oas", "/manager/a",
+		[]interface{}{"org.example.Thing"})
+	select {
+	case event := <-removed:
+		if event.Path != "/manager/a" || len(event.Interfaces) != 1 || event.Interfaces[0] != "org.example.Thing" {
+			t.Error("#3 Failed:", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("#3 Failed: no event")
+	}
+}
+
+func TestWatchInterfacesSender(t *testing.T) {
+	rules := make(chan string, 4)
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		switch msg.Member {
+		case "AddMatch":
+			rules <- msg.Params[0].(string)
+			bus.Reply(msg, "")
+		case "GetNameOwner":
+			bus.Reply(msg, "s", ":1.5")
+		}
+	})
+	obj := &Object{dest: "org.example.Service", path: "/manager"}
+	added := make(chan *InterfacesAdded, 2)
+	removed := make(chan *InterfacesRemoved, 2)
+	_, e := con.WatchInterfaces(obj,
+		func(event *InterfacesAdded) { added <- event },
+		func(event *InterfacesRemoved) { removed <- event })
+	if e != nil {
+		t.Fatal(e)
+	}
+	if rule := <-rules; !strings.Contains(rule, "sender='org.example.Service'") {
+		t.Error("#1 Failed:", rule)
+	}
+
+	for _, sender := range []string{":1.66", ":1.5"} {
+		bus.EmitFrom(sender, "/manager", OBJECT_MANAGER_INTERFACE, "InterfacesAdded", "oa{sa{sv}}",
+			"/manager/"+sender[3:], []interface{}{[]interface{}{"org.example.Thing", []interface{}{}}})
+		bus.EmitFrom(sender, "/manager", OBJECT_MANAGER_INTERFACE, "InterfacesRemoved", "oas",
+			"/manager/"+sender[3:], []interface{}{"org.example.Thing"})
+	}
+	select {
+	case event := <-added:
+		if event.Path != "/manager/5" {
+			t.Error("#2 Failed:", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("#2 Failed: no event")
+	}
+	select {
+	case event := <-removed:
+		if event.Path != "/manager/5" {
+			t.Error("#3 Failed:", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("#3 Failed: no event")
+	}
+}
@@ -0,0 +1,176 @@
+package dbus
+
+import (
+	"strings"
+)
+
+// nameOwner tracks the unique name owning a well-known name which match
+// rules use as sender. Signals carry the unique name of their sender, so
+// those rules can only be checked locally against the owner.
+type nameOwner struct {
+	owner   string
+	refs    int
+	changes uint64 // NameOwnerChanged signals received, to spot stale replies
+	handler *SignalHandler
+}
+
+// _IsTrackedSender reports whether the owner of sender, the sender of a
+// match rule, must be tracked to check the rule. Unique names are compared
+// as they are, and the bus sends as itself.
+func (p *Connection) _IsTrackedSender(sender string) bool {
+	return !p.peer && sender != "" && !strings.HasPrefix(sender, ":") && sender != "org.freedesktop.DBus"
+}
+
+// _IsFromSender reports whether msg was sent by sender, the sender of a
+// match rule. A well-known name matches the messages of its current owner,
+// and none while the owner is unknown. Peers have no bus to send as anyone
+// else, and their messages carry no sender.
+func (p *Connection) _IsFromSender(msg *Message, sender string) bool {
+	if p.peer || sender == "" {
+		return true
+	}
+	if !p._IsTrackedSender(sender) {
+		return msg.Sender == sender
+	}
+	p.ownersMutex.Lock()
+	defer p.ownersMutex.Unlock()
+	owner := p.owners[sender]
+	return owner != nil && owner.owner != "" && owner.owner == msg.Sender
+}
+
+// _WatchSender starts tracking the owner of sender for a new match rule.
+// The NameOwnerChanged rule is added before the owner is asked for, so that
+// no change goes unnoticed.
+func (p *Connection) _WatchSender(sender string) error {
+	if !p._IsTrackedSender(sender) {
+		return nil
+	}
+	p.ownersMutex.Lock()
+	if owner := p.owners[sender]; owner != nil {
+		owner.refs++
+		p.ownersMutex.Unlock()
+		return nil
+	}
+	if p.owners == nil {
+		p.owners = make(map[string]*nameOwner)
+	}
+	owner := &nameOwner{refs: 1}
+	p.owners[sender] = owner
+	p.ownersMutex.Unlock()
+
+	mr := &MatchRule{
+		Type:      "signal",
+		Sender:    "org.freedesktop.DBus",
+		Interface: "org.freedesktop.DBus",
+		Member:    "NameOwnerChanged",
+		Path:      "/org/freedesktop/DBus",
+		Args:      map[int]string{0: sender},
+	}
+	handler, err := p.AddSignalHandler(mr, func(msg *Message) {
+		var name, oldOwner, newOwner string
+		if Store(msg.Params, &name, &oldOwner, &newOwner) != nil || name != sender {
+			return
+		}
+		p.ownersMutex.Lock()
+		owner.owner = newOwner
+		owner.changes++
+		p.ownersMutex.Unlock()
+	})
+	p.ownersMutex.Lock()
+	owner.handler = handler
+	if err != nil && p.owners[sender] == owner {
+		delete(p.owners, sender)
+	}
+	p.ownersMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	p.handlersMutex.Lock()
+	matchesSent := p.matchesSent
+	p.handlersMutex.Unlock()
+	if matchesSent {
+		return p._ResolveOwner(sender)
+	}
+	return nil
+}
+
+// _UnwatchSender stops tracking the owner of sender once no match rule
+// uses it anymore.
+func (p *Connection) _UnwatchSender(sender string) error {
+	if !p._IsTrackedSender(sender) {
+		return nil
+	}
+	p.ownersMutex.Lock()
+	owner := p.owners[sender]
+	if owner == nil {
+		p.ownersMutex.Unlock()
+		return nil
+	}
+	owner.refs--
+	if owner.refs > 0 {
+		p.ownersMutex.Unlock()
+		return nil
+	}
+	delete(p.owners, sender)
+	p.ownersMutex.Unlock()
+	return p.RemoveSignalHandler(owner.handler)
+}
+
+// _ResolveOwner asks the bus for the owner of name. The reply is dropped
+// if the owner changed meanwhile, as the NameOwnerChanged signal is newer.
+func (p *Connection) _ResolveOwner(name string) error {
+	p.ownersMutex.Lock()
+	owner := p.owners[name]
+	if owner == nil {
+		p.ownersMutex.Unlock()
+		return nil
+	}
+	changes := owner.changes
+	p.ownersMutex.Unlock()
+
+	ret, err := p.CallMethod(p.proxy, "GetNameOwner", name)
+	unique, err := _NameOwner(ret, err)
+	if err != nil {
+		return err
+	}
+	p.ownersMutex.Lock()
+	if owner.changes == changes {
+		owner.owner = unique
+	}
+	p.ownersMutex.Unlock()
+	return nil
+}
+
+// _ResolveOwners asks the bus for the owners of all tracked names, once
+// the match rules added before Initialize were registered.
+func (p *Connection) _ResolveOwners() error {
+	p.ownersMutex.Lock()
+	names := make([]string, 0, len(p.owners))
+	for name := range p.owners {
+		names = append(names, name)
+	}
+	p.ownersMutex.Unlock()
+	for _, name := range names {
+		if err := p._ResolveOwner(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// _NameOwner returns the unique name from the result of GetNameOwner, or
+// an empty string if the name has no owner.
+func _NameOwner(ret []interface{}, err error) (string, error) {
+	if e, ok := err.(*Error); ok && e.Name == ERROR_NAME_HAS_NO_OWNER {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var unique string
+	if err = Store(ret, &unique); err != nil {
+		return "", err
+	}
+	return unique, nil
+}
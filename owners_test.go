@@ -0,0 +1,128 @@
+package dbus
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSenderOwner(t *testing.T) {
+	var mutex sync.Mutex
+	removed := make([]string, 0)
+	con, bus := newTestBus(t, func(bus *testBus, msg *Message) {
+		switch msg.Member {
+		case "AddMatch":
+			bus.Reply(msg, "")
+		case "RemoveMatch":
+			mutex.Lock()
+			removed = append(removed, msg.Params[0].(string))
+			mutex.Unlock()
+			bus.Reply(msg, "")
+		case "GetNameOwner":
+			if msg.Params[0] == "org.example.Service" {
+				bus.Send(_NewErrorReply(msg, ERROR_NAME_HAS_NO_OWNER, "no owner"))
+			}
+		}
+	})
+	signals := make(chan string, 4)
+	proc := func(msg *Message) { signals <- msg.Sender }
+	// Added before Initialize, the owner is asked for once connected.
+	first, e := con.AddSignalHandler(NewMatchRule().WithSender("org.example.Service").WithMember("Changed"), proc)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e = con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+	second, e := con.AddSignalHandler(NewMatchRule().WithSender("org.example.Service").WithMember("Moved"), proc)
+	if e != nil {
+		t.Fatal(e)
+	}
+	next := func() string {
+		select {
+		case sender := <-signals:
+			return sender
+		case <-time.After(time.Second):
+			return "none"
+		}
+	}
+
+	// Without an owner, nobody sends as the name.
+	bus.EmitFrom(":1.5", "/thing", "org.example.Thing", "Changed", "")
+	bus.Emit("/org/freedesktop/DBus", "org.freedesktop.DBus", "NameOwnerChanged", "sss",
+		"org.example.Service", "", ":1.5")
+	bus.EmitFrom(":1.5", "/thing", "org.example.Thing", "Moved", "")
+	if sender := next(); sender != ":1.5" {
+		t.Error("#1 Failed:", sender)
+	}
+	bus.Emit("/org/freedesktop/DBus", "org.freedesktop.DBus", "NameOwnerChanged", "sss",
+		"org.example.Service", ":1.5", "")
+	bus.EmitFrom(":1.5", "/thing", "org.example.Thing", "Changed", "")
+	bus.EmitFrom("", "/thing", "org.example.Thing", "Changed", "")
+	if sender := next(); sender != "none" {
+		t.Error("#2 Failed:", sender)
+	}
+
+	// The owner is tracked until the last rule naming it is removed.
+	if e = con.RemoveSignalHandler(first); e != nil {
+		t.Error("#3 Failed:", e)
+	}
+	if e = con.RemoveSignalHandler(second); e != nil {
+		t.Error("#4 Failed:", e)
+	}
+	mutex.Lock()
+	if len(removed) != 3 || removed[2] != "type='signal',sender='org.freedesktop.DBus',interface='org.freedesktop.DBus',member='NameOwnerChanged',path='/org/freedesktop/DBus',arg0='org.example.Service'" {
+		t.Error("#5 Failed:", removed)
+	}
+	mutex.Unlock()
+	con.ownersMutex.Lock()
+	if owners := len(con.owners); owners != 0 {
+		t.Error("#6 Failed:", owners)
+	}
+	con.ownersMutex.Unlock()
+}
+
+func TestSenderOwnerReconnect(t *testing.T) {
+	var mutex sync.Mutex
+	owners := map[*testBus]string{}
+	con, buses := newTestReconnecting(t, func(bus *testBus, msg *Message) {
+		switch msg.Member {
+		case "AddMatch":
+			bus.Reply(msg, "")
+		case "GetNameOwner":
+			mutex.Lock()
+			if owners[bus] == "" {
+				owners[bus] = ":1." + string(rune('5'+len(owners)))
+			}
+			bus.Reply(msg, "s", owners[bus])
+			mutex.Unlock()
+		}
+	})
+	reconnected := make(chan error, 1)
+	con.Reconnected = func(err error) { reconnected <- err }
+	if e := con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+	first := <-buses
+	signals := make(chan string, 4)
+	if _, e := con.AddSignalHandler(NewMatchRule().WithSender("org.example.Service"), func(msg *Message) { signals <- msg.Sender }); e != nil {
+		t.Fatal(e)
+	}
+	first.EmitFrom(":1.5", "/thing", "org.example.Thing", "Changed", "")
+	if sender := <-signals; sender != ":1.5" {
+		t.Error("#1 Failed:", sender)
+	}
+
+	first.conn.Close()
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("#2 Failed: not reconnected")
+	}
+	second := <-buses
+	second.EmitFrom(":1.5", "/thing", "org.example.Thing", "Changed", "")
+	second.EmitFrom(":1.6", "/thing", "org.example.Thing", "Changed", "")
+	if sender := <-signals; sender != ":1.6" {
+		t.Error("#3 Failed:", sender)
+	}
+}
@@ -0,0 +1,148 @@
+package dbus
+
+import (
+	"strings"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// PathEncode returns the object path of the object identified by the
+// arbitrary string external below prefix, like sd_bus_path_encode. Bytes
+// other than ASCII letters, and digits after the first byte, are escaped
+// as an underscore followed by two lowercase hex digits, and the empty
+// string is encoded as a single underscore.
+func PathEncode(prefix, external string) string {
+	if prefix != "/" {
+		prefix += "/"
+	}
+	if external == "" {
+		return prefix + "_"
+	}
+
+	buff := make([]byte, 0, len(prefix)+len(external)*3)
+	buff = append(buff, prefix...)
+	for i := 0; i < len(external); i++ {
+		c := external[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && '0' <= c && c <= '9' {
+			buff = append(buff, c)
+			continue
+		}
+		buff = append(buff, '_', hexDigits[c>>4], hexDigits[c&0xf])
+	}
+	return string(buff)
+}
+
+// PathDecode returns the string encoded by PathEncode into the object path
+// path below prefix. ok is false if path is not a direct child of prefix or
+// its last element is not validly escaped.
+func PathDecode(path, prefix string) (external string, ok bool) {
+	if prefix != "/" {
+		prefix += "/"
+	}
+	if !strings.HasPrefix(path, prefix) {
+		return "", false
+	}
+	label := path[len(prefix):]
+	if label == "" || strings.IndexByte(label, '/') >= 0 {
+		return "", false
+	}
+	if label == "_" {
+		return "", true
+	}
+
+	buff := make([]byte, 0, len(label))
+	for i := 0; i < len(label); i++ {
+		if label[i] != '_' {
+			buff = append(buff, label[i])
+			continue
+		}
+		if i+2 >= len(label) {
+			return "", false
+		}
+		hi := strings.IndexByte(hexDigits, label[i+1])
+		lo := strings.IndexByte(hexDigits, label[i+2])
+		if hi < 0 || lo < 0 {
+			return "", false
+		}
+		buff = append(buff, byte(hi<<4|lo))
+		i += 2
+	}
+	return string(buff), true
+}
+
+// ObjectPath is the path of an object, like "/org/freedesktop/DBus". Values
+// of the object path wire type decode to ObjectPath, and both ObjectPath and
+// string values marshal as object paths, which fails for invalid paths. The
+// methods assume a valid path, see Validate.
+type ObjectPath string
+
+// Validate checks p against the grammar of the specification.
+func (p ObjectPath) Validate() error {
+	return ValidateObjectPath(string(p))
+}
+
+// IsValid reports whether p follows the grammar of the specification.
+func (p ObjectPath) IsValid() bool {
+	return p.Validate() == nil
+}
+
+// Join returns the path of the descendant of p with the given elements
+// below it. Empty elements are skipped.
+func (p ObjectPath) Join(elements ...string) ObjectPath {
+	path := string(p)
+	for _, element := range elements {
+		if element == "" {
+			continue
+		}
+		if path != "/" {
+			path += "/"
+		}
+		path += element
+	}
+	return ObjectPath(path)
+}
+
+// Split returns the elements of p, which are none for the root.
+func (p ObjectPath) Split() []string {
+	if p == "/" || p == "" {
+		return []string{}
+	}
+	return strings.Split(string(p[1:]), "/")
+}
+
+// Parent returns the path p is a direct child of. The root has no parent,
+// so its Parent is the empty path.
+func (p ObjectPath) Parent() ObjectPath {
+	i := strings.LastIndex(string(p), "/")
+	switch {
+	case p == "/" || i < 0:
+		return ""
+	case i == 0:
+		return "/"
+	}
+	return p[:i]
+}
+
+// IsAncestor reports whether p is an ancestor of path, that is its parent,
+// the parent of its parent and so on. No path is its own ancestor.
+func (p ObjectPath) IsAncestor(path ObjectPath) bool {
+	if p == "/" {
+		return path != "/" && path != ""
+	}
+	return strings.HasPrefix(string(path), string(p)+"/")
+}
+
+// Rel returns the elements which lead from p to path, separated by slashes,
+// like "b/c" from "/a" to "/a/b/c". It is empty for path itself. ok is
+// false if path is not p or one of its descendants.
+func (p ObjectPath) Rel(path ObjectPath) (rel string, ok bool) {
+	switch {
+	case p == path:
+		return "", true
+	case !p.IsAncestor(path):
+		return "", false
+	case p == "/":
+		return string(path[1:]), true
+	}
+	return string(path[len(p)+1:]), true
+}
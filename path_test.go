@@ -0,0 +1,148 @@
+package dbus
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPathEncode(t *testing.T) {
+	tests := []struct {
+		external string
+		path     string
+	}{
+		{"", "/org/example/_"},
+		{"foo", "/org/example/foo"},
+		{"00:11:22:aa", "/org/example/_300_3a11_3a22_3aaa"},
+		{"user-name.1", "/org/example/user_2dname_2e1"},
+		{"/", "/org/example/_2f"},
+	}
+	for i, test := range tests {
+		path := PathEncode("/org/example", test.external)
+		if path != test.path {
+			t.Errorf("#%d-1 Failed: %q", i+1, path)
+		}
+		external, ok := PathDecode(path, "/org/example")
+		if !ok || external != test.external {
+			t.Errorf("#%d-2 Failed: %q %v", i+1, external, ok)
+		}
+	}
+
+	if path := PathEncode("/", "a b"); path != "/a_20b" {
+		t.Error("#6 Failed:", path)
+	}
+}
+
+func TestPathDecodeInvalid(t *testing.T) {
+	for i, path := range []string{
+		"/org/other/foo",
+		"/org/example",
+		"/org/example/",
+		"/org/example/foo/bar",
+		"/org/example/foo_2",
+		"/org/example/foo_zz",
+	} {
+		if _, ok := PathDecode(path, "/org/example"); ok {
+			t.Errorf("#%d Failed: %q decoded", i+1, path)
+		}
+	}
+}
+
+func TestObjectPath(t *testing.T) {
+	root := ObjectPath("/")
+	path := ObjectPath("/org/example")
+	if !root.IsValid() || !path.IsValid() || ObjectPath("/org/").IsValid() || ObjectPath("").IsValid() {
+		t.Error("#1 Failed")
+	}
+
+	if p := root.Join("org", "", "example"); p != path {
+		t.Error("#2 Failed:", p)
+	}
+	if p := path.Join("a", "b"); p != "/org/example/a/b" {
+		t.Error("#3 Failed:", p)
+	}
+	if p := path.Join(); p != path {
+		t.Error("#4 Failed:", p)
+	}
+
+	if s := path.Split(); len(s) != 2 || s[0] != "org" || s[1] != "example" {
+		t.Error("#5 Failed:", s)
+	}
+	if s := root.Split(); len(s) != 0 {
+		t.Error("#6 Failed:", s)
+	}
+
+	if p := path.Parent(); p != "/org" {
+		t.Error("#7 Failed:", p)
+	}
+	if p := path.Parent().Parent(); p != root {
+		t.Error("#8 Failed:", p)
+	}
+	if p := root.Parent(); p != "" {
+		t.Error("#9 Failed:", p)
+	}
+
+	ancestors := []struct {
+		p, path ObjectPath
+		ok      bool
+	}{
+		{root, path, true},
+		{"/org", path, true},
+		{path, path, false},
+		{root, root, false},
+		{"/org/ex", path, false},
+		{path, "/org", false},
+	}
+	for i, test := range ancestors {
+		if ok := test.p.IsAncestor(test.path); ok != test.ok {
+			t.Errorf("#10-%d Failed: %s %s", i+1, test.p, test.path)
+		}
+	}
+
+	if rel, ok := root.Rel(path); !ok || rel != "org/example" {
+		t.Error("#11 Failed:", rel, ok)
+	}
+	if rel, ok := ObjectPath("/org").Rel(path.Join("a")); !ok || rel != "example/a" {
+		t.Error("#12 Failed:", rel, ok)
+	}
+	if rel, ok := path.Rel(path); !ok || rel != "" {
+		t.Error("#13 Failed:", rel, ok)
+	}
+	if _, ok := path.Rel("/org"); ok {
+		t.Error("#14 Failed")
+	}
+}
+
+func TestMarshalObjectPath(t *testing.T) {
+	buff := bytes.NewBuffer([]byte{})
+	if e := _AppendParamsData(buff, "oos", []interface{}{ObjectPath("/a/b"), "/c", "/d"}); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	slice, _, e := Parse(buff.Bytes(), "oos", 0)
+	if e != nil || len(slice) != 3 || slice[0] != ObjectPath("/a/b") || slice[1] != ObjectPath("/c") || slice[2] != "/d" {
+		t.Error("#2 Failed:", slice, e)
+	}
+
+	if _, e := _AppendValue(bytes.NewBuffer([]byte{}), "o", ObjectPath("a/b")); e == nil {
+		t.Error("#3 Failed")
+	}
+	if _, e := _AppendValue(bytes.NewBuffer([]byte{}), "s", ObjectPath("/a")); e == nil {
+		t.Error("#4 Failed")
+	}
+	if _, e := _AppendValue(bytes.NewBuffer([]byte{}), "ao", []interface{}{"/a", "b"}); e == nil {
+		t.Error("#5 Failed")
+	}
+
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/a"
+	msg.Iface = "org.example.Iface"
+	msg.Member = "Moved"
+	msg.Sig = "o"
+	msg.Params = []interface{}{ObjectPath("//")}
+	if _, _, e := msg._MarshalParts(); e == nil {
+		t.Error("#6 Failed")
+	}
+	if sig, _ := _InferSignature([]interface{}{ObjectPath("/a"), "/a"}); sig != "os" {
+		t.Error("#7 Failed:", sig)
+	}
+}
@@ -0,0 +1,152 @@
+package dbus
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// Names of the errors sent in reply to method calls the connection can not
+// handle.
+const (
+	ERROR_UNKNOWN_METHOD    = "org.freedesktop.DBus.Error.UnknownMethod"
+	ERROR_UNKNOWN_OBJECT    = "org.freedesktop.DBus.Error.UnknownObject"
+	ERROR_UNKNOWN_INTERFACE = "org.freedesktop.DBus.Error.UnknownInterface"
+	ERROR_FAILED            = "org.freedesktop.DBus.Error.Failed"
+	ERROR_INVALID_ARGS      = "org.freedesktop.DBus.Error.InvalidArgs"
+)
+
+const PEER_INTERFACE = "org.freedesktop.DBus.Peer"
+
+// machineIdFiles are the places the machine id is read from, in order.
+var machineIdFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// _NewMethodReturn returns an empty method return replying to call.
+func _NewMethodReturn(call *Message) *Message {
+	msg := NewMessage()
+	msg.Type = METHOD_RETURN
+	msg.replySerial = call.serial
+	msg.Dest = call.Sender
+	return msg
+}
+
+// _NewErrorReply returns an error named name replying to call, with text as
+// its message.
+func _NewErrorReply(call *Message, name, text string) *Message {
+	msg := NewMessage()
+	msg.Type = ERROR
+	msg.ErrorName = name
+	msg.replySerial = call.serial
+	msg.Dest = call.Sender
+	msg.Sig = "s"
+	msg.Params = []interface{}{text}
+	return msg
+}
+
+// _MachineId returns the id of the local machine, as used by the
+// org.freedesktop.DBus.Peer interface.
+func _MachineId() (string, error) {
+	var err error
+	for _, name := range machineIdFiles {
+		var buff []byte
+		if buff, err = ioutil.ReadFile(name); err == nil {
+			return strings.TrimSpace(string(buff)), nil
+		}
+	}
+	return "", err
+}
+
+// _HandleMethodCall answers a method call addressed to the connection. The
+// org.freedesktop.DBus.Peer interface is implemented on every path, and
+// Introspectable on the exported objects and their parents; other calls go
+// to the exported objects. Calls to objects which are not exported
+// get an UnknownObject error so that the caller does not wait for a reply
+// until it times out. Calls flagged NO_REPLY_EXPECTED are handled without
+// replying.
+func (p *Connection) _HandleMethodCall(msg *Message) {
+	reply := p._MethodCallReply(msg)
+	if msg.Flags&NO_REPLY_EXPECTED != 0 {
+		return
+	}
+	reply.serial = p._NextSerial()
+	if err := p._QueueMessage(reply, nil); err != nil {
+		p._Logf("cannot reply to %s.%s from %s: %v", msg.Iface, msg.Member, msg.Sender, err)
+	}
+}
+
+// _MethodCallReply handles the method call msg and returns its reply.
+func (p *Connection) _MethodCallReply(msg *Message) *Message {
+	var reply *Message
+	switch {
+	case msg.Iface == PEER_INTERFACE && msg.Member == "Ping":
+		reply = _NewMethodReturn(msg)
+	case msg.Iface == PEER_INTERFACE && msg.Member == "GetMachineId":
+		if id, err := _MachineId(); err != nil {
+			reply = _NewErrorReply(msg, ERROR_FAILED, err.Error())
+		} else {
+			reply = _NewMethodReturn(msg)
+			reply.Sig = "s"
+			reply.Params = []interface{}{id}
+		}
+	case msg.Iface == PEER_INTERFACE:
+		reply = _NewErrorReply(msg, ERROR_UNKNOWN_METHOD,
+			"Unknown method '"+msg.Member+"' on interface '"+msg.Iface+"'")
+	default:
+		if msg.Member == "Introspect" && (msg.Iface == INTROSPECTABLE_INTERFACE || msg.Iface == "") {
+			reply = p._IntrospectExported(msg)
+		}
+		if reply == nil {
+			reply = p._CallExported(msg)
+		}
+		if reply == nil {
+			reply = _NewErrorReply(msg, ERROR_UNKNOWN_OBJECT,
+				"Unknown object '"+msg.Path+"'")
+		}
+	}
+	return reply
+}
+
+// _CallSelf answers the method call msg, addressed to the connection itself,
+// without going through the bus: a call made from the dispatcher, which
+// handles incoming calls, would otherwise wait for itself. The call and its
+// reply are marshalled and decoded as if they were sent, so that exported
+// methods and callers get the same values. The call is handled by a
+// goroutine of its own, and its reply passed to its pending call.
+func (p *Connection) _CallSelf(msg *Message) error {
+	if err := msg._Validate(); err != nil {
+		return err
+	}
+	call, err := _Reencode(msg)
+	if err != nil {
+		return err
+	}
+	call.Sender = p.UniqueName()
+	go func() {
+		reply := p._MethodCallReply(call)
+		if call.Flags&NO_REPLY_EXPECTED != 0 {
+			return
+		}
+		reply.serial = p._NextSerial()
+		decoded, err := _Reencode(reply)
+		if err != nil {
+			decoded = _NewErrorReply(call, ERROR_FAILED, err.Error())
+			decoded.serial = reply.serial
+		}
+		decoded.Sender = call.Sender
+		if pending, ok := p.methodCallReplies.Remove(call.serial); ok {
+			p.stats._CountReply(pending)
+			pending.callback(decoded)
+		}
+	}()
+	return nil
+}
+
+// _Reencode returns msg as it would be received.
+func _Reencode(msg *Message) (*Message, error) {
+	buff, err := msg._MarshalBuffer()
+	if err != nil {
+		return nil, err
+	}
+	defer _PutBuffer(buff)
+	decoded, _, err := _Unmarshal(buff.Bytes())
+	return decoded, err
+}
@@ -0,0 +1,71 @@
+package dbus
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestHandleMethodCall(t *testing.T) {
+	replies := make(chan *Message, 4)
+	_, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Type == METHOD_RETURN || msg.Type == ERROR {
+			replies <- msg
+		}
+	})
+
+	call := func(flags MessageFlag, path, iface, member string) *Message {
+		msg := NewMessage()
+		msg.Type = METHOD_CALL
+		msg.Flags = flags
+		msg.Path = path
+		msg.Iface = iface
+		msg.Member = member
+		bus.Send(msg)
+		return msg
+	}
+
+	ping := call(0, "/", PEER_INTERFACE, "Ping")
+	call(NO_REPLY_EXPECTED, "/org/example", "org.example.Iface", "Quiet")
+	stray := call(0, "/org/example", "org.example.Iface", "Foo")
+	bogus := call(0, "/", PEER_INTERFACE, "Bogus")
+
+	expect := []struct {
+		call *Message
+		typ  MessageType
+		name string
+	}{
+		{ping, METHOD_RETURN, ""},
+		{stray, ERROR, ERROR_UNKNOWN_OBJECT},
+		{bogus, ERROR, ERROR_UNKNOWN_METHOD},
+	}
+	for i, e := range expect {
+		select {
+		case reply := <-replies:
+			if reply.Type != e.typ || reply.ErrorName != e.name || reply.ReplySerial() != e.call.Serial() {
+				t.Errorf("#%d Failed: %d %q %d", i+1, reply.Type, reply.ErrorName, reply.ReplySerial())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("#%d Failed: no reply", i+1)
+		}
+	}
+}
+
+func TestMachineId(t *testing.T) {
+	saved := machineIdFiles
+	defer func() { machineIdFiles = saved }()
+
+	name := t.TempDir() + "/machine-id"
+	if e := ioutil.WriteFile(name, []byte("0123456789abcdef0123456789abcdef\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	machineIdFiles = []string{t.TempDir() + "/missing", name}
+	if id, e := _MachineId(); e != nil || id != "0123456789abcdef0123456789abcdef" {
+		t.Error("#1 Failed:", id, e)
+	}
+
+	machineIdFiles = []string{t.TempDir() + "/missing"}
+	if _, e := _MachineId(); e == nil {
+		t.Error("#2 Failed")
+	}
+}
@@ -0,0 +1,27 @@
+package dbus
+
+import (
+	"net"
+	"syscall"
+)
+
+// _PeerUID returns the uid of the process at the other end of conn, which
+// the kernel knows for unix sockets.
+func _PeerUID(conn net.Conn) (int, bool) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, false
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	var cred *syscall.Ucred
+	err = raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || cred == nil {
+		return 0, false
+	}
+	return int(cred.Uid), true
+}
@@ -0,0 +1,103 @@
+// Package polkit checks authorizations with the PolicyKit authority on the
+// system bus, so that system services can gate privileged methods on the
+// policy configured for an action:
+//
+//	authority, _ := polkit.NewAuthority(conn)
+//	ok, err := authority.IsAuthorized(sender, "org.example.service.reboot")
+package polkit
+
+import (
+	"errors"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION = "org.freedesktop.PolicyKit1"
+	PATH        = "/org/freedesktop/PolicyKit1/Authority"
+	INTERFACE   = "org.freedesktop.PolicyKit1.Authority"
+)
+
+var ErrNoAuthority = errors.New("NoPolicyKitAuthority")
+
+// CheckFlags are the flags of CheckAuthorization.
+type CheckFlags uint32
+
+const (
+	// CHECK_ALLOW_USER_INTERACTION lets the authority ask the user to
+	// authenticate if the action requires it. The call then only returns
+	// once the user answered.
+	CHECK_ALLOW_USER_INTERACTION CheckFlags = 0x1
+)
+
+// Result is the outcome of an authorization check.
+type Result struct {
+	IsAuthorized bool
+	// IsChallenge is set if the subject could be authorized after
+	// authenticating, when interaction was not allowed.
+	IsChallenge bool
+	Details     map[string]string
+}
+
+// Authority is the PolicyKit authority.
+type Authority struct {
+	conn  *dbus.Connection
+	iface *dbus.Interface
+}
+
+// NewAuthority returns the authority reached through conn, which must be an
+// initialized connection to the system bus.
+func NewAuthority(conn *dbus.Connection) (*Authority, error) {
+	obj := conn.GetObject(DESTINATION, PATH)
+	iface := conn.Interface(obj, INTERFACE)
+	if iface == nil {
+		return nil, ErrNoAuthority
+	}
+	return &Authority{conn, iface}, nil
+}
+
+// SystemBusNameSubject returns the subject struct identifying the process
+// owning the bus name sender, usually the sender of a method call.
+func SystemBusNameSubject(sender string) []interface{} {
+	return []interface{}{
+		"system-bus-name",
+		[]interface{}{[]interface{}{"name", sender}},
+	}
+}
+
+// CheckAuthorization checks whether the connection named sender may perform
+// actionID.
+func (p *Authority) CheckAuthorization(sender, actionID string, details map[string]string, flags CheckFlags) (*Result, error) {
+	detailsDict := make([]interface{}, 0, len(details))
+	for k, v := range details {
+		detailsDict = append(detailsDict, []interface{}{k, v})
+	}
+
+	ret, err := p.conn.CallMethod(p.iface, "CheckAuthorization",
+		SystemBusNameSubject(sender), actionID, detailsDict, uint32(flags), "")
+	if err != nil {
+		return nil, err
+	}
+	return _NewResult(ret)
+}
+
+// _NewResult decodes the (bba{ss}) reply of CheckAuthorization.
+func _NewResult(ret []interface{}) (*Result, error) {
+	var fields []interface{}
+	if err := dbus.Store(ret, &fields); err != nil {
+		return nil, err
+	}
+	result := new(Result)
+	err := dbus.Store(fields, &result.IsAuthorized, &result.IsChallenge, &result.Details)
+	return result, err
+}
+
+// IsAuthorized checks whether the connection named sender may perform
+// actionID, asking the user to authenticate if needed.
+func (p *Authority) IsAuthorized(sender, actionID string) (bool, error) {
+	result, err := p.CheckAuthorization(sender, actionID, nil, CHECK_ALLOW_USER_INTERACTION)
+	if err != nil {
+		return false, err
+	}
+	return result.IsAuthorized, nil
+}
@@ -0,0 +1,34 @@
+package polkit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSystemBusNameSubject(t *testing.T) {
+	subject := SystemBusNameSubject(":1.42")
+	expected := []interface{}{
+		"system-bus-name",
+		[]interface{}{[]interface{}{"name", ":1.42"}},
+	}
+	if !reflect.DeepEqual(subject, expected) {
+		t.Error("#1 Failed:", subject)
+	}
+}
+
+func TestNewResult(t *testing.T) {
+	fields := []interface{}{true, false, []interface{}{[]interface{}{"polkit.retains_authorization_after_challenge", "1"}}}
+	result, e := _NewResult([]interface{}{fields})
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if !result.IsAuthorized || result.IsChallenge || result.Details["polkit.retains_authorization_after_challenge"] != "1" {
+		t.Error("#2 Failed:", result)
+	}
+}
+
+func TestNewResultMismatch(t *testing.T) {
+	if _, e := _NewResult([]interface{}{"unexpected"}); e == nil {
+		t.Error("#1 Failed")
+	}
+}
@@ -0,0 +1,207 @@
+// Package portal calls XDG desktop portals, through which sandboxed
+// applications open URIs, take screenshots and use other services of the
+// desktop.
+//
+// Portal methods return immediately with the path of a request object,
+// which later emits a Response signal with the results. Call subscribes to
+// that signal before calling, using a handle token so that the path is
+// known in advance, and waits for the response.
+package portal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION          = "org.freedesktop.portal.Desktop"
+	PATH                 = "/org/freedesktop/portal/desktop"
+	REQUEST_INTERFACE    = "org.freedesktop.portal.Request"
+	OPEN_URI_INTERFACE   = "org.freedesktop.portal.OpenURI"
+	SCREENSHOT_INTERFACE = "org.freedesktop.portal.Screenshot"
+)
+
+// Response codes.
+const (
+	RESPONSE_SUCCESS   = 0
+	RESPONSE_CANCELLED = 1
+	RESPONSE_OTHER     = 2
+)
+
+var (
+	ErrNoPortal  = errors.New("NoSuchPortal")
+	ErrCancelled = errors.New("PortalRequestCancelled")
+	ErrFailed    = errors.New("PortalRequestFailed")
+)
+
+// Response is the outcome of a portal request.
+type Response struct {
+	Code    uint32
+	Results map[string]interface{}
+}
+
+// Portal is the desktop portal service.
+type Portal struct {
+	conn *dbus.Connection
+
+	mutex sync.Mutex
+	obj   *dbus.Object
+}
+
+var tokenCounter uint32
+
+// New returns the portal service reached through conn, which must be an
+// initialized connection to the session bus.
+func New(conn *dbus.Connection) *Portal {
+	return &Portal{conn: conn}
+}
+
+// _NewToken returns a handle token, unique within the process.
+func _NewToken() string {
+	return fmt.Sprintf("go_dbus_%d", atomic.AddUint32(&tokenCounter, 1))
+}
+
+// _RequestPath returns the path of the request object the portal creates
+// for the caller with the unique name sender and token.
+func _RequestPath(sender, token string) string {
+	sender = strings.Replace(strings.TrimPrefix(sender, ":"), ".", "_", -1)
+	return PATH + "/request/" + sender + "/" + token
+}
+
+func (p *Portal) _Interface(name string) (*dbus.Interface, error) {
+	p.mutex.Lock()
+	if p.obj == nil {
+		p.obj = p.conn.GetObject(DESTINATION, PATH)
+	}
+	obj := p.obj
+	p.mutex.Unlock()
+
+	iface := p.conn.Interface(obj, name)
+	if iface == nil {
+		return nil, ErrNoPortal
+	}
+	return iface, nil
+}
+
+func (p *Portal) _WatchResponse(path string, ch chan *Response) (*dbus.SignalHandler, error) {
+	mr := &dbus.MatchRule{
+		Type:      "signal",
+		Sender:    DESTINATION,
+		Interface: REQUEST_INTERFACE,
+		Member:    "Response",
+		Path:      path,
+	}
+	return p.conn.AddSignalHandler(mr, func(msg *dbus.Message) {
+		response := new(Response)
+		if dbus.Store(msg.Params, &response.Code, &response.Results) != nil {
+			response.Code = RESPONSE_OTHER
+		}
+		select {
+		case ch <- response:
+		default:
+		}
+	})
+}
+
+// Call calls method of the portal interface iface with args followed by
+// options, and waits for the response. The handle token is added to
+// options. If ctx is done first, the request is closed and ctx.Err is
+// returned; if the connection fails first, its error is.
+func (p *Portal) Call(ctx context.Context, iface, method string, options map[string]interface{}, args ...interface{}) (*Response, error) {
+	i, err := p._Interface(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	token := _NewToken()
+	path := _RequestPath(p.conn.UniqueName(), token)
+	ch := make(chan *Response, 1)
+	handler, err := p._WatchResponse(path, ch)
+	if err != nil {
+		return nil, err
+	}
+	defer p.conn.RemoveSignalHandler(handler)
+
+	dict := []interface{}{[]interface{}{"handle_token", token}}
+	for k, v := range options {
+		dict = append(dict, []interface{}{k, v})
+	}
+	ret, err := p.conn.CallMethodWithContext(ctx, i, method, append(args, dict)...)
+	if err != nil {
+		return nil, err
+	}
+	var handle string
+	if err = dbus.Store(ret, &handle); err != nil {
+		return nil, err
+	}
+	if handle != path {
+		// Portals predating handle tokens choose the path themselves; a
+		// response sent before this point is lost.
+		if handler, err = p._WatchResponse(handle, ch); err != nil {
+			return nil, err
+		}
+		defer p.conn.RemoveSignalHandler(handler)
+	}
+	return p._Wait(ctx, ch, handle)
+}
+
+// _Wait waits for the response of the request at path.
+func (p *Portal) _Wait(ctx context.Context, ch <-chan *Response, path string) (*Response, error) {
+	select {
+	case response := <-ch:
+		return response, nil
+	case <-ctx.Done():
+		// Dismiss the dialog the portal may be showing.
+		p.conn.CallWithFlags(dbus.NO_REPLY_EXPECTED, DESTINATION, path, REQUEST_INTERFACE, "Close", "")
+		return nil, ctx.Err()
+	case <-p.conn.Done():
+		// A response to a request of the broken connection is never
+		// delivered, even once it is re-established.
+		if err := p.conn.Err(); err != nil {
+			return nil, err
+		}
+		return nil, dbus.ErrDisconnected
+	}
+}
+
+// _Err returns the error of a response which was not successful.
+func (p *Response) _Err() error {
+	switch p.Code {
+	case RESPONSE_SUCCESS:
+		return nil
+	case RESPONSE_CANCELLED:
+		return ErrCancelled
+	}
+	return ErrFailed
+}
+
+// OpenURI asks the desktop to open uri with the handler the user chooses.
+// parentWindow identifies the application window, it may be empty.
+func (p *Portal) OpenURI(ctx context.Context, parentWindow, uri string) error {
+	response, err := p.Call(ctx, OPEN_URI_INTERFACE, "OpenURI", nil, parentWindow, uri)
+	if err != nil {
+		return err
+	}
+	return response._Err()
+}
+
+// Screenshot takes a screenshot and returns the URI of the image. If
+// interactive is set, the user may choose what to capture.
+func (p *Portal) Screenshot(ctx context.Context, parentWindow string, interactive bool) (string, error) {
+	options := map[string]interface{}{"interactive": interactive}
+	response, err := p.Call(ctx, SCREENSHOT_INTERFACE, "Screenshot", options, parentWindow)
+	if err != nil {
+		return "", err
+	}
+	if err = response._Err(); err != nil {
+		return "", err
+	}
+	uri, _ := response.Results["uri"].(string)
+	return uri, nil
+}
@@ -0,0 +1,107 @@
+package portal
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/norisatir/go-dbus"
+)
+
+func TestRequestPath(t *testing.T) {
+	path := _RequestPath(":1.42", "go_dbus_1")
+	if path != "/org/freedesktop/portal/desktop/request/1_42/go_dbus_1" {
+		t.Error("#1 Failed:", path)
+	}
+}
+
+func TestNewToken(t *testing.T) {
+	if a, b := _NewToken(), _NewToken(); a == b {
+		t.Error("#1 Failed:", a, b)
+	}
+}
+
+func TestResponseErr(t *testing.T) {
+	if e := (&Response{Code: RESPONSE_SUCCESS})._Err(); e != nil {
+		t.Error("#1 Failed:", e)
+	}
+	if e := (&Response{Code: RESPONSE_CANCELLED})._Err(); e != ErrCancelled {
+		t.Error("#2 Failed:", e)
+	}
+	if e := (&Response{Code: RESPONSE_OTHER})._Err(); e != ErrFailed {
+		t.Error("#3 Failed:", e)
+	}
+}
+
+type testRequest chan bool
+
+func (p testRequest) Close() { p <- true }
+
+// newTestPeers returns a client connected to a peer which exports a
+// request at path.
+func newTestPeers(t *testing.T, path string) (*dbus.Connection, testRequest) {
+	l, e := net.Listen("unix", filepath.Join(t.TempDir(), "peer"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+	conn, e := net.Dial("unix", l.Addr().String())
+	if e != nil {
+		t.Fatal(e)
+	}
+	client := dbus.ConnectPeer(conn)
+	server := dbus.AcceptPeer(<-accepted)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.Initialize() }()
+	if e := client.Initialize(); e != nil {
+		t.Fatal("client:", e)
+	}
+	if e := <-errs; e != nil {
+		t.Fatal("server:", e)
+	}
+	request := make(testRequest, 1)
+	if e := server.Export(request, path, REQUEST_INTERFACE); e != nil {
+		t.Fatal(e)
+	}
+	return client, request
+}
+
+func TestWait(t *testing.T) {
+	path := "/org/freedesktop/portal/desktop/request/1_2/t"
+	conn, request := newTestPeers(t, path)
+	portal := New(conn)
+	ch := make(chan *Response, 1)
+
+	ch <- &Response{Code: RESPONSE_SUCCESS}
+	if response, e := portal._Wait(context.Background(), ch, path); e != nil || response.Code != RESPONSE_SUCCESS {
+		t.Error("#1 Failed:", response, e)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, e := portal._Wait(ctx, ch, path); e != context.DeadlineExceeded {
+		t.Error("#2 Failed:", e)
+	}
+	select {
+	case <-request:
+	case <-time.After(time.Second):
+		t.Error("#3 Failed: request not closed")
+	}
+
+	conn.Close()
+	if _, e := portal._Wait(context.Background(), ch, path); e != dbus.ErrClosed {
+		t.Error("#4 Failed:", e)
+	}
+}
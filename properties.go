@@ -0,0 +1,86 @@
+package dbus
+
+const PROPERTIES_INTERFACE = "org.freedesktop.DBus.Properties"
+
+// GetProperty returns the value of the property name of iface, read through
+// the org.freedesktop.DBus.Properties interface of its object. Variants in
+// the value are replaced by their values.
+func (p *Connection) GetProperty(iface *Interface, name string) (interface{}, error) {
+	ret, err := p._CallProperties(iface, "Get", "ss", iface.name, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) != 1 {
+		return nil, ErrUnexpectedReply
+	}
+	return _Unwrap(ret[0]), nil
+}
+
+// SetProperty sets the property name of iface to value. The signature of
+// the value is inferred from its Go type.
+func (p *Connection) SetProperty(iface *Interface, name string, value interface{}) error {
+	if _, err := _InferSignature([]interface{}{value}); err != nil {
+		return err
+	}
+	_, err := p._CallProperties(iface, "Set", "ssv", iface.name, name, value)
+	return err
+}
+
+// GetAllProperties returns the values of all properties of iface by name.
+func (p *Connection) GetAllProperties(iface *Interface) (map[string]interface{}, error) {
+	ret, err := p._CallProperties(iface, "GetAll", "s", iface.name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) != 1 {
+		return nil, ErrUnexpectedReply
+	}
+	var props map[string]interface{}
+	if err = Store(ret, &props); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+// _CallProperties calls a method of the Properties interface of the object
+// of iface. It does not need the object to list the interface when
+// introspected.
+func (p *Connection) _CallProperties(iface *Interface, member, sig string, args ...interface{}) ([]interface{}, error) {
+	return p.CallWithSignature(iface.obj.dest, iface.obj.path, PROPERTIES_INTERFACE, member, sig, args...)
+}
+
+// PropertiesChanged is a decoded PropertiesChanged signal.
+type PropertiesChanged struct {
+	// Path is the object whose properties changed.
+	Path string
+	// Interface is the interface the properties belong to.
+	Interface string
+	// Changed holds the new values of the properties by name.
+	Changed map[string]interface{}
+	// Invalidated lists the properties which changed without their new
+	// values being sent.
+	Invalidated []string
+}
+
+// WatchProperties calls proc with each change to the properties of iface,
+// as announced by the PropertiesChanged signal of its object, sent by the
+// current owner of the destination of the object. Signals whose body does
+// not decode are ignored. The handler can be passed to RemoveSignalHandler
+// to stop watching.
+func (p *Connection) WatchProperties(iface *Interface, proc func(*PropertiesChanged)) (*SignalHandler, error) {
+	mr := &MatchRule{
+		Type:      "signal",
+		Sender:    iface.obj.dest,
+		Interface: PROPERTIES_INTERFACE,
+		Member:    "PropertiesChanged",
+		Path:      iface.obj.path,
+		Args:      map[int]string{0: iface.name},
+	}
+	return p.AddSignalHandler(mr, func(msg *Message) {
+		change := &PropertiesChanged{Path: msg.Path}
+		if Store(msg.Params, &change.Interface, &change.Changed, &change.Invalidated) != nil {
+			return
+		}
+		proc(change)
+	})
+}
@@ -0,0 +1,143 @@
+package dbus
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProperties(t *testing.T) {
+	props := map[string]interface{}{"Name": "thing", "Count": int32(3)}
+	con, _ := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Iface != PROPERTIES_INTERFACE || msg.Path != "/thing" || msg.Params[0] != "org.example.Thing" {
+			return
+		}
+		switch msg.Member {
+		case "Get":
+			bus.Reply(msg, "v", props[msg.Params[1].(string)])
+		case "Set":
+			props[msg.Params[1].(string)] = msg.Params[2]
+			bus.Reply(msg, "")
+		case "GetAll":
+			entries := []interface{}{}
+			for k, v := range props {
+				entries = append(entries, []interface{}{k, v})
+			}
+			bus.Reply(msg, "a{sv}", entries)
+		}
+	})
+	iface := &Interface{&Object{dest: "org.example", path: "/thing"}, "org.example.Thing", nil}
+
+	if v, e := con.GetProperty(iface, "Name"); e != nil || v != "thing" {
+		t.Error("#1 Failed:", v, e)
+	}
+	if e := con.SetProperty(iface, "Count", int32(4)); e != nil {
+		t.Error("#2 Failed:", e)
+	}
+	if v, e := con.GetProperty(iface, "Count"); e != nil || v != int32(4) {
+		t.Error("#3 Failed:", v, e)
+	}
+	all, e := con.GetAllProperties(iface)
+	if e != nil || len(all) != 2 || all["Name"] != "thing" || all["Count"] != int32(4) {
+		t.Error("#4 Failed:", all, e)
+	}
+	if e := con.SetProperty(iface, "Count", 4); e == nil {
+		t.Error("#5 Failed")
+	}
+}
+
+func TestWatchProperties(t *testing.T) {
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		switch msg.Member {
+		case "AddMatch":
+			bus.Reply(msg, "")
+		case "GetNameOwner":
+			bus.Reply(msg, "s", ":1.5")
+		}
+	})
+	iface := &Interface{&Object{dest: "org.example", path: "/thing"}, "org.example.Thing", nil}
+	changes := make(chan *PropertiesChanged, 4)
+	if _, e := con.WatchProperties(iface, func(change *PropertiesChanged) { changes <- change }); e != nil {
+		t.Fatal(e)
+	}
+
+	bus.EmitFrom(":1.5", "/thing", PROPERTIES_INTERFACE, "PropertiesChanged", "sa{sv}as", "org.example.Other",
+		[]interface{}{[]interface{}{"Count", int32(1)}}, []interface{}{})
+	bus.EmitFrom(":1.5", "/other", PROPERTIES_INTERFACE, "PropertiesChanged", "sa{sv}as", "org.example.Thing",
+		[]interface{}{[]interface{}{"Count", int32(2)}}, []interface{}{})
+	bus.EmitFrom(":1.5", "/thing", PROPERTIES_INTERFACE, "PropertiesChanged", "s", "org.example.Thing")
+	bus.EmitFrom(":1.5", "/thing", PROPERTIES_INTERFACE, "PropertiesChanged", "sa{sv}as", "org.example.Thing",
+		[]interface{}{[]interface{}{"Count", int32(3)}}, []interface{}{"Name"})
+
+	select {
+	case change := <-changes:
+		if change.Path != "/thing" || change.Interface != "org.example.Thing" ||
+			len(change.Changed) != 1 || change.Changed["Count"] != int32(3) ||
+			len(change.Invalidated) != 1 || change.Invalidated[0] != "Name" {
+			t.Error("#1 Failed:", change)
+		}
+	case <-time.After(time.Second):
+		t.Error("#1 Failed: no change")
+	}
+	select {
+	case change := <-changes:
+		t.Error("#2 Failed:", change)
+	default:
+	}
+}
+
+func TestWatchPropertiesSender(t *testing.T) {
+	rules := make(chan string, 2)
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		switch msg.Member {
+		case "AddMatch":
+			rules <- msg.Params[0].(string)
+			bus.Reply(msg, "")
+		case "GetNameOwner":
+			if msg.Params[0] == "org.example.Service" {
+				bus.Reply(msg, "s", ":1.5")
+			}
+		}
+	})
+	iface := &Interface{&Object{dest: "org.example.Service", path: "/thing"}, "org.example.Thing", nil}
+	changes := make(chan *PropertiesChanged, 4)
+	if _, e := con.WatchProperties(iface, func(change *PropertiesChanged) { changes <- change }); e != nil {
+		t.Fatal(e)
+	}
+	if rule := <-rules; !strings.Contains(rule, "sender='org.example.Service'") {
+		t.Error("#1 Failed:", rule)
+	}
+	if rule := <-rules; !strings.Contains(rule, "member='NameOwnerChanged'") || !strings.Contains(rule, "arg0='org.example.Service'") {
+		t.Error("#2 Failed:", rule)
+	}
+
+	emit := func(sender string, count int32) {
+		bus.EmitFrom(sender, "/thing", PROPERTIES_INTERFACE, "PropertiesChanged", "sa{sv}as",
+			"org.example.Thing", []interface{}{[]interface{}{"Count", count}}, []interface{}{})
+	}
+	next := func() int32 {
+		select {
+		case change := <-changes:
+			return change.Changed["Count"].(int32)
+		case <-time.After(time.Second):
+			return -1
+		}
+	}
+	emit(":1.66", 1)
+	emit(":1.5", 2)
+	if count := next(); count != 2 {
+		t.Error("#3 Failed:", count)
+	}
+
+	// Only the bus can hand the name over.
+	bus.EmitFrom(":1.66", "/org/freedesktop/DBus", "org.freedesktop.DBus", "NameOwnerChanged", "sss",
+		"org.example.Service", ":1.5", ":1.66")
+	emit(":1.66", 3)
+	bus.Emit("/org/freedesktop/DBus", "org.freedesktop.DBus", "NameOwnerChanged", "sss",
+		"org.example.Service", ":1.5", ":1.7")
+	emit(":1.5", 4)
+	emit(":1.7", 5)
+	if count := next(); count != 5 {
+		t.Error("#4 Failed:", count)
+	}
+}
@@ -0,0 +1,225 @@
+package dbus
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrDisconnected is returned by calls which were pending when the
+// connection to the bus broke, if it was re-established meanwhile.
+var ErrDisconnected = errors.New("Disconnected")
+
+const DEFAULT_RECONNECT_DELAY = time.Second
+
+// _Reconnect dials the bus again after the connection broke with cause,
+// until it succeeds or the connection is closed.
+func (p *Connection) _Reconnect(cause error) {
+	// The socket and buffers of the broken connection are only replaced
+	// once nothing uses them anymore.
+	p.workers.Wait()
+	p.namesMutex.Lock()
+	p.names = make(map[string]bool)
+	p.namesMutex.Unlock()
+
+	delay := p.ReconnectDelay
+	if delay <= 0 {
+		delay = DEFAULT_RECONNECT_DELAY
+	}
+	for !p._IsShutdown() {
+		if p._Redial() == nil {
+			if p.Reconnected != nil {
+				p.Reconnected(cause)
+			}
+			return
+		}
+		time.Sleep(delay)
+	}
+}
+
+func (p *Connection) _IsShutdown() bool {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	return p.shutdown
+}
+
+// _Redial connects and registers to the bus again, and restarts the
+// workers. Calls are rejected until it is done, as the bus disconnects
+// clients which send anything before Hello.
+func (p *Connection) _Redial() error {
+	conn, addressMap, err := _Dial(p.dial, p.address)
+	if err != nil {
+		p._Logf("reconnecting failed: %v", err)
+		return err
+	}
+	unixFDs, err := p._Auth(conn)
+	if err != nil {
+		p._Logf("authentication failed: %v", err)
+		conn.Close()
+		return err
+	}
+
+	p.stateMutex.Lock()
+	if p.shutdown {
+		p.stateMutex.Unlock()
+		conn.Close()
+		return ErrClosed
+	}
+	p.conn = conn
+	p.addressMap = addressMap
+	p.unixFDs = unixFDs
+	p.stateMutex.Unlock()
+	p._InitReader()
+
+	received, err := p._Register()
+	if err != nil {
+		p._Logf("reconnecting failed: %v", err)
+		conn.Close()
+		return err
+	}
+	// Services may have restarted along with the bus.
+	p.introsMutex.Lock()
+	p.intros = nil
+	p.introsMutex.Unlock()
+
+	p.stateMutex.Lock()
+	if p.shutdown {
+		p.stateMutex.Unlock()
+		conn.Close()
+		return ErrClosed
+	}
+	p.closed = make(chan struct{})
+	p.closeErr = nil
+	p._ChangeState(STATE_CONNECTED, nil)
+	closed := p.closed
+	p.stateMutex.Unlock()
+
+	p._Go(p._MessageWriter)
+	p._Go(p._RunLoop)
+	for _, msg := range received {
+		if !p._Filter(msg) {
+			continue
+		}
+		select {
+		case p.msgChan <- msg:
+		case <-closed:
+			return nil
+		}
+	}
+	return nil
+}
+
+// _Register says Hello on a new connection to the bus, adds the match rules
+// of the signal handlers, requests the names the connection held and asks
+// for the owners of well-known senders again. The messages are written and
+// their replies read directly, before the workers start. Other messages
+// received meanwhile are returned for dispatch.
+func (p *Connection) _Register() ([]*Message, error) {
+	if timeout := p._CallTimeout(0); timeout > 0 {
+		p.conn.SetDeadline(time.Now().Add(timeout))
+		defer p.conn.SetDeadline(time.Time{})
+	}
+
+	hello, _ := p._NewMethodCall(p.proxy, "Hello")
+	replies, received, err := p._CallDirect([]*Message{hello})
+	if err != nil {
+		return nil, err
+	}
+	if replies[0].Type == ERROR {
+		return nil, _ReplyError(replies[0])
+	}
+	var name string
+	if err = Store(replies[0].Params, &name); err != nil {
+		return nil, err
+	}
+
+	calls := make([]*Message, 0)
+	p.namesMutex.Lock()
+	p.uniqName = name
+	for name, flags := range p.requested {
+		msg, _ := p._NewMethodCall(p.proxy, "RequestName", name, uint32(flags))
+		calls = append(calls, msg)
+	}
+	p.namesMutex.Unlock()
+	p.handlersMutex.Lock()
+	for _, handler := range p.signalHandlers.All() {
+		msg, _ := p._NewMethodCall(p.proxy, "AddMatch", handler.mr._ToString())
+		calls = append(calls, msg)
+	}
+	p.handlersMutex.Unlock()
+
+	// Names come back with NameAcquired signals. As on Initialize, a rule
+	// the bus refuses fails the connection, which is then retried.
+	replies, more, err := p._CallDirect(calls)
+	if err != nil {
+		return nil, err
+	}
+	for _, reply := range replies {
+		if reply.Type == ERROR {
+			return nil, _ReplyError(reply)
+		}
+	}
+	received = append(received, more...)
+
+	// The owners of well-known senders are asked for once their
+	// NameOwnerChanged rules are back, and the signals received meanwhile
+	// are dispatched after the replies.
+	p.ownersMutex.Lock()
+	owners := make([]*nameOwner, 0, len(p.owners))
+	calls = calls[:0]
+	for name, owner := range p.owners {
+		msg, _ := p._NewMethodCall(p.proxy, "GetNameOwner", name)
+		owners = append(owners, owner)
+		calls = append(calls, msg)
+	}
+	p.ownersMutex.Unlock()
+	replies, more, err = p._CallDirect(calls)
+	if err != nil {
+		return nil, err
+	}
+	p.ownersMutex.Lock()
+	for i, reply := range replies {
+		var ret []interface{}
+		var err error
+		if reply.Type == ERROR {
+			err = _ReplyError(reply)
+		} else {
+			ret = reply.Params
+		}
+		if owners[i].owner, err = _NameOwner(ret, err); err != nil {
+			p.ownersMutex.Unlock()
+			return nil, err
+		}
+	}
+	p.ownersMutex.Unlock()
+	return append(received, more...), nil
+}
+
+// _CallDirect writes the method calls msgs to the socket, bypassing the
+// writer, and reads until all their replies arrived. The replies are
+// returned in the order of the calls, followed by the other messages read.
+func (p *Connection) _CallDirect(msgs []*Message) ([]*Message, []*Message, error) {
+	index := make(map[uint32]int)
+	for i, msg := range msgs {
+		msg.serial = p._NextSerial()
+		index[msg.serial] = i
+		if err := p._WriteMessage(msg); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	replies := make([]*Message, len(msgs))
+	received := make([]*Message, 0)
+	for len(index) > 0 {
+		msg, err := p._ReadMessage()
+		if err != nil {
+			return nil, nil, err
+		}
+		if i, ok := index[msg.replySerial]; ok && (msg.Type == METHOD_RETURN || msg.Type == ERROR) {
+			delete(index, msg.replySerial)
+			replies[i] = msg
+			continue
+		}
+		received = append(received, msg)
+	}
+	return replies, received, nil
+}
@@ -0,0 +1,202 @@
+package dbus
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestReconnecting returns an initialized Connection with Reconnect set,
+// talking to a testBus which is replaced each time the connection dials
+// again. The buses are sent to buses as they accept a connection.
+func newTestReconnecting(t *testing.T, handle func(*testBus, *Message)) (*Connection, chan *testBus) {
+	l, e := net.Listen("unix", filepath.Join(t.TempDir(), "bus"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	buses := make(chan *testBus, 4)
+	go func() {
+		for {
+			conn, e := l.Accept()
+			if e != nil {
+				return
+			}
+			bus := &testBus{conn: conn, reader: bufio.NewReader(conn), handle: handle}
+			buses <- bus
+			go bus._Run()
+		}
+	}()
+
+	address := "unix:path=" + l.Addr().String()
+	con := new(Connection)
+	if con.conn, con.addressMap, e = _Dial(net.Dial, address); e != nil {
+		t.Fatal(e)
+	}
+	con.dial = net.Dial
+	con.address = address
+	con.Reconnect = true
+	con.ReconnectDelay = 10 * time.Millisecond
+	t.Cleanup(func() {
+		con.Close()
+		l.Close()
+	})
+	return con, buses
+}
+
+func TestReconnect(t *testing.T) {
+	var mutex sync.Mutex
+	calls := make(map[*testBus][]string)
+	con, buses := newTestReconnecting(t, func(bus *testBus, msg *Message) {
+		mutex.Lock()
+		calls[bus] = append(calls[bus], msg.Member)
+		mutex.Unlock()
+		switch msg.Member {
+		case "AddMatch":
+			bus.Reply(msg, "")
+		case "RequestName":
+			bus.Reply(msg, "u", uint32(REQUEST_NAME_REPLY_PRIMARY_OWNER))
+			bus.Emit("/org/freedesktop/DBus", "org.freedesktop.DBus", "NameAcquired", "s", msg.Params[0])
+		case "ReleaseName":
+			bus.Reply(msg, "u", uint32(RELEASE_NAME_REPLY_RELEASED))
+		case "Ping":
+			bus.Reply(msg, "")
+		}
+	})
+	reconnected := make(chan error, 1)
+	con.Reconnected = func(err error) { reconnected <- err }
+	if e := con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+	first := <-buses
+
+	signals := make(chan string, 2)
+	if _, e := con.AddSignalHandler(NewMatchRule().WithMember("Changed"), func(msg *Message) { signals <- msg.Path }); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := con.RequestName("org.example.Service", NAME_FLAG_DO_NOT_QUEUE); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := con.RequestName("org.example.Taken", 0); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := con.ReleaseName("org.example.Taken"); e != nil {
+		t.Fatal(e)
+	}
+
+	first.conn.Close()
+	select {
+	case e := <-reconnected:
+		if e != io.EOF {
+			t.Error("#1 Failed:", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("#1 Failed: not reconnected")
+	}
+	if e := con.Err(); e != nil {
+		t.Error("#2 Failed:", e)
+	}
+	second := <-buses
+
+	mutex.Lock()
+	registered := calls[second]
+	mutex.Unlock()
+	if len(registered) != 2 || registered[0] != "RequestName" || registered[1] != "AddMatch" {
+		t.Error("#3 Failed:", registered)
+	}
+	if _, e := con.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", PEER_INTERFACE, "Ping"); e != nil {
+		t.Error("#4 Failed:", e)
+	}
+	second.Emit("/thing", "org.example.Thing", "Changed", "")
+	if path := <-signals; path != "/thing" {
+		t.Error("#5 Failed:", path)
+	}
+	for i := 0; !con.OwnsName("org.example.Service"); i++ {
+		if i == 100 {
+			t.Fatal("#6 Failed: name not acquired again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Closing stops reconnecting.
+	con.Close()
+	second.conn.Close()
+	select {
+	case <-buses:
+		t.Error("#7 Failed: reconnected after Close")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if e := con.Err(); e != ErrClosed {
+		t.Error("#8 Failed:", e)
+	}
+}
+
+func TestReconnectDisabled(t *testing.T) {
+	con, buses := newTestReconnecting(t, nil)
+	con.Reconnect = false
+	if e := con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+	(<-buses).conn.Close()
+	<-con.Done()
+	select {
+	case <-buses:
+		t.Error("#1 Failed: reconnected")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if e := con.Err(); e != io.EOF {
+		t.Error("#2 Failed:", e)
+	}
+}
+
+func TestStateChanged(t *testing.T) {
+	con, buses := newTestReconnecting(t, nil)
+	type change struct {
+		state ConnectionState
+		err   error
+	}
+	changes := make(chan change, 8)
+	con.StateChanged = func(state ConnectionState, err error) {
+		changes <- change{state, err}
+		if state == STATE_CONNECTED {
+			// The callback may use the connection.
+			con.State()
+		}
+	}
+	if state, e := con.State(); state != STATE_DISCONNECTED || e != nil {
+		t.Error("#1 Failed:", state, e)
+	}
+	if e := con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+	(<-buses).conn.Close()
+	second := <-buses
+	for i, expected := range []change{{STATE_CONNECTED, nil}, {STATE_RECONNECTING, io.EOF}, {STATE_CONNECTED, nil}} {
+		select {
+		case c := <-changes:
+			if c != expected {
+				t.Error("#2 Failed:", i, c.state, c.err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("#2 Failed:", i, "no change")
+		}
+	}
+	if state, e := con.State(); state != STATE_CONNECTED || e != nil {
+		t.Error("#3 Failed:", state, e)
+	}
+
+	con.Close()
+	second.conn.Close()
+	if c := <-changes; c.state != STATE_DISCONNECTED || c.err != ErrClosed {
+		t.Error("#4 Failed:", c.state, c.err)
+	}
+	if state, e := con.State(); state != STATE_DISCONNECTED || e != ErrClosed {
+		t.Error("#5 Failed:", state, e)
+	}
+	if s := STATE_RECONNECTING.String(); s != "Reconnecting" {
+		t.Error("#6 Failed:", s)
+	}
+}
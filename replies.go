@@ -0,0 +1,83 @@
+package dbus
+
+import (
+	"sync"
+)
+
+// replyShards is the number of independently locked parts of a replyTable.
+const replyShards = 32
+
+// replyTable holds the method calls waiting for a reply, keyed by serial. It
+// is split into shards with their own locks, so that concurrent callers and
+// the dispatcher rarely contend. The zero value is ready to use.
+type replyTable struct {
+	shards [replyShards]replyShard
+}
+
+type replyShard struct {
+	sync.Mutex
+	calls map[uint32]*methodCall
+}
+
+func (p *replyTable) _Shard(serial uint32) *replyShard {
+	return &p.shards[serial%replyShards]
+}
+
+// Add registers call as waiting for the reply to serial. It reports false
+// and leaves the table unchanged if another call already waits for it.
+func (p *replyTable) Add(serial uint32, call *methodCall) bool {
+	shard := p._Shard(serial)
+	shard.Lock()
+	defer shard.Unlock()
+	if shard.calls == nil {
+		shard.calls = make(map[uint32]*methodCall)
+	}
+	if _, ok := shard.calls[serial]; ok {
+		return false
+	}
+	shard.calls[serial] = call
+	return true
+}
+
+// Remove unregisters and returns the call waiting for the reply to serial.
+func (p *replyTable) Remove(serial uint32) (*methodCall, bool) {
+	shard := p._Shard(serial)
+	shard.Lock()
+	call, ok := shard.calls[serial]
+	delete(shard.calls, serial)
+	shard.Unlock()
+	return call, ok
+}
+
+// Contains reports whether a call waits for the reply to serial.
+func (p *replyTable) Contains(serial uint32) bool {
+	shard := p._Shard(serial)
+	shard.Lock()
+	_, ok := shard.calls[serial]
+	shard.Unlock()
+	return ok
+}
+
+// Range calls f for every pending call. f must not modify the table.
+func (p *replyTable) Range(f func(serial uint32, call *methodCall)) {
+	for i := range p.shards {
+		shard := &p.shards[i]
+		shard.Lock()
+		for serial, call := range shard.calls {
+			f(serial, call)
+		}
+		shard.Unlock()
+	}
+}
+
+// Len returns the number of pending calls.
+func (p *replyTable) Len() int {
+	n := 0
+	for i := range p.shards {
+		shard := &p.shards[i]
+		shard.Lock()
+		n += len(shard.calls)
+		shard.Unlock()
+	}
+	return n
+}
@@ -0,0 +1,51 @@
+package dbus
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReplyTable(t *testing.T) {
+	var table replyTable
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				table.Add(uint32(g*1000+i), &methodCall{})
+			}
+		}(g)
+	}
+	wg.Wait()
+	if table.Len() != 8000 {
+		t.Error("#1 Failed:", table.Len())
+	}
+
+	if _, ok := table.Remove(4242); !ok {
+		t.Error("#2 Failed")
+	}
+	if _, ok := table.Remove(4242); ok {
+		t.Error("#3 Failed")
+	}
+
+	n := 0
+	table.Range(func(uint32, *methodCall) { n++ })
+	if n != 7999 {
+		t.Error("#4 Failed:", n)
+	}
+}
+
+func BenchmarkReplyTableParallel(b *testing.B) {
+	var table replyTable
+	var serial uint32
+	b.RunParallel(func(pb *testing.PB) {
+		call := &methodCall{}
+		for pb.Next() {
+			s := atomic.AddUint32(&serial, 1)
+			table.Add(s, call)
+			table.Remove(s)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package dbus
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SdNotify sends state, like "READY=1" or "STATUS=...", to the service
+// manager through the socket in NOTIFY_SOCKET. It reports false without an
+// error if the process was not started with one, so services can call it
+// unconditionally.
+func SdNotify(state string) (bool, error) {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return false, nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the interval of the watchdog systemd enabled for
+// the process, from WATCHDOG_USEC and WATCHDOG_PID.
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+// NotifyReady tells the service manager that the service is ready, which
+// Type=notify services do once their names are acquired and their objects
+// exported, and starts the watchdog if one is enabled, see StartWatchdog.
+func (p *Connection) NotifyReady() error {
+	if _, err := SdNotify("READY=1"); err != nil {
+		return err
+	}
+	p.StartWatchdog()
+	return nil
+}
+
+// StartWatchdog pings the bus every half watchdog interval and sends
+// WATCHDOG=1 to the service manager after each successful ping, until the
+// connection closes. A connection which stops working thus makes systemd
+// restart the service. It reports false if no watchdog is enabled.
+func (p *Connection) StartWatchdog() bool {
+	interval, ok := WatchdogInterval()
+	if !ok {
+		return false
+	}
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if p._Ping() == nil {
+					SdNotify("WATCHDOG=1")
+				}
+			case <-p.Done():
+				return
+			}
+		}
+	}()
+	return true
+}
+
+// _Ping calls Ping on the bus, checking that messages still make the round
+// trip.
+func (p *Connection) _Ping() error {
+	msg := NewMessage()
+	msg.Type = METHOD_CALL
+	msg.Path = "/org/freedesktop/DBus"
+	msg.Dest = "org.freedesktop.DBus"
+	msg.Iface = PEER_INTERFACE
+	msg.Member = "Ping"
+	return p._SendSync(msg, func(*Message) {})
+}
@@ -0,0 +1,79 @@
+package dbus
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// _ListenNotify sets NOTIFY_SOCKET to a new socket and returns it.
+func _ListenNotify(t *testing.T) *net.UnixConn {
+	name := filepath.Join(t.TempDir(), "notify")
+	l, e := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: name, Net: "unixgram"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { l.Close() })
+	t.Setenv("NOTIFY_SOCKET", name)
+	return l
+}
+
+func _ReadNotify(t *testing.T, l *net.UnixConn) string {
+	buff := make([]byte, 256)
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	n, e := l.Read(buff)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return string(buff[:n])
+}
+
+func TestSdNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if ok, e := SdNotify("READY=1"); ok || e != nil {
+		t.Error("#1 Failed:", ok, e)
+	}
+
+	l := _ListenNotify(t)
+	if ok, e := SdNotify("READY=1"); !ok || e != nil {
+		t.Error("#2 Failed:", ok, e)
+	}
+	if state := _ReadNotify(t, l); state != "READY=1" {
+		t.Error("#3 Failed:", state)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	if _, ok := WatchdogInterval(); ok {
+		t.Error("#1 Failed")
+	}
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", "1")
+	if _, ok := WatchdogInterval(); ok {
+		t.Error("#2 Failed")
+	}
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if d, ok := WatchdogInterval(); !ok || d != 20*time.Millisecond {
+		t.Error("#3 Failed:", d, ok)
+	}
+
+	l := _ListenNotify(t)
+	con, _ := newTestConnection(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "Ping" {
+			bus.Reply(msg, "")
+		}
+	})
+	if e := con.NotifyReady(); e != nil {
+		t.Fatal("#4 Failed:", e)
+	}
+	if state := _ReadNotify(t, l); state != "READY=1" {
+		t.Error("#5 Failed:", state)
+	}
+	if state := _ReadNotify(t, l); state != "WATCHDOG=1" {
+		t.Error("#6 Failed:", state)
+	}
+}
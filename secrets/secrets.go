@@ -0,0 +1,228 @@
+// Package secrets is a client of the Secret Service, the password store
+// of desktop sessions provided by GNOME Keyring, KWallet and others.
+//
+// Secrets are transferred unencrypted within a "plain" session, which is
+// fine on the local session bus.
+package secrets
+
+import (
+	"errors"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION          = "org.freedesktop.secrets"
+	PATH                 = "/org/freedesktop/secrets"
+	SERVICE_INTERFACE    = "org.freedesktop.Secret.Service"
+	COLLECTION_INTERFACE = "org.freedesktop.Secret.Collection"
+	ITEM_INTERFACE       = "org.freedesktop.Secret.Item"
+
+	// NO_PROMPT is the prompt path returned when no prompt is needed.
+	NO_PROMPT = "/"
+)
+
+var (
+	ErrNoService    = errors.New("NoSecretService")
+	ErrNoObject     = errors.New("NoSuchSecretObject")
+	ErrNoCollection = errors.New("NoSuchCollection")
+)
+
+// Secret is the (oayays) secret struct. Parameters are empty for plain
+// sessions.
+type Secret struct {
+	Session     string
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// Service is the Secret Service, with an open session to transfer secrets.
+type Service struct {
+	conn    *dbus.Connection
+	iface   *dbus.Interface
+	session string
+}
+
+// NewService opens a session with the Secret Service reached through conn,
+// which must be an initialized connection to the session bus.
+func NewService(conn *dbus.Connection) (*Service, error) {
+	obj := conn.GetObject(DESTINATION, PATH)
+	iface := conn.Interface(obj, SERVICE_INTERFACE)
+	if iface == nil {
+		return nil, ErrNoService
+	}
+
+	ret, err := conn.CallMethod(iface, "OpenSession", "plain", "")
+	if err != nil {
+		return nil, err
+	}
+	var output interface{}
+	var session string
+	if err = dbus.Store(ret, &output, &session); err != nil {
+		return nil, err
+	}
+	return &Service{conn, iface, session}, nil
+}
+
+// Session returns the path of the session secrets are transferred in.
+func (p *Service) Session() string { return p.session }
+
+func (p *Service) _Interface(path, name string) (*dbus.Interface, error) {
+	obj := p.conn.GetObject(DESTINATION, path)
+	iface := p.conn.Interface(obj, name)
+	if iface == nil {
+		return nil, ErrNoObject
+	}
+	return iface, nil
+}
+
+// Collection returns the collection with the object path path.
+func (p *Service) Collection(path string) (*Collection, error) {
+	iface, err := p._Interface(path, COLLECTION_INTERFACE)
+	if err != nil {
+		return nil, err
+	}
+	return &Collection{p, path, iface}, nil
+}
+
+// DefaultCollection returns the collection new secrets are usually stored
+// in, normally the login keyring.
+func (p *Service) DefaultCollection() (*Collection, error) {
+	ret, err := p.conn.CallMethod(p.iface, "ReadAlias", "default")
+	if err != nil {
+		return nil, err
+	}
+	var path string
+	if err = dbus.Store(ret, &path); err != nil {
+		return nil, err
+	}
+	if path == NO_PROMPT {
+		return nil, ErrNoCollection
+	}
+	return p.Collection(path)
+}
+
+// Item returns the item with the object path path.
+func (p *Service) Item(path string) (*Item, error) {
+	iface, err := p._Interface(path, ITEM_INTERFACE)
+	if err != nil {
+		return nil, err
+	}
+	return &Item{p, path, iface}, nil
+}
+
+// SearchItems returns the paths of the items of all collections whose
+// attributes match attrs, separated into unlocked and locked ones.
+func (p *Service) SearchItems(attrs map[string]string) (unlocked, locked []string, err error) {
+	ret, err := p.conn.CallMethod(p.iface, "SearchItems", attrs)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = dbus.Store(ret, &unlocked, &locked)
+	return
+}
+
+// Unlock unlocks the given items or collections. Those which need the user
+// to authenticate are not in unlocked but are unlocked by the returned
+// prompt, which is NO_PROMPT if there are none.
+func (p *Service) Unlock(paths []string) (unlocked []string, prompt string, err error) {
+	ret, err := p.conn.CallMethod(p.iface, "Unlock", _Strings(paths))
+	if err != nil {
+		return nil, "", err
+	}
+	err = dbus.Store(ret, &unlocked, &prompt)
+	return
+}
+
+func _Strings(s []string) []interface{} {
+	ret := make([]interface{}, len(s))
+	for i, v := range s {
+		ret[i] = v
+	}
+	return ret
+}
+
+// _SecretStruct returns the secret struct transferring value in the
+// session of the service.
+func (p *Service) _SecretStruct(value []byte, contentType string) []interface{} {
+	return []interface{}{p.session, []byte{}, value, contentType}
+}
+
+// Collection is a set of items, such as a keyring.
+type Collection struct {
+	svc   *Service
+	path  string
+	iface *dbus.Interface
+}
+
+// Path returns the object path of the collection.
+func (p *Collection) Path() string { return p.path }
+
+// SearchItems returns the paths of the items of the collection whose
+// attributes match attrs.
+func (p *Collection) SearchItems(attrs map[string]string) ([]string, error) {
+	ret, err := p.svc.conn.CallMethod(p.iface, "SearchItems", attrs)
+	if err != nil {
+		return nil, err
+	}
+	var items []string
+	err = dbus.Store(ret, &items)
+	return items, err
+}
+
+// CreateItem stores secret in a new item labeled label, or in the item with
+// the same attributes if replace is set. If the collection is locked, the
+// item is only created once the returned prompt completed and item is
+// NO_PROMPT.
+func (p *Collection) CreateItem(label string, attrs map[string]string, secret []byte, contentType string, replace bool) (item, prompt string, err error) {
+	props := []interface{}{
+		[]interface{}{ITEM_INTERFACE + ".Label", label},
+		[]interface{}{ITEM_INTERFACE + ".Attributes", attrs},
+	}
+	ret, err := p.svc.conn.CallMethod(p.iface, "CreateItem",
+		props, p.svc._SecretStruct(secret, contentType), replace)
+	if err != nil {
+		return "", "", err
+	}
+	err = dbus.Store(ret, &item, &prompt)
+	return
+}
+
+// Item is a secret with its label and attributes.
+type Item struct {
+	svc   *Service
+	path  string
+	iface *dbus.Interface
+}
+
+// Path returns the object path of the item.
+func (p *Item) Path() string { return p.path }
+
+// GetSecret returns the secret of the item, which must be unlocked.
+func (p *Item) GetSecret() (*Secret, error) {
+	ret, err := p.svc.conn.CallMethod(p.iface, "GetSecret", p.svc.session)
+	if err != nil {
+		return nil, err
+	}
+	secret := new(Secret)
+	err = dbus.Store(ret, secret)
+	return secret, err
+}
+
+// SetSecret replaces the secret of the item.
+func (p *Item) SetSecret(value []byte, contentType string) error {
+	_, err := p.svc.conn.CallMethod(p.iface, "SetSecret", p.svc._SecretStruct(value, contentType))
+	return err
+}
+
+// Delete deletes the item, which is only done once the returned prompt
+// completed if it is not NO_PROMPT.
+func (p *Item) Delete() (prompt string, err error) {
+	ret, err := p.svc.conn.CallMethod(p.iface, "Delete")
+	if err != nil {
+		return "", err
+	}
+	err = dbus.Store(ret, &prompt)
+	return
+}
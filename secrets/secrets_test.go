@@ -0,0 +1,29 @@
+package secrets
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/norisatir/go-dbus"
+)
+
+func TestSecretStruct(t *testing.T) {
+	svc := &Service{session: "/org/freedesktop/secrets/session/1"}
+	secret := svc._SecretStruct([]byte("hunter2"), "text/plain")
+	expected := []interface{}{svc.session, []byte{}, []byte("hunter2"), "text/plain"}
+	if !reflect.DeepEqual(secret, expected) {
+		t.Error("#1 Failed:", secret)
+	}
+}
+
+func TestStoreSecret(t *testing.T) {
+	ret := []interface{}{[]interface{}{"/org/freedesktop/secrets/session/1", []byte{}, []byte("hunter2"), "text/plain"}}
+	secret := new(Secret)
+	if e := dbus.Store(ret, secret); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if !bytes.Equal(secret.Value, []byte("hunter2")) || secret.ContentType != "text/plain" {
+		t.Error("#2 Failed:", secret)
+	}
+}
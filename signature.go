@@ -0,0 +1,149 @@
+package dbus
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Limits of signatures set by the specification.
+const (
+	MAX_SIGNATURE_LENGTH = 255
+	MAX_ARRAY_NESTING    = 32
+	MAX_STRUCT_NESTING   = 32
+)
+
+// basicTypes are the type codes of the basic types, which can be the keys
+// of dict entries.
+const basicTypes = "ybnqiuxtdsogh"
+
+// Signature is a type signature, like "a{sv}". Values of the signature wire
+// type decode to Signature, and both Signature and string values marshal as
+// signatures, which fails for invalid signatures.
+type Signature string
+
+// SignatureError tells why a signature is invalid.
+type SignatureError struct {
+	Sig    string
+	Reason string
+}
+
+func (p *SignatureError) Error() string {
+	return "invalid signature " + strconv.Quote(p.Sig) + ": " + p.Reason
+}
+
+// ParseSignature checks that sig is a valid signature and splits it into
+// its complete types, like "a{sv}" and "s" for "a{sv}s".
+func ParseSignature(sig string) ([]Signature, error) {
+	types := make([]Signature, 0)
+	if e := _SplitSignature(sig, func(t string) { types = append(types, Signature(t)) }); e != nil {
+		return nil, e
+	}
+	return types, nil
+}
+
+// Validate checks that the signature is valid.
+func (p Signature) Validate() error {
+	// Not split, so that checking the signatures received allocates
+	// nothing.
+	return _SplitSignature(string(p), nil)
+}
+
+// _SplitSignature checks sig and passes its complete types to proc, unless
+// proc is nil.
+func _SplitSignature(sig string, proc func(t string)) error {
+	if len(sig) > MAX_SIGNATURE_LENGTH {
+		return &SignatureError{sig, "longer than " + strconv.Itoa(MAX_SIGNATURE_LENGTH) + " bytes"}
+	}
+	for i := 0; i < len(sig); {
+		end, e := _ParseType(sig, i, 0, 0)
+		if e != nil {
+			return e
+		}
+		if proc != nil {
+			proc(sig[i:end])
+		}
+		i = end
+	}
+	return nil
+}
+
+// _ParseType returns the end of the complete type starting at sig[index],
+// which is nested in the given number of arrays and structs.
+func _ParseType(sig string, index, arrays, structs int) (int, error) {
+	if index >= len(sig) {
+		return 0, &SignatureError{sig, "missing type"}
+	}
+	switch c := sig[index]; {
+	case strings.IndexByte(basicTypes, c) >= 0 || c == 'v':
+		return index + 1, nil
+
+	case c == 'a':
+		if arrays+1 > MAX_ARRAY_NESTING {
+			return 0, &SignatureError{sig, "arrays nested too deeply"}
+		}
+		if index+1 < len(sig) && sig[index+1] == '{' {
+			return _ParseDictEntry(sig, index+1, arrays+1, structs)
+		}
+		return _ParseType(sig, index+1, arrays+1, structs)
+
+	case c == '(':
+		if structs+1 > MAX_STRUCT_NESTING {
+			return 0, &SignatureError{sig, "structs nested too deeply"}
+		}
+		i := index + 1
+		if i < len(sig) && sig[i] == ')' {
+			return 0, &SignatureError{sig, "empty struct"}
+		}
+		for i < len(sig) && sig[i] != ')' {
+			end, e := _ParseType(sig, i, arrays, structs+1)
+			if e != nil {
+				return 0, e
+			}
+			i = end
+		}
+		if i >= len(sig) {
+			return 0, &SignatureError{sig, "unterminated struct"}
+		}
+		return i + 1, nil
+
+	case c == '{':
+		return 0, &SignatureError{sig, "dict entry outside of an array"}
+	}
+	return 0, &SignatureError{sig, "unknown type code " + strconv.QuoteRune(rune(sig[index]))}
+}
+
+// _ParseDictEntry returns the end of the dict entry starting at sig[index].
+// Dict entries count as structs for the nesting limit.
+func _ParseDictEntry(sig string, index, arrays, structs int) (int, error) {
+	if structs+1 > MAX_STRUCT_NESTING {
+		return 0, &SignatureError{sig, "structs nested too deeply"}
+	}
+	if index+1 >= len(sig) || strings.IndexByte(basicTypes, sig[index+1]) < 0 {
+		return 0, &SignatureError{sig, "dict entry key is not a basic type"}
+	}
+	end, e := _ParseType(sig, index+2, arrays, structs+1)
+	if e != nil {
+		return 0, e
+	}
+	if end >= len(sig) || sig[end] != '}' {
+		return 0, &SignatureError{sig, "dict entry does not have exactly two types"}
+	}
+	return end + 1, nil
+}
+
+// _GetSingleType returns the complete type starting at sig[index], including
+// the element type of arrays. A dict entry is accepted on its own, as it is
+// the element type of dict arrays.
+func _GetSingleType(sig string, index int) (string, error) {
+	var end int
+	var e error
+	if index < len(sig) && sig[index] == '{' {
+		end, e = _ParseDictEntry(sig, index, 0, 0)
+	} else {
+		end, e = _ParseType(sig, index, 0, 0)
+	}
+	if e != nil {
+		return "", e
+	}
+	return sig[index:end], nil
+}
@@ -0,0 +1,87 @@
+package dbus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseSignature(t *testing.T) {
+	types, e := ParseSignature("a{sv}s(ia(yy))aai")
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	expected := []Signature{"a{sv}", "s", "(ia(yy))", "aai"}
+	if len(types) != len(expected) {
+		t.Fatal("#2 Failed:", types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Error("#3 Failed:", i, types[i])
+		}
+	}
+
+	types, e = ParseSignature("")
+	if e != nil || len(types) != 0 {
+		t.Error("#4 Failed:", types, e)
+	}
+}
+
+func TestSignatureValidate(t *testing.T) {
+	valid := []Signature{
+		"", "y", "v", "ay", "a{sv}", "a{oa{sa{sv}}}", "(s(i))",
+		Signature(strings.Repeat("a", MAX_ARRAY_NESTING) + "y"),
+		Signature(strings.Repeat("(", MAX_STRUCT_NESTING) + "y" + strings.Repeat(")", MAX_STRUCT_NESTING)),
+	}
+	for i, sig := range valid {
+		if e := sig.Validate(); e != nil {
+			t.Error("#1 Failed:", i, e)
+		}
+	}
+
+	invalid := []Signature{
+		"a", "()", "(i", "i)", "{sv}", "a{vs}", "a{s}", "a{sss}", "z",
+		"a{(s)s}",
+		Signature(strings.Repeat("a", MAX_ARRAY_NESTING+1) + "y"),
+		Signature(strings.Repeat("(", MAX_STRUCT_NESTING+1) + "y" + strings.Repeat(")", MAX_STRUCT_NESTING+1)),
+		Signature(strings.Repeat("y", MAX_SIGNATURE_LENGTH+1)),
+	}
+	for i, sig := range invalid {
+		e := sig.Validate()
+		if e == nil {
+			t.Error("#2 Failed:", i, sig)
+		} else if _, ok := e.(*SignatureError); !ok {
+			t.Error("#3 Failed:", i, e)
+		}
+	}
+}
+
+func TestMarshalSignature(t *testing.T) {
+	buff := new(bytes.Buffer)
+	if e := _AppendParamsData(buff, "gg", []interface{}{Signature("a{sv}"), "i"}); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	slice, _, e := new(decoder)._Parse(buff.Bytes(), "gg", 0)
+	if e != nil {
+		t.Fatal("#2 Failed:", e)
+	}
+	if slice[0] != Signature("a{sv}") || slice[1] != Signature("i") {
+		t.Error("#3 Failed:", slice)
+	}
+
+	if e := _AppendParamsData(new(bytes.Buffer), "g", []interface{}{"a{"}); e == nil {
+		t.Error("#4 Failed")
+	}
+	if e := _AppendParamsData(new(bytes.Buffer), "g", []interface{}{int32(1)}); e == nil {
+		t.Error("#5 Failed")
+	}
+
+	msg := NewMessage()
+	msg.Type = METHOD_CALL
+	msg.Path = "/org/test"
+	msg.Member = "Test"
+	msg.Sig = "a{"
+	if _, e := msg._Marshal(); e == nil {
+		t.Error("#6 Failed")
+	}
+}
@@ -0,0 +1,80 @@
+package dbus
+
+import (
+	"strconv"
+)
+
+// ConnectionState tells whether a connection is usable, as reported to
+// StateChanged.
+type ConnectionState int
+
+const (
+	// STATE_DISCONNECTED means the connection was not initialized yet, or
+	// ended for good.
+	STATE_DISCONNECTED ConnectionState = iota
+	// STATE_CONNECTED means the connection is initialized and usable.
+	STATE_CONNECTED
+	// STATE_RECONNECTING means the connection broke and, as Reconnect is
+	// set, it is being re-established. Calls fail meanwhile.
+	STATE_RECONNECTING
+)
+
+var connectionStateNames = map[ConnectionState]string{
+	STATE_DISCONNECTED: "Disconnected",
+	STATE_CONNECTED:    "Connected",
+	STATE_RECONNECTING: "Reconnecting",
+}
+
+func (p ConnectionState) String() string {
+	if name, ok := connectionStateNames[p]; ok {
+		return name
+	}
+	return "ConnectionState(" + strconv.Itoa(int(p)) + ")"
+}
+
+type stateChange struct {
+	state ConnectionState
+	err   error
+}
+
+// State returns the state of the connection and the error which broke it,
+// if it is not connected.
+func (p *Connection) State() (ConnectionState, error) {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	return p.state, p.closeErr
+}
+
+// _ChangeState moves the connection to state, because of err, and queues
+// the change for StateChanged. It must be called with stateMutex held.
+// Changes are delivered in order by a goroutine of their own, so that the
+// callback may use the connection, even Close it.
+func (p *Connection) _ChangeState(state ConnectionState, err error) {
+	if state == p.state {
+		return
+	}
+	p.state = state
+	if p.StateChanged == nil {
+		return
+	}
+	p.stateChanges = append(p.stateChanges, stateChange{state, err})
+	if !p.notifying {
+		p.notifying = true
+		go p._NotifyStates()
+	}
+}
+
+func (p *Connection) _NotifyStates() {
+	for {
+		p.stateMutex.Lock()
+		if len(p.stateChanges) == 0 {
+			p.notifying = false
+			p.stateMutex.Unlock()
+			return
+		}
+		change := p.stateChanges[0]
+		p.stateChanges = p.stateChanges[1:]
+		p.stateMutex.Unlock()
+		p.StateChanged(change.state, change.err)
+	}
+}
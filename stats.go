@@ -0,0 +1,89 @@
+package dbus
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the traffic of a Connection since it was created,
+// meant for capacity planning. Counters keep running across reconnections.
+type Stats struct {
+	// MessagesSent and MessagesReceived count the messages written to
+	// and decoded from the socket, by type.
+	MessagesSent     map[MessageType]uint64
+	MessagesReceived map[MessageType]uint64
+	// BytesRead and BytesWritten count whole messages, including those
+	// dropped for ViolationPolicy.
+	BytesRead    uint64
+	BytesWritten uint64
+	PendingCalls int
+	// DroppedSignals counts the signals dropped because more than
+	// MaxQueuedSignals were waiting for the dispatcher.
+	DroppedSignals uint64
+	// Replies counts the method calls which got a reply, and
+	// AverageCallLatency is their mean wait for it. Calls which failed
+	// without a reply, like those which timed out, are left out.
+	Replies            uint64
+	AverageCallLatency time.Duration
+}
+
+type connStats struct {
+	sent         [SIGNAL + 1]uint64
+	received     [SIGNAL + 1]uint64
+	bytesRead    uint64
+	bytesWritten uint64
+	replies      uint64
+	latency      time.Duration
+	mutex        sync.Mutex // guards replies and latency
+}
+
+// Stats returns the message counters of the connection.
+func (p *Connection) Stats() Stats {
+	stats := Stats{
+		MessagesSent:     make(map[MessageType]uint64),
+		MessagesReceived: make(map[MessageType]uint64),
+	}
+	for typ := MessageType(METHOD_CALL); typ <= SIGNAL; typ++ {
+		stats.MessagesSent[typ] = atomic.LoadUint64(&p.stats.sent[typ])
+		stats.MessagesReceived[typ] = atomic.LoadUint64(&p.stats.received[typ])
+	}
+	stats.BytesRead = atomic.LoadUint64(&p.stats.bytesRead)
+	stats.BytesWritten = atomic.LoadUint64(&p.stats.bytesWritten)
+	stats.PendingCalls = p.methodCallReplies.Len()
+	stats.DroppedSignals = atomic.LoadUint64(&p.droppedSignals)
+
+	p.stats.mutex.Lock()
+	stats.Replies = p.stats.replies
+	if p.stats.replies > 0 {
+		stats.AverageCallLatency = p.stats.latency / time.Duration(p.stats.replies)
+	}
+	p.stats.mutex.Unlock()
+	return stats
+}
+
+// _CountSent records a message of type typ and length bytes written.
+func (p *connStats) _CountSent(typ byte, length int) {
+	if int(typ) < len(p.sent) {
+		atomic.AddUint64(&p.sent[typ], 1)
+	}
+	atomic.AddUint64(&p.bytesWritten, uint64(length))
+}
+
+// _CountReceived records a message of length bytes read, and of type typ
+// if it could be decoded.
+func (p *connStats) _CountReceived(typ MessageType, length int) {
+	if typ > INVALID && int(typ) < len(p.received) {
+		atomic.AddUint64(&p.received[typ], 1)
+	}
+	atomic.AddUint64(&p.bytesRead, uint64(length))
+}
+
+// _CountReply records the reply to call.
+func (p *connStats) _CountReply(call *methodCall) {
+	latency := time.Since(call.sent)
+	p.mutex.Lock()
+	p.replies++
+	p.latency += latency
+	p.mutex.Unlock()
+}
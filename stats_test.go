@@ -0,0 +1,61 @@
+package dbus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	con, bus := newTestConnection(t, func(bus *testBus, msg *Message) {
+		switch msg.Member {
+		case "AddMatch", "Ping":
+			bus.Reply(msg, "")
+		}
+	})
+	received := make(chan *Message, 1)
+	if _, e := con.AddSignalHandler(NewMatchRule().WithInterface("org.example.Thing"), func(msg *Message) { received <- msg }); e != nil {
+		t.Fatal(e)
+	}
+	before := con.Stats()
+
+	if _, e := con.Call("org.freedesktop.DBus", "/org/freedesktop/DBus", PEER_INTERFACE, "Ping"); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	bus.Emit("/thing", "org.example.Thing", "Changed", "")
+	<-received
+
+	stats := con.Stats()
+	if n := stats.MessagesSent[METHOD_CALL] - before.MessagesSent[METHOD_CALL]; n != 1 {
+		t.Error("#2 Failed:", n)
+	}
+	if n := stats.MessagesReceived[METHOD_RETURN] - before.MessagesReceived[METHOD_RETURN]; n != 1 {
+		t.Error("#3 Failed:", n)
+	}
+	if n := stats.MessagesReceived[SIGNAL] - before.MessagesReceived[SIGNAL]; n != 1 {
+		t.Error("#4 Failed:", n)
+	}
+	if stats.BytesWritten <= before.BytesWritten || stats.BytesRead <= before.BytesRead {
+		t.Error("#5 Failed:", stats.BytesWritten, stats.BytesRead)
+	}
+	if stats.Replies != before.Replies+1 || stats.AverageCallLatency <= 0 {
+		t.Error("#6 Failed:", stats.Replies, stats.AverageCallLatency)
+	}
+	if stats.PendingCalls != 0 {
+		t.Error("#7 Failed:", stats.PendingCalls)
+	}
+}
+
+func TestStatsLatency(t *testing.T) {
+	con := new(Connection)
+	for _, age := range []time.Duration{time.Second, 3 * time.Second} {
+		con.stats._CountReply(&methodCall{sent: time.Now().Add(-age)})
+	}
+	con.methodCallReplies.Add(1, &methodCall{})
+	stats := con.Stats()
+	if stats.Replies != 2 || stats.AverageCallLatency < 2*time.Second || stats.AverageCallLatency > 3*time.Second {
+		t.Error("#1 Failed:", stats.Replies, stats.AverageCallLatency)
+	}
+	if stats.PendingCalls != 1 {
+		t.Error("#2 Failed:", stats.PendingCalls)
+	}
+}
@@ -0,0 +1,257 @@
+package dbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+)
+
+var (
+	ErrStoreCount    = errors.New("StoreCountMismatch")
+	ErrStoreMismatch = errors.New("StoreTypeMismatch")
+	ErrStoreNotPtr   = errors.New("StoreNotPointer")
+)
+
+// Store copies decoded values from src into the values pointed to by dest.
+// Arrays are stored into slices, structs into slices or Go structs with the
+// same number of exported fields, not counting fields tagged `dbus:"-"`, and
+// arrays of dict entries into maps.
+// Numeric values are converted when the destination kind differs, a pointer
+// to an interface{} receives the value as is. Variants are replaced by their
+// values unless stored into a Variant, also inside values stored into an
+// interface{}.
+func Store(src []interface{}, dest ...interface{}) error {
+	if len(src) != len(dest) {
+		return ErrStoreCount
+	}
+	for i, d := range dest {
+		v := reflect.ValueOf(d)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			return ErrStoreNotPtr
+		}
+		if e := _StoreValue(v.Elem(), src[i]); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func _StoreValue(dest reflect.Value, src interface{}) error {
+	if variant, ok := src.(Variant); ok && dest.Type() != variantType {
+		return _StoreValue(dest, variant.Value)
+	}
+	if src == nil {
+		return ErrStoreMismatch
+	}
+	if dest.Kind() == reflect.Interface && dest.NumMethod() == 0 {
+		src = _Unwrap(src)
+	}
+	sv := reflect.ValueOf(src)
+
+	if sv.Type().AssignableTo(dest.Type()) {
+		dest.Set(sv)
+		return nil
+	}
+
+	switch dest.Kind() {
+	case reflect.Ptr:
+		if dest.IsNil() {
+			dest.Set(reflect.New(dest.Type().Elem()))
+		}
+		return _StoreValue(dest.Elem(), src)
+
+	case reflect.Slice:
+		if b, ok := src.([]byte); ok {
+			slice := make([]interface{}, len(b))
+			for i, v := range b {
+				slice[i] = v
+			}
+			src = slice
+		}
+		slice, ok := src.([]interface{})
+		if !ok {
+			return ErrStoreMismatch
+		}
+		ret := reflect.MakeSlice(dest.Type(), len(slice), len(slice))
+		for i, v := range slice {
+			if e := _StoreValue(ret.Index(i), v); e != nil {
+				return e
+			}
+		}
+		dest.Set(ret)
+		return nil
+
+	case reflect.Map:
+		slice, ok := src.([]interface{})
+		if !ok {
+			return ErrStoreMismatch
+		}
+		ret := reflect.MakeMap(dest.Type())
+		for _, v := range slice {
+			entry, ok := v.([]interface{})
+			if !ok || len(entry) != 2 {
+				return ErrStoreMismatch
+			}
+			key := reflect.New(dest.Type().Key()).Elem()
+			val := reflect.New(dest.Type().Elem()).Elem()
+			if e := _StoreValue(key, entry[0]); e != nil {
+				return e
+			}
+			if e := _StoreValue(val, entry[1]); e != nil {
+				return e
+			}
+			ret.SetMapIndex(key, val)
+		}
+		dest.Set(ret)
+		return nil
+
+	case reflect.Struct:
+		fields, ok := src.([]interface{})
+		if !ok {
+			return ErrStoreMismatch
+		}
+		indices := _StructFields(dest.Type())
+		if len(indices) != len(fields) {
+			return ErrStoreMismatch
+		}
+		for j, i := range indices {
+			if e := _StoreValue(dest.Field(i), fields[j]); e != nil {
+				return e
+			}
+		}
+		return nil
+	}
+
+	if _IsNumeric(sv.Kind()) && _IsNumeric(dest.Kind()) || sv.Kind() == dest.Kind() {
+		if sv.Type().ConvertibleTo(dest.Type()) {
+			dest.Set(sv.Convert(dest.Type()))
+			return nil
+		}
+	}
+	return ErrStoreMismatch
+}
+
+func _IsNumeric(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// Store copies the body of the message into the values pointed to by dest,
+// as the Store function does with the message Params. Bodies consisting only
+// of fixed size types are decoded straight from the received bytes when dest
+// holds pointers of the matching Go types, which does not allocate.
+func (p *Message) Store(dest ...interface{}) error {
+	if p.body != nil && _IsFixedSignature(p.Sig) {
+		if e := _StoreFixed(p.body, p.Order, p.Sig, dest); e != ErrStoreMismatch {
+			return e
+		}
+	}
+	return Store(p.Params, dest...)
+}
+
+// _IsFixedSignature reports whether sig consists only of fixed size basic
+// types.
+func _IsFixedSignature(sig string) bool {
+	for i := 0; i < len(sig); i++ {
+		if _FixedSize(sig[i]) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// _FixedSize returns the size of a fixed size basic type, or 0 for any
+// other type.
+func _FixedSize(t byte) int {
+	switch t {
+	case 'y':
+		return 1
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u':
+		return 4
+	case 'x', 't', 'd':
+		return 8
+	}
+	return 0
+}
+
+// _StoreFixed decodes body of the fixed size signature sig, in the byte
+// order order, into dest. It returns ErrStoreMismatch if dest does not hold
+// pointers to the exact Go types of the values.
+func _StoreFixed(body []byte, order binary.ByteOrder, sig string, dest []interface{}) error {
+	if len(sig) != len(dest) {
+		return ErrStoreCount
+	}
+
+	if order == nil {
+		order = binary.LittleEndian
+	}
+	idx := 0
+	for i := 0; i < len(sig); i++ {
+		size := _FixedSize(sig[i])
+		idx = _Align(size, idx)
+		if len(body) < idx+size {
+			return errors.New("index error")
+		}
+		b := body[idx : idx+size]
+
+		switch d := dest[i].(type) {
+		case *byte:
+			if sig[i] != 'y' {
+				return ErrStoreMismatch
+			}
+			*d = b[0]
+		case *bool:
+			if sig[i] != 'b' {
+				return ErrStoreMismatch
+			}
+			*d = order.Uint32(b) != 0
+		case *int16:
+			if sig[i] != 'n' {
+				return ErrStoreMismatch
+			}
+			*d = int16(order.Uint16(b))
+		case *uint16:
+			if sig[i] != 'q' {
+				return ErrStoreMismatch
+			}
+			*d = order.Uint16(b)
+		case *int32:
+			if sig[i] != 'i' {
+				return ErrStoreMismatch
+			}
+			*d = int32(order.Uint32(b))
+		case *uint32:
+			if sig[i] != 'u' {
+				return ErrStoreMismatch
+			}
+			*d = order.Uint32(b)
+		case *int64:
+			if sig[i] != 'x' {
+				return ErrStoreMismatch
+			}
+			*d = int64(order.Uint64(b))
+		case *uint64:
+			if sig[i] != 't' {
+				return ErrStoreMismatch
+			}
+			*d = order.Uint64(b)
+		case *float64:
+			if sig[i] != 'd' {
+				return ErrStoreMismatch
+			}
+			*d = math.Float64frombits(order.Uint64(b))
+		default:
+			return ErrStoreMismatch
+		}
+		idx += size
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package dbus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	var (
+		u  uint32
+		s  string
+		i  int
+		as []string
+		m  map[string]interface{}
+		st struct {
+			Name string
+			Id   uint32
+		}
+		v interface{}
+	)
+
+	src := []interface{}{
+		uint32(3),
+		"foo",
+		int32(-1),
+		[]interface{}{"a", "b"},
+		[]interface{}{[]interface{}{"k", byte(1)}},
+		[]interface{}{"bar", uint32(9)},
+		"any",
+	}
+	if e := Store(src, &u, &s, &i, &as, &m, &st, &v); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if u != 3 || s != "foo" || i != -1 {
+		t.Error("#2 Failed:", u, s, i)
+	}
+	if !reflect.DeepEqual(as, []string{"a", "b"}) {
+		t.Error("#3 Failed:", as)
+	}
+	if !reflect.DeepEqual(m, map[string]interface{}{"k": byte(1)}) {
+		t.Error("#4 Failed:", m)
+	}
+	if st.Name != "bar" || st.Id != 9 {
+		t.Error("#5 Failed:", st)
+	}
+	if v != "any" {
+		t.Error("#6 Failed:", v)
+	}
+
+	if e := Store([]interface{}{"foo"}, &u); e != ErrStoreMismatch {
+		t.Error("#7 Failed:", e)
+	}
+	if e := Store([]interface{}{"foo"}, s); e != ErrStoreNotPtr {
+		t.Error("#8 Failed:", e)
+	}
+	if e := Store([]interface{}{"foo"}, &s, &u); e != ErrStoreCount {
+		t.Error("#9 Failed:", e)
+	}
+}
+
+func TestMessageStoreFixed(t *testing.T) {
+	msg := NewMessage()
+	msg.Type = METHOD_RETURN
+	msg.Sig = "yyyu"
+	msg.Params = []interface{}{byte(7), byte(1), byte(0xfd), uint32(1 << 20)}
+	buff, _ := msg._Marshal()
+	recv, _, e := _Unmarshal(buff)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+
+	var (
+		y, b1, b2 byte
+		u         uint32
+	)
+	allocs := testing.AllocsPerRun(100, func() {
+		if e := recv.Store(&y, &b1, &b2, &u); e != nil {
+			t.Fatal("#2 Failed:", e)
+		}
+	})
+	if allocs != 0 {
+		t.Error("#3 Failed:", allocs)
+	}
+	if y != 7 || b1 != 1 || b2 != 0xfd || u != 1<<20 {
+		t.Error("#4 Failed:", y, b1, b2, u)
+	}
+
+	// Destinations of other types go through the generic path.
+	var i int
+	var v interface{}
+	if e := recv.Store(&i, &v, &b2, &u); e != nil || i != 7 || v != byte(1) {
+		t.Error("#5 Failed:", e, i, v)
+	}
+}
+
+func TestStoreFixed(t *testing.T) {
+	body := []byte("\x01\x00\xfd\xff\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\xf0\x3f")
+	var (
+		y byte
+		n int16
+		b bool
+		d float64
+	)
+	if e := _StoreFixed(body, nil, "ynbd", []interface{}{&y, &n, &b, &d}); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if y != 1 || n != -3 || !b || d != 1.0 {
+		t.Error("#2 Failed:", y, n, b, d)
+	}
+	if e := _StoreFixed(body, nil, "ynbd", []interface{}{&y, &y, &b, &d}); e != ErrStoreMismatch {
+		t.Error("#3 Failed:", e)
+	}
+	if e := _StoreFixed(body[:8], nil, "ynbd", []interface{}{&y, &n, &b, &d}); e == nil {
+		t.Error("#4 Failed")
+	}
+}
@@ -0,0 +1,238 @@
+// Package systemd1 provides typed bindings for the systemd manager on the
+// system bus: starting and stopping units, listing them, watching jobs and
+// reading unit properties.
+package systemd1
+
+import (
+	"errors"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION          = "org.freedesktop.systemd1"
+	PATH                 = "/org/freedesktop/systemd1"
+	MANAGER_INTERFACE    = "org.freedesktop.systemd1.Manager"
+	UNIT_INTERFACE       = "org.freedesktop.systemd1.Unit"
+	PROPERTIES_INTERFACE = "org.freedesktop.DBus.Properties"
+)
+
+var (
+	ErrNoManager = errors.New("NoSystemdManager")
+	ErrNoUnit    = errors.New("NoSuchUnit")
+	ErrNoReply   = errors.New("EmptyReply")
+)
+
+// Job modes, deciding how a new job interacts with queued ones.
+const (
+	MODE_REPLACE             = "replace"
+	MODE_FAIL                = "fail"
+	MODE_ISOLATE             = "isolate"
+	MODE_IGNORE_DEPENDENCIES = "ignore-dependencies"
+	MODE_IGNORE_REQUIREMENTS = "ignore-requirements"
+)
+
+// UnitStatus is an entry of ListUnits.
+type UnitStatus struct {
+	Name        string
+	Description string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	Followed    string
+	Path        string
+	JobID       uint32
+	JobType     string
+	JobPath     string
+}
+
+// JobResult is sent by the JobRemoved signal once a job finished. Result is
+// one of "done", "canceled", "timeout", "failed", "dependency" or "skipped".
+type JobResult struct {
+	ID     uint32
+	Job    string
+	Unit   string
+	Result string
+}
+
+// Manager is the systemd manager object.
+type Manager struct {
+	conn  *dbus.Connection
+	iface *dbus.Interface
+}
+
+// NewManager returns the manager reached through conn, which must be an
+// initialized connection to the system bus.
+func NewManager(conn *dbus.Connection) (*Manager, error) {
+	obj := conn.GetObject(DESTINATION, PATH)
+	iface := conn.Interface(obj, MANAGER_INTERFACE)
+	if iface == nil {
+		return nil, ErrNoManager
+	}
+	return &Manager{conn, iface}, nil
+}
+
+// _CallJob calls a method queueing a job for the unit name and returns the
+// path of the job.
+func (p *Manager) _CallJob(method, name, mode string) (string, error) {
+	ret, err := p.conn.CallMethod(p.iface, method, name, mode)
+	if err != nil {
+		return "", err
+	}
+	var job string
+	err = dbus.Store(ret, &job)
+	return job, err
+}
+
+// StartUnit queues a job starting the unit name and returns the path of the
+// job. The job's completion is announced by JobRemoved.
+func (p *Manager) StartUnit(name, mode string) (string, error) {
+	return p._CallJob("StartUnit", name, mode)
+}
+
+// StopUnit queues a job stopping the unit name.
+func (p *Manager) StopUnit(name, mode string) (string, error) {
+	return p._CallJob("StopUnit", name, mode)
+}
+
+// RestartUnit queues a job restarting the unit name.
+func (p *Manager) RestartUnit(name, mode string) (string, error) {
+	return p._CallJob("RestartUnit", name, mode)
+}
+
+// ReloadUnit queues a job reloading the unit name.
+func (p *Manager) ReloadUnit(name, mode string) (string, error) {
+	return p._CallJob("ReloadUnit", name, mode)
+}
+
+// ListUnits returns the units currently loaded.
+func (p *Manager) ListUnits() ([]UnitStatus, error) {
+	ret, err := p.conn.CallMethod(p.iface, "ListUnits")
+	if err != nil {
+		return nil, err
+	}
+	var units []UnitStatus
+	err = dbus.Store(ret, &units)
+	return units, err
+}
+
+// GetUnit returns the loaded unit name.
+func (p *Manager) GetUnit(name string) (*Unit, error) {
+	ret, err := p.conn.CallMethod(p.iface, "GetUnit", name)
+	if err != nil {
+		return nil, err
+	}
+	var path string
+	if err = dbus.Store(ret, &path); err != nil {
+		return nil, err
+	}
+	return NewUnit(p.conn, path)
+}
+
+// Subscribe asks the manager to emit job and unit signals, which it does
+// not by default.
+func (p *Manager) Subscribe() error {
+	_, err := p.conn.CallMethod(p.iface, "Subscribe")
+	return err
+}
+
+// OnJobRemoved calls proc each time a job finished. Subscribe must be called
+// for the signal to be sent. The handler can be passed to
+// RemoveSignalHandler to stop watching.
+func (p *Manager) OnJobRemoved(proc func(*JobResult)) (*dbus.SignalHandler, error) {
+	mr := &dbus.MatchRule{
+		Type:      "signal",
+		Sender:    DESTINATION,
+		Interface: MANAGER_INTERFACE,
+		Member:    "JobRemoved",
+		Path:      PATH,
+	}
+	return p.conn.AddSignalHandler(mr, func(msg *dbus.Message) {
+		if result, err := _NewJobResult(msg.Params); err == nil {
+			proc(result)
+		}
+	})
+}
+
+// _NewJobResult decodes the (uoss) body of JobRemoved.
+func _NewJobResult(params []interface{}) (*JobResult, error) {
+	result := new(JobResult)
+	err := dbus.Store(params, &result.ID, &result.Job, &result.Unit, &result.Result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Unit is a unit object of the manager.
+type Unit struct {
+	conn  *dbus.Connection
+	path  string
+	props *dbus.Interface
+}
+
+// NewUnit returns the unit with the object path path.
+func NewUnit(conn *dbus.Connection, path string) (*Unit, error) {
+	obj := conn.GetObject(DESTINATION, path)
+	props := conn.Interface(obj, PROPERTIES_INTERFACE)
+	if props == nil {
+		return nil, ErrNoUnit
+	}
+	return &Unit{conn, path, props}, nil
+}
+
+// Path returns the object path of the unit.
+func (p *Unit) Path() string { return p.path }
+
+// GetProperty returns the property name of the interface iface, for example
+// UNIT_INTERFACE or "org.freedesktop.systemd1.Service".
+func (p *Unit) GetProperty(iface, name string) (interface{}, error) {
+	ret, err := p.conn.CallMethod(p.props, "Get", iface, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, ErrNoReply
+	}
+	var v interface{}
+	err = dbus.Store(ret[:1], &v)
+	return v, err
+}
+
+// GetAllProperties returns the properties of the interface iface.
+func (p *Unit) GetAllProperties(iface string) (map[string]interface{}, error) {
+	ret, err := p.conn.CallMethod(p.props, "GetAll", iface)
+	if err != nil {
+		return nil, err
+	}
+	var props map[string]interface{}
+	err = dbus.Store(ret, &props)
+	return props, err
+}
+
+func (p *Unit) _GetString(name string) (string, error) {
+	v, err := p.GetProperty(UNIT_INTERFACE, name)
+	if err != nil {
+		return "", err
+	}
+	var s string
+	err = dbus.Store([]interface{}{v}, &s)
+	return s, err
+}
+
+// Id returns the primary name of the unit.
+func (p *Unit) Id() (string, error) { return p._GetString("Id") }
+
+// Description returns the description of the unit.
+func (p *Unit) Description() (string, error) { return p._GetString("Description") }
+
+// LoadState returns whether the unit configuration was loaded, for example
+// "loaded" or "not-found".
+func (p *Unit) LoadState() (string, error) { return p._GetString("LoadState") }
+
+// ActiveState returns the high level state of the unit, for example
+// "active", "inactive" or "failed".
+func (p *Unit) ActiveState() (string, error) { return p._GetString("ActiveState") }
+
+// SubState returns the unit type specific state, for example "running".
+func (p *Unit) SubState() (string, error) { return p._GetString("SubState") }
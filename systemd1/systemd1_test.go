@@ -0,0 +1,34 @@
+package systemd1
+
+import (
+	"testing"
+
+	"github.com/norisatir/go-dbus"
+)
+
+func TestListUnitsReply(t *testing.T) {
+	ret := []interface{}{[]interface{}{
+		[]interface{}{"dbus.service", "D-Bus System Message Bus", "loaded", "active", "running", "",
+			"/org/freedesktop/systemd1/unit/dbus_2eservice", uint32(0), "", "/"},
+	}}
+	var units []UnitStatus
+	if e := dbus.Store(ret, &units); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if len(units) != 1 || units[0].Name != "dbus.service" || units[0].SubState != "running" || units[0].JobPath != "/" {
+		t.Error("#2 Failed:", units)
+	}
+}
+
+func TestNewJobResult(t *testing.T) {
+	result, e := _NewJobResult([]interface{}{uint32(7), "/org/freedesktop/systemd1/job/7", "foo.service", "done"})
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if result.ID != 7 || result.Unit != "foo.service" || result.Result != "done" {
+		t.Error("#2 Failed:", result)
+	}
+	if _, e := _NewJobResult([]interface{}{uint32(7)}); e == nil {
+		t.Error("#3 Failed")
+	}
+}
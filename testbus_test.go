@@ -0,0 +1,193 @@
+package dbus
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testBus is a minimal in-process bus speaking just enough of the protocol
+// for connection tests: it accepts EXTERNAL authentication, answers Hello
+// and hands every other message to handle. It passes file descriptors only
+// if created by newTestFDBus, since reading them hides the ordering of the
+// socket from the race detector.
+type testBus struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	fdReader *fdReader
+	handle   func(bus *testBus, msg *Message)
+	serial   uint32
+	mutex    sync.Mutex
+}
+
+// newTestConnection returns an initialized Connection talking to a new
+// testBus over a unix socket.
+func newTestConnection(t testing.TB, handle func(*testBus, *Message)) (*Connection, *testBus) {
+	con, bus := newTestBus(t, handle)
+	if e := con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+	return con, bus
+}
+
+// newTestBus returns a Connection connected to a new testBus, which has not
+// been initialized yet.
+func newTestBus(t testing.TB, handle func(*testBus, *Message)) (*Connection, *testBus) {
+	return _NewTestBus(t, handle, false)
+}
+
+// newTestFDBus works like newTestBus, but the bus agrees to pass file
+// descriptors.
+func newTestFDBus(t testing.TB, handle func(*testBus, *Message)) (*Connection, *testBus) {
+	return _NewTestBus(t, handle, true)
+}
+
+func _NewTestBus(t testing.TB, handle func(*testBus, *Message), unixFDs bool) (*Connection, *testBus) {
+	l, e := net.Listen("unix", filepath.Join(t.TempDir(), "bus"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer l.Close()
+
+	accepted := make(chan *testBus)
+	go func() {
+		conn, e := l.Accept()
+		if e != nil {
+			accepted <- nil
+			return
+		}
+		bus := &testBus{conn: conn, reader: bufio.NewReader(conn), handle: handle}
+		if unixFDs {
+			bus.fdReader = _NewFDReader(conn.(*net.UnixConn))
+			bus.reader = bufio.NewReader(bus.fdReader)
+		}
+		accepted <- bus
+		bus._Run()
+	}()
+
+	con := new(Connection)
+	if con.conn, e = net.Dial("unix", l.Addr().String()); e != nil {
+		t.Fatal(e)
+	}
+	bus := <-accepted
+	if bus == nil {
+		t.Fatal("accept failed")
+	}
+	t.Cleanup(func() {
+		con.conn.Close()
+		bus.conn.Close()
+	})
+	return con, bus
+}
+
+func (p *testBus) _Run() {
+	if !p._Auth() {
+		p.conn.Close()
+		return
+	}
+	for {
+		buff, e := _ReadMessageData(p.reader)
+		if e != nil {
+			return
+		}
+		msg := NewMessage()
+		if p.fdReader != nil {
+			msg.fds = p.fdReader.fds
+		}
+		_, _, e = _UnmarshalInto(msg, buff)
+		if p.fdReader != nil {
+			p.fdReader._Take(len(msg.fds))
+		}
+		if e != nil {
+			return
+		}
+		if msg.Type == METHOD_CALL && msg.Member == "Hello" {
+			p.Reply(msg, "s", ":1.1")
+			continue
+		}
+		if p.handle != nil {
+			p.handle(p, msg)
+		}
+	}
+}
+
+func (p *testBus) _Auth() bool {
+	if b, e := p.reader.ReadByte(); e != nil || b != 0 {
+		return false
+	}
+	for {
+		line, e := p.reader.ReadString('\n')
+		if e != nil {
+			return false
+		}
+		switch {
+		case strings.HasPrefix(line, "AUTH "):
+			p.conn.Write([]byte("OK 0123456789abcdef0123456789abcdef\r\n"))
+		case strings.HasPrefix(line, "NEGOTIATE_UNIX_FD") && p.fdReader != nil:
+			p.conn.Write([]byte("AGREE_UNIX_FD\r\n"))
+		case strings.HasPrefix(line, "BEGIN"):
+			return true
+		default:
+			p.conn.Write([]byte("ERROR\r\n"))
+		}
+	}
+}
+
+// Send writes msg to the client.
+func (p *testBus) Send(msg *Message) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.serial++
+	msg.serial = p.serial
+	header, body, e := msg._MarshalParts()
+	if e != nil {
+		return
+	}
+	buff := header.Bytes()
+	for _, segment := range body.segments {
+		buff = append(buff, segment...)
+	}
+	if len(body.fds) != 0 {
+		_WriteWithFDs(p.conn.(*net.UnixConn), net.Buffers{buff}, body.fds)
+	} else {
+		p.conn.Write(buff)
+	}
+	body.Release()
+}
+
+// Reply sends a method return for call with the given body.
+func (p *testBus) Reply(call *Message, sig string, params ...interface{}) {
+	msg := NewMessage()
+	msg.Type = METHOD_RETURN
+	msg.replySerial = call.serial
+	msg.Dest = ":1.1"
+	msg.Sig = sig
+	msg.Params = params
+	p.Send(msg)
+}
+
+// Emit sends a signal to the client. Signals of the interface of the bus come
+// from the bus itself.
+func (p *testBus) Emit(path, iface, member, sig string, params ...interface{}) {
+	sender := ""
+	if iface == "org.freedesktop.DBus" {
+		sender = "org.freedesktop.DBus"
+	}
+	p.EmitFrom(sender, path, iface, member, sig, params...)
+}
+
+// EmitFrom sends a signal to the client as sent by sender.
+func (p *testBus) EmitFrom(sender, path, iface, member, sig string, params ...interface{}) {
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Sender = sender
+	msg.Path = path
+	msg.Iface = iface
+	msg.Member = member
+	msg.Sig = sig
+	msg.Params = params
+	p.Send(msg)
+}
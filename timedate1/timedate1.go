@@ -0,0 +1,132 @@
+// Package timedate1 is a client of systemd-timedated on the system bus,
+// which reads and sets the system clock, time zone and NTP use.
+//
+// Setters take an interactive flag, which lets polkit ask the user to
+// authenticate if the caller is not privileged.
+package timedate1
+
+import (
+	"errors"
+	"time"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION          = "org.freedesktop.timedate1"
+	PATH                 = "/org/freedesktop/timedate1"
+	INTERFACE            = "org.freedesktop.timedate1"
+	PROPERTIES_INTERFACE = "org.freedesktop.DBus.Properties"
+)
+
+var (
+	ErrNoService = errors.New("NoTimedated")
+	ErrNoReply   = errors.New("EmptyReply")
+)
+
+// Client is the timedated service.
+type Client struct {
+	conn  *dbus.Connection
+	iface *dbus.Interface
+	props *dbus.Interface
+}
+
+// NewClient returns the service reached through conn, which must be an
+// initialized connection to the system bus.
+func NewClient(conn *dbus.Connection) (*Client, error) {
+	obj := conn.GetObject(DESTINATION, PATH)
+	iface := conn.Interface(obj, INTERFACE)
+	props := conn.Interface(obj, PROPERTIES_INTERFACE)
+	if iface == nil || props == nil {
+		return nil, ErrNoService
+	}
+	return &Client{conn, iface, props}, nil
+}
+
+func (p *Client) _Get(name string, dest interface{}) error {
+	ret, err := p.conn.CallMethod(p.props, "Get", INTERFACE, name)
+	if err != nil {
+		return err
+	}
+	if len(ret) == 0 {
+		return ErrNoReply
+	}
+	return dbus.Store(ret[:1], dest)
+}
+
+func (p *Client) _GetBool(name string) (bool, error) {
+	var b bool
+	err := p._Get(name, &b)
+	return b, err
+}
+
+// Timezone returns the system time zone, like "Europe/Berlin".
+func (p *Client) Timezone() (string, error) {
+	var tz string
+	err := p._Get("Timezone", &tz)
+	return tz, err
+}
+
+// LocalRTC reports whether the hardware clock is kept in local time rather
+// than UTC.
+func (p *Client) LocalRTC() (bool, error) { return p._GetBool("LocalRTC") }
+
+// CanNTP reports whether a time synchronization service is available.
+func (p *Client) CanNTP() (bool, error) { return p._GetBool("CanNTP") }
+
+// NTP reports whether time synchronization is enabled.
+func (p *Client) NTP() (bool, error) { return p._GetBool("NTP") }
+
+// NTPSynchronized reports whether the clock is synchronized.
+func (p *Client) NTPSynchronized() (bool, error) { return p._GetBool("NTPSynchronized") }
+
+// Time returns the system time as seen by the service.
+func (p *Client) Time() (time.Time, error) {
+	var usec uint64
+	if err := p._Get("TimeUSec", &usec); err != nil {
+		return time.Time{}, err
+	}
+	return _FromUSec(usec), nil
+}
+
+// _FromUSec returns the time of usec microseconds since the epoch.
+func _FromUSec(usec uint64) time.Time {
+	return time.Unix(int64(usec/1e6), int64(usec%1e6)*int64(time.Microsecond))
+}
+
+// SetTime sets the system clock to t. It fails while NTP is enabled.
+func (p *Client) SetTime(t time.Time, interactive bool) error {
+	_, err := p.conn.CallMethod(p.iface, "SetTime", t.UnixMicro(), false, interactive)
+	return err
+}
+
+// SetTimezone sets the system time zone.
+func (p *Client) SetTimezone(tz string, interactive bool) error {
+	_, err := p.conn.CallMethod(p.iface, "SetTimezone", tz, interactive)
+	return err
+}
+
+// SetLocalRTC sets whether the hardware clock is kept in local time. If
+// fixSystem is set, the system clock is set from the hardware clock,
+// otherwise the other way round.
+func (p *Client) SetLocalRTC(localRTC, fixSystem, interactive bool) error {
+	_, err := p.conn.CallMethod(p.iface, "SetLocalRTC", localRTC, fixSystem, interactive)
+	return err
+}
+
+// SetNTP enables or disables time synchronization.
+func (p *Client) SetNTP(enable, interactive bool) error {
+	_, err := p.conn.CallMethod(p.iface, "SetNTP", enable, interactive)
+	return err
+}
+
+// ListTimezones returns the time zones which may be passed to SetTimezone.
+func (p *Client) ListTimezones() ([]string, error) {
+	ret, err := p.conn.CallMethod(p.iface, "ListTimezones")
+	if err != nil {
+		return nil, err
+	}
+	var zones []string
+	err = dbus.Store(ret, &zones)
+	return zones, err
+}
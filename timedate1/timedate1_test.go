@@ -0,0 +1,13 @@
+package timedate1
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFromUSec(t *testing.T) {
+	now := time.Date(2038, 1, 19, 3, 14, 8, 123456000, time.UTC)
+	if got := _FromUSec(uint64(now.UnixMicro())); !got.Equal(now) {
+		t.Error("#1 Failed:", got)
+	}
+}
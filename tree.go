@@ -0,0 +1,78 @@
+package dbus
+
+import (
+	"strings"
+)
+
+// ObjectNode is an object in the hierarchy returned by Tree.
+type ObjectNode struct {
+	Path string
+	// Interfaces lists the interfaces of the object by name.
+	Interfaces []string
+	Children   []*ObjectNode
+}
+
+// Tree introspects the object at root of dest and, recursively, the child
+// nodes its introspection data lists, returning the hierarchy of objects
+// below root. Children whose introspection fails are kept without
+// interfaces or children; only a failure to introspect root is returned.
+func (p *Connection) Tree(dest, root string) (*ObjectNode, error) {
+	if err := ValidateObjectPath(root); err != nil {
+		return nil, err
+	}
+	intro, err := p._IntrospectPath(dest, root)
+	if err != nil {
+		return nil, err
+	}
+	return p._WalkTree(dest, root, intro), nil
+}
+
+func (p *Connection) _IntrospectPath(dest, path string) (Introspect, error) {
+	ret, err := p.CallWithSignature(dest, path, INTROSPECTABLE_INTERFACE, "Introspect", "")
+	if err != nil {
+		return nil, err
+	}
+	var data string
+	if err = Store(ret, &data); err != nil {
+		return nil, err
+	}
+	return NewIntrospect(data)
+}
+
+// _WalkTree returns the node of the object at path described by intro.
+// Children described inline with their interfaces are not introspected
+// again.
+func (p *Connection) _WalkTree(dest, path string, intro Introspect) *ObjectNode {
+	node := &ObjectNode{Path: path, Interfaces: intro.GetInterfaceNames()}
+	for _, child := range intro.GetChildren() {
+		childPath := _ChildPath(path, child.GetName())
+		if ValidateObjectPath(childPath) != nil {
+			continue
+		}
+		if len(child.GetInterfaceNames()) == 0 {
+			var err error
+			if child, err = p._IntrospectPath(dest, childPath); err != nil {
+				node.Children = append(node.Children, &ObjectNode{Path: childPath})
+				continue
+			}
+		}
+		node.Children = append(node.Children, p._WalkTree(dest, childPath, child))
+	}
+	return node
+}
+
+// _ChildPath returns the path of the child node name of the object at path.
+// Names are relative, though some services still list absolute paths, which
+// must be below path.
+func _ChildPath(path, name string) string {
+	if strings.HasPrefix(name, "/") {
+		if !strings.HasPrefix(name, strings.TrimSuffix(path, "/")+"/") {
+			return ""
+		}
+		return name
+	}
+	if path == "/" {
+		return "/" + name
+	}
+	return path + "/" + name
+}
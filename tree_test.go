@@ -0,0 +1,66 @@
+package dbus
+
+import (
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	client, server := newTestPeers(t)
+	for _, path := range []string{"/calc/main", "/calc/backup", "/other/deep/calc"} {
+		if e := server.Export(testCalc{}, path, "org.example.Calc"); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	root, e := client.Tree("", "/")
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if root.Path != "/" || len(root.Children) != 2 {
+		t.Fatal("#2 Failed:", root)
+	}
+	calc := root.Children[0]
+	if calc.Path != "/calc" || len(calc.Children) != 2 || len(calc.Interfaces) != 2 {
+		t.Error("#3 Failed:", calc)
+	}
+	paths := map[string][]string{}
+	var walk func(*ObjectNode)
+	walk = func(node *ObjectNode) {
+		paths[node.Path] = node.Interfaces
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	if len(paths) != 7 {
+		t.Error("#4 Failed:", paths)
+	}
+	if ifaces := paths["/other/deep/calc"]; len(ifaces) != 3 || ifaces[2] != "org.example.Calc" {
+		t.Error("#5 Failed:", ifaces)
+	}
+
+	if node, e := client.Tree("", "/other/deep"); e != nil || len(node.Children) != 1 || node.Children[0].Path != "/other/deep/calc" {
+		t.Error("#6 Failed:", node, e)
+	}
+	if _, e := client.Tree("", "/missing"); e == nil {
+		t.Error("#7 Failed")
+	}
+	if _, e := client.Tree("", "bad"); e == nil {
+		t.Error("#8 Failed")
+	}
+}
+
+func TestChildPath(t *testing.T) {
+	for _, test := range []struct{ path, name, expected string }{
+		{"/", "a", "/a"},
+		{"/a", "b", "/a/b"},
+		{"/a", "/a/b", "/a/b"},
+		{"/", "/a", "/a"},
+		{"/a", "/b", ""},
+		{"/a", "/a", ""},
+	} {
+		if childPath := _ChildPath(test.path, test.name); childPath != test.expected {
+			t.Error("#1 Failed:", test, childPath)
+		}
+	}
+}
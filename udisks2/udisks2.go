@@ -0,0 +1,241 @@
+// Package udisks2 gives typed access to the block devices, drives and
+// filesystems managed by the UDisks2 daemon on the system bus.
+package udisks2
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION              = "org.freedesktop.UDisks2"
+	PATH                     = "/org/freedesktop/UDisks2"
+	BLOCK_INTERFACE          = "org.freedesktop.UDisks2.Block"
+	DRIVE_INTERFACE          = "org.freedesktop.UDisks2.Drive"
+	FILESYSTEM_INTERFACE     = "org.freedesktop.UDisks2.Filesystem"
+	OBJECT_MANAGER_INTERFACE = "org.freedesktop.DBus.ObjectManager"
+)
+
+var (
+	ErrNoService = errors.New("NoUDisks2")
+	ErrNoObject  = errors.New("NoSuchObject")
+)
+
+// ManagedObjects maps object paths to the properties of their interfaces
+// by interface name, as returned by GetManagedObjects.
+type ManagedObjects map[string]map[string]map[string]interface{}
+
+// Client is the UDisks2 daemon.
+type Client struct {
+	conn *dbus.Connection
+	om   *dbus.Interface
+}
+
+// NewClient returns the daemon reached through conn, which must be an
+// initialized connection to the system bus.
+func NewClient(conn *dbus.Connection) (*Client, error) {
+	obj := conn.GetObject(DESTINATION, PATH)
+	om := conn.Interface(obj, OBJECT_MANAGER_INTERFACE)
+	if om == nil {
+		return nil, ErrNoService
+	}
+	return &Client{conn, om}, nil
+}
+
+// ManagedObjects returns all objects of the daemon.
+func (p *Client) ManagedObjects() (ManagedObjects, error) {
+	ret, err := p.conn.CallMethod(p.om, "GetManagedObjects")
+	if err != nil {
+		return nil, err
+	}
+	return _NewManagedObjects(ret)
+}
+
+// _NewManagedObjects decodes the a{oa{sa{sv}}} reply of GetManagedObjects.
+func _NewManagedObjects(ret []interface{}) (ManagedObjects, error) {
+	var objects ManagedObjects
+	err := dbus.Store(ret, &objects)
+	return objects, err
+}
+
+// BlockDevices returns the block devices, sorted by path.
+func (p *Client) BlockDevices() ([]*Block, error) {
+	objects, err := p.ManagedObjects()
+	if err != nil {
+		return nil, err
+	}
+	return _Blocks(p.conn, objects), nil
+}
+
+func _Blocks(conn *dbus.Connection, objects ManagedObjects) []*Block {
+	blocks := make([]*Block, 0)
+	for _, path := range _SortedPaths(objects) {
+		ifaces := objects[path]
+		props, ok := ifaces[BLOCK_INTERFACE]
+		if !ok {
+			continue
+		}
+		_, isFilesystem := ifaces[FILESYSTEM_INTERFACE]
+		blocks = append(blocks, &Block{conn, path, props, isFilesystem})
+	}
+	return blocks
+}
+
+// Drives returns the drives, sorted by path.
+func (p *Client) Drives() ([]*Drive, error) {
+	objects, err := p.ManagedObjects()
+	if err != nil {
+		return nil, err
+	}
+	drives := make([]*Drive, 0)
+	for _, path := range _SortedPaths(objects) {
+		if props, ok := objects[path][DRIVE_INTERFACE]; ok {
+			drives = append(drives, &Drive{path, props})
+		}
+	}
+	return drives, nil
+}
+
+func _SortedPaths(objects ManagedObjects) []string {
+	paths := make([]string, 0, len(objects))
+	for path := range objects {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// _Options returns the a{sv} options dictionary for options.
+func _Options(options map[string]interface{}) []interface{} {
+	dict := make([]interface{}, 0, len(options))
+	for k, v := range options {
+		dict = append(dict, []interface{}{k, v})
+	}
+	return dict
+}
+
+// _ByteString decodes the NUL terminated byte strings UDisks2 uses for
+// device files and mount points.
+func _ByteString(v interface{}) string {
+	b, _ := v.([]byte)
+	return string(bytes.TrimRight(b, "\x00"))
+}
+
+// Block is a block device. Its properties are those at the time it was
+// listed.
+type Block struct {
+	conn         *dbus.Connection
+	path         string
+	Properties   map[string]interface{}
+	IsFilesystem bool
+}
+
+// Path returns the object path of the device.
+func (p *Block) Path() string { return p.path }
+
+// Device returns the device file, like "/dev/sda1".
+func (p *Block) Device() string { return _ByteString(p.Properties["Device"]) }
+
+// Size returns the size of the device in bytes.
+func (p *Block) Size() uint64 {
+	size, _ := p.Properties["Size"].(uint64)
+	return size
+}
+
+// IdType returns the detected content, like "ext4" or "vfat".
+func (p *Block) IdType() string {
+	t, _ := p.Properties["IdType"].(string)
+	return t
+}
+
+// IdLabel returns the label of the content.
+func (p *Block) IdLabel() string {
+	label, _ := p.Properties["IdLabel"].(string)
+	return label
+}
+
+// Drive returns the object path of the drive of the device, or "/".
+func (p *Block) Drive() string {
+	drive, _ := p.Properties["Drive"].(dbus.ObjectPath)
+	return string(drive)
+}
+
+// MountPoints returns where the filesystem on the device is mounted.
+func (p *Block) MountPoints(objects ManagedObjects) []string {
+	points := make([]string, 0)
+	v, _ := objects[p.path][FILESYSTEM_INTERFACE]["MountPoints"].([]interface{})
+	for _, point := range v {
+		points = append(points, _ByteString(point))
+	}
+	return points
+}
+
+func (p *Block) _Filesystem() (*dbus.Interface, error) {
+	if !p.IsFilesystem {
+		return nil, ErrNoObject
+	}
+	obj := p.conn.GetObject(DESTINATION, p.path)
+	iface := p.conn.Interface(obj, FILESYSTEM_INTERFACE)
+	if iface == nil {
+		return nil, ErrNoObject
+	}
+	return iface, nil
+}
+
+// Mount mounts the filesystem on the device and returns the mount point.
+// options may set "fstype" and "options", the mount options as a comma
+// separated string.
+func (p *Block) Mount(options map[string]interface{}) (string, error) {
+	fs, err := p._Filesystem()
+	if err != nil {
+		return "", err
+	}
+	ret, err := p.conn.CallMethod(fs, "Mount", _Options(options))
+	if err != nil {
+		return "", err
+	}
+	var point string
+	err = dbus.Store(ret, &point)
+	return point, err
+}
+
+// Unmount unmounts the filesystem on the device. options may set "force"
+// to true.
+func (p *Block) Unmount(options map[string]interface{}) error {
+	fs, err := p._Filesystem()
+	if err != nil {
+		return err
+	}
+	_, err = p.conn.CallMethod(fs, "Unmount", _Options(options))
+	return err
+}
+
+// Drive is a drive. Its properties are those at the time it was listed.
+type Drive struct {
+	path       string
+	Properties map[string]interface{}
+}
+
+// Path returns the object path of the drive.
+func (p *Drive) Path() string { return p.path }
+
+// Model returns the model name of the drive.
+func (p *Drive) Model() string {
+	model, _ := p.Properties["Model"].(string)
+	return model
+}
+
+// Vendor returns the vendor name of the drive.
+func (p *Drive) Vendor() string {
+	vendor, _ := p.Properties["Vendor"].(string)
+	return vendor
+}
+
+// Removable reports whether the media of the drive may be removed.
+func (p *Drive) Removable() bool {
+	removable, _ := p.Properties["Removable"].(bool)
+	return removable
+}
@@ -0,0 +1,49 @@
+package udisks2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestManagedObjects(t *testing.T) {
+	ret := []interface{}{[]interface{}{
+		[]interface{}{"/org/freedesktop/UDisks2/block_devices/sda1", []interface{}{
+			[]interface{}{BLOCK_INTERFACE, []interface{}{
+				[]interface{}{"Device", []byte("/dev/sda1\x00")},
+				[]interface{}{"Size", uint64(1 << 30)},
+				[]interface{}{"IdType", "ext4"},
+			}},
+			[]interface{}{FILESYSTEM_INTERFACE, []interface{}{
+				[]interface{}{"MountPoints", []interface{}{[]byte("/mnt\x00")}},
+			}},
+		}},
+		[]interface{}{"/org/freedesktop/UDisks2/drives/disk", []interface{}{
+			[]interface{}{DRIVE_INTERFACE, []interface{}{
+				[]interface{}{"Model", "Disk"},
+			}},
+		}},
+	}}
+	objects, e := _NewManagedObjects(ret)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+
+	blocks := _Blocks(nil, objects)
+	if len(blocks) != 1 {
+		t.Fatal("#2 Failed:", len(blocks))
+	}
+	block := blocks[0]
+	if block.Device() != "/dev/sda1" || block.Size() != 1<<30 || block.IdType() != "ext4" || !block.IsFilesystem {
+		t.Error("#3 Failed:", block.Properties)
+	}
+	if points := block.MountPoints(objects); !reflect.DeepEqual(points, []string{"/mnt"}) {
+		t.Error("#4 Failed:", points)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	dict := _Options(map[string]interface{}{"force": true})
+	if !reflect.DeepEqual(dict, []interface{}{[]interface{}{"force", true}}) {
+		t.Error("#1 Failed:", dict)
+	}
+}
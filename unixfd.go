@@ -0,0 +1,106 @@
+package dbus
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"syscall"
+)
+
+// ErrUnixFDsUnsupported is returned for messages carrying file descriptors
+// on connections which can not pass them, because they are not unix sockets
+// or the bus did not agree to it.
+var ErrUnixFDsUnsupported = errors.New("UnixFDsUnsupported")
+
+// MAX_UNIX_FDS is the largest number of file descriptors a message may
+// carry, the most the kernel passes at once.
+const MAX_UNIX_FDS = 253
+
+// UnixFD is a file descriptor, the value of the unix_fd wire type. A UnixFD
+// in the body of a sent message is passed to the receiver, which gets a
+// duplicate of it; the sender may close its own once the message was sent.
+// Descriptors received belong to the receiver, which must close them.
+type UnixFD int
+
+var unixFDType = reflect.TypeOf(UnixFD(0))
+
+// fdReader reads from a unix socket and collects the file descriptors
+// passed along, in the order they arrive. Since the descriptors of a message
+// arrive with its first byte, those of each message decoded are at the front
+// of fds.
+type fdReader struct {
+	conn *net.UnixConn
+	oob  []byte
+	fds  []int
+}
+
+func _NewFDReader(conn *net.UnixConn) *fdReader {
+	return &fdReader{conn: conn, oob: make([]byte, syscall.CmsgSpace(MAX_UNIX_FDS*4))}
+}
+
+func (p *fdReader) Read(b []byte) (int, error) {
+	n, oobn, _, _, err := p.conn.ReadMsgUnix(b, p.oob)
+	if n < 0 {
+		n = 0
+	}
+	if oobn > 0 {
+		fds, e := _ParseUnixRights(p.oob[:oobn])
+		p.fds = append(p.fds, fds...)
+		if err == nil {
+			err = e
+		}
+	}
+	return n, err
+}
+
+// _Take removes the first n file descriptors.
+func (p *fdReader) _Take(n int) {
+	p.fds = append(p.fds[:0], p.fds[n:]...)
+}
+
+// _ParseUnixRights returns the file descriptors in the control messages
+// oob.
+func _ParseUnixRights(oob []byte) ([]int, error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, err
+	}
+	fds := make([]int, 0)
+	for i := range msgs {
+		rights, err := syscall.ParseUnixRights(&msgs[i])
+		if err != nil {
+			continue // not SCM_RIGHTS
+		}
+		fds = append(fds, rights...)
+	}
+	return fds, nil
+}
+
+// _WriteWithFDs writes buffs to conn, passing fds along with the first
+// bytes written.
+func _WriteWithFDs(conn *net.UnixConn, buffs net.Buffers, fds []int) error {
+	n, _, err := conn.WriteMsgUnix(buffs[0], syscall.UnixRights(fds...), nil)
+	if err != nil {
+		return err
+	}
+	buffs[0] = buffs[0][n:]
+	return _WriteFull(conn, buffs)
+}
+
+// _CloseFDs closes the file descriptors received with msg, for messages
+// which are not delivered.
+func _CloseFDs(msg *Message) {
+	for _, fd := range msg.fds {
+		syscall.Close(fd)
+	}
+	msg.fds = nil
+}
+
+// SupportsUnixFDs reports whether the connection can pass file
+// descriptors, which the bus agrees to during authentication on unix
+// sockets.
+func (p *Connection) SupportsUnixFDs() bool {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	return p.unixFDs
+}
@@ -0,0 +1,89 @@
+package dbus
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestUnixFD(t *testing.T) {
+	con, _ := newTestFDBus(t, func(bus *testBus, msg *Message) {
+		if msg.Member == "Echo" {
+			bus.Reply(msg, "h", msg.Params[0])
+			_CloseFDs(msg)
+		}
+	})
+	if e := con.Initialize(); e != nil {
+		t.Fatal(e)
+	}
+	if !con.SupportsUnixFDs() {
+		t.Fatal("#1 Failed")
+	}
+
+	r, w, e := os.Pipe()
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	ret, e := con.CallWithSignature("org.test", "/org/test", "org.test", "Echo", "h", UnixFD(w.Fd()))
+	if e != nil {
+		t.Fatal("#2 Failed:", e)
+	}
+	if other, _ := newTestConnection(t, nil); other.SupportsUnixFDs() {
+		t.Error("#3 Failed")
+	}
+
+	var fd UnixFD
+	if e := Store(ret, &fd); e != nil || fd == UnixFD(w.Fd()) {
+		t.Fatal("#4 Failed:", fd, e)
+	}
+	f := os.NewFile(uintptr(fd), "echo")
+	f.Write([]byte("hi"))
+	f.Close()
+	w.Close()
+
+	b := make([]byte, 2)
+	if _, e := r.Read(b); e != nil || string(b) != "hi" {
+		t.Error("#5 Failed:", string(b), e)
+	}
+}
+
+func TestUnixFDUnsupported(t *testing.T) {
+	msg := NewMessage()
+	msg.Type = METHOD_CALL
+	msg.Path = "/org/test"
+	msg.Member = "Test"
+	msg.Sig = "hhh"
+	msg.Params = []interface{}{UnixFD(7), UnixFD(8), UnixFD(7)}
+
+	header, body, e := msg._MarshalParts()
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if len(body.fds) != 2 || body.fds[0] != 7 || body.fds[1] != 8 {
+		t.Error("#2 Failed:", body.fds)
+	}
+	buff := append(header.Bytes(), body.segments[0]...)
+
+	if _, _, e := _Unmarshal(buff); e == nil {
+		t.Error("#3 Failed")
+	}
+	ret := NewMessage()
+	ret.fds = []int{3, 4, 5}
+	if _, _, e := _UnmarshalInto(ret, buff); e != nil {
+		t.Fatal("#4 Failed:", e)
+	}
+	if len(ret.fds) != 2 || ret.Params[0] != UnixFD(3) || ret.Params[1] != UnixFD(4) || ret.Params[2] != UnixFD(3) {
+		t.Error("#5 Failed:", ret.fds, ret.Params)
+	}
+
+	con := new(Connection)
+	if _, _, e := con._MarshalMessage(msg); e != ErrUnixFDsUnsupported {
+		t.Error("#6 Failed:", e)
+	}
+	if _, e := _AppendValue(new(bytes.Buffer), "h", 7); e == nil {
+		t.Error("#7 Failed")
+	}
+}
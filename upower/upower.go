@@ -0,0 +1,239 @@
+// Package upower reports the power sources known to the UPower daemon on
+// the system bus, such as batteries and line power.
+//
+// A Device caches its properties and keeps them up to date from the
+// PropertiesChanged signals of the daemon, so status bars can read them
+// as often as they like.
+package upower
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/norisatir/go-dbus"
+)
+
+const (
+	DESTINATION          = "org.freedesktop.UPower"
+	PATH                 = "/org/freedesktop/UPower"
+	INTERFACE            = "org.freedesktop.UPower"
+	DEVICE_INTERFACE     = "org.freedesktop.UPower.Device"
+	PROPERTIES_INTERFACE = "org.freedesktop.DBus.Properties"
+)
+
+var (
+	ErrNoService = errors.New("NoUPower")
+	ErrNoObject  = errors.New("NoSuchObject")
+)
+
+// DeviceType is the kind of a power source.
+type DeviceType uint32
+
+const (
+	TYPE_UNKNOWN    DeviceType = 0
+	TYPE_LINE_POWER DeviceType = 1
+	TYPE_BATTERY    DeviceType = 2
+	TYPE_UPS        DeviceType = 3
+	TYPE_MONITOR    DeviceType = 4
+	TYPE_MOUSE      DeviceType = 5
+	TYPE_KEYBOARD   DeviceType = 6
+	TYPE_PDA        DeviceType = 7
+	TYPE_PHONE      DeviceType = 8
+)
+
+// State is the charge state of a battery.
+type State uint32
+
+const (
+	STATE_UNKNOWN           State = 0
+	STATE_CHARGING          State = 1
+	STATE_DISCHARGING       State = 2
+	STATE_EMPTY             State = 3
+	STATE_FULLY_CHARGED     State = 4
+	STATE_PENDING_CHARGE    State = 5
+	STATE_PENDING_DISCHARGE State = 6
+)
+
+// Client is the UPower daemon.
+type Client struct {
+	conn  *dbus.Connection
+	iface *dbus.Interface
+}
+
+// NewClient returns the daemon reached through conn, which must be an
+// initialized connection to the system bus.
+func NewClient(conn *dbus.Connection) (*Client, error) {
+	obj := conn.GetObject(DESTINATION, PATH)
+	iface := conn.Interface(obj, INTERFACE)
+	if iface == nil {
+		return nil, ErrNoService
+	}
+	return &Client{conn, iface}, nil
+}
+
+// Devices returns the power sources.
+func (p *Client) Devices() ([]*Device, error) {
+	ret, err := p.conn.CallMethod(p.iface, "EnumerateDevices")
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	if err = dbus.Store(ret, &paths); err != nil {
+		return nil, err
+	}
+	devices := make([]*Device, 0, len(paths))
+	for _, path := range paths {
+		device, err := NewDevice(p.conn, path)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// DisplayDevice returns the composite device summarizing all batteries,
+// which is what status bars usually show.
+func (p *Client) DisplayDevice() (*Device, error) {
+	ret, err := p.conn.CallMethod(p.iface, "GetDisplayDevice")
+	if err != nil {
+		return nil, err
+	}
+	var path string
+	if err = dbus.Store(ret, &path); err != nil {
+		return nil, err
+	}
+	return NewDevice(p.conn, path)
+}
+
+// Device is a power source.
+type Device struct {
+	conn    *dbus.Connection
+	path    string
+	handler *dbus.SignalHandler
+
+	mutex    sync.Mutex
+	props    map[string]interface{}
+	watchers []func(*Device)
+}
+
+// NewDevice returns the device with the object path path, with its
+// properties fetched. Its properties are kept current until Close.
+func NewDevice(conn *dbus.Connection, path string) (*Device, error) {
+	obj := conn.GetObject(DESTINATION, path)
+	iface := conn.Interface(obj, PROPERTIES_INTERFACE)
+	if iface == nil {
+		return nil, ErrNoObject
+	}
+
+	p := &Device{conn: conn, path: path, props: make(map[string]interface{})}
+	mr := &dbus.MatchRule{
+		Type:      "signal",
+		Sender:    DESTINATION,
+		Interface: PROPERTIES_INTERFACE,
+		Member:    "PropertiesChanged",
+		Path:      path,
+	}
+	var err error
+	if p.handler, err = conn.AddSignalHandler(mr, p._OnPropertiesChanged); err != nil {
+		return nil, err
+	}
+
+	ret, err := conn.CallMethod(iface, "GetAll", DEVICE_INTERFACE)
+	var props map[string]interface{}
+	if err == nil {
+		err = dbus.Store(ret, &props)
+	}
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	p.mutex.Lock()
+	for k, v := range props {
+		if _, ok := p.props[k]; !ok {
+			p.props[k] = v
+		}
+	}
+	p.mutex.Unlock()
+	return p, nil
+}
+
+func (p *Device) _OnPropertiesChanged(msg *dbus.Message) {
+	var iface string
+	var changed map[string]interface{}
+	var invalidated []string
+	if dbus.Store(msg.Params, &iface, &changed, &invalidated) != nil || iface != DEVICE_INTERFACE {
+		return
+	}
+
+	p.mutex.Lock()
+	for k, v := range changed {
+		p.props[k] = v
+	}
+	watchers := p.watchers
+	p.mutex.Unlock()
+
+	for _, watcher := range watchers {
+		watcher(p)
+	}
+}
+
+// Watch calls proc each time properties of the device changed.
+func (p *Device) Watch(proc func(*Device)) {
+	p.mutex.Lock()
+	p.watchers = append(p.watchers, proc)
+	p.mutex.Unlock()
+}
+
+// Close stops watching the properties of the device.
+func (p *Device) Close() error {
+	return p.conn.RemoveSignalHandler(p.handler)
+}
+
+// Path returns the object path of the device.
+func (p *Device) Path() string { return p.path }
+
+// Property returns the cached property name.
+func (p *Device) Property(name string) interface{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.props[name]
+}
+
+// Type returns the kind of the device.
+func (p *Device) Type() DeviceType {
+	t, _ := p.Property("Type").(uint32)
+	return DeviceType(t)
+}
+
+// State returns the charge state of the device.
+func (p *Device) State() State {
+	state, _ := p.Property("State").(uint32)
+	return State(state)
+}
+
+// Percentage returns the charge level in percent.
+func (p *Device) Percentage() float64 {
+	percentage, _ := p.Property("Percentage").(float64)
+	return percentage
+}
+
+// TimeToEmpty returns the estimated seconds until the device is empty, or
+// 0 if unknown.
+func (p *Device) TimeToEmpty() int64 {
+	seconds, _ := p.Property("TimeToEmpty").(int64)
+	return seconds
+}
+
+// TimeToFull returns the estimated seconds until the device is charged, or
+// 0 if unknown.
+func (p *Device) TimeToFull() int64 {
+	seconds, _ := p.Property("TimeToFull").(int64)
+	return seconds
+}
+
+// IsPresent reports whether a battery is present in its bay.
+func (p *Device) IsPresent() bool {
+	present, _ := p.Property("IsPresent").(bool)
+	return present
+}
@@ -0,0 +1,41 @@
+package upower
+
+import (
+	"testing"
+
+	"github.com/norisatir/go-dbus"
+)
+
+func TestPropertiesChanged(t *testing.T) {
+	p := &Device{props: map[string]interface{}{
+		"Type":       uint32(2),
+		"Percentage": 50.0,
+		"State":      uint32(2),
+	}}
+	watched := 0
+	p.Watch(func(*Device) { watched++ })
+
+	msg := dbus.NewMessage()
+	msg.Params = []interface{}{
+		DEVICE_INTERFACE,
+		[]interface{}{
+			[]interface{}{"Percentage", 51.5},
+			[]interface{}{"State", uint32(1)},
+		},
+		[]interface{}{},
+	}
+	p._OnPropertiesChanged(msg)
+
+	if p.Type() != TYPE_BATTERY || p.Percentage() != 51.5 || p.State() != STATE_CHARGING {
+		t.Error("#1 Failed:", p.props)
+	}
+	if watched != 1 {
+		t.Error("#2 Failed:", watched)
+	}
+
+	msg.Params[0] = PROPERTIES_INTERFACE
+	p._OnPropertiesChanged(msg)
+	if watched != 1 {
+		t.Error("#3 Failed: change of another interface applied")
+	}
+}
@@ -0,0 +1,177 @@
+package dbus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The longest bus, interface, member and error name the specification
+// allows.
+const MAX_NAME_LENGTH = 255
+
+var ErrMissingField = errors.New("MissingHeaderField")
+
+// NameError describes a name or object path which does not follow the
+// grammar of the specification. The bus disconnects peers sending such
+// names, so they are rejected before sending.
+type NameError struct {
+	Kind   string // "bus name", "interface name", ...
+	Name   string
+	Reason string
+}
+
+func (p *NameError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", p.Kind, p.Name, p.Reason)
+}
+
+func _IsNameChar(c byte, digit, hyphen bool) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' ||
+		digit && '0' <= c && c <= '9' || hyphen && c == '-'
+}
+
+// _ValidateDotted checks a name made of at least two elements separated by
+// dots. Elements may not start with a digit unless digitFirst is set, and
+// contain hyphens only if hyphen is set.
+func _ValidateDotted(kind, name string, digitFirst, hyphen bool) error {
+	if name == "" {
+		return &NameError{kind, name, "empty"}
+	}
+	if len(name) > MAX_NAME_LENGTH {
+		return &NameError{kind, name, "longer than 255 bytes"}
+	}
+	elements := strings.Split(name, ".")
+	if len(elements) < 2 {
+		return &NameError{kind, name, "fewer than two elements"}
+	}
+	for _, element := range elements {
+		if element == "" {
+			return &NameError{kind, name, "empty element"}
+		}
+		if !_IsNameChar(element[0], digitFirst, hyphen) {
+			return &NameError{kind, name, fmt.Sprintf("element %q starts with %q", element, element[0])}
+		}
+		for i := 1; i < len(element); i++ {
+			if !_IsNameChar(element[i], true, hyphen) {
+				return &NameError{kind, name, fmt.Sprintf("invalid character %q", element[i])}
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateBusName checks a unique connection name, like ":1.42", or a
+// well-known bus name, like "org.freedesktop.DBus".
+func ValidateBusName(name string) error {
+	if strings.HasPrefix(name, ":") {
+		return _ValidateDotted("bus name", name[1:], true, true)
+	}
+	return _ValidateDotted("bus name", name, false, true)
+}
+
+// ValidateInterfaceName checks an interface name, like
+// "org.freedesktop.DBus.Properties".
+func ValidateInterfaceName(name string) error {
+	return _ValidateDotted("interface name", name, false, false)
+}
+
+// ValidateErrorName checks an error name, which follows the rules of
+// interface names.
+func ValidateErrorName(name string) error {
+	return _ValidateDotted("error name", name, false, false)
+}
+
+// ValidateMemberName checks a method or signal name.
+func ValidateMemberName(name string) error {
+	if name == "" {
+		return &NameError{"member name", name, "empty"}
+	}
+	if len(name) > MAX_NAME_LENGTH {
+		return &NameError{"member name", name, "longer than 255 bytes"}
+	}
+	if !_IsNameChar(name[0], false, false) {
+		return &NameError{"member name", name, fmt.Sprintf("starts with %q", name[0])}
+	}
+	for i := 1; i < len(name); i++ {
+		if !_IsNameChar(name[i], true, false) {
+			return &NameError{"member name", name, fmt.Sprintf("invalid character %q", name[i])}
+		}
+	}
+	return nil
+}
+
+// ValidateObjectPath checks an object path, like "/org/freedesktop/DBus".
+func ValidateObjectPath(path string) error {
+	if path == "" || path[0] != '/' {
+		return &NameError{"object path", path, "does not start with '/'"}
+	}
+	if path == "/" {
+		return nil
+	}
+	// Scanned in place, as this runs for every object path received.
+	for rest := path[1:]; ; {
+		element := rest
+		end := strings.IndexByte(rest, '/')
+		if end >= 0 {
+			element = rest[:end]
+		}
+		if element == "" {
+			return &NameError{"object path", path, "empty element"}
+		}
+		for i := 0; i < len(element); i++ {
+			if !_IsNameChar(element[i], true, false) {
+				return &NameError{"object path", path, fmt.Sprintf("invalid character %q", element[i])}
+			}
+		}
+		if end < 0 {
+			return nil
+		}
+		rest = rest[end+1:]
+	}
+}
+
+// _Validate checks that the message has the header fields its type
+// requires, and that its names and path are valid.
+func (p *Message) _Validate() error {
+	switch p.Type {
+	case METHOD_CALL:
+		if p.Path == "" || p.Member == "" {
+			return ErrMissingField
+		}
+	case SIGNAL:
+		if p.Path == "" || p.Iface == "" || p.Member == "" {
+			return ErrMissingField
+		}
+	case ERROR:
+		if p.ErrorName == "" {
+			return ErrMissingField
+		}
+	}
+
+	if p.Path != "" {
+		if e := ValidateObjectPath(p.Path); e != nil {
+			return e
+		}
+	}
+	if p.Iface != "" {
+		if e := ValidateInterfaceName(p.Iface); e != nil {
+			return e
+		}
+	}
+	if p.Member != "" {
+		if e := ValidateMemberName(p.Member); e != nil {
+			return e
+		}
+	}
+	if p.ErrorName != "" {
+		if e := ValidateErrorName(p.ErrorName); e != nil {
+			return e
+		}
+	}
+	if p.Dest != "" {
+		if e := ValidateBusName(p.Dest); e != nil {
+			return e
+		}
+	}
+	return nil
+}
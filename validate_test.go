@@ -0,0 +1,74 @@
+package dbus
+
+import (
+	"testing"
+)
+
+func TestValidateNames(t *testing.T) {
+	valid := []struct {
+		validate func(string) error
+		name     string
+	}{
+		{ValidateBusName, ":1.42"},
+		{ValidateBusName, "org.freedesktop.DBus"},
+		{ValidateBusName, "org.example.foo-bar"},
+		{ValidateInterfaceName, "org.freedesktop.DBus.Properties"},
+		{ValidateInterfaceName, "_a.b_1"},
+		{ValidateErrorName, "org.freedesktop.DBus.Error.UnknownMethod"},
+		{ValidateMemberName, "GetAll"},
+		{ValidateObjectPath, "/"},
+		{ValidateObjectPath, "/org/freedesktop/DBus"},
+		{ValidateObjectPath, "/_1/a_b"},
+	}
+	for i, v := range valid {
+		if e := v.validate(v.name); e != nil {
+			t.Errorf("#%d Failed: %v", i+1, e)
+		}
+	}
+
+	invalid := []struct {
+		validate func(string) error
+		name     string
+	}{
+		{ValidateBusName, ""},
+		{ValidateBusName, "org"},
+		{ValidateBusName, "org.1example"},
+		{ValidateBusName, ":1..42"},
+		{ValidateInterfaceName, "org.example-foo.Bar"},
+		{ValidateInterfaceName, ".org.example"},
+		{ValidateInterfaceName, "org." + string(make([]byte, MAX_NAME_LENGTH))},
+		{ValidateErrorName, "Failed"},
+		{ValidateMemberName, ""},
+		{ValidateMemberName, "Get.All"},
+		{ValidateMemberName, "1Get"},
+		{ValidateObjectPath, ""},
+		{ValidateObjectPath, "org/example"},
+		{ValidateObjectPath, "/org/example/"},
+		{ValidateObjectPath, "/org//example"},
+		{ValidateObjectPath, "/org/example-foo"},
+	}
+	for i, v := range invalid {
+		e := v.validate(v.name)
+		if _, ok := e.(*NameError); !ok {
+			t.Errorf("#%d Failed: %q accepted (%v)", len(valid)+i+1, v.name, e)
+		}
+	}
+}
+
+func TestValidateMessage(t *testing.T) {
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Member = "Foo"
+	if e := msg._Validate(); e != ErrMissingField {
+		t.Error("#1 Failed:", e)
+	}
+	msg.Iface = "org.example.Iface"
+	if e := msg._Validate(); e != nil {
+		t.Error("#2 Failed:", e)
+	}
+	msg.Dest = "org..example"
+	if e, ok := msg._Validate().(*NameError); !ok || e.Kind != "bus name" {
+		t.Error("#3 Failed:", e)
+	}
+}
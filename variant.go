@@ -0,0 +1,78 @@
+package dbus
+
+import (
+	"errors"
+	"reflect"
+)
+
+var (
+	ErrVariantSignature = errors.New("InvalidVariantSignature")
+	ErrVariantNesting   = errors.New("VariantsNestedTooDeeply")
+)
+
+// MAX_VARIANT_NESTING is the depth to which received variants may contain
+// variants.
+const MAX_VARIANT_NESTING = 64
+
+// Variant is a value of the variant wire type, together with the signature
+// of the value. Variants in received messages decode to Variant, and a
+// Variant marshals with its own signature wherever the signature says "v",
+// which is the only way to send values whose signature can not be guessed
+// from their Go type. Values of other types are marshalled as variants
+// with the signature _GuessSignature picks for them.
+type Variant struct {
+	Sig   string
+	Value interface{}
+}
+
+var variantType = reflect.TypeOf(Variant{})
+
+// NewVariant returns a variant holding v, with the signature guessed from
+// the Go type of v.
+func NewVariant(v interface{}) Variant {
+	return Variant{_GuessSignature(v), v}
+}
+
+// _CheckVariantSignature checks that sig is a single complete type, as the
+// signature of a variant must be.
+func _CheckVariantSignature(sig string) error {
+	types, e := ParseSignature(sig)
+	if e != nil || len(types) != 1 {
+		return ErrVariantSignature
+	}
+	return nil
+}
+
+// _Unwrap replaces the variants in v by their values, also inside arrays,
+// structs and dict entries.
+func _Unwrap(v interface{}) interface{} {
+	switch val := v.(type) {
+	case Variant:
+		return _Unwrap(val.Value)
+	case []interface{}:
+		if !_HasVariants(val) {
+			return val
+		}
+		ret := make([]interface{}, len(val))
+		for i, elem := range val {
+			ret[i] = _Unwrap(elem)
+		}
+		return ret
+	}
+	return v
+}
+
+// _HasVariants reports whether v contains any variants.
+func _HasVariants(v interface{}) bool {
+	switch val := v.(type) {
+	case Variant:
+		return true
+	case []interface{}:
+		for _, elem := range val {
+			if _HasVariants(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
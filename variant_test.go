@@ -0,0 +1,72 @@
+package dbus
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestVariantRoundTrip(t *testing.T) {
+	values := []interface{}{
+		Variant{"o", "/org/example"},
+		Variant{"v", Variant{"as", []interface{}{"a", "b"}}},
+		Variant{"a{sv}", []interface{}{[]interface{}{"k", Variant{"u", uint32(7)}}}},
+		int32(3),
+	}
+	buff := bytes.NewBuffer([]byte{})
+	_AppendParamsData(buff, "vvvv", values)
+
+	slice, _, e := Parse(buff.Bytes(), "vvvv", 0)
+	if e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	values[0] = Variant{"o", ObjectPath("/org/example")}
+	values[3] = Variant{"i", int32(3)}
+	if !reflect.DeepEqual(slice, values) {
+		t.Error("#2 Failed:", slice)
+	}
+
+	for i, bad := range []Variant{{"", nil}, {"ss", "a"}, {"a", nil}} {
+		if _, e := _AppendValue(bytes.NewBuffer([]byte{}), "v", bad); e == nil {
+			t.Errorf("#3-%d Failed", i+1)
+		}
+	}
+	if _, _, e := Parse([]byte("\x02ss\x00"), "v", 0); e == nil {
+		t.Error("#4 Failed")
+	}
+}
+
+func TestStoreVariant(t *testing.T) {
+	src := []interface{}{
+		Variant{"v", Variant{"u", uint32(7)}},
+		[]interface{}{[]interface{}{"k", Variant{"as", []interface{}{"a"}}}},
+		Variant{"s", "x"},
+	}
+	var n int
+	var props map[string]interface{}
+	var v Variant
+	if e := Store(src, &n, &props, &v); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	if n != 7 || !reflect.DeepEqual(props, map[string]interface{}{"k": []interface{}{"a"}}) || v != (Variant{"s", "x"}) {
+		t.Error("#2 Failed:", n, props, v)
+	}
+
+	var variants map[string]Variant
+	if e := Store(src[1:2], &variants); e != nil || variants["k"].Sig != "as" {
+		t.Error("#3 Failed:", variants, e)
+	}
+	var raw interface{}
+	if e := Store(src[1:2], &raw); e != nil || !reflect.DeepEqual(raw, []interface{}{[]interface{}{"k", []interface{}{"a"}}}) {
+		t.Error("#4 Failed:", raw, e)
+	}
+	if !reflect.DeepEqual(src[1], []interface{}{[]interface{}{"k", Variant{"as", []interface{}{"a"}}}}) {
+		t.Error("#5 Failed: source modified")
+	}
+}
+
+func TestFormatVariant(t *testing.T) {
+	if s := FormatParams("v", []interface{}{Variant{"o", "/a"}}); s != "variant object_path /a\n" {
+		t.Errorf("#1 Failed: %q", s)
+	}
+}
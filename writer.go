@@ -0,0 +1,161 @@
+package dbus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+)
+
+var ErrWriteQueueFull = errors.New("WriteQueueFull")
+
+// QueuePolicy selects the behavior of senders when the write queue of a
+// Connection is full.
+type QueuePolicy int
+
+const (
+	QUEUE_BLOCK QueuePolicy = iota // wait until the writer catches up
+	QUEUE_ERROR                    // fail with ErrWriteQueueFull
+)
+
+const DEFAULT_WRITE_QUEUE_SIZE = 64
+
+type writeRequest struct {
+	header *bytes.Buffer
+	body   *messageBody
+	done   chan error
+}
+
+func (p *Connection) _StartWriter() {
+	size := p.WriteQueueSize
+	if size <= 0 {
+		size = DEFAULT_WRITE_QUEUE_SIZE
+	}
+	p.writeQueue = make(chan *writeRequest, size)
+	p._Go(p._MessageWriter)
+}
+
+// _MessageWriter writes queued messages to the socket, so that senders do
+// not have to wait for a slow peer.
+func (p *Connection) _MessageWriter() {
+	for {
+		select {
+		case req := <-p.writeQueue:
+			err := p._WriteParts(req.header, req.body)
+			if req.done != nil {
+				req.done <- err
+			}
+			if err != nil {
+				p._Fail(err)
+			}
+		case <-p.closed:
+			return
+		}
+	}
+}
+
+// _QueueMessage validates and marshals msg and hands it to the writer. If
+// done is not nil, the result of the write is sent to it.
+func (p *Connection) _QueueMessage(msg *Message, done chan error) error {
+	header, body, err := p._MarshalMessage(msg)
+	if err != nil {
+		return err
+	}
+	req := &writeRequest{header, body, done}
+
+	closed := p.Done()
+	if err := p._SendErr(); err != nil {
+		_PutBuffer(header)
+		body.Release()
+		return err
+	}
+	if p.WriteQueuePolicy == QUEUE_ERROR {
+		select {
+		case p.writeQueue <- req:
+		default:
+			_PutBuffer(header)
+			body.Release()
+			return ErrWriteQueueFull
+		}
+		return nil
+	}
+	select {
+	case p.writeQueue <- req:
+	case <-closed:
+		_PutBuffer(header)
+		body.Release()
+		return p._CallErr()
+	}
+	return nil
+}
+
+// _WriteMessage validates and marshals msg and writes it to the socket
+// directly.
+func (p *Connection) _WriteMessage(msg *Message) error {
+	header, body, err := p._MarshalMessage(msg)
+	if err != nil {
+		return err
+	}
+	return p._WriteParts(header, body)
+}
+
+// _MarshalMessage validates and marshals msg, in the ByteOrder of the
+// connection unless msg has its own.
+func (p *Connection) _MarshalMessage(msg *Message) (*bytes.Buffer, *messageBody, error) {
+	if err := msg._Validate(); err != nil {
+		return nil, nil, err
+	}
+	if msg.Order == nil {
+		msg.Order = p.ByteOrder
+	}
+	header, body, err := msg._MarshalParts()
+	if err == nil && len(body.fds) != 0 && !p.SupportsUnixFDs() {
+		_PutBuffer(header)
+		body.Release()
+		return nil, nil, ErrUnixFDsUnsupported
+	}
+	return header, body, err
+}
+
+// _WriteParts writes the header and the body of a message with a single
+// vectored write and releases their buffers.
+func (p *Connection) _WriteParts(header *bytes.Buffer, body *messageBody) error {
+	buffs := append(net.Buffers{header.Bytes()}, body.segments...)
+	var err error
+	if len(body.fds) != 0 {
+		err = _WriteWithFDs(p.conn.(*net.UnixConn), buffs, body.fds)
+	} else {
+		err = _WriteFull(p.conn, buffs)
+	}
+	if err == nil {
+		p.stats._CountSent(header.Bytes()[1], header.Len()+body.length)
+	}
+	_PutBuffer(header)
+	body.Release()
+	return err
+}
+
+// _WriteFull writes all of buffs to w. Unix and TCP sockets write them with
+// writev, which retries short writes itself. Other connections are written
+// one buffer at a time, retrying short writes, since net.Buffers would go on
+// with the next buffer after one and corrupt the stream.
+func _WriteFull(w io.Writer, buffs net.Buffers) error {
+	switch w.(type) {
+	case *net.UnixConn, *net.TCPConn:
+		_, err := buffs.WriteTo(w)
+		return err
+	}
+	for _, b := range buffs {
+		for len(b) > 0 {
+			n, err := w.Write(b)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return io.ErrShortWrite
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
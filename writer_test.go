@@ -0,0 +1,93 @@
+package dbus
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestQueuePolicy(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	con := new(Connection)
+	con.conn = client
+	con.WriteQueueSize = 1
+	con.WriteQueuePolicy = QUEUE_ERROR
+	con._StartWriter()
+
+	msg := NewMessage()
+	msg.Type = SIGNAL
+	msg.Path = "/org/example"
+	msg.Iface = "org.example.Iface"
+	msg.Member = "Foo"
+
+	// Nobody reads the other end, so the writer blocks on the first
+	// message and the second one fills the queue.
+	if e := con._QueueMessage(msg, nil); e != nil {
+		t.Fatal("#1 Failed:", e)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(con.writeQueue) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if e := con._QueueMessage(msg, nil); e != nil {
+		t.Fatal("#2 Failed:", e)
+	}
+	if e := con._QueueMessage(msg, nil); e != ErrWriteQueueFull {
+		t.Fatal("#3 Failed:", e)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < 3; i++ {
+			_ReadMessage(server)
+		}
+	}()
+	con.WriteQueuePolicy = QUEUE_BLOCK
+	if e := con._QueueMessage(msg, done); e != nil {
+		t.Fatal("#4 Failed:", e)
+	}
+	select {
+	case e := <-done:
+		if e != nil {
+			t.Error("#5 Failed:", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("#5 Failed: not written")
+	}
+}
+
+// shortWriter writes at most max bytes per call without reporting an error,
+// like a misbehaving connection.
+type shortWriter struct {
+	bytes.Buffer
+	max int
+}
+
+func (p *shortWriter) Write(b []byte) (int, error) {
+	if len(b) > p.max {
+		b = b[:p.max]
+	}
+	return p.Buffer.Write(b)
+}
+
+type stuckWriter struct{}
+
+func (stuckWriter) Write(b []byte) (int, error) { return 0, nil }
+
+func TestWriteFull(t *testing.T) {
+	w := &shortWriter{max: 3}
+	buffs := net.Buffers{[]byte("header"), []byte("body"), []byte("tail")}
+	if e := _WriteFull(w, buffs); e != nil {
+		t.Error("#1 Failed:", e)
+	}
+	if w.String() != "headerbodytail" {
+		t.Error("#2 Failed:", w.String())
+	}
+
+	if e := _WriteFull(stuckWriter{}, buffs); e != io.ErrShortWrite {
+		t.Error("#3 Failed:", e)
+	}
+}